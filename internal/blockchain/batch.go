@@ -0,0 +1,209 @@
+package blockchain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const batchMaxRetries = 3 // 批量请求里失败条目最多重试3轮
+
+var batchRetryDelay = time.Second // 第n轮重试前等待 n*batchRetryDelay
+
+// 区块头（只取我们需要的字段，交易只返回哈希）
+// zksync的区块哈希不是按以太坊RLP规则算的，所以直接用节点返回的hash字段
+type BlockHeader struct {
+	Number       hexutil.Uint64 `json:"number"`
+	Hash         common.Hash    `json:"hash"`
+	ParentHash   common.Hash    `json:"parentHash"`
+	Timestamp    hexutil.Uint64 `json:"timestamp"`
+	Transactions []common.Hash  `json:"transactions"`
+}
+
+/*
+批量发送JSON-RPC请求，按rpc_batch_size切分。
+某一批整体失败或者单条返回错误/空结果(missing判断)，下一轮只重试这些失败的条目；
+合约revert之类的确定性错误重试也一样，留在elems[i].Error里不重试，也不算进返回的错误。
+elems里的Result指针由调用方提供，成功后结果直接写进去。
+*/
+func BatchCallWithRetry(elems []rpc.BatchElem, missing func(i int) bool) error {
+	pending := make([]int, len(elems))
+	for i := range elems {
+		pending[i] = i
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < batchMaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * batchRetryDelay) // 每轮重试间隔1秒，2秒
+		}
+
+		var failed []int
+		for begin := 0; begin < len(pending); begin += Client.batchSize {
+			end := begin + Client.batchSize
+			if end > len(pending) {
+				end = len(pending)
+			}
+			chunk := pending[begin:end]
+
+			batch := make([]rpc.BatchElem, len(chunk))
+			for j, i := range chunk {
+				batch[j] = rpc.BatchElem{Method: elems[i].Method, Args: elems[i].Args, Result: elems[i].Result}
+			}
+			if err := Client.BatchCall(batch); err != nil {
+				lastErr = err
+				failed = append(failed, chunk...)
+				continue
+			}
+			for j, i := range chunk {
+				elems[i].Error = batch[j].Error
+				if batch[j].Error != nil {
+					if !IsDeterministicError(batch[j].Error) {
+						lastErr = batch[j].Error
+						failed = append(failed, i)
+					}
+				} else if missing != nil && missing(i) {
+					lastErr = fmt.Errorf("%s 返回空结果", elems[i].Method)
+					failed = append(failed, i)
+				}
+			}
+		}
+
+		if len(failed) == 0 {
+			return nil
+		}
+		pending = failed
+	}
+	return fmt.Errorf("批量请求失败 %d/%d 条: %v", len(pending), len(elems), lastErr)
+}
+
+// 批量获取区块头 [from, to]，按区块号顺序返回
+func GetBlockHeaders(from, to uint64) ([]*BlockHeader, error) {
+	if to < from {
+		return nil, nil
+	}
+	numbers := make([]uint64, to-from+1)
+	for i := range numbers {
+		numbers[i] = from + uint64(i)
+	}
+	headers, err := GetBlockHeadersAt(numbers)
+	if err != nil {
+		return nil, fmt.Errorf("批量获取区块头失败 %d-%d: %v", from, to, err)
+	}
+	return headers, nil
+}
+
+// 批量获取指定区块的区块头，按传入的区块号顺序返回
+func GetBlockHeadersAt(numbers []uint64) ([]*BlockHeader, error) {
+	headers := make([]*BlockHeader, len(numbers))
+	elems := make([]rpc.BatchElem, len(numbers))
+	for i, number := range numbers {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_getBlockByNumber",
+			Args:   []interface{}{hexutil.EncodeUint64(number), false}, // false = 只返回交易哈希
+			Result: &headers[i],
+		}
+	}
+	if err := BatchCallWithRetry(elems, func(i int) bool { return headers[i] == nil }); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// 批量获取交易回执，按传入的交易哈希顺序返回
+func GetReceiptsByHashes(txHashes []common.Hash) ([]*types.Receipt, error) {
+	receipts := make([]*types.Receipt, len(txHashes))
+	elems := make([]rpc.BatchElem, len(txHashes))
+	for i, txHash := range txHashes {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{txHash},
+			Result: &receipts[i],
+		}
+	}
+	// 节点还没同步到的回执会返回null，当作失败重试
+	err := BatchCallWithRetry(elems, func(i int) bool { return receipts[i] == nil })
+	if err != nil {
+		return nil, fmt.Errorf("批量获取交易回执失败: %v", err)
+	}
+	return receipts, nil
+}
+
+/*
+获取一段区块 [from, to] 的所有交易回执
+先批量拿区块头里的交易哈希，再把整段的交易哈希合在一起批量拿回执，
+返回 区块号 -> 该区块的交易回执（与GetBlockReceipts结构一致）
+*/
+func GetBlockRangeReceipts(from, to uint64) (map[uint64][]*types.Receipt, error) {
+	headers, err := GetBlockHeaders(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return GetReceiptsForHeaders(headers)
+}
+
+// 已经拿到区块头时直接按区块头里的交易哈希批量拿回执
+func GetReceiptsForHeaders(headers []*BlockHeader) (map[uint64][]*types.Receipt, error) {
+	var txHashes []common.Hash
+	for _, header := range headers {
+		txHashes = append(txHashes, header.Transactions...)
+	}
+	receipts, err := GetReceiptsByHashes(txHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint64][]*types.Receipt, len(headers))
+	offset := 0
+	for _, header := range headers {
+		n := len(header.Transactions)
+		result[uint64(header.Number)] = receipts[offset : offset+n]
+		offset += n
+	}
+	return result, nil
+}
+
+// 一次只读合约调用
+type ContractCall struct {
+	To   common.Address
+	Data []byte
+}
+
+/*
+在指定区块上批量 eth_call
+每条调用单独返回结果和错误，合约revert等失败的条目不影响其他条目；
+返回的error不为nil表示有条目重试之后还是因为节点/网络失败，这些条目的结果不能当成合约的真实返回
+*/
+func BatchCallContracts(calls []ContractCall, block uint64) ([]hexutil.Bytes, []error, error) {
+	results := make([]hexutil.Bytes, len(calls))
+	elems := make([]rpc.BatchElem, len(calls))
+	for i, call := range calls {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{"to": call.To, "data": hexutil.Bytes(call.Data)},
+				hexutil.EncodeUint64(block),
+			},
+			Result: &results[i],
+		}
+	}
+	// 没拿到结果的重试；拿到了但是空的(调用的地址不是合约)和revert一样是确定性的
+	err := BatchCallWithRetry(elems, func(i int) bool { return results[i] == nil })
+
+	errs := make([]error, len(calls))
+	for i := range elems {
+		if elems[i].Error != nil {
+			errs[i] = elems[i].Error
+		} else if len(results[i]) == 0 {
+			errs[i] = fmt.Errorf("调用合约%s返回空结果", calls[i].To.Hex())
+		}
+	}
+	if err != nil {
+		return results, errs, fmt.Errorf("批量调用合约失败: %v", err)
+	}
+	return results, errs, nil
+}
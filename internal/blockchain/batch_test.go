@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// 测试期间把全局客户端换成指向假节点的客户端，重试不等待
+func useTestClient(t *testing.T, batchSize int, nodes ...*fakeNode) {
+	t.Helper()
+	m := newTestMultiClient(t, nodes...)
+	m.batchSize = batchSize
+	oldClient, oldDelay := Client, batchRetryDelay
+	Client, batchRetryDelay = m, 0
+	t.Cleanup(func() { Client, batchRetryDelay = oldClient, oldDelay })
+}
+
+func testReceipt(txHash string) map[string]interface{} {
+	return map[string]interface{}{
+		"transactionHash":   txHash,
+		"status":            "0x1",
+		"cumulativeGasUsed": "0x1",
+		"gasUsed":           "0x1",
+		"logsBloom":         hexutil.Encode(make([]byte, 256)),
+		"logs":              []interface{}{},
+	}
+}
+
+func TestReceiptsRetryPartialBatchFailures(t *testing.T) {
+	hashes := make([]common.Hash, 6)
+	for i := range hashes {
+		hashes[i] = common.BigToHash(big.NewInt(int64(i + 1)))
+	}
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	node := newFakeNode(t, func(req rpcRequest) map[string]interface{} {
+		var txHash string
+		json.Unmarshal(req.Params[0], &txHash)
+		mu.Lock()
+		attempts[txHash]++
+		first := attempts[txHash] == 1
+		mu.Unlock()
+		if first {
+			switch txHash {
+			case hashes[0].Hex(): // 单条返回节点错误
+				return map[string]interface{}{"error": map[string]interface{}{"code": -32000, "message": "header not found"}}
+			case hashes[1].Hex(): // 批量响应里漏掉这一条
+				return nil
+			case hashes[2].Hex(): // 响应的id对不上
+				return map[string]interface{}{"id": 9999, "result": testReceipt(txHash)}
+			case hashes[3].Hex(): // 节点还没同步到，返回null
+				return map[string]interface{}{"result": nil}
+			}
+		}
+		return map[string]interface{}{"result": testReceipt(txHash)}
+	})
+	node.failNext = 1 // 第一批整批失败
+	useTestClient(t, 2, node)
+
+	receipts, err := GetReceiptsByHashes(hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, receipt := range receipts {
+		if receipt == nil || receipt.TxHash != hashes[i] {
+			t.Fatalf("receipt %d = %+v, want tx %s", i, receipt, hashes[i].Hex())
+		}
+	}
+	// 成功的条目不重复请求
+	if n := attempts[hashes[5].Hex()]; n != 1 {
+		t.Fatalf("successful receipt requested %d times, want 1", n)
+	}
+}
+
+func TestBatchGivesUpAfterMaxRetries(t *testing.T) {
+	node := newFakeNode(t, func(req rpcRequest) map[string]interface{} {
+		return nil // 永远缺这一条
+	})
+	useTestClient(t, 10, node)
+
+	_, err := GetReceiptsByHashes([]common.Hash{{1}})
+	if err == nil {
+		t.Fatal("missing responses did not fail the batch")
+	}
+	if node.calls != batchMaxRetries {
+		t.Fatalf("requests = %d, want %d", node.calls, batchMaxRetries)
+	}
+}
+
+func TestBatchCallContractsKeepsDeterministicErrors(t *testing.T) {
+	node := newFakeNode(t, func(req rpcRequest) map[string]interface{} {
+		var call struct {
+			To common.Address `json:"to"`
+		}
+		json.Unmarshal(req.Params[0], &call)
+		if call.To == (common.Address{1}) {
+			return map[string]interface{}{"error": map[string]interface{}{"code": 3, "message": "execution reverted"}}
+		}
+		return map[string]interface{}{"result": "0x01"}
+	})
+	useTestClient(t, 10, node)
+
+	results, errs, err := BatchCallContracts([]ContractCall{{To: common.Address{1}}, {To: common.Address{2}}}, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] == nil || errs[1] != nil || results[1].String() != "0x01" {
+		t.Fatalf("errs = %v, results = %v", errs, results)
+	}
+	// revert不重试
+	if node.calls != 1 {
+		t.Fatalf("requests = %d, want 1", node.calls)
+	}
+}
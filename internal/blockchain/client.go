@@ -4,44 +4,40 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 	"zk-sync-go-pool/internal/config"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-var Client *ethclient.Client // 全局区块链客户端 最终获得类似于https://zksync-mainnet.core.chainstack.com/a65bb3406867941f5537427dc0e05896 的RPC地址
+var Client *MultiClient // 全局区块链客户端 rpc_url + rpc_backups 多节点自动故障切换
 
 func InitClient(cfg *config.BlockchainConfig) error {
-	// 链接主RPC
-	client, err := ethclient.Dial(cfg.RPCURL)
+	// 连接主RPC和所有备用RPC，逐个校验chainID
+	client, err := NewMultiClient(cfg)
 	if err != nil {
 		return fmt.Errorf("创建区块链客户端失败: %v", err)
 	}
 
-	// 测试连接 - 获取chainID
-	ctx := context.Background()         // 创建一个上下文,用于取消请求
-	chainID, err := client.ChainID(ctx) // 内部可取消的请求
-	if err != nil {
-		return fmt.Errorf("获取chainID失败: %v", err)
-	}
-
-	// 验证chainID是否正确
-	if chainID.Uint64() != uint64(cfg.ChainID) {
-		return fmt.Errorf("链ID不正确: %d != %d", chainID.Uint64(), uint64(cfg.ChainID))
-	}
-
 	Client = client
-	fmt.Printf("区块链客户端初始化成功: %s\n", cfg.RPCURL)
+	// chainID不一致、创建不了客户端的节点已经剔除，按实际保留的节点打印
+	urls, verified := client.Endpoints()
+	fmt.Printf("区块链客户端初始化成功: %s (共 %d 个节点，chainID校验通过 %d 个)\n", strings.Join(urls, ", "), len(urls), verified)
 	return nil
 }
 
 // 获取最新区块
 func GetLatestBlockNumber() (uint64, error) {
-	ctx := context.Background()                 // 创建一个上下文,用于取消请求
-	blockNumber, err := Client.BlockNumber(ctx) // 获取当然节点的最新区块号
+	var blockNumber uint64
+	err := Client.Call(func(ctx context.Context, ec *ethclient.Client) error {
+		var err error
+		blockNumber, err = ec.BlockNumber(ctx) // 获取当然节点的最新区块号
+		return err
+	})
 	if err != nil {
 		return 0, fmt.Errorf("获取最新区块失败: %v", err)
 	}
@@ -50,8 +46,12 @@ func GetLatestBlockNumber() (uint64, error) {
 
 // 获取指定区块的详细信息
 func GetBlockByNumber(blockNumber uint64) (*types.Block, error) {
-	ctx := context.Background()                                             // 创建一个上下文,用于取消请求
-	block, err := Client.BlockByNumber(ctx, big.NewInt(int64(blockNumber))) // 获取指定区块的详细信息,返回一个Block结构体
+	var block *types.Block
+	err := Client.Call(func(ctx context.Context, ec *ethclient.Client) error {
+		var err error
+		block, err = ec.BlockByNumber(ctx, big.NewInt(int64(blockNumber))) // 获取指定区块的详细信息,返回一个Block结构体
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("获取指定区块失败: %v", err)
 	}
@@ -60,8 +60,12 @@ func GetBlockByNumber(blockNumber uint64) (*types.Block, error) {
 
 // 获取指定区块的时间戳
 func GetBlockTimestamp(blockNumber uint64) (int64, error) {
-	ctx := context.Background()                                               // 创建一个上下文,用于取消请求
-	header, err := Client.HeaderByNumber(ctx, big.NewInt(int64(blockNumber))) // 获取指定区块头部信息,返回一个Header结构体
+	var header *types.Header
+	err := Client.Call(func(ctx context.Context, ec *ethclient.Client) error {
+		var err error
+		header, err = ec.HeaderByNumber(ctx, big.NewInt(int64(blockNumber))) // 获取指定区块头部信息,返回一个Header结构体
+		return err
+	})
 	if err != nil {
 		return 0, fmt.Errorf("获取指定区块头部信息失败: %v", err)
 	}
@@ -117,40 +121,14 @@ func GetBlockReceipts(blockNumber uint64) ([]*types.Receipt, error) {
 
 /*
 获取指定区块的所有交易回执 兼容性写法
+区块头拿交易哈希，再用JSON-RPC批量请求一次性拿全部回执，失败的条目单独重试
 */
 func getBlockReceiptsOnce(blockNumber uint64) ([]*types.Receipt, error) {
-	ctx := context.Background() // 创建一个上下文,用于取消请求
-	// Step 1: 获取区块信息（只获取交易哈希，不解析交易体）
-	type BlockWithTxHashes struct {
-		Transactions []common.Hash `json:"transactions"`
-	}
-
-	var block BlockWithTxHashes
-	err := Client.Client().CallContext(ctx, &block, "eth_getBlockByNumber",
-		fmt.Sprintf("0x%x", blockNumber), false) // false = 只返回交易哈希
+	receipts, err := GetBlockRangeReceipts(blockNumber, blockNumber)
 	if err != nil {
-		return nil, fmt.Errorf("获取区块信息失败: %v", err)
-	}
-
-	// Step 2: 逐个获取交易回执 加上重试机制
-	var receipts []*types.Receipt
-	for _, txHash := range block.Transactions {
-		var receipt *types.Receipt
-		var err error
-		for retry := 0; retry < 3; retry++ {
-			receipt, err = Client.TransactionReceipt(ctx, txHash)
-			if err == nil {
-				break
-			}
-			time.Sleep(time.Duration(retry+1) * time.Second)
-		}
-		if err != nil {
-			return nil, fmt.Errorf("获取交易回执失败 %s: %w", txHash.Hex(), err)
-		}
-		receipts = append(receipts, receipt)
+		return nil, err
 	}
-
-	return receipts, nil
+	return receipts[blockNumber], nil
 }
 
 /*
@@ -158,11 +136,10 @@ func getBlockReceiptsOnce(blockNumber uint64) ([]*types.Receipt, error) {
 */
 
 func GetSafeBlockNumber() (uint64, error) {
-	ctx := context.Background() // 创建一个上下文,用于取消请求
 	var block struct {
 		Number string `json:"number"`
 	}
-	err := Client.Client().CallContext(ctx, &block, "eth_getBlockByNumber", "safe", false)
+	err := Client.CallContext(&block, "eth_getBlockByNumber", "safe", false)
 	if err != nil {
 		return 0, fmt.Errorf("获取safe头高度失败: %v", err)
 	}
@@ -174,3 +151,36 @@ func GetSafeBlockNumber() (uint64, error) {
 
 	return n.Uint64(), nil
 }
+
+/*
+eth_getLogs 按过滤条件获取日志
+*/
+func GetLogs(query ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := Client.Call(func(ctx context.Context, ec *ethclient.Client) error {
+		var err error
+		logs, err = ec.FilterLogs(ctx, query)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取日志失败: %w", err)
+	}
+	return logs, nil
+}
+
+/*
+eth_call 调用合约只读方法，返回原始返回值
+合约revert属于确定性错误，不会切换节点重试
+*/
+func CallContract(to common.Address, data []byte) ([]byte, error) {
+	var result []byte
+	err := Client.Call(func(ctx context.Context, ec *ethclient.Client) error {
+		var err error
+		result, err = ec.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("调用合约%s失败: %w", to.Hex(), err)
+	}
+	return result, nil
+}
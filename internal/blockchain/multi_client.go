@@ -0,0 +1,395 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"zk-sync-go-pool/internal/config"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+/*
+多节点RPC客户端
+rpc_url + rpc_backups 全部接入，后台定时健康检查，请求优先路由到最健康的节点，
+出错/超时自动切换到下一个节点。每个节点单独一个熔断器：连续失败达到阈值后熔断一段时间，
+冷却结束后放行一次试探请求（半开），成功则恢复，失败则继续熔断。
+*/
+
+const (
+	defaultRequestTimeout      = 10 // 单次请求超时(秒)
+	defaultHealthCheckInterval = 15 // 健康检查间隔(秒)
+	defaultFailureThreshold    = 3  // 连续失败3次熔断
+	defaultCircuitCooldown     = 30 // 熔断冷却(秒)
+	defaultRPCBatchSize        = 50 // JSON-RPC批量请求每批最多条数
+	maxHeadLag                 = 10 // 落后最高节点超过10个区块视为不健康
+)
+
+// 单个RPC节点
+type endpoint struct {
+	url string
+	eth *ethclient.Client
+
+	mu        sync.Mutex
+	verified  bool          // chainID是否已校验通过
+	healthy   bool          // 最近一次健康检查结果
+	latency   time.Duration // 最近一次健康检查耗时
+	head      uint64        // 最近一次健康检查拿到的最新区块
+	failures  int           // 连续失败次数
+	openUntil time.Time     // 熔断截止时间，零值表示未熔断
+}
+
+type MultiClient struct {
+	chainID          uint64
+	endpoints        []*endpoint
+	timeout          time.Duration
+	interval         time.Duration
+	failureThreshold int
+	cooldown         time.Duration
+	batchSize        int
+	stop             chan struct{}
+}
+
+// 创建多节点客户端，逐个校验chainID；chainID不一致的节点直接剔除，暂时连不上的节点留给健康检查再校验
+func NewMultiClient(cfg *config.BlockchainConfig) (*MultiClient, error) {
+	m := &MultiClient{
+		chainID:          uint64(cfg.ChainID),
+		timeout:          time.Duration(orDefault(cfg.RequestTimeout, defaultRequestTimeout)) * time.Second,
+		interval:         time.Duration(orDefault(cfg.HealthCheckInterval, defaultHealthCheckInterval)) * time.Second,
+		failureThreshold: orDefault(cfg.FailureThreshold, defaultFailureThreshold),
+		cooldown:         time.Duration(orDefault(cfg.CircuitCooldown, defaultCircuitCooldown)) * time.Second,
+		batchSize:        orDefault(cfg.RPCBatchSize, defaultRPCBatchSize),
+		stop:             make(chan struct{}),
+	}
+
+	verified := 0
+	for _, url := range rpcURLs(cfg) {
+		client, err := ethclient.Dial(url)
+		if err != nil {
+			fmt.Printf("⚠️ 创建RPC客户端失败 %s: %v\n", url, err)
+			continue
+		}
+		ep := &endpoint{url: url, eth: client}
+
+		err = m.verifyChainID(ep)
+		var mismatch *chainIDMismatchError
+		if errors.As(err, &mismatch) {
+			fmt.Printf("⚠️ 剔除RPC节点 %s: %v\n", url, err)
+			client.Close()
+			continue
+		}
+		if err != nil {
+			fmt.Printf("⚠️ RPC节点暂不可用 %s: %v，等待健康检查重试\n", url, err)
+		} else {
+			verified++
+		}
+		m.endpoints = append(m.endpoints, ep)
+	}
+
+	if verified == 0 {
+		m.Close()
+		return nil, fmt.Errorf("没有可用的RPC节点(chainID=%d)", m.chainID)
+	}
+
+	go m.healthLoop()
+	return m, nil
+}
+
+// 保留下来的节点地址(按配置顺序)和其中chainID已校验通过的个数
+func (m *MultiClient) Endpoints() (urls []string, verified int) {
+	for _, ep := range m.endpoints {
+		urls = append(urls, ep.url)
+		ep.mu.Lock()
+		if ep.verified {
+			verified++
+		}
+		ep.mu.Unlock()
+	}
+	return urls, verified
+}
+
+// 关闭所有节点连接和健康检查
+func (m *MultiClient) Close() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	for _, ep := range m.endpoints {
+		ep.eth.Close()
+	}
+}
+
+/*
+按健康度依次尝试各个节点，直到有一个成功。
+fn 拿到的ctx已经带了单次请求超时。合约revert这类确定性错误换节点也没用，直接返回。
+*/
+func (m *MultiClient) Call(fn func(ctx context.Context, ec *ethclient.Client) error) error {
+	candidates := m.candidates()
+	if len(candidates) == 0 {
+		return fmt.Errorf("没有可用的RPC节点")
+	}
+
+	var lastErr error
+	for _, ep := range candidates {
+		ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+		err := fn(ctx, ep.eth)
+		cancel()
+		if err == nil {
+			m.markSuccess(ep)
+			return nil
+		}
+		if IsDeterministicError(err) || IsTooManyResultsError(err) {
+			m.markSuccess(ep) // 节点能正常响应，不算节点故障
+			return err
+		}
+		m.markFailure(ep, err)
+		lastErr = fmt.Errorf("%s: %w", ep.url, err)
+	}
+	return lastErr
+}
+
+// 对应rpc.Client的CallContext，自动故障切换
+func (m *MultiClient) CallContext(result interface{}, method string, args ...interface{}) error {
+	return m.Call(func(ctx context.Context, ec *ethclient.Client) error {
+		return ec.Client().CallContext(ctx, result, method, args...)
+	})
+}
+
+// 对应rpc.Client的BatchCallContext，整批传输失败才切换节点，单条错误写在elems[i].Error里
+func (m *MultiClient) BatchCall(elems []rpc.BatchElem) error {
+	return m.Call(func(ctx context.Context, ec *ethclient.Client) error {
+		return ec.Client().BatchCallContext(ctx, elems)
+	})
+}
+
+/*
+返回本次请求的节点顺序：
+1. 未熔断(或冷却结束可半开试探)的节点排前面，熔断中的兜底放最后
+2. 健康的排前面，区块落后太多的视为不健康
+3. 同等条件下延迟低的优先
+*/
+func (m *MultiClient) candidates() []*endpoint {
+	now := time.Now()
+	var maxHead uint64
+	for _, ep := range m.endpoints {
+		ep.mu.Lock()
+		if ep.head > maxHead {
+			maxHead = ep.head
+		}
+		ep.mu.Unlock()
+	}
+
+	type ranked struct {
+		ep      *endpoint
+		open    bool
+		healthy bool
+		latency time.Duration
+	}
+	var list []ranked
+	for _, ep := range m.endpoints {
+		ep.mu.Lock()
+		if !ep.verified {
+			ep.mu.Unlock()
+			continue // chainID没校验过的节点不接流量
+		}
+		r := ranked{
+			ep:      ep,
+			open:    now.Before(ep.openUntil),
+			healthy: ep.healthy && ep.head+maxHeadLag >= maxHead,
+			latency: ep.latency,
+		}
+		ep.mu.Unlock()
+		list = append(list, r)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].open != list[j].open {
+			return !list[i].open
+		}
+		if list[i].healthy != list[j].healthy {
+			return list[i].healthy
+		}
+		return list[i].latency < list[j].latency
+	})
+
+	eps := make([]*endpoint, 0, len(list))
+	for _, r := range list {
+		eps = append(eps, r.ep)
+	}
+	return eps
+}
+
+func (m *MultiClient) markSuccess(ep *endpoint) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.failures = 0
+	ep.openUntil = time.Time{}
+}
+
+func (m *MultiClient) markFailure(ep *endpoint, err error) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	ep.failures++
+	ep.healthy = false
+	if ep.failures >= m.failureThreshold {
+		ep.openUntil = time.Now().Add(m.cooldown)
+		fmt.Printf("⚠️ RPC节点熔断 %s %v: 连续失败%d次: %v\n", ep.url, m.cooldown, ep.failures, err)
+	}
+}
+
+// 健康检查协程
+func (m *MultiClient) healthLoop() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	m.checkAll()
+	for {
+		select {
+		case <-ticker.C:
+			m.checkAll()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// 并发检查所有节点
+func (m *MultiClient) checkAll() {
+	var wg sync.WaitGroup
+	for _, ep := range m.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			m.check(ep)
+		}(ep)
+	}
+	wg.Wait()
+}
+
+func (m *MultiClient) check(ep *endpoint) {
+	ep.mu.Lock()
+	verified := ep.verified
+	ep.mu.Unlock()
+	if !verified {
+		if err := m.verifyChainID(ep); err != nil {
+			return
+		}
+		fmt.Printf("RPC节点恢复可用: %s\n", ep.url)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	begin := time.Now()
+	head, err := ep.eth.BlockNumber(ctx)
+	if err != nil {
+		m.markFailure(ep, err)
+		return
+	}
+
+	// 熔断冷却没结束时只更新健康信息，不提前恢复；冷却结束后(半开)试探成功才关闭熔断
+	ep.mu.Lock()
+	ep.healthy = true
+	ep.head = head
+	ep.latency = time.Since(begin)
+	if !time.Now().Before(ep.openUntil) {
+		ep.failures = 0
+		ep.openUntil = time.Time{}
+	}
+	ep.mu.Unlock()
+}
+
+type chainIDMismatchError struct {
+	got, want uint64
+}
+
+func (e *chainIDMismatchError) Error() string {
+	return fmt.Sprintf("链ID不正确: %d != %d", e.got, e.want)
+}
+
+// 校验节点chainID
+func (m *MultiClient) verifyChainID(ep *endpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	chainID, err := ep.eth.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("获取chainID失败: %v", err)
+	}
+	if chainID.Uint64() != m.chainID {
+		return &chainIDMismatchError{got: chainID.Uint64(), want: m.chainID}
+	}
+	ep.mu.Lock()
+	ep.verified = true
+	ep.mu.Unlock()
+	return nil
+}
+
+/*
+确定性错误：节点正常返回了JSON-RPC错误，换节点结果也一样（例如合约revert）。
+*/
+func IsDeterministicError(err error) bool {
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	if rpcErr.ErrorCode() == 3 { // execution reverted
+		return true
+	}
+	return strings.Contains(strings.ToLower(rpcErr.Error()), "revert")
+}
+
+/*
+eth_getLogs 结果太多/区块范围太大，需要调用方缩小范围重试
+只认各家节点的原始报错，限流("rate limit"、"limit exceeded")之类的临时错误不算，不能当成缩小范围的信号。
+不算确定性错误(调用方据此把请求当成永久失败)，Call 里原样返回交给调用方拆分
+*/
+func IsTooManyResultsError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "rate limit") {
+		return false
+	}
+	for _, keyword := range tooManyResultsMessages {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+var tooManyResultsMessages = []string{
+	"query returned more than",    // geth、Infura、zkSync: query returned more than 10000 results
+	"log response size exceeded",  // Alchemy
+	"exceed maximum block range",  // geth 配置了区块范围上限
+	"eth_getlogs is limited to a", // QuickNode: eth_getLogs is limited to a 10,000 range
+	"block range is too wide",
+	"block range too large",
+}
+
+// 主RPC + 备用RPC 去重
+func rpcURLs(cfg *config.BlockchainConfig) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, url := range append([]string{cfg.RPCURL}, cfg.RPCBackups...) {
+		url = strings.TrimSpace(url)
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		urls = append(urls, url)
+	}
+	return urls
+}
+
+func orDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,249 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+	"zk-sync-go-pool/internal/config"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+type testRPCError struct {
+	code int
+	msg  string
+}
+
+func (e *testRPCError) Error() string  { return e.msg }
+func (e *testRPCError) ErrorCode() int { return e.code }
+
+func TestIsTooManyResultsError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&testRPCError{-32005, "query returned more than 10000 results"}, true},
+		{&testRPCError{-32602, "Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range"}, true},
+		{&testRPCError{-32000, "exceed maximum block range: 5000"}, true},
+		{fmt.Errorf("https://rpc: %w", &testRPCError{-32614, "eth_getLogs is limited to a 10,000 range"}), true},
+		{&testRPCError{-32005, "limit exceeded"}, false},
+		{&testRPCError{-32005, "daily request count exceeded, request rate limited"}, false},
+		{&testRPCError{-32000, "requested block range is beyond head block, rate limit exceeded"}, false},
+		{errors.New("context deadline exceeded"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := IsTooManyResultsError(c.err); got != c.want {
+			t.Errorf("IsTooManyResultsError(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestTooManyResultsIsNotDeterministic(t *testing.T) {
+	if IsDeterministicError(&testRPCError{-32005, "query returned more than 10000 results"}) {
+		t.Fatal("too many results should not be a deterministic error")
+	}
+	if !IsDeterministicError(&testRPCError{3, "execution reverted"}) {
+		t.Fatal("revert should be a deterministic error")
+	}
+}
+
+// 测试用的JSON-RPC节点，handle 返回一条响应(不含jsonrpc字段)，返回nil表示批量里丢掉这条
+type fakeNode struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	down     bool // 整个请求返回500
+	failNext int  // 接下来的几次请求返回500
+	calls    int  // 收到的HTTP请求数
+	handle   func(req rpcRequest) map[string]interface{}
+}
+
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func newFakeNode(t *testing.T, handle func(req rpcRequest) map[string]interface{}) *fakeNode {
+	n := &fakeNode{handle: handle}
+	n.server = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+func (n *fakeNode) setDown(down bool) {
+	n.mu.Lock()
+	n.down = down
+	n.mu.Unlock()
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	n.calls++
+	down := n.down || n.failNext > 0
+	if n.failNext > 0 {
+		n.failNext--
+	}
+	n.mu.Unlock()
+	if down {
+		http.Error(w, "node down", http.StatusInternalServerError)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	respond := func(req rpcRequest) map[string]interface{} {
+		resp := n.handle(req)
+		if resp == nil {
+			return nil
+		}
+		resp["jsonrpc"] = "2.0"
+		if _, ok := resp["id"]; !ok {
+			resp["id"] = req.ID
+		}
+		return resp
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []rpcRequest
+		json.Unmarshal(body, &reqs)
+		resps := []map[string]interface{}{}
+		for _, req := range reqs {
+			if resp := respond(req); resp != nil {
+				resps = append(resps, resp)
+			}
+		}
+		json.NewEncoder(w).Encode(resps)
+		return
+	}
+	var req rpcRequest
+	json.Unmarshal(body, &req)
+	json.NewEncoder(w).Encode(respond(req))
+}
+
+// 返回固定区块高度的节点
+func blockNumberNode(t *testing.T) *fakeNode {
+	return newFakeNode(t, func(req rpcRequest) map[string]interface{} {
+		return map[string]interface{}{"result": "0x64"}
+	})
+}
+
+// 不启动健康检查协程的多节点客户端，节点都已校验过chainID
+func newTestMultiClient(t *testing.T, nodes ...*fakeNode) *MultiClient {
+	t.Helper()
+	m := &MultiClient{
+		timeout:          2 * time.Second,
+		failureThreshold: 2,
+		cooldown:         time.Hour,
+		batchSize:        defaultRPCBatchSize,
+		stop:             make(chan struct{}),
+	}
+	for _, node := range nodes {
+		client, err := ethclient.Dial(node.server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.endpoints = append(m.endpoints, &endpoint{url: node.server.URL, eth: client, verified: true, healthy: true})
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestCallFailsOverToNextEndpoint(t *testing.T) {
+	bad, good := blockNumberNode(t), blockNumberNode(t)
+	bad.setDown(true)
+	m := newTestMultiClient(t, bad, good)
+
+	var head hexutil.Uint64
+	if err := m.CallContext(&head, "eth_blockNumber"); err != nil {
+		t.Fatal(err)
+	}
+	if head != 100 {
+		t.Fatalf("head = %d, want 100", head)
+	}
+	if bad.calls != 1 || good.calls != 1 {
+		t.Fatalf("calls bad=%d good=%d, want 1 and 1", bad.calls, good.calls)
+	}
+	if m.endpoints[0].failures != 1 || m.endpoints[0].healthy {
+		t.Fatalf("failed endpoint failures=%d healthy=%v", m.endpoints[0].failures, m.endpoints[0].healthy)
+	}
+	// 不健康的节点排到后面
+	if m.candidates()[0] != m.endpoints[1] {
+		t.Fatal("unhealthy endpoint still tried first")
+	}
+}
+
+func TestCircuitStaysOpenUntilCooldownExpires(t *testing.T) {
+	flaky, backup := blockNumberNode(t), blockNumberNode(t)
+	m := newTestMultiClient(t, flaky, backup)
+	ep := m.endpoints[0]
+
+	flaky.setDown(true)
+	for i := 0; i < m.failureThreshold; i++ {
+		m.check(ep)
+	}
+	if !time.Now().Before(ep.openUntil) {
+		t.Fatal("circuit not opened after reaching the failure threshold")
+	}
+
+	// 冷却期内健康检查成功也不恢复，熔断的节点排在最后
+	flaky.setDown(false)
+	m.check(ep)
+	if !time.Now().Before(ep.openUntil) {
+		t.Fatal("successful probe closed the circuit before the cooldown expired")
+	}
+	if m.candidates()[0] != m.endpoints[1] {
+		t.Fatal("open endpoint was not ranked last")
+	}
+
+	// 冷却结束(半开)，试探成功才关闭
+	ep.mu.Lock()
+	ep.openUntil = time.Now().Add(-time.Second)
+	ep.mu.Unlock()
+	m.check(ep)
+	if !ep.openUntil.IsZero() || ep.failures != 0 {
+		t.Fatalf("half-open probe did not close the circuit: openUntil=%v failures=%d", ep.openUntil, ep.failures)
+	}
+
+	// 半开时试探失败继续熔断
+	flaky.setDown(true)
+	for i := 0; i < m.failureThreshold; i++ {
+		m.check(ep)
+	}
+	if !time.Now().Before(ep.openUntil) {
+		t.Fatal("circuit not reopened")
+	}
+}
+
+// 只回答 eth_chainId 的节点
+func chainIDNode(t *testing.T, chainID string) *fakeNode {
+	return newFakeNode(t, func(req rpcRequest) map[string]interface{} {
+		return map[string]interface{}{"result": chainID}
+	})
+}
+
+func TestEndpointsListOnlyKeptNodes(t *testing.T) {
+	wrongChain, good, down := chainIDNode(t, "0x1"), chainIDNode(t, "0x144"), chainIDNode(t, "0x144")
+	down.setDown(true)
+	m, err := NewMultiClient(&config.BlockchainConfig{
+		ChainID:    324,
+		RPCURL:     wrongChain.server.URL,
+		RPCBackups: []string{good.server.URL, "ftp://unsupported", down.server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// 主节点chainID不对被剔除，创建不了客户端的跳过，暂时不可用的留着等健康检查
+	urls, verified := m.Endpoints()
+	if want := []string{good.server.URL, down.server.URL}; !reflect.DeepEqual(urls, want) || verified != 1 {
+		t.Fatalf("endpoints = %v (%d verified), want %v (1 verified)", urls, verified, want)
+	}
+}
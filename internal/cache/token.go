@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	"github.com/go-redis/redis"
+)
+
+const tokenKeyPrefix = "token:" // 代币元数据缓存 token:<小写地址>，元数据不会变，不设过期时间
+
+func tokenKey(address string) string {
+	return tokenKeyPrefix + strings.ToLower(address)
+}
+
+// 从Redis读取代币元数据，不存在返回 nil, nil
+func GetToken(address string) (*models.Token, error) {
+	if RDB == nil {
+		return nil, nil
+	}
+	data, err := RDB.Get(tokenKey(address)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取代币缓存失败: %v", err)
+	}
+	var token models.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("解析代币缓存失败: %v", err)
+	}
+	return &token, nil
+}
+
+// 写入代币元数据缓存
+func SetToken(token *models.Token) error {
+	if RDB == nil {
+		return nil
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := RDB.Set(tokenKey(token.Address), data, 0).Err(); err != nil {
+		return fmt.Errorf("写入代币缓存失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package clickhouse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"zk-sync-go-pool/internal/config"
+)
+
+const (
+	defaultURL      = "http://127.0.0.1:8123"
+	defaultDatabase = "zksync"
+	defaultUser     = "default"
+	requestTimeout  = 60 * time.Second
+	insertBatchSize = 10000 // 每个INSERT请求最多的行数
+)
+
+// 库名直接拼进SQL
+var databasePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+/*
+ClickHouse分析库
+走HTTP接口(默认8123端口)，不需要额外的驱动；只用来同步事件和查询，索引器本身的状态都在主库
+*/
+type Client struct {
+	url      string
+	database string
+	user     string
+	password string
+	http     *http.Client
+	mapped   []string // 事件映射表，EnsureTable 登记
+}
+
+// 连接ClickHouse，建库建表
+func New(cfg *config.ClickhouseConfig) (*Client, error) {
+	c := &Client{
+		url:      strings.TrimRight(cfg.URL, "/"),
+		database: cfg.Database,
+		user:     cfg.User,
+		password: cfg.Password,
+		http:     &http.Client{Timeout: requestTimeout},
+	}
+	if c.url == "" {
+		c.url = defaultURL
+	}
+	if c.database == "" {
+		c.database = defaultDatabase
+	}
+	if c.user == "" {
+		c.user = defaultUser
+	}
+	if !databasePattern.MatchString(c.database) {
+		return nil, fmt.Errorf("ClickHouse库名%q只能用字母、数字和下划线", c.database)
+	}
+
+	if err := c.exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", c.database)); err != nil {
+		return nil, fmt.Errorf("ClickHouse连接失败: %v", err)
+	}
+	for _, t := range tables {
+		if err := c.createTable(t); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Println("ClickHouse连接成功")
+	return c, nil
+}
+
+// 建表，已经建好的表补上之后新增的列
+func (c *Client) createTable(t table) error {
+	if err := c.exec(t.ddl(c.database)); err != nil {
+		return fmt.Errorf("ClickHouse创建表%s失败: %v", t.name, err)
+	}
+	for _, column := range t.added {
+		if err := c.exec(fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN IF NOT EXISTS %s", c.database, Quote(t.name), column)); err != nil {
+			return fmt.Errorf("ClickHouse表%s添加列失败: %v", t.name, err)
+		}
+	}
+	return nil
+}
+
+/*
+登记一张事件映射表，和内置表一起同步
+columns 是 contract_address 和映射列的定义(如 "`amount` Nullable(UInt256)"，列名用 Quote 加引号)，区块、交易、日志索引列自动加上；
+表已经存在时补上缺少的列，同名的表多次登记时列合并
+*/
+func (c *Client) EnsureTable(name string, columns []string) error {
+	if !databasePattern.MatchString(name) {
+		return fmt.Errorf("ClickHouse表名%q只能用字母、数字和下划线", name)
+	}
+	// 映射列都按新增列处理，旧表上缺少的列也能补上
+	if err := c.createTable(table{name: name, added: columns}); err != nil {
+		return err
+	}
+	for _, registered := range c.mapped {
+		if registered == name {
+			return nil
+		}
+	}
+	c.mapped = append(c.mapped, name)
+	return nil
+}
+
+// 给表名、列名加反引号，映射的列名可能是 from/to 之类的关键字
+func Quote(name string) string {
+	return "`" + name + "`"
+}
+
+// 执行一条语句
+func (c *Client) exec(query string) error {
+	return c.post(nil, strings.NewReader(query))
+}
+
+/*
+写入 JSONEachRow 格式的数据，语句放在URL参数里，请求体是数据
+模型里多出来的字段(id、created_at等)忽略
+*/
+func (c *Client) insert(table string, data []byte) error {
+	params := url.Values{}
+	params.Set("query", fmt.Sprintf("INSERT INTO %s.%s FORMAT JSONEachRow", c.database, Quote(table)))
+	params.Set("input_format_skip_unknown_fields", "1")
+	return c.post(params, bytes.NewReader(data))
+}
+
+func (c *Client) post(params url.Values, body io.Reader) error {
+	endpoint := c.url + "/"
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-ClickHouse-User", c.user)
+	req.Header.Set("X-ClickHouse-Key", c.password)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return fmt.Errorf("ClickHouse返回%d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
@@ -0,0 +1,204 @@
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"zk-sync-go-pool/internal/models"
+)
+
+// 同步的事件表，表名和主库一样，列是主库的列去掉 id/finality_status/created_at
+type table struct {
+	name    string
+	columns []string
+	added   []string // 表发布之后新增的列，已经建好的表启动时用 ADD COLUMN 补上
+}
+
+var tables = []table{
+	{models.SwapEvent{}.TableName(), []string{
+		"pool_address String",
+		"protocol LowCardinality(String)",
+		"sender String",
+		"recipient String",
+		"token_in String",
+		"token_out String",
+		"amount_in UInt256",
+		"amount_out UInt256",
+		"amount_in_decimal Nullable(Decimal(76, 30))",
+		"amount_out_decimal Nullable(Decimal(76, 30))",
+		"amount_usd Nullable(Decimal(76, 30))",
+	}, nil},
+	{models.RangeSwap{}.TableName(), []string{
+		"pool_address String",
+		"protocol LowCardinality(String)",
+		"sender String",
+		"recipient String",
+		"amount0 Int256",
+		"amount1 Int256",
+		"sqrt_price_x96 UInt256",
+		"liquidity UInt256",
+		"tick Int32",
+	}, nil},
+	{models.LiquidityEvent{}.TableName(), []string{
+		"pool_address String",
+		"event_type LowCardinality(String)",
+		"sender String",
+		"recipient String",
+		"amount0 UInt256",
+		"amount1 UInt256",
+		"liquidity UInt256",
+	}, nil},
+	{models.RangePositionEvent{}.TableName(), []string{
+		"pool_address String",
+		"event_type LowCardinality(String)",
+		"owner String",
+		"sender String",
+		"recipient String",
+		"tick_lower Int32",
+		"tick_upper Int32",
+		"liquidity UInt256",
+		"amount0 UInt256",
+		"amount1 UInt256",
+	}, nil},
+	{models.RangePoolEvent{}.TableName(), []string{
+		"pool_address String",
+		"event_type LowCardinality(String)",
+		"sender Nullable(String)",
+		"recipient Nullable(String)",
+		"amount0 Nullable(UInt256)",
+		"amount1 Nullable(UInt256)",
+		"paid0 Nullable(UInt256)",
+		"paid1 Nullable(UInt256)",
+		"sqrt_price_x96 Nullable(UInt256)",
+		"tick Nullable(Int32)",
+		"fee_protocol0 Nullable(Int32)",
+		"fee_protocol1 Nullable(Int32)",
+	}, nil},
+	{models.PoolFeeChange{}.TableName(), []string{
+		"contract_address String",
+		"pool_address String",
+		"event_name LowCardinality(String)",
+		"tick_spacing Nullable(Int32)",
+		"fee_rate Nullable(Int32)",
+		"amount0 Nullable(UInt256)",
+		"amount1 Nullable(UInt256)",
+	}, nil},
+	{models.DecodedEvent{}.TableName(), []string{
+		"contract_address String",
+		"contract_kind LowCardinality(String)",
+		"event_name LowCardinality(String)",
+		"signature String",
+		"topic0 String",
+		"topics String",
+		"data String",
+		"args Nullable(String)",
+	}, nil},
+}
+
+/*
+建表语句
+ReplacingMergeTree 按 (tx_hash, log_index) 去重，合并后只保留 version 最大的一行，is_deleted=1 的是删除标记；
+查询时加 FINAL 拿到去重后的结果。按月分区，block_number 上的minmax索引让按区块段写删除标记时不用扫全表
+*/
+func (t table) ddl(database string) string {
+	columns := append([]string{
+		"block_number UInt64",
+		"block_timestamp Int64",
+		"tx_hash String",
+		"log_index UInt32",
+	}, t.columns...)
+	columns = append(columns, t.added...)
+	columns = append(columns,
+		"version UInt64",
+		"is_deleted UInt8",
+		"INDEX idx_block_number block_number TYPE minmax GRANULARITY 1",
+	)
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s.%s (\n  %s\n) ENGINE = ReplacingMergeTree(version, is_deleted)\n"+
+		"PARTITION BY toYYYYMM(toDateTime(block_timestamp))\nORDER BY (tx_hash, log_index)",
+		database, Quote(t.name), strings.Join(columns, ",\n  "))
+}
+
+// 一段区块里要同步的事件，都是safe状态
+type Events struct {
+	Swaps           []*models.SwapEvent
+	RangeSwaps      []*models.RangeSwap
+	LiquidityEvents []*models.LiquidityEvent
+	RangePositions  []*models.RangePositionEvent
+	RangePoolEvents []*models.RangePoolEvent
+	FeeChanges      []*models.PoolFeeChange
+	DecodedEvents   []*models.DecodedEvent
+	Mapped          map[string][]map[string]interface{} // 事件映射表名 -> 行
+}
+
+// 表名 -> 行(模型切片)
+func (e *Events) rows() map[string]interface{} {
+	return map[string]interface{}{
+		models.SwapEvent{}.TableName():          e.Swaps,
+		models.RangeSwap{}.TableName():          e.RangeSwaps,
+		models.LiquidityEvent{}.TableName():     e.LiquidityEvents,
+		models.RangePositionEvent{}.TableName(): e.RangePositions,
+		models.RangePoolEvent{}.TableName():     e.RangePoolEvents,
+		models.PoolFeeChange{}.TableName():      e.FeeChanges,
+		models.DecodedEvent{}.TableName():       e.DecodedEvents,
+	}
+}
+
+/*
+用一段区块 [from, to] 的事件替换ClickHouse里的数据
+先给这段区块里已有的行写删除标记，再用更大的version写入新行：
+重复同步(进程重启、重新索引)的行被覆盖，链重组后分叉上已经不存在的行被删除。
+中途失败不影响正确性，整段重新同步一次就行
+*/
+func (c *Client) ReplaceBlocks(from, to uint64, events *Events) error {
+	version := uint64(time.Now().UnixNano())
+	rows := events.rows()
+	names := make([]string, 0, len(tables)+len(c.mapped))
+	for _, t := range tables {
+		names = append(names, t.name)
+	}
+	for _, name := range c.mapped {
+		rows[name] = events.Mapped[name]
+		names = append(names, name)
+	}
+	for _, name := range names {
+		tombstone := fmt.Sprintf("INSERT INTO %[1]s.%[2]s SELECT * REPLACE (%[3]d AS version, 1 AS is_deleted) "+
+			"FROM %[1]s.%[2]s WHERE block_number BETWEEN %[4]d AND %[5]d AND is_deleted = 0",
+			c.database, Quote(name), version, from, to)
+		if err := c.exec(tombstone); err != nil {
+			return fmt.Errorf("%s写删除标记失败: %v", name, err)
+		}
+		if err := c.insertRows(name, rows[name], version+1); err != nil {
+			return fmt.Errorf("%s写入失败: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// 模型按json标签(和列名一致)序列化，映射表的行是 列名 -> 值；每行补上version
+func (c *Client) insertRows(table string, rows interface{}, version uint64) error {
+	value := reflect.ValueOf(rows)
+	suffix := []byte(fmt.Sprintf(`,"version":%d,"is_deleted":0}`, version))
+	for start := 0; start < value.Len(); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > value.Len() {
+			end = value.Len()
+		}
+		var buf bytes.Buffer
+		for i := start; i < end; i++ {
+			row, err := json.Marshal(value.Index(i).Interface())
+			if err != nil {
+				return err
+			}
+			buf.Write(row[:len(row)-1]) // 去掉结尾的 }
+			buf.Write(suffix)
+			buf.WriteByte('\n')
+		}
+		if err := c.insert(table, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
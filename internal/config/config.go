@@ -2,14 +2,18 @@ package config
 
 // Config全局配置,后面通用映射config.yaml文件赋值给结构体
 type Config struct {
-	Server     ServerConfig     `mapstructure:"server"`     // 服务配置
-	Blockchain BlockchainConfig `mapstructure:"blockchain"` // 区块链配置
-	Syncswap   SyncswapConfig   `mapstructure:"syncswap"`   // Syncswap配置
-	Scanner    ScannerConfig    `mapstructure:"scanner"`    // 扫描器配置
-	Abi        AbiConfig        `mapstructure:"abi"`        // ABI配置
-	Database   DatabaseConfig   `mapstructure:"database"`   // 数据库配置
-	Redis      RedisConfig      `mapstructure:"redis"`      // Redis配置
-	Log        LogConfig        `mapstructure:"log"`        // 日志配置
+	Server     ServerConfig     `mapstructure:"server"`         // 服务配置
+	Blockchain BlockchainConfig `mapstructure:"blockchain"`     // 区块链配置
+	Syncswap   SyncswapConfig   `mapstructure:"syncswap"`       // Syncswap配置
+	Protocols  []ProtocolConfig `mapstructure:"protocols"`      // 其他DEX协议(uniswap v2/v3分叉等)
+	Scanner    ScannerConfig    `mapstructure:"scanner"`        // 扫描器配置
+	Pricing    PricingConfig    `mapstructure:"pricing"`        // USD定价配置
+	Clickhouse ClickhouseConfig `mapstructure:"clickhouse"`     // ClickHouse分析库(可选)
+	Mappings   []MappingConfig  `mapstructure:"event_mappings"` // 声明式事件入库
+	Abi        AbiConfig        `mapstructure:"abi"`            // ABI配置
+	Database   DatabaseConfig   `mapstructure:"database"`       // 数据库配置
+	Redis      RedisConfig      `mapstructure:"redis"`          // Redis配置
+	Log        LogConfig        `mapstructure:"log"`            // 日志配置
 }
 
 // ServerConfig子配置,映射server配置
@@ -24,6 +28,12 @@ type BlockchainConfig struct {
 	ChainID    int      `mapstructure:"chain_id"`    // 链ID
 	RPCURL     string   `mapstructure:"rpc_url"`     // RPC地址
 	RPCBackups []string `mapstructure:"rpc_backups"` // 备用RPC地址
+
+	RequestTimeout      int `mapstructure:"request_timeout"`       // 单次RPC请求超时(秒)
+	HealthCheckInterval int `mapstructure:"health_check_interval"` // 节点健康检查间隔(秒)
+	FailureThreshold    int `mapstructure:"failure_threshold"`     // 连续失败多少次触发熔断
+	CircuitCooldown     int `mapstructure:"circuit_cooldown"`      // 熔断冷却时间(秒)
+	RPCBatchSize        int `mapstructure:"rpc_batch_size"`        // JSON-RPC批量请求每批最多条数
 }
 
 // SyncswapConfig子配置,映射syncswap配置
@@ -80,12 +90,82 @@ type RoutersConfig struct {
 	V3 string `mapstructure:"v3"` // 路由器V3
 }
 
+/*
+ProtocolConfig 其他DEX协议：自己的工厂、解析池子事件的ABI和兑换语义
+SyncSwap 由上面的 syncswap 配置固定生成，协议名 syncswap
+*/
+type ProtocolConfig struct {
+	Name       string                  `mapstructure:"name"`        // 协议名称，写入 pools.protocol、swap_events.protocol
+	StartBlock int                     `mapstructure:"start_block"` // 协议部署区块，池子从这里开始导入
+	Factories  []ProtocolFactoryConfig `mapstructure:"factories"`   // 工厂合约
+}
+
+// ProtocolFactoryConfig 协议的一个工厂，同一个工厂创建的池子类型、版本、事件ABI都一样
+type ProtocolFactoryConfig struct {
+	Address          string `mapstructure:"address"`            // 工厂地址，ABI要在 abi.addresses 里
+	PoolType         string `mapstructure:"pool_type"`          // 写入 pools.pool_type，如 classic/range
+	Version          string `mapstructure:"version"`            // 写入 pools.version
+	Event            string `mapstructure:"event"`              // 创建池子的事件，默认 PoolCreated，要有 token0/token1 字段
+	PoolField        string `mapstructure:"pool_field"`         // 事件里的池子地址字段，默认 pool(uniswap v2 是 pair)
+	FeeField         string `mapstructure:"fee_field"`          // 事件里的费率字段(百万分之一)，可为空
+	TickSpacingField string `mapstructure:"tick_spacing_field"` // 事件里的tickSpacing字段，可为空
+	FeeRate          int    `mapstructure:"fee_rate"`           // 固定费率(百万分之一)，事件和合约都读不到费率时使用，如uniswap v2的3000
+	Swap             string `mapstructure:"swap"`               // 兑换语义：v2(amount0In/amount1In/amount0Out/amount1Out)，v3(有符号的amount0/amount1)
+	PoolABI          string `mapstructure:"pool_abi"`           // 解析池子事件的ABI地址(任意一个池子或池子实现合约)，要在 abi.addresses 里
+}
+
 type ScannerConfig struct {
 	StartBlock        int    `mapstructure:"start_block"`         // 开始区块
-	FetchMode         string `mapstructure:"fetch_mode"`          // 获取模式
+	FetchMode         string `mapstructure:"fetch_mode"`          // 获取模式 block_receipts/logs
+	FetchSpan         int    `mapstructure:"fetch_span"`          // 每个扫描任务拉取的区块数
 	BatchSize         int    `mapstructure:"batch_size"`          // 批量大小
 	BatchIntervarSize int    `mapstructure:"batch_interval_size"` // 批量间隔大小
 	Workers           int    `mapstructure:"workers"`             // 工作线程数
+	MaxReorgDepth     int    `mapstructure:"max_reorg_depth"`     // 链重组最多回溯的区块数
+	RetryInterval     int    `mapstructure:"retry_interval"`      // 失败区块重试检查间隔(秒)
+	RetryBaseDelay    int    `mapstructure:"retry_base_delay"`    // 失败区块首次重试延迟(秒)，之后指数退避
+	RetryMaxAttempts  int    `mapstructure:"retry_max_attempts"`  // 失败区块最多重试次数，超过标记为dead
+	SnapshotInterval  int    `mapstructure:"snapshot_interval"`   // 池子快照周期(秒)
+	BootstrapPools    bool   `mapstructure:"bootstrap_pools"`     // 启动前导入start_block之前创建的池子
+	BootstrapSpan     int    `mapstructure:"bootstrap_span"`      // 导入池子时每次eth_getLogs的区块数
+	ArchiveEvents     bool   `mapstructure:"archive_events"`      // 跟踪合约的每条日志解码后归档到decoded_events
+}
+
+// PricingConfig子配置,映射pricing配置
+type PricingConfig struct {
+	Stablecoins     []string `mapstructure:"stablecoins"`       // 按1美元计价的稳定币地址
+	WETH            string   `mapstructure:"weth"`              // 没有稳定币池子的代币经过WETH定价
+	MinLiquidityUSD float64  `mapstructure:"min_liquidity_usd"` // 流动性低于该值(USD)的池子不参与定价，防止操纵
+	Interval        int      `mapstructure:"interval"`          // 定价worker检查间隔(秒)
+	BlockSpan       int      `mapstructure:"block_span"`        // 每次定价处理的区块数
+}
+
+/*
+ClickhouseConfig 可选的ClickHouse分析库
+safe区块的事件跟在定价进度后面批量同步过去，聚合查询走ClickHouse，不压MySQL
+*/
+type ClickhouseConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`    // 开启同步
+	URL       string `mapstructure:"url"`        // HTTP接口地址，默认 http://127.0.0.1:8123
+	Database  string `mapstructure:"database"`   // 数据库，不存在自动创建，默认 zksync
+	User      string `mapstructure:"user"`       // 用户，默认 default
+	Password  string `mapstructure:"password"`   // 密码
+	Interval  int    `mapstructure:"interval"`   // 同步检查间隔(秒)
+	BlockSpan int    `mapstructure:"block_span"` // 每次同步的区块数
+}
+
+/*
+MappingConfig 声明式事件入库：按合约地址或池子类型匹配事件，解码后的字段按映射写入目标表
+*/
+type MappingConfig struct {
+	Name      string            `mapstructure:"name"`       // 映射名称，只用于日志
+	Event     string            `mapstructure:"event"`      // ABI里的事件名
+	Contracts []string          `mapstructure:"contracts"`  // 按合约地址匹配
+	PoolTypes []string          `mapstructure:"pool_types"` // 按池子类型匹配，classic 或 classic:v2
+	Protocol  string            `mapstructure:"protocol"`   // pool_types 所属的协议，默认 syncswap
+	ABI       string            `mapstructure:"abi"`        // 解析用的ABI地址，默认第一个合约自身或者对应的pool master
+	Table     string            `mapstructure:"table"`      // 目标表，不存在自动创建
+	Columns   map[string]string `mapstructure:"columns"`    // 列名 -> 事件字段，不填则全部字段按蛇形命名入库
 }
 
 type AbiConfig struct {
@@ -96,11 +176,15 @@ type AbiConfig struct {
 }
 
 type DatabaseConfig struct {
-	Host     string `mapstructure:"host"`     // 主机
-	Port     int    `mapstructure:"port"`     // 端口
-	User     string `mapstructure:"user"`     // 用户
-	Password string `mapstructure:"password"` // 密码
-	Dbname   string `mapstructure:"dbname"`   // 数据库名称
+	Driver      string `mapstructure:"driver"`       // mysql(默认) / postgres / sqlite
+	Host        string `mapstructure:"host"`         // 主机
+	Port        int    `mapstructure:"port"`         // 端口
+	User        string `mapstructure:"user"`         // 用户
+	Password    string `mapstructure:"password"`     // 密码
+	Dbname      string `mapstructure:"dbname"`       // 数据库名称
+	SSLMode     string `mapstructure:"sslmode"`      // postgres的sslmode，默认 disable
+	Path        string `mapstructure:"path"`         // sqlite数据库文件，默认 data/indexer.db，:memory: 为内存库
+	AutoMigrate bool   `mapstructure:"auto_migrate"` // 启动时自动执行没执行的迁移，否则要先 migrate up
 }
 
 type RedisConfig struct {
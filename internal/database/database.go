@@ -0,0 +1,69 @@
+package database
+
+import (
+	"fmt"
+	"zk-sync-go-pool/internal/config"
+
+	"gorm.io/gorm"
+)
+
+// database.driver 可选的数据库
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite" // 嵌入式，本地运行和测试用，不用装MySQL
+)
+
+// 驱动名 -> 连接方式
+var dialectors = map[string]func(cfg *config.DatabaseConfig) (gorm.Dialector, error){
+	DriverMySQL:    mysqlDialector,
+	DriverPostgres: postgresDialector,
+	DriverSQLite:   sqliteDialector,
+}
+
+/*
+按 database.driver 连接数据库并检查表结构版本
+不配置driver默认MySQL；表结构由 migrations 下的迁移脚本维护(见 migrate.go)
+*/
+func Open(cfg *config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchema(db, cfg.AutoMigrate); err != nil {
+		return nil, err
+	}
+	fmt.Printf("%s连接成功\n", db.Dialector.Name())
+	return db, nil
+}
+
+// 只连接数据库，不检查表结构版本(migrate子命令用)
+func Connect(cfg *config.DatabaseConfig) (*gorm.DB, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = DriverMySQL
+	}
+	newDialector, ok := dialectors[driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的数据库驱动: %s", cfg.Driver)
+	}
+	dialector, err := newDialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// 连接数据库
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %v", err)
+	}
+	if driver == DriverSQLite {
+		// SQLite同一时间只能有一个写事务，多个连接并发写会报 database is locked，扫描worker排队用一个连接
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
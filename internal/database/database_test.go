@@ -0,0 +1,24 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"zk-sync-go-pool/internal/config"
+)
+
+// 只改配置就能用SQLite，不需要额外的编译标签
+func TestOpenSQLiteFromConfig(t *testing.T) {
+	cfg := &config.DatabaseConfig{Driver: DriverSQLite, Path: filepath.Join(t.TempDir(), "indexer.db"), AutoMigrate: true}
+	db, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	if !db.Migrator().HasTable("swap_events") {
+		t.Fatal("swap_events not created by auto_migrate")
+	}
+}
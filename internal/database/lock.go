@@ -0,0 +1,71 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	scannerLockName      = "zk_sync_go_pool_scanner" // MySQL GET_LOCK 的锁名
+	scannerLockKey       = 7301853926                // PostgreSQL advisory lock 的键
+	scannerLockKeepalive = time.Minute               // 拿锁的连接空闲时多久ping一次，防止被 wait_timeout 断开
+)
+
+// 扫描器锁被别的进程拿着
+var ErrScannerLocked = errors.New("扫描器正在运行(或者有其他命令在改同一个库)，先停掉扫描器再执行")
+
+/*
+扫描器锁，同一个库同一时间只有一个进程在写扫描数据
+扫描器运行期间一直拿着；rebuild-candles 这类在另一个进程里改扫描数据的命令也要拿，拿不到就直接报错不等。
+锁是会话级的，拿锁的连接留到 fn 返回，期间定时 SELECT 1 保持连接；MySQL 用 GET_LOCK，PostgreSQL 用 advisory lock，
+SQLite 没有跨进程的咨询锁，不加锁，执行这些命令前要自己先停掉扫描器
+*/
+func WithScannerLock(db *gorm.DB, fn func() error) error {
+	if db.Dialector.Name() == DriverSQLite {
+		return fn()
+	}
+	return db.Connection(func(conn *gorm.DB) error {
+		switch conn.Dialector.Name() {
+		case DriverMySQL:
+			var locked sql.NullInt64
+			if err := conn.Raw("SELECT GET_LOCK(?, 0)", scannerLockName).Row().Scan(&locked); err != nil {
+				return fmt.Errorf("获取扫描器锁失败: %v", err)
+			}
+			if !locked.Valid || locked.Int64 != 1 {
+				return ErrScannerLocked
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", scannerLockName)
+		case DriverPostgres:
+			var locked bool
+			if err := conn.Raw("SELECT pg_try_advisory_lock(?)", scannerLockKey).Row().Scan(&locked); err != nil {
+				return fmt.Errorf("获取扫描器锁失败: %v", err)
+			}
+			if !locked {
+				return ErrScannerLocked
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", scannerLockKey)
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(scannerLockKeepalive)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := conn.Exec("SELECT 1").Error; err != nil {
+						fmt.Printf("⚠️ 扫描器锁的连接保活失败: %v\n", err)
+					}
+				}
+			}
+		}()
+		return fn()
+	})
+}
@@ -0,0 +1,429 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+版本化的表结构迁移
+迁移脚本按数据库放在 migrations/<mysql|postgres|sqlite>/ 下，编译进程序；
+文件名 版本号_名称.up.sql / 版本号_名称.down.sql，up 和 down 成对出现，三种数据库的版本号保持一致。
+执行过的版本记在 schema_migrations 表，改表结构只能新增迁移，已经发布的脚本不要再改。
+模型上的gorm标签不再建表，只决定读写时的列映射
+*/
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// 一个版本的迁移
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+// 迁移状态，AppliedAt为nil表示还没执行；Unknown表示库里记录的版本程序里没有(数据库被更新的程序迁移过)
+type MigrationState struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// schema_migrations 的一行
+type schemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// 三种数据库通用的写法
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// 读取当前数据库的迁移脚本，按版本升序
+func loadMigrations(dialect string) ([]*Migration, error) {
+	dir := "migrations/" + dialect
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("没有%s的迁移脚本", dialect)
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("迁移文件名不对: %s/%s", dir, entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("迁移版本%d有两个名称: %s、%s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.up = string(data)
+		} else {
+			migration.down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("迁移%04d_%s缺少up或down脚本", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// 已经执行的迁移，只读：schema_migrations 还不存在时当作一个都没执行
+func appliedMigrations(db *gorm.DB) (map[int64]schemaMigration, error) {
+	applied := make(map[int64]schemaMigration)
+	if !db.Migrator().HasTable(schemaMigration{}.TableName()) {
+		return applied, nil
+	}
+	var rows []schemaMigration
+	if err := db.Order("version ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("读取schema_migrations失败: %v", err)
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func ensureSchemaMigrations(db *gorm.DB) error {
+	if err := db.Exec(createSchemaMigrations).Error; err != nil {
+		return fmt.Errorf("创建schema_migrations失败: %v", err)
+	}
+	return nil
+}
+
+// 所有迁移的状态，按版本升序；库里有但程序里没有的版本标记为Unknown。只读，不会建表
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(migrations))
+	known := make(map[int64]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	for version, row := range applied {
+		if !known[version] {
+			appliedAt := row.AppliedAt
+			states = append(states, MigrationState{Version: version, Name: row.Name, AppliedAt: &appliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// 库里有程序不认识的版本时不能继续，用旧程序跑新表结构可能写坏数据
+func checkUnknown(states []MigrationState) error {
+	for _, state := range states {
+		if state.Unknown {
+			return fmt.Errorf("数据库的表结构版本%04d_%s不在程序的迁移里，数据库被更新的程序迁移过，请升级程序", state.Version, state.Name)
+		}
+	}
+	return nil
+}
+
+// 判断旧库用的表：0001_init 建的，旧版本 AutoMigrate/init_tables.sql 也建过
+var legacyTables = []string{"pools", "swap_events", "scan_progress"}
+
+/*
+一个迁移都没执行过，库里却已经有表：旧版本 AutoMigrate 或 init_tables.sql 建的库
+这时直接执行 0001_init 会因为 IF NOT EXISTS 跳过建表，表结构对不上也看不出来，要先人工确认再 baseline
+*/
+func checkLegacy(db *gorm.DB, states []MigrationState) error {
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			return nil
+		}
+	}
+	for _, table := range legacyTables {
+		if db.Migrator().HasTable(table) {
+			return fmt.Errorf("数据库里已经有表%s但没有迁移记录：旧版本(AutoMigrate/init_tables.sql)建的库，"+
+				"确认表结构和0001_init一致后执行 go run main.go migrate baseline，再执行 migrate up；"+
+				"MySQL上0001_init执行到一半失败留下的表，删掉后重新执行 migrate up", table)
+		}
+	}
+	return nil
+}
+
+const (
+	migrationLockName    = "zk_sync_go_pool_migrate" // MySQL GET_LOCK 的锁名
+	migrationLockKey     = 7301853925                // PostgreSQL advisory lock 的键
+	migrationLockTimeout = 300                       // MySQL 等锁的秒数
+)
+
+/*
+迁移锁，同一时间只有一个进程在迁移(多个实例同时启动并开了 auto_migrate 时)
+锁是会话级的，迁移都在拿到锁的这个连接上执行；MySQL 用 GET_LOCK，PostgreSQL 用 advisory lock，
+SQLite 的写事务本身互斥，拿到锁后重新读一次迁移状态，别的进程已经执行过的版本会跳过
+*/
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		switch conn.Dialector.Name() {
+		case DriverMySQL:
+			var locked sql.NullInt64
+			if err := conn.Raw("SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeout).Row().Scan(&locked); err != nil {
+				return fmt.Errorf("获取迁移锁失败: %v", err)
+			}
+			if !locked.Valid || locked.Int64 != 1 {
+				return fmt.Errorf("等待迁移锁超时，有其他进程正在迁移")
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", migrationLockName)
+		case DriverPostgres:
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+				return fmt.Errorf("获取迁移锁失败: %v", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+		}
+		return fn(conn)
+	})
+}
+
+/*
+按版本顺序执行所有没执行过的迁移，返回执行了的迁移
+每个迁移的脚本和 schema_migrations 记录在一个事务里；MySQL的DDL会隐式提交，中途失败时已经执行的语句不会回滚，
+所以脚本尽量写成可以重复执行的(IF NOT EXISTS)，修好后再执行会从这个版本的第一条语句重来
+(0001_init 例外：留下的表和旧版本建的库分不开，会被 checkLegacy 拦住，要先删表)
+*/
+func MigrateUp(db *gorm.DB) ([]*Migration, error) {
+	var done []*Migration
+	err := withMigrationLock(db, func(conn *gorm.DB) error {
+		states, err := MigrationStatus(conn)
+		if err != nil {
+			return err
+		}
+		if err := checkUnknown(states); err != nil {
+			return err
+		}
+		if err := checkLegacy(conn, states); err != nil {
+			return err
+		}
+		if err := ensureSchemaMigrations(conn); err != nil {
+			return err
+		}
+		migrations, err := loadMigrations(conn.Dialector.Name())
+		if err != nil {
+			return err
+		}
+		applied := make(map[int64]bool)
+		for _, state := range states {
+			applied[state.Version] = state.AppliedAt != nil
+		}
+
+		for _, migration := range migrations {
+			if applied[migration.Version] {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := execScript(tx, migration.up); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("执行迁移%04d_%s失败: %v", migration.Version, migration.Name, err)
+			}
+			fmt.Printf("✅ 执行迁移 %04d_%s\n", migration.Version, migration.Name)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// 从最新的版本开始回退steps个已执行的迁移，返回回退了的迁移
+func MigrateDown(db *gorm.DB, steps int) ([]*Migration, error) {
+	var done []*Migration
+	err := withMigrationLock(db, func(conn *gorm.DB) error {
+		states, err := MigrationStatus(conn)
+		if err != nil {
+			return err
+		}
+		if err := checkUnknown(states); err != nil {
+			return err
+		}
+		migrations, err := loadMigrations(conn.Dialector.Name())
+		if err != nil {
+			return err
+		}
+		applied := make(map[int64]bool)
+		for _, state := range states {
+			applied[state.Version] = state.AppliedAt != nil
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := execScript(tx, migration.down); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("回退迁移%04d_%s失败: %v", migration.Version, migration.Name, err)
+			}
+			fmt.Printf("✅ 回退迁移 %04d_%s\n", migration.Version, migration.Name)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+/*
+把旧版本建的库登记到迁移记录里(migrate baseline)：版本号不超过version的迁移记为已执行，不执行脚本
+只能在一个迁移都没执行过的库上用，之后 migrate up 从下一个版本开始执行
+*/
+func MigrateBaseline(db *gorm.DB, version int64) ([]*Migration, error) {
+	var done []*Migration
+	err := withMigrationLock(db, func(conn *gorm.DB) error {
+		states, err := MigrationStatus(conn)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			if state.AppliedAt != nil {
+				return fmt.Errorf("数据库已经有迁移记录(%04d_%s)，不需要baseline", state.Version, state.Name)
+			}
+		}
+		migrations, err := loadMigrations(conn.Dialector.Name())
+		if err != nil {
+			return err
+		}
+		if err := ensureSchemaMigrations(conn); err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if migration.Version > version {
+				break
+			}
+			row := &schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if err := conn.Create(row).Error; err != nil {
+				return fmt.Errorf("登记迁移%04d_%s失败: %v", migration.Version, migration.Name, err)
+			}
+			fmt.Printf("✅ 登记迁移 %04d_%s(未执行脚本)\n", migration.Version, migration.Name)
+			done = append(done, migration)
+		}
+		if len(done) == 0 {
+			return fmt.Errorf("没有版本号不超过%d的迁移", version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+/*
+启动时检查表结构版本
+库里有程序不认识的版本、旧版本建的库没有baseline时拒绝启动；有没执行的迁移时，开了 auto_migrate 自动执行，否则拒绝启动
+*/
+func checkSchema(db *gorm.DB, autoMigrate bool) error {
+	states, err := MigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	if err := checkUnknown(states); err != nil {
+		return err
+	}
+	if err := checkLegacy(db, states); err != nil {
+		return err
+	}
+	var pending []string
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%04d_%s", state.Version, state.Name))
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if !autoMigrate {
+		return fmt.Errorf("数据库有没执行的迁移 %s，先执行 go run main.go migrate up，或者配置 database.auto_migrate: true",
+			strings.Join(pending, ", "))
+	}
+	_, err = MigrateUp(db)
+	return err
+}
+
+// 逐条执行脚本
+func execScript(tx *gorm.DB, script string) error {
+	for _, statement := range splitStatements(script) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+按行尾的分号把脚本拆成单条语句(MySQL驱动默认不能一次执行多条)
+整行的 -- 注释去掉；语句中间的分号(如注释文字里的)不在行尾，不会被拆开
+*/
+func splitStatements(script string) []string {
+	var statements []string
+	var current []string
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";")
+			statements = append(statements, statement)
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		statements = append(statements, strings.TrimSpace(strings.Join(current, "\n")))
+	}
+	return statements
+}
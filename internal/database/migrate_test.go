@@ -0,0 +1,149 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1) // :memory: 每个连接是一个新库
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- ========================================
+-- 注释里的分号; 不拆
+-- ========================================
+
+CREATE TABLE a (
+    id INT -- 行尾注释; 不在行尾的分号不拆
+);
+
+  -- 缩进的注释
+INSERT INTO a VALUES (1);
+UPDATE a SET id = 2`
+	want := []string{
+		"CREATE TABLE a (\n    id INT -- 行尾注释; 不在行尾的分号不拆\n)",
+		"INSERT INTO a VALUES (1)",
+		"UPDATE a SET id = 2",
+	}
+	if got := splitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Fatalf("splitStatements = %q, want %q", got, want)
+	}
+	if got := splitStatements("-- 只有注释\n\n"); len(got) != 0 {
+		t.Fatalf("comment-only script = %q, want none", got)
+	}
+}
+
+func TestMigrateUpDownRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := MigrateUp(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+	if again, err := MigrateUp(db); err != nil || len(again) != 0 {
+		t.Fatalf("second MigrateUp = %d, %v; want nothing to do", len(again), err)
+	}
+
+	rolledBack, err := MigrateDown(db, len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) != len(migrations) {
+		t.Fatalf("rolled back %d migrations, want %d", len(rolledBack), len(migrations))
+	}
+	for _, table := range legacyTables {
+		if db.Migrator().HasTable(table) {
+			t.Fatalf("table %s left after rolling back everything", table)
+		}
+	}
+
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp after full rollback: %v", err)
+	}
+	states, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.AppliedAt == nil {
+			t.Fatalf("%04d_%s not applied", state.Version, state.Name)
+		}
+	}
+}
+
+func TestMigrationStatusIsReadOnly(t *testing.T) {
+	db := newTestDB(t)
+	states, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			t.Fatalf("%04d_%s applied on an empty database", state.Version, state.Name)
+		}
+	}
+	if db.Migrator().HasTable(schemaMigration{}.TableName()) {
+		t.Fatal("MigrationStatus created schema_migrations")
+	}
+}
+
+func TestLegacyDatabaseNeedsBaseline(t *testing.T) {
+	db := newTestDB(t)
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 旧版本建的库：有 0001_init 的表，没有迁移记录
+	if err := execScript(db, migrations[0].up); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateUp(db); err == nil || !strings.Contains(err.Error(), "baseline") {
+		t.Fatalf("MigrateUp on legacy database = %v, want baseline error", err)
+	}
+	if err := checkSchema(db, true); err == nil {
+		t.Fatal("checkSchema accepted a legacy database")
+	}
+
+	baselined, err := MigrateBaseline(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(baselined) != 1 || baselined[0].Version != 1 {
+		t.Fatalf("baseline recorded %d migrations, want only 0001", len(baselined))
+	}
+	applied, err := MigrateUp(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations)-1 {
+		t.Fatalf("applied %d migrations after baseline, want %d", len(applied), len(migrations)-1)
+	}
+	if _, err := MigrateBaseline(db, 1); err == nil {
+		t.Fatal("baseline accepted a database that already has migration records")
+	}
+}
@@ -0,0 +1,384 @@
+-- ========================================
+-- 初始表结构(MySQL)
+-- ========================================
+
+-- 1. 池子信息表
+CREATE TABLE IF NOT EXISTS pools (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    pool_address VARCHAR(42) UNIQUE NOT NULL COMMENT '池子地址',
+    factory_address VARCHAR(42) NOT NULL COMMENT '工厂地址(基于哪个合约的池子)',
+    protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap' COMMENT '所属DEX协议(syncswap或配置里protocols的name)',
+    pool_type VARCHAR(20) NOT NULL COMMENT '池子类型(classic/stable/range)',
+    version VARCHAR(10) NOT NULL COMMENT '版本(v1/v2/v2.1/v3)',
+    token0 VARCHAR(42) NOT NULL COMMENT 'token0地址(池子的对币地址，固定不会变)',
+    token1 VARCHAR(42) NOT NULL COMMENT 'token1地址(池子的对币地址，固定不会变)',
+    fee_rate INT COMMENT '手续费率(百万分之一，3000 = 0.3% 、500 = 0.05%。可为空，创建区块上读取失败的等费率事件补齐)',
+    fee_block BIGINT NOT NULL DEFAULT 0 COMMENT 'fee_rate来自的区块号(旧区块的费率变化不覆盖新的)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    created_tx VARCHAR(66) NOT NULL COMMENT '创建交易哈希(创建池子也算交易，保证唯一性)',
+    created_block BIGINT NOT NULL COMMENT '创建区块号',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    deleted_at TIMESTAMP NULL COMMENT '删除时间',
+    status BOOLEAN DEFAULT TRUE COMMENT '状态',
+
+    INDEX idx_tokens (token0 , token1), -- 按照代币0地址和代币1地址查询
+    INDEX idx_pool_type (pool_type , version), -- 按照类型和版本查询
+    INDEX idx_factory_address (factory_address), -- 按照工厂地址查询
+    INDEX idx_pools_protocol (protocol) -- 按照协议查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='池子信息表';
+
+CREATE TABLE IF NOT EXISTS tokens(
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    address VARCHAR(42) UNIQUE NOT NULL COMMENT '代币地址',
+    symbol varchar(20) NOT NULL COMMENT '代币符号',
+    name VARCHAR(100) NOT NULL COMMENT '代币名称', 
+    decimals SMALLINT NOT NULL COMMENT '代币精度',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+    deleted_at TIMESTAMP NULL COMMENT '删除时间',
+    status BOOLEAN DEFAULT TRUE COMMENT '状态',
+ 
+    INDEX idx_symbol (symbol) -- 按照代币符号查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='代币信息表';
+
+CREATE TABLE IF NOT EXISTS swap_events(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    block_number BIGINT NOT NULL COMMENT '区块高度',
+    block_timestamp BIGINT NOT NULL COMMENT '区块时间戳(Unix秒)',
+    tx_hash VARCHAR(66) NOT NULL COMMENT '交易哈希',
+    log_index INT NOT NULL COMMENT '日志索引（同一交易可能有多条日志，加上tx_hash和log_index联合唯一索引区分日志; 触发多个事件:Transfer->Transfer->Swap->Transfer->Transfer）',
+    pool_address VARCHAR(42) NOT NULL COMMENT '池子地址',
+    protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap' COMMENT '池子所属DEX协议(冗余，按协议统计不用联表)',
+    sender VARCHAR(42) NOT NULL COMMENT '发送者',
+    recipient VARCHAR(42) NOT NULL COMMENT '接收者',
+    token_in VARCHAR(42) NOT NULL COMMENT '输入代币地址(比如WETH,USDC,USDT,WBTC的地址)',
+    token_out VARCHAR(42) NOT NULL COMMENT '输出代币地址(比如WETH,USDC,USDT,WBTC的地址)',
+    amount_in VARCHAR(78) NOT NULL COMMENT '输入数量(Wei,字符串)',
+    amount_out VARCHAR(78) NOT NULL COMMENT '输出数量(Wei,字符串)',
+    amount_in_decimal DECIMAL(65,30) NULL COMMENT '输入数量(按代币精度换算，精度未知时为NULL，之后回填)',
+    amount_out_decimal DECIMAL(65,30) NULL COMMENT '输出数量(按代币精度换算，精度未知时为NULL，之后回填)',
+    amount_usd DECIMAL(65,30) NULL COMMENT '成交额(USD)，由定价worker在safe区块上回填',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '最终状态(pending/safe)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+    INDEX idx_block_number (block_number), -- 按照区块高度查询
+    UNIQUE idx_tx_event (tx_hash , log_index), -- 交易哈希加日志索引联合唯一索引 防止重复记录
+    INDEX idx_pool_address (pool_address), -- 按照池子地址查询
+    INDEX idx_sender (sender), -- 按照发送者查询
+    INDEX idx_recipient (recipient), -- 按照接收者查询
+    INDEX idx_tokens (token_in , token_out), -- 按照输入代币地址和输出代币地址查询
+    INDEX idx_time (block_timestamp) -- 按照区块时间戳查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='交易事件表';
+
+CREATE TABLE IF NOT EXISTS scan_progress(
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    task_name VARCHAR(50) UNIQUE NOT NULL COMMENT '任务名称',
+    last_scanned_block BIGINT NOT NULL COMMENT '最后扫描的区块高度',
+    status VARCHAR(20) DEFAULT 'running' COMMENT '状态(running/done，done表示一次性的导入、回填任务已完成)',
+    error_message TEXT COMMENT '错误信息',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='扫描进度表';
+
+CREATE TABLE IF NOT EXISTS blocks(
+    number BIGINT PRIMARY KEY COMMENT '区块高度',
+    hash VARCHAR(66) NOT NULL COMMENT '区块哈希',
+    parent_hash VARCHAR(66) NOT NULL COMMENT '父区块哈希(用于检测链重组)',
+    timestamp BIGINT NOT NULL COMMENT '区块时间戳(Unix秒)',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '最终状态(pending/safe)',
+    swap_count INT NOT NULL DEFAULT 0 COMMENT '扫描时解析出的swap事件数(audit对账用)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='已扫描区块表';
+
+CREATE TABLE IF NOT EXISTS reorg_logs(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    detected_block BIGINT NOT NULL COMMENT '发现分叉的区块高度',
+    common_ancestor BIGINT NOT NULL COMMENT '回滚到的公共祖先区块',
+    depth BIGINT NOT NULL COMMENT '重组深度',
+    old_hash VARCHAR(66) NOT NULL COMMENT '库里记录的哈希',
+    new_hash VARCHAR(66) NOT NULL COMMENT '链上最新的哈希',
+    worker VARCHAR(16) NOT NULL COMMENT '发现重组的worker(safe/pending)',
+    swaps_deleted BIGINT NOT NULL DEFAULT 0 COMMENT '回滚删除的swap事件数',
+    pools_deleted BIGINT NOT NULL DEFAULT 0 COMMENT '回滚删除的池子数',
+    blocks_deleted BIGINT NOT NULL DEFAULT 0 COMMENT '回滚删除的区块数',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='链重组日志表';
+
+CREATE TABLE IF NOT EXISTS failed_blocks(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    block_number BIGINT UNIQUE NOT NULL COMMENT '扫描失败的区块高度',
+    error TEXT COMMENT '最近一次失败原因',
+    attempts INT NOT NULL DEFAULT 0 COMMENT '已重试次数',
+    next_retry_at TIMESTAMP NOT NULL COMMENT '下次重试时间(指数退避)',
+    status VARCHAR(16) NOT NULL DEFAULT 'retrying' COMMENT '状态(retrying/dead)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+    INDEX idx_next_retry_at (next_retry_at) -- 按照下次重试时间查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='扫描失败区块表(死信队列)';
+
+CREATE TABLE IF NOT EXISTS liquidity_events(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    block_number BIGINT NOT NULL COMMENT '区块高度',
+    block_timestamp BIGINT NOT NULL COMMENT '区块时间戳(Unix秒)',
+    tx_hash VARCHAR(66) NOT NULL COMMENT '交易哈希',
+    log_index INT NOT NULL COMMENT '日志索引',
+    pool_address VARCHAR(42) NOT NULL COMMENT '池子地址',
+    event_type VARCHAR(8) NOT NULL COMMENT '事件类型(mint/burn)',
+    sender VARCHAR(42) NOT NULL COMMENT '发送者',
+    recipient VARCHAR(42) NOT NULL COMMENT '接收者(mint为LP接收者，burn为代币接收者)',
+    amount0 VARCHAR(78) NOT NULL COMMENT 'token0数量(Wei,字符串)',
+    amount1 VARCHAR(78) NOT NULL COMMENT 'token1数量(Wei,字符串)',
+    liquidity VARCHAR(78) NOT NULL COMMENT 'LP数量(Wei,字符串)',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '最终状态(pending/safe)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+    INDEX idx_block_number (block_number), -- 按照区块高度查询
+    UNIQUE idx_liquidity_tx_event (tx_hash , log_index), -- 交易哈希加日志索引联合唯一索引 防止重复记录
+    INDEX idx_pool_address (pool_address) -- 按照池子地址查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='流动性事件表(Mint/Burn)';
+
+CREATE TABLE IF NOT EXISTS pool_reserves(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    pool_address VARCHAR(42) NOT NULL COMMENT '池子地址',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '最终状态(pending/safe)，safe和pending各一行',
+    reserve0 VARCHAR(78) NOT NULL COMMENT 'token0储备量(Wei,字符串)',
+    reserve1 VARCHAR(78) NOT NULL COMMENT 'token1储备量(Wei,字符串)',
+    block_number BIGINT NOT NULL COMMENT '最近一次Sync所在区块',
+    log_index INT NOT NULL COMMENT '最近一次Sync的日志索引',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+    UNIQUE idx_pool_finality (pool_address , finality_status) -- 每个池子safe/pending各一行
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='池子储备量表(最近一次Sync)';
+
+CREATE TABLE IF NOT EXISTS range_swaps(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    block_number BIGINT NOT NULL COMMENT '区块高度',
+    block_timestamp BIGINT NOT NULL COMMENT '区块时间戳(Unix秒)',
+    tx_hash VARCHAR(66) NOT NULL COMMENT '交易哈希',
+    log_index INT NOT NULL COMMENT '日志索引',
+    pool_address VARCHAR(42) NOT NULL COMMENT '池子地址',
+    sender VARCHAR(42) NOT NULL COMMENT '发送者',
+    recipient VARCHAR(42) NOT NULL COMMENT '接收者',
+    amount0 VARCHAR(79) NOT NULL COMMENT 'token0数量(有符号,正数为池子收入,负数为池子支出)',
+    amount1 VARCHAR(79) NOT NULL COMMENT 'token1数量(有符号,正数为池子收入,负数为池子支出)',
+    sqrt_price_x96 VARCHAR(78) NOT NULL COMMENT 'swap后的价格(sqrtPriceX96)',
+    liquidity VARCHAR(78) NOT NULL COMMENT 'swap后的活跃流动性',
+    tick INT NOT NULL COMMENT 'swap后的tick',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '最终状态(pending/safe)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+    INDEX idx_block_number (block_number), -- 按照区块高度查询
+    UNIQUE idx_range_swap_tx_event (tx_hash , log_index), -- 交易哈希加日志索引联合唯一索引 防止重复记录
+    INDEX idx_range_swap_pool_block (pool_address , block_number) -- 按照池子地址查询价格变化
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='range池子Swap事件表(价格/流动性/tick)';
+
+CREATE TABLE IF NOT EXISTS range_position_events(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    block_number BIGINT NOT NULL COMMENT '区块高度',
+    block_timestamp BIGINT NOT NULL COMMENT '区块时间戳(Unix秒)',
+    tx_hash VARCHAR(66) NOT NULL COMMENT '交易哈希',
+    log_index INT NOT NULL COMMENT '日志索引',
+    pool_address VARCHAR(42) NOT NULL COMMENT '池子地址',
+    event_type VARCHAR(8) NOT NULL COMMENT '事件类型(mint/burn/collect)',
+    owner VARCHAR(42) NOT NULL COMMENT '头寸所有者',
+    sender VARCHAR(42) NOT NULL DEFAULT '' COMMENT '发送者(只有mint有)',
+    recipient VARCHAR(42) NOT NULL DEFAULT '' COMMENT '接收者(只有collect有)',
+    tick_lower INT NOT NULL COMMENT '头寸tick下界',
+    tick_upper INT NOT NULL COMMENT '头寸tick上界',
+    liquidity VARCHAR(78) NOT NULL COMMENT '增加/减少的流动性(collect为0)',
+    amount0 VARCHAR(78) NOT NULL COMMENT 'token0数量(Wei,字符串)',
+    amount1 VARCHAR(78) NOT NULL COMMENT 'token1数量(Wei,字符串)',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '最终状态(pending/safe)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+    INDEX idx_block_number (block_number), -- 按照区块高度查询
+    UNIQUE idx_range_position_tx_event (tx_hash , log_index), -- 交易哈希加日志索引联合唯一索引 防止重复记录
+    INDEX idx_range_position (pool_address , owner , tick_lower , tick_upper) -- 按照头寸查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='range池子头寸事件表(Mint/Burn/Collect)';
+
+CREATE TABLE IF NOT EXISTS range_pool_events(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    block_number BIGINT NOT NULL COMMENT '区块高度',
+    block_timestamp BIGINT NOT NULL COMMENT '区块时间戳(Unix秒)',
+    tx_hash VARCHAR(66) NOT NULL COMMENT '交易哈希',
+    log_index INT NOT NULL COMMENT '日志索引',
+    pool_address VARCHAR(42) NOT NULL COMMENT '池子地址',
+    event_type VARCHAR(20) NOT NULL COMMENT '事件类型(initialize/collect_fees/flash/set_fee_protocol)',
+    sender VARCHAR(42) NULL COMMENT '发送者(flash)',
+    recipient VARCHAR(42) NULL COMMENT '接收者(collect_fees/flash)',
+    amount0 VARCHAR(78) NULL COMMENT 'token0数量(collect_fees/flash)',
+    amount1 VARCHAR(78) NULL COMMENT 'token1数量(collect_fees/flash)',
+    paid0 VARCHAR(78) NULL COMMENT 'flash归还的token0手续费',
+    paid1 VARCHAR(78) NULL COMMENT 'flash归还的token1手续费',
+    sqrt_price_x96 VARCHAR(78) NULL COMMENT '初始价格(initialize)',
+    tick INT NULL COMMENT '初始tick(initialize)',
+    fee_protocol0 INT NULL COMMENT '新的token0协议费比例(set_fee_protocol)',
+    fee_protocol1 INT NULL COMMENT '新的token1协议费比例(set_fee_protocol)',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '最终状态(pending/safe)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+    INDEX idx_block_number (block_number), -- 按照区块高度查询
+    UNIQUE idx_range_pool_tx_event (tx_hash , log_index), -- 交易哈希加日志索引联合唯一索引 防止重复记录
+    INDEX idx_pool_address (pool_address) -- 按照池子地址查询
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='range池子级事件表(Initialize/CollectFees/Flash/SetFeeProtocol)';
+
+CREATE TABLE IF NOT EXISTS candles(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    market_type VARCHAR(8) NOT NULL COMMENT '市场类型(pool按池子/pair按交易对)',
+    market VARCHAR(85) NOT NULL COMMENT '池子地址 或 交易对(两个代币地址小写排序 token0-token1)',
+    period VARCHAR(4) NOT NULL COMMENT 'K线周期(1m/5m/1h/1d)',
+    bucket_start BIGINT NOT NULL COMMENT '周期开始时间(Unix秒)',
+    open DECIMAL(65,30) NOT NULL COMMENT '开盘价(token1/token0，已按精度换算)',
+    high DECIMAL(65,30) NOT NULL COMMENT '最高价',
+    low DECIMAL(65,30) NOT NULL COMMENT '最低价',
+    close DECIMAL(65,30) NOT NULL COMMENT '收盘价',
+    volume0 DECIMAL(65,30) NOT NULL COMMENT 'token0成交量',
+    volume1 DECIMAL(65,30) NOT NULL COMMENT 'token1成交量',
+    trade_count INT NOT NULL COMMENT '成交笔数',
+    open_block BIGINT NOT NULL COMMENT '开盘swap所在区块(乱序写入时判断先后)',
+    open_log_index INT NOT NULL COMMENT '开盘swap日志索引',
+    close_block BIGINT NOT NULL COMMENT '收盘swap所在区块',
+    close_log_index INT NOT NULL COMMENT '收盘swap日志索引',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+    UNIQUE idx_candle_bucket (market_type , market , period , bucket_start) -- 每个市场每个周期一根K线
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='K线表(OHLCV)';
+
+CREATE TABLE IF NOT EXISTS token_prices(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    token VARCHAR(42) NOT NULL COMMENT '代币地址',
+    bucket_start BIGINT NOT NULL COMMENT '分钟开始时间(Unix秒)',
+    block_number BIGINT NOT NULL COMMENT '该分钟内最后一笔参与定价的swap所在区块',
+    price_usd DECIMAL(65,30) NOT NULL COMMENT 'USD价格',
+    route VARCHAR(16) NOT NULL COMMENT '定价路径(stable:稳定币本身/direct:直接对稳定币/weth:经过WETH)',
+    quote_token VARCHAR(42) NOT NULL COMMENT '定价池子的另一个代币(稳定币或WETH)',
+    pool_address VARCHAR(42) NOT NULL COMMENT '定价池子地址',
+    liquidity_usd DECIMAL(65,30) NOT NULL COMMENT '定价池子的流动性(USD，储备量或24小时成交量)',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+    UNIQUE idx_token_bucket (token, bucket_start), -- 每个代币每分钟一个价格
+    INDEX idx_block_number (block_number) -- 链重组回滚时按区块删除
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='代币USD价格表';
+
+CREATE TABLE IF NOT EXISTS pool_snapshots(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    pool_address VARCHAR(42) NOT NULL COMMENT '池子地址',
+    pool_type VARCHAR(20) NOT NULL COMMENT '池子类型(冗余，按类型统计不用联表)',
+    version VARCHAR(10) NOT NULL COMMENT '池子版本(冗余)',
+    bucket_start BIGINT NOT NULL COMMENT '快照周期开始时间(Unix秒)',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '最终状态(pending/safe)',
+    block_number BIGINT NOT NULL COMMENT '快照所在区块',
+    block_timestamp BIGINT NOT NULL COMMENT '区块时间戳(Unix秒)',
+    log_index INT NOT NULL COMMENT 'Sync的日志索引，调用getReserves()的为区块末尾',
+    source VARCHAR(8) NOT NULL COMMENT '来源(sync:Sync事件/call:定时调用合约)',
+    reserve0 VARCHAR(78) NOT NULL COMMENT 'token0储备量(Wei,字符串)',
+    reserve1 VARCHAR(78) NOT NULL COMMENT 'token1储备量(Wei,字符串)',
+    reserve0_decimal DECIMAL(65,30) NULL COMMENT 'token0储备量(按代币精度换算)',
+    reserve1_decimal DECIMAL(65,30) NULL COMMENT 'token1储备量(按代币精度换算)',
+    tvl_usd DECIMAL(65,30) NULL COMMENT 'TVL(USD)，两个代币都有价格时才有值',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+    UNIQUE idx_snapshot_bucket (pool_address , bucket_start , finality_status), -- 每个池子每个周期safe/pending各一行
+    INDEX idx_snapshot_type (pool_type , version , bucket_start), -- 按池子类型和版本统计
+    INDEX idx_block_number (block_number) -- pending删除和链重组回滚
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='池子储备量/TVL快照表';
+
+CREATE TABLE IF NOT EXISTS pool_rollups(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    period VARCHAR(4) NOT NULL COMMENT '汇总周期(1h/1d)',
+    bucket_start BIGINT NOT NULL COMMENT '周期开始时间(Unix秒)',
+    pool_address VARCHAR(42) NOT NULL COMMENT '池子地址(小写)',
+    pool_type VARCHAR(20) NOT NULL COMMENT '池子类型',
+    version VARCHAR(10) NOT NULL COMMENT '池子版本',
+    swap_count INT NOT NULL COMMENT '成交笔数',
+    volume0 DECIMAL(65,30) NOT NULL COMMENT 'token0成交量(买入卖出合计)',
+    volume1 DECIMAL(65,30) NOT NULL COMMENT 'token1成交量(买入卖出合计)',
+    volume_usd DECIMAL(65,30) NOT NULL COMMENT '成交额(USD)',
+    unique_traders INT NOT NULL COMMENT '成交人数(按接收地址去重)',
+    fees_usd DECIMAL(65,30) NOT NULL COMMENT '手续费(USD，按池子费率估算)',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+    UNIQUE idx_pool_rollup (period , bucket_start , pool_address) -- 每个池子每个周期一行
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='池子成交汇总表';
+
+CREATE TABLE IF NOT EXISTS token_rollups(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    period VARCHAR(4) NOT NULL COMMENT '汇总周期(1h/1d)',
+    bucket_start BIGINT NOT NULL COMMENT '周期开始时间(Unix秒)',
+    token VARCHAR(42) NOT NULL COMMENT '代币地址(小写)',
+    swap_count INT NOT NULL COMMENT '成交笔数(作为输入或输出代币)',
+    volume DECIMAL(65,30) NOT NULL COMMENT '代币成交量(买入卖出合计)',
+    volume_usd DECIMAL(65,30) NOT NULL COMMENT '成交额(USD)',
+    unique_traders INT NOT NULL COMMENT '成交人数(按接收地址去重)',
+    fees_usd DECIMAL(65,30) NOT NULL COMMENT '手续费(USD，只计在输入代币上)',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+    UNIQUE idx_token_rollup (period , bucket_start , token) -- 每个代币每个周期一行
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='代币成交汇总表';
+
+CREATE TABLE IF NOT EXISTS pool_type_rollups(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    period VARCHAR(4) NOT NULL COMMENT '汇总周期(1h/1d)',
+    bucket_start BIGINT NOT NULL COMMENT '周期开始时间(Unix秒)',
+    pool_type VARCHAR(20) NOT NULL COMMENT '池子类型',
+    version VARCHAR(10) NOT NULL COMMENT '池子版本',
+    swap_count INT NOT NULL COMMENT '成交笔数',
+    volume_usd DECIMAL(65,30) NOT NULL COMMENT '成交额(USD)',
+    unique_traders INT NOT NULL COMMENT '成交人数(按接收地址去重)',
+    fees_usd DECIMAL(65,30) NOT NULL COMMENT '手续费(USD，按池子费率估算)',
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+    UNIQUE idx_pool_type_rollup (period , bucket_start , pool_type , version) -- 每个池子类型+版本每个周期一行
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='池子类型成交汇总表';
+
+CREATE TABLE IF NOT EXISTS pool_fee_history(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    block_number BIGINT NOT NULL COMMENT '区块号',
+    block_timestamp BIGINT NOT NULL COMMENT '区块时间戳',
+    tx_hash VARCHAR(66) NOT NULL COMMENT '交易哈希',
+    log_index INT NOT NULL COMMENT '日志索引',
+    contract_address VARCHAR(42) NOT NULL COMMENT '发出事件的合约(池子或工厂)',
+    pool_address VARCHAR(42) NOT NULL DEFAULT '' COMMENT '池子地址(工厂按tickSpacing设置的默认费率为空)',
+    event_name VARCHAR(40) NOT NULL COMMENT '来源事件(PoolCreated/SetTickSpacingDefaultSwapFee/TickSpacingEnabled/FeeAmount/Swapped/Fee)',
+    tick_spacing INT NULL COMMENT 'tickSpacing(只有range有)',
+    fee_rate INT NULL COMMENT '手续费率(百万分之一)',
+    amount0 VARCHAR(78) NULL COMMENT '手续费数量0(只有aqua Fee事件有)',
+    amount1 VARCHAR(78) NULL COMMENT '手续费数量1(只有aqua Fee事件有)',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '确认状态(safe/pending)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+    UNIQUE idx_fee_tx_event (tx_hash , log_index), -- 同一条日志只记录一次
+    INDEX idx_block_number (block_number), -- 链重组和pending重建按区块删除
+    INDEX idx_pool_address (pool_address) -- 按池子查询费率历史
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='池子费率变化历史表';
+
+CREATE TABLE IF NOT EXISTS decoded_events(
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    block_number BIGINT NOT NULL COMMENT '区块号',
+    block_timestamp BIGINT NOT NULL COMMENT '区块时间戳',
+    tx_hash VARCHAR(66) NOT NULL COMMENT '交易哈希',
+    log_index INT NOT NULL COMMENT '日志索引',
+    contract_address VARCHAR(42) NOT NULL COMMENT '发出事件的合约',
+    contract_kind VARCHAR(10) NOT NULL COMMENT '合约类型(factory/pool/router)',
+    event_name VARCHAR(64) NOT NULL DEFAULT '' COMMENT '事件名(ABI里没有的事件为空)',
+    signature VARCHAR(255) NOT NULL DEFAULT '' COMMENT '事件签名',
+    topic0 VARCHAR(66) NOT NULL COMMENT '事件签名哈希',
+    topics TEXT NOT NULL COMMENT '全部topics(JSON数组)',
+    data TEXT NOT NULL COMMENT '原始data(0x开头)',
+    args TEXT NULL COMMENT '解码后的参数(JSON，解码失败为NULL)',
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe' COMMENT '确认状态(safe/pending)',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+    UNIQUE idx_decoded_tx_event (tx_hash , log_index), -- 同一条日志只归档一次
+    INDEX idx_block_number (block_number), -- 链重组和pending重建按区块删除
+    INDEX idx_decoded_contract_event (contract_address , event_name) -- 按合约和事件重新推导数据
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='原始事件归档表';
+
+-- 预填充常用Token（zkSync Era主网）
+INSERT IGNORE INTO tokens (address, symbol, name, decimals) VALUES
+('0x5aea5775959fbc2557cc8789bc1bf90a239d9a91', 'WETH', 'Wrapped Ether', 18),
+('0x3355df6D4c9C3035724Fd0e3914dE96A5a83aaf4', 'USDC', 'USD Coin', 6),
+('0x493257fD37EDB34451f62EDf8D2a0C418852bA4C', 'USDT', 'Tether USD', 6),
+('0xBBeB516fb02a01611cBBE0453Fe3c580D7281011', 'WBTC', 'Wrapped BTC', 8);
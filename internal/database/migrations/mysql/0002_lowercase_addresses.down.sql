@@ -0,0 +1 @@
+-- 原来的checksum大小写没有保存，地址保持小写，不回退
@@ -0,0 +1,47 @@
+-- ========================================
+-- 地址统一存小写
+-- 以前池子/代币地址按checksum写入，手工导入的代币是小写，大小写敏感的比较下关联不上
+-- MySQL默认排序规则比较时不区分大小写，唯一键上不会有大小写两份，要用BINARY才能找出不是小写的行
+-- ========================================
+
+UPDATE tokens SET address = LOWER(address) WHERE BINARY address <> LOWER(address);
+
+UPDATE pools SET pool_address = LOWER(pool_address), factory_address = LOWER(factory_address),
+    token0 = LOWER(token0), token1 = LOWER(token1)
+    WHERE BINARY pool_address <> LOWER(pool_address) OR BINARY factory_address <> LOWER(factory_address)
+        OR BINARY token0 <> LOWER(token0) OR BINARY token1 <> LOWER(token1);
+
+UPDATE swap_events SET pool_address = LOWER(pool_address), sender = LOWER(sender), recipient = LOWER(recipient),
+    token_in = LOWER(token_in), token_out = LOWER(token_out)
+    WHERE BINARY pool_address <> LOWER(pool_address) OR BINARY sender <> LOWER(sender) OR BINARY recipient <> LOWER(recipient)
+        OR BINARY token_in <> LOWER(token_in) OR BINARY token_out <> LOWER(token_out);
+
+UPDATE liquidity_events SET pool_address = LOWER(pool_address), sender = LOWER(sender), recipient = LOWER(recipient)
+    WHERE BINARY pool_address <> LOWER(pool_address) OR BINARY sender <> LOWER(sender) OR BINARY recipient <> LOWER(recipient);
+
+UPDATE pool_reserves SET pool_address = LOWER(pool_address) WHERE BINARY pool_address <> LOWER(pool_address);
+
+UPDATE range_swaps SET pool_address = LOWER(pool_address), sender = LOWER(sender), recipient = LOWER(recipient)
+    WHERE BINARY pool_address <> LOWER(pool_address) OR BINARY sender <> LOWER(sender) OR BINARY recipient <> LOWER(recipient);
+
+UPDATE range_position_events SET pool_address = LOWER(pool_address), owner = LOWER(owner),
+    sender = LOWER(sender), recipient = LOWER(recipient)
+    WHERE BINARY pool_address <> LOWER(pool_address) OR BINARY owner <> LOWER(owner)
+        OR BINARY sender <> LOWER(sender) OR BINARY recipient <> LOWER(recipient);
+
+UPDATE range_pool_events SET pool_address = LOWER(pool_address), sender = LOWER(sender), recipient = LOWER(recipient)
+    WHERE BINARY pool_address <> LOWER(pool_address) OR BINARY sender <> LOWER(sender) OR BINARY recipient <> LOWER(recipient);
+
+UPDATE token_prices SET token = LOWER(token), quote_token = LOWER(quote_token), pool_address = LOWER(pool_address)
+    WHERE BINARY token <> LOWER(token) OR BINARY quote_token <> LOWER(quote_token) OR BINARY pool_address <> LOWER(pool_address);
+
+UPDATE pool_snapshots SET pool_address = LOWER(pool_address) WHERE BINARY pool_address <> LOWER(pool_address);
+
+UPDATE pool_rollups SET pool_address = LOWER(pool_address) WHERE BINARY pool_address <> LOWER(pool_address);
+
+UPDATE token_rollups SET token = LOWER(token) WHERE BINARY token <> LOWER(token);
+
+UPDATE pool_fee_history SET contract_address = LOWER(contract_address), pool_address = LOWER(pool_address)
+    WHERE BINARY contract_address <> LOWER(contract_address) OR BINARY pool_address <> LOWER(pool_address);
+
+UPDATE decoded_events SET contract_address = LOWER(contract_address) WHERE BINARY contract_address <> LOWER(contract_address);
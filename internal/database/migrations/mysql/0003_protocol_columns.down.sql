@@ -0,0 +1,3 @@
+ALTER TABLE pool_type_rollups DROP INDEX idx_pool_type_rollup, DROP COLUMN protocol;
+
+ALTER TABLE range_swaps DROP COLUMN protocol;
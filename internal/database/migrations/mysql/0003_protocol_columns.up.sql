@@ -0,0 +1,14 @@
+-- ========================================
+-- range_swaps 和 pool_type_rollups 加上协议
+-- range_swaps 按池子表补上已有行的协议；池子类型汇总以前把各协议合在一起，有其他协议的池子时删掉汇总进度从头重算
+-- ========================================
+
+ALTER TABLE range_swaps ADD COLUMN protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap' COMMENT '池子所属DEX协议(冗余，按协议统计不用联表)' AFTER pool_address;
+
+UPDATE range_swaps r JOIN pools p ON p.pool_address = r.pool_address SET r.protocol = p.protocol WHERE p.protocol <> 'syncswap';
+
+ALTER TABLE pool_type_rollups ADD COLUMN protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap' COMMENT '所属DEX协议' AFTER bucket_start,
+    DROP INDEX idx_pool_type_rollup,
+    ADD UNIQUE idx_pool_type_rollup (period, bucket_start, protocol, pool_type, version);
+
+DELETE FROM scan_progress WHERE task_name = 'rollup' AND EXISTS (SELECT 1 FROM pools WHERE protocol <> 'syncswap');
@@ -0,0 +1,3 @@
+-- ========================================
+-- 只有 SQLite 需要把小数列改成 TEXT，这里没有要改的，保留版本号和其他数据库一致
+-- ========================================
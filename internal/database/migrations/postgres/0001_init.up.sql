@@ -0,0 +1,402 @@
+-- ========================================
+-- 初始表结构(PostgreSQL)
+-- 金额用 NUMERIC(78,0)，pending数据用部分索引
+-- ========================================
+
+-- 池子信息表
+CREATE TABLE IF NOT EXISTS pools (
+    id BIGSERIAL PRIMARY KEY,
+    pool_address VARCHAR(42) NOT NULL,
+    factory_address VARCHAR(42) NOT NULL,
+    protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap',
+    pool_type VARCHAR(20) NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    token0 VARCHAR(42) NOT NULL,
+    token1 VARCHAR(42) NOT NULL,
+    fee_rate INT,
+    fee_block BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_tx VARCHAR(66) NOT NULL,
+    created_block BIGINT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    status BOOLEAN DEFAULT TRUE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pools_pool_address ON pools (pool_address);
+CREATE INDEX IF NOT EXISTS idx_pools_tokens ON pools (token0, token1);
+CREATE INDEX IF NOT EXISTS idx_pools_pool_type ON pools (pool_type, version);
+CREATE INDEX IF NOT EXISTS idx_pools_factory_address ON pools (factory_address);
+CREATE INDEX IF NOT EXISTS idx_pools_protocol ON pools (protocol);
+
+-- 代币信息表
+CREATE TABLE IF NOT EXISTS tokens (
+    id SERIAL PRIMARY KEY,
+    address VARCHAR(42) NOT NULL,
+    symbol VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    decimals SMALLINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    status BOOLEAN DEFAULT TRUE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tokens_address ON tokens (address);
+CREATE INDEX IF NOT EXISTS idx_tokens_symbol ON tokens (symbol);
+
+-- 交易事件表
+CREATE TABLE IF NOT EXISTS swap_events (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap',
+    sender VARCHAR(42) NOT NULL,
+    recipient VARCHAR(42) NOT NULL,
+    token_in VARCHAR(42) NOT NULL,
+    token_out VARCHAR(42) NOT NULL,
+    amount_in NUMERIC(78,0) NOT NULL,
+    amount_out NUMERIC(78,0) NOT NULL,
+    amount_in_decimal NUMERIC(65,30),
+    amount_out_decimal NUMERIC(65,30),
+    amount_usd NUMERIC(65,30),
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tx_event ON swap_events (tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_swap_events_block_number ON swap_events (block_number);
+CREATE INDEX IF NOT EXISTS idx_swap_events_pool_address ON swap_events (pool_address);
+CREATE INDEX IF NOT EXISTS idx_swap_events_sender ON swap_events (sender);
+CREATE INDEX IF NOT EXISTS idx_swap_events_recipient ON swap_events (recipient);
+CREATE INDEX IF NOT EXISTS idx_swap_events_tokens ON swap_events (token_in, token_out);
+CREATE INDEX IF NOT EXISTS idx_swap_events_time ON swap_events (block_timestamp);
+CREATE INDEX IF NOT EXISTS idx_swap_events_pending ON swap_events (block_number) WHERE finality_status = 'pending';
+
+-- 扫描进度表
+CREATE TABLE IF NOT EXISTS scan_progress (
+    id SERIAL PRIMARY KEY,
+    task_name VARCHAR(50) NOT NULL,
+    last_scanned_block BIGINT NOT NULL,
+    status VARCHAR(20) DEFAULT 'running',
+    error_message TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scan_progress_task_name ON scan_progress (task_name);
+
+-- 已扫描区块表
+CREATE TABLE IF NOT EXISTS blocks (
+    number BIGINT PRIMARY KEY,
+    hash VARCHAR(66) NOT NULL,
+    parent_hash VARCHAR(66) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    swap_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_blocks_pending ON blocks (number) WHERE finality_status = 'pending';
+
+-- 链重组日志表
+CREATE TABLE IF NOT EXISTS reorg_logs (
+    id BIGSERIAL PRIMARY KEY,
+    detected_block BIGINT NOT NULL,
+    common_ancestor BIGINT NOT NULL,
+    depth BIGINT NOT NULL,
+    old_hash VARCHAR(66) NOT NULL,
+    new_hash VARCHAR(66) NOT NULL,
+    worker VARCHAR(16) NOT NULL,
+    swaps_deleted BIGINT NOT NULL DEFAULT 0,
+    pools_deleted BIGINT NOT NULL DEFAULT 0,
+    blocks_deleted BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 扫描失败区块表(死信队列)
+CREATE TABLE IF NOT EXISTS failed_blocks (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    error TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    next_retry_at TIMESTAMP NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'retrying',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_failed_blocks_block_number ON failed_blocks (block_number);
+CREATE INDEX IF NOT EXISTS idx_failed_blocks_next_retry_at ON failed_blocks (next_retry_at);
+
+-- 流动性事件表(Mint/Burn)
+CREATE TABLE IF NOT EXISTS liquidity_events (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    event_type VARCHAR(8) NOT NULL,
+    sender VARCHAR(42) NOT NULL,
+    recipient VARCHAR(42) NOT NULL,
+    amount0 NUMERIC(78,0) NOT NULL,
+    amount1 NUMERIC(78,0) NOT NULL,
+    liquidity NUMERIC(78,0) NOT NULL,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_liquidity_tx_event ON liquidity_events (tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_liquidity_events_block_number ON liquidity_events (block_number);
+CREATE INDEX IF NOT EXISTS idx_liquidity_events_pool_address ON liquidity_events (pool_address);
+CREATE INDEX IF NOT EXISTS idx_liquidity_events_pending ON liquidity_events (block_number) WHERE finality_status = 'pending';
+
+-- 池子储备量表(最近一次Sync)
+CREATE TABLE IF NOT EXISTS pool_reserves (
+    id BIGSERIAL PRIMARY KEY,
+    pool_address VARCHAR(42) NOT NULL,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    reserve0 NUMERIC(78,0) NOT NULL,
+    reserve1 NUMERIC(78,0) NOT NULL,
+    block_number BIGINT NOT NULL,
+    log_index INT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pool_finality ON pool_reserves (pool_address, finality_status);
+CREATE INDEX IF NOT EXISTS idx_pool_reserves_pending ON pool_reserves (block_number) WHERE finality_status = 'pending';
+
+-- range池子Swap事件表(价格/流动性/tick)
+CREATE TABLE IF NOT EXISTS range_swaps (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    sender VARCHAR(42) NOT NULL,
+    recipient VARCHAR(42) NOT NULL,
+    amount0 NUMERIC(78,0) NOT NULL,
+    amount1 NUMERIC(78,0) NOT NULL,
+    sqrt_price_x96 NUMERIC(78,0) NOT NULL,
+    liquidity NUMERIC(78,0) NOT NULL,
+    tick INT NOT NULL,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_range_swap_tx_event ON range_swaps (tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_range_swaps_block_number ON range_swaps (block_number);
+CREATE INDEX IF NOT EXISTS idx_range_swap_pool_block ON range_swaps (pool_address, block_number);
+CREATE INDEX IF NOT EXISTS idx_range_swaps_pending ON range_swaps (block_number) WHERE finality_status = 'pending';
+
+-- range池子头寸事件表(Mint/Burn/Collect)
+CREATE TABLE IF NOT EXISTS range_position_events (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    event_type VARCHAR(8) NOT NULL,
+    owner VARCHAR(42) NOT NULL,
+    sender VARCHAR(42) NOT NULL DEFAULT '',
+    recipient VARCHAR(42) NOT NULL DEFAULT '',
+    tick_lower INT NOT NULL,
+    tick_upper INT NOT NULL,
+    liquidity NUMERIC(78,0) NOT NULL,
+    amount0 NUMERIC(78,0) NOT NULL,
+    amount1 NUMERIC(78,0) NOT NULL,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_range_position_tx_event ON range_position_events (tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_range_position_events_block_number ON range_position_events (block_number);
+CREATE INDEX IF NOT EXISTS idx_range_position ON range_position_events (pool_address, owner, tick_lower, tick_upper);
+CREATE INDEX IF NOT EXISTS idx_range_position_events_pending ON range_position_events (block_number) WHERE finality_status = 'pending';
+
+-- range池子级事件表(Initialize/CollectFees/Flash/SetFeeProtocol)
+CREATE TABLE IF NOT EXISTS range_pool_events (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    event_type VARCHAR(20) NOT NULL,
+    sender VARCHAR(42),
+    recipient VARCHAR(42),
+    amount0 NUMERIC(78,0),
+    amount1 NUMERIC(78,0),
+    paid0 NUMERIC(78,0),
+    paid1 NUMERIC(78,0),
+    sqrt_price_x96 NUMERIC(78,0),
+    tick INT,
+    fee_protocol0 INT,
+    fee_protocol1 INT,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_range_pool_tx_event ON range_pool_events (tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_range_pool_events_block_number ON range_pool_events (block_number);
+CREATE INDEX IF NOT EXISTS idx_range_pool_events_pool_address ON range_pool_events (pool_address);
+CREATE INDEX IF NOT EXISTS idx_range_pool_events_pending ON range_pool_events (block_number) WHERE finality_status = 'pending';
+
+-- K线表(OHLCV)
+CREATE TABLE IF NOT EXISTS candles (
+    id BIGSERIAL PRIMARY KEY,
+    market_type VARCHAR(8) NOT NULL,
+    market VARCHAR(85) NOT NULL,
+    period VARCHAR(4) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    open NUMERIC(65,30) NOT NULL,
+    high NUMERIC(65,30) NOT NULL,
+    low NUMERIC(65,30) NOT NULL,
+    close NUMERIC(65,30) NOT NULL,
+    volume0 NUMERIC(65,30) NOT NULL,
+    volume1 NUMERIC(65,30) NOT NULL,
+    trade_count INT NOT NULL,
+    open_block BIGINT NOT NULL,
+    open_log_index INT NOT NULL,
+    close_block BIGINT NOT NULL,
+    close_log_index INT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_candle_bucket ON candles (market_type, market, period, bucket_start);
+
+-- 代币USD价格表
+CREATE TABLE IF NOT EXISTS token_prices (
+    id BIGSERIAL PRIMARY KEY,
+    token VARCHAR(42) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    block_number BIGINT NOT NULL,
+    price_usd NUMERIC(65,30) NOT NULL,
+    route VARCHAR(16) NOT NULL,
+    quote_token VARCHAR(42) NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    liquidity_usd NUMERIC(65,30) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_token_bucket ON token_prices (token, bucket_start);
+CREATE INDEX IF NOT EXISTS idx_token_prices_block_number ON token_prices (block_number);
+
+-- 池子储备量/TVL快照表
+CREATE TABLE IF NOT EXISTS pool_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    pool_address VARCHAR(42) NOT NULL,
+    pool_type VARCHAR(20) NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    log_index INT NOT NULL,
+    source VARCHAR(8) NOT NULL,
+    reserve0 NUMERIC(78,0) NOT NULL,
+    reserve1 NUMERIC(78,0) NOT NULL,
+    reserve0_decimal NUMERIC(65,30),
+    reserve1_decimal NUMERIC(65,30),
+    tvl_usd NUMERIC(65,30),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_snapshot_bucket ON pool_snapshots (pool_address, bucket_start, finality_status);
+CREATE INDEX IF NOT EXISTS idx_snapshot_type ON pool_snapshots (pool_type, version, bucket_start);
+CREATE INDEX IF NOT EXISTS idx_pool_snapshots_block_number ON pool_snapshots (block_number);
+CREATE INDEX IF NOT EXISTS idx_pool_snapshots_pending ON pool_snapshots (block_number) WHERE finality_status = 'pending';
+
+-- 池子成交汇总表
+CREATE TABLE IF NOT EXISTS pool_rollups (
+    id BIGSERIAL PRIMARY KEY,
+    period VARCHAR(4) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    pool_type VARCHAR(20) NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    swap_count INT NOT NULL,
+    volume0 NUMERIC(65,30) NOT NULL,
+    volume1 NUMERIC(65,30) NOT NULL,
+    volume_usd NUMERIC(65,30) NOT NULL,
+    unique_traders INT NOT NULL,
+    fees_usd NUMERIC(65,30) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pool_rollup ON pool_rollups (period, bucket_start, pool_address);
+
+-- 代币成交汇总表
+CREATE TABLE IF NOT EXISTS token_rollups (
+    id BIGSERIAL PRIMARY KEY,
+    period VARCHAR(4) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    token VARCHAR(42) NOT NULL,
+    swap_count INT NOT NULL,
+    volume NUMERIC(65,30) NOT NULL,
+    volume_usd NUMERIC(65,30) NOT NULL,
+    unique_traders INT NOT NULL,
+    fees_usd NUMERIC(65,30) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_token_rollup ON token_rollups (period, bucket_start, token);
+
+-- 池子类型成交汇总表
+CREATE TABLE IF NOT EXISTS pool_type_rollups (
+    id BIGSERIAL PRIMARY KEY,
+    period VARCHAR(4) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    pool_type VARCHAR(20) NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    swap_count INT NOT NULL,
+    volume_usd NUMERIC(65,30) NOT NULL,
+    unique_traders INT NOT NULL,
+    fees_usd NUMERIC(65,30) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pool_type_rollup ON pool_type_rollups (period, bucket_start, pool_type, version);
+
+-- 池子费率变化历史表
+CREATE TABLE IF NOT EXISTS pool_fee_history (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    contract_address VARCHAR(42) NOT NULL,
+    pool_address VARCHAR(42) NOT NULL DEFAULT '',
+    event_name VARCHAR(40) NOT NULL,
+    tick_spacing INT,
+    fee_rate INT,
+    amount0 NUMERIC(78,0),
+    amount1 NUMERIC(78,0),
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_fee_tx_event ON pool_fee_history (tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_pool_fee_history_block_number ON pool_fee_history (block_number);
+CREATE INDEX IF NOT EXISTS idx_pool_fee_history_pool_address ON pool_fee_history (pool_address);
+CREATE INDEX IF NOT EXISTS idx_pool_fee_history_pending ON pool_fee_history (block_number) WHERE finality_status = 'pending';
+
+-- 原始事件归档表
+CREATE TABLE IF NOT EXISTS decoded_events (
+    id BIGSERIAL PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    contract_address VARCHAR(42) NOT NULL,
+    contract_kind VARCHAR(10) NOT NULL,
+    event_name VARCHAR(64) NOT NULL DEFAULT '',
+    signature VARCHAR(255) NOT NULL DEFAULT '',
+    topic0 VARCHAR(66) NOT NULL,
+    topics TEXT NOT NULL,
+    data TEXT NOT NULL,
+    args TEXT,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_decoded_tx_event ON decoded_events (tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_decoded_events_block_number ON decoded_events (block_number);
+CREATE INDEX IF NOT EXISTS idx_decoded_contract_event ON decoded_events (contract_address, event_name);
+CREATE INDEX IF NOT EXISTS idx_decoded_events_pending ON decoded_events (block_number) WHERE finality_status = 'pending';
+
+-- 预填充常用Token（zkSync Era主网）
+INSERT INTO tokens (address, symbol, name, decimals) VALUES
+('0x5aea5775959fbc2557cc8789bc1bf90a239d9a91', 'WETH', 'Wrapped Ether', 18),
+('0x3355df6D4c9C3035724Fd0e3914dE96A5a83aaf4', 'USDC', 'USD Coin', 6),
+('0x493257fD37EDB34451f62EDf8D2a0C418852bA4C', 'USDT', 'Tether USD', 6),
+('0xBBeB516fb02a01611cBBE0453Fe3c580D7281011', 'WBTC', 'Wrapped BTC', 8)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_pool_type_rollup;
+
+ALTER TABLE pool_type_rollups DROP COLUMN protocol;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pool_type_rollup ON pool_type_rollups (period, bucket_start, pool_type, version);
+
+ALTER TABLE range_swaps DROP COLUMN protocol;
@@ -0,0 +1,3 @@
+-- ========================================
+-- 只有 SQLite 有改动，这里没有要回退的
+-- ========================================
@@ -0,0 +1,64 @@
+-- ========================================
+-- 地址统一存小写
+-- 以前池子/代币地址按checksum写入，手工导入的代币是小写，大小写敏感的数据库上关联不上
+-- 唯一键上已经有小写副本的行先删掉，再把剩下的改成小写
+-- ========================================
+
+DELETE FROM tokens WHERE address <> LOWER(address)
+    AND EXISTS (SELECT 1 FROM tokens t WHERE t.address = LOWER(tokens.address));
+UPDATE tokens SET address = LOWER(address) WHERE address <> LOWER(address);
+
+UPDATE pools SET pool_address = LOWER(pool_address), factory_address = LOWER(factory_address),
+    token0 = LOWER(token0), token1 = LOWER(token1)
+    WHERE pool_address <> LOWER(pool_address) OR factory_address <> LOWER(factory_address)
+        OR token0 <> LOWER(token0) OR token1 <> LOWER(token1);
+
+UPDATE swap_events SET pool_address = LOWER(pool_address), sender = LOWER(sender), recipient = LOWER(recipient),
+    token_in = LOWER(token_in), token_out = LOWER(token_out)
+    WHERE pool_address <> LOWER(pool_address) OR sender <> LOWER(sender) OR recipient <> LOWER(recipient)
+        OR token_in <> LOWER(token_in) OR token_out <> LOWER(token_out);
+
+UPDATE liquidity_events SET pool_address = LOWER(pool_address), sender = LOWER(sender), recipient = LOWER(recipient)
+    WHERE pool_address <> LOWER(pool_address) OR sender <> LOWER(sender) OR recipient <> LOWER(recipient);
+
+DELETE FROM pool_reserves WHERE pool_address <> LOWER(pool_address)
+    AND EXISTS (SELECT 1 FROM pool_reserves r WHERE r.pool_address = LOWER(pool_reserves.pool_address)
+        AND r.finality_status = pool_reserves.finality_status);
+UPDATE pool_reserves SET pool_address = LOWER(pool_address) WHERE pool_address <> LOWER(pool_address);
+
+UPDATE range_swaps SET pool_address = LOWER(pool_address), sender = LOWER(sender), recipient = LOWER(recipient)
+    WHERE pool_address <> LOWER(pool_address) OR sender <> LOWER(sender) OR recipient <> LOWER(recipient);
+
+UPDATE range_position_events SET pool_address = LOWER(pool_address), owner = LOWER(owner),
+    sender = LOWER(sender), recipient = LOWER(recipient)
+    WHERE pool_address <> LOWER(pool_address) OR owner <> LOWER(owner)
+        OR sender <> LOWER(sender) OR recipient <> LOWER(recipient);
+
+UPDATE range_pool_events SET pool_address = LOWER(pool_address), sender = LOWER(sender), recipient = LOWER(recipient)
+    WHERE pool_address <> LOWER(pool_address) OR sender <> LOWER(sender) OR recipient <> LOWER(recipient);
+
+DELETE FROM token_prices WHERE token <> LOWER(token)
+    AND EXISTS (SELECT 1 FROM token_prices p WHERE p.token = LOWER(token_prices.token)
+        AND p.bucket_start = token_prices.bucket_start);
+UPDATE token_prices SET token = LOWER(token), quote_token = LOWER(quote_token), pool_address = LOWER(pool_address)
+    WHERE token <> LOWER(token) OR quote_token <> LOWER(quote_token) OR pool_address <> LOWER(pool_address);
+
+DELETE FROM pool_snapshots WHERE pool_address <> LOWER(pool_address)
+    AND EXISTS (SELECT 1 FROM pool_snapshots s WHERE s.pool_address = LOWER(pool_snapshots.pool_address)
+        AND s.bucket_start = pool_snapshots.bucket_start AND s.finality_status = pool_snapshots.finality_status);
+UPDATE pool_snapshots SET pool_address = LOWER(pool_address) WHERE pool_address <> LOWER(pool_address);
+
+DELETE FROM pool_rollups WHERE pool_address <> LOWER(pool_address)
+    AND EXISTS (SELECT 1 FROM pool_rollups r WHERE r.pool_address = LOWER(pool_rollups.pool_address)
+        AND r.period = pool_rollups.period AND r.bucket_start = pool_rollups.bucket_start);
+UPDATE pool_rollups SET pool_address = LOWER(pool_address) WHERE pool_address <> LOWER(pool_address);
+
+DELETE FROM token_rollups WHERE token <> LOWER(token)
+    AND EXISTS (SELECT 1 FROM token_rollups r WHERE r.token = LOWER(token_rollups.token)
+        AND r.period = token_rollups.period AND r.bucket_start = token_rollups.bucket_start);
+UPDATE token_rollups SET token = LOWER(token) WHERE token <> LOWER(token);
+
+UPDATE pool_fee_history SET contract_address = LOWER(contract_address), pool_address = LOWER(pool_address)
+    WHERE contract_address <> LOWER(contract_address) OR pool_address <> LOWER(pool_address);
+
+UPDATE decoded_events SET contract_address = LOWER(contract_address) WHERE contract_address <> LOWER(contract_address);
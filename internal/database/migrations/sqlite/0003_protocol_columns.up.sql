@@ -0,0 +1,17 @@
+-- ========================================
+-- range_swaps 和 pool_type_rollups 加上协议
+-- range_swaps 按池子表补上已有行的协议；池子类型汇总以前把各协议合在一起，有其他协议的池子时删掉汇总进度从头重算
+-- ========================================
+
+ALTER TABLE range_swaps ADD COLUMN protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap';
+
+UPDATE range_swaps SET protocol = (SELECT p.protocol FROM pools p WHERE p.pool_address = range_swaps.pool_address)
+    WHERE EXISTS (SELECT 1 FROM pools p WHERE p.pool_address = range_swaps.pool_address AND p.protocol <> 'syncswap');
+
+ALTER TABLE pool_type_rollups ADD COLUMN protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap';
+
+DROP INDEX IF EXISTS idx_pool_type_rollup;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pool_type_rollup ON pool_type_rollups (period, bucket_start, protocol, pool_type, version);
+
+DELETE FROM scan_progress WHERE task_name = 'rollup' AND EXISTS (SELECT 1 FROM pools WHERE protocol <> 'syncswap');
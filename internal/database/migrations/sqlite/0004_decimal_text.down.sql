@@ -0,0 +1,163 @@
+-- ========================================
+-- 小数列改回 DECIMAL(65,30)
+-- ========================================
+
+CREATE TABLE swap_events_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INT NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap',
+    sender VARCHAR(42) NOT NULL,
+    recipient VARCHAR(42) NOT NULL,
+    token_in VARCHAR(42) NOT NULL,
+    token_out VARCHAR(42) NOT NULL,
+    amount_in VARCHAR(78) NOT NULL,
+    amount_out VARCHAR(78) NOT NULL,
+    amount_in_decimal DECIMAL(65,30),
+    amount_out_decimal DECIMAL(65,30),
+    amount_usd DECIMAL(65,30),
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO swap_events_new (id, block_number, block_timestamp, tx_hash, log_index, pool_address, protocol, sender, recipient, token_in, token_out, amount_in, amount_out, amount_in_decimal, amount_out_decimal, amount_usd, finality_status, created_at)
+    SELECT id, block_number, block_timestamp, tx_hash, log_index, pool_address, protocol, sender, recipient, token_in, token_out, amount_in, amount_out, amount_in_decimal, amount_out_decimal, amount_usd, finality_status, created_at FROM swap_events;
+DROP TABLE swap_events;
+ALTER TABLE swap_events_new RENAME TO swap_events;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tx_event ON swap_events (tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_swap_events_block_number ON swap_events (block_number);
+CREATE INDEX IF NOT EXISTS idx_swap_events_pool_address ON swap_events (pool_address);
+CREATE INDEX IF NOT EXISTS idx_swap_events_sender ON swap_events (sender);
+CREATE INDEX IF NOT EXISTS idx_swap_events_recipient ON swap_events (recipient);
+CREATE INDEX IF NOT EXISTS idx_swap_events_tokens ON swap_events (token_in, token_out);
+CREATE INDEX IF NOT EXISTS idx_swap_events_time ON swap_events (block_timestamp);
+
+CREATE TABLE candles_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    market_type VARCHAR(8) NOT NULL,
+    market VARCHAR(85) NOT NULL,
+    period VARCHAR(4) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    open DECIMAL(65,30) NOT NULL,
+    high DECIMAL(65,30) NOT NULL,
+    low DECIMAL(65,30) NOT NULL,
+    close DECIMAL(65,30) NOT NULL,
+    volume0 DECIMAL(65,30) NOT NULL,
+    volume1 DECIMAL(65,30) NOT NULL,
+    trade_count INT NOT NULL,
+    open_block BIGINT NOT NULL,
+    open_log_index INT NOT NULL,
+    close_block BIGINT NOT NULL,
+    close_log_index INT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO candles_new (id, market_type, market, period, bucket_start, open, high, low, close, volume0, volume1, trade_count, open_block, open_log_index, close_block, close_log_index, updated_at)
+    SELECT id, market_type, market, period, bucket_start, open, high, low, close, volume0, volume1, trade_count, open_block, open_log_index, close_block, close_log_index, updated_at FROM candles;
+DROP TABLE candles;
+ALTER TABLE candles_new RENAME TO candles;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_candle_bucket ON candles (market_type, market, period, bucket_start);
+
+CREATE TABLE token_prices_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token VARCHAR(42) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    block_number BIGINT NOT NULL,
+    price_usd DECIMAL(65,30) NOT NULL,
+    route VARCHAR(16) NOT NULL,
+    quote_token VARCHAR(42) NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    liquidity_usd DECIMAL(65,30) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO token_prices_new (id, token, bucket_start, block_number, price_usd, route, quote_token, pool_address, liquidity_usd, updated_at)
+    SELECT id, token, bucket_start, block_number, price_usd, route, quote_token, pool_address, liquidity_usd, updated_at FROM token_prices;
+DROP TABLE token_prices;
+ALTER TABLE token_prices_new RENAME TO token_prices;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_token_bucket ON token_prices (token, bucket_start);
+CREATE INDEX IF NOT EXISTS idx_token_prices_block_number ON token_prices (block_number);
+
+CREATE TABLE pool_snapshots_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pool_address VARCHAR(42) NOT NULL,
+    pool_type VARCHAR(20) NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    finality_status VARCHAR(16) NOT NULL DEFAULT 'safe',
+    block_number BIGINT NOT NULL,
+    block_timestamp BIGINT NOT NULL,
+    log_index INT NOT NULL,
+    source VARCHAR(8) NOT NULL,
+    reserve0 VARCHAR(78) NOT NULL,
+    reserve1 VARCHAR(78) NOT NULL,
+    reserve0_decimal DECIMAL(65,30),
+    reserve1_decimal DECIMAL(65,30),
+    tvl_usd DECIMAL(65,30),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO pool_snapshots_new (id, pool_address, pool_type, version, bucket_start, finality_status, block_number, block_timestamp, log_index, source, reserve0, reserve1, reserve0_decimal, reserve1_decimal, tvl_usd, updated_at)
+    SELECT id, pool_address, pool_type, version, bucket_start, finality_status, block_number, block_timestamp, log_index, source, reserve0, reserve1, reserve0_decimal, reserve1_decimal, tvl_usd, updated_at FROM pool_snapshots;
+DROP TABLE pool_snapshots;
+ALTER TABLE pool_snapshots_new RENAME TO pool_snapshots;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_snapshot_bucket ON pool_snapshots (pool_address, bucket_start, finality_status);
+CREATE INDEX IF NOT EXISTS idx_snapshot_type ON pool_snapshots (pool_type, version, bucket_start);
+CREATE INDEX IF NOT EXISTS idx_pool_snapshots_block_number ON pool_snapshots (block_number);
+
+CREATE TABLE pool_rollups_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    period VARCHAR(4) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    pool_address VARCHAR(42) NOT NULL,
+    pool_type VARCHAR(20) NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    swap_count INT NOT NULL,
+    volume0 DECIMAL(65,30) NOT NULL,
+    volume1 DECIMAL(65,30) NOT NULL,
+    volume_usd DECIMAL(65,30) NOT NULL,
+    unique_traders INT NOT NULL,
+    fees_usd DECIMAL(65,30) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO pool_rollups_new (id, period, bucket_start, pool_address, pool_type, version, swap_count, volume0, volume1, volume_usd, unique_traders, fees_usd, updated_at)
+    SELECT id, period, bucket_start, pool_address, pool_type, version, swap_count, volume0, volume1, volume_usd, unique_traders, fees_usd, updated_at FROM pool_rollups;
+DROP TABLE pool_rollups;
+ALTER TABLE pool_rollups_new RENAME TO pool_rollups;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pool_rollup ON pool_rollups (period, bucket_start, pool_address);
+
+CREATE TABLE token_rollups_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    period VARCHAR(4) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    token VARCHAR(42) NOT NULL,
+    swap_count INT NOT NULL,
+    volume DECIMAL(65,30) NOT NULL,
+    volume_usd DECIMAL(65,30) NOT NULL,
+    unique_traders INT NOT NULL,
+    fees_usd DECIMAL(65,30) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO token_rollups_new (id, period, bucket_start, token, swap_count, volume, volume_usd, unique_traders, fees_usd, updated_at)
+    SELECT id, period, bucket_start, token, swap_count, volume, volume_usd, unique_traders, fees_usd, updated_at FROM token_rollups;
+DROP TABLE token_rollups;
+ALTER TABLE token_rollups_new RENAME TO token_rollups;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_token_rollup ON token_rollups (period, bucket_start, token);
+
+CREATE TABLE pool_type_rollups_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    period VARCHAR(4) NOT NULL,
+    bucket_start BIGINT NOT NULL,
+    pool_type VARCHAR(20) NOT NULL,
+    version VARCHAR(10) NOT NULL,
+    swap_count INT NOT NULL,
+    volume_usd DECIMAL(65,30) NOT NULL,
+    unique_traders INT NOT NULL,
+    fees_usd DECIMAL(65,30) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    protocol VARCHAR(32) NOT NULL DEFAULT 'syncswap'
+);
+INSERT INTO pool_type_rollups_new (id, period, bucket_start, pool_type, version, swap_count, volume_usd, unique_traders, fees_usd, updated_at, protocol)
+    SELECT id, period, bucket_start, pool_type, version, swap_count, volume_usd, unique_traders, fees_usd, updated_at, protocol FROM pool_type_rollups;
+DROP TABLE pool_type_rollups;
+ALTER TABLE pool_type_rollups_new RENAME TO pool_type_rollups;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pool_type_rollup ON pool_type_rollups (period, bucket_start, protocol, pool_type, version);
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"fmt"
+	"zk-sync-go-pool/internal/config"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func postgresDialector(cfg *config.DatabaseConfig) (gorm.Dialector, error) {
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host,
+		cfg.Port,
+		cfg.User,
+		cfg.Password,
+		cfg.Dbname,
+		sslMode,
+	)
+	return postgres.Open(dsn), nil
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"zk-sync-go-pool/internal/config"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+/*
+SQLite驱动(纯Go实现，不需要cgo)，配置 database.driver: sqlite 即可使用
+SQLite没有精确的小数类型，小数列存TEXT(见迁移0004)，SQL里不能对这些列做数值比较和求和
+*/
+
+const defaultSQLitePath = "data/indexer.db"
+
+func sqliteDialector(cfg *config.DatabaseConfig) (gorm.Dialector, error) {
+	path := cfg.Path
+	if path == "" {
+		path = defaultSQLitePath
+	}
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("创建数据库目录失败: %v", err)
+		}
+	}
+	// WAL模式下读不阻塞写；写锁被占用时等待而不是直接报错
+	dsn := path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	return sqlite.Open(dsn), nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+链上的大整数(uint256/int256)，十进制字符串
+列类型按数据库区分：PostgreSQL 用 NUMERIC(78,0)，可以直接在库里做数值计算；
+MySQL/SQLite 没有这么大的整数类型，存 varchar(78)，有符号的字段用 size:79 留出负号
+*/
+type BigInt string
+
+func (BigInt) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "NUMERIC(78,0)"
+	}
+	size := field.Size
+	if size == 0 {
+		size = 78
+	}
+	return fmt.Sprintf("varchar(%d)", size)
+}
+
+func (b BigInt) String() string { return string(b) }
+
+func (b BigInt) Value() (driver.Value, error) { return string(b), nil }
+
+/*
+NUMERIC 列各驱动返回的类型不一样，统一转成十进制字符串
+有的驱动和聚合结果直接给 int64/float64，浮点数按定点格式输出，不带指数
+*/
+func (b *BigInt) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*b = ""
+	case string:
+		*b = BigInt(v)
+	case []byte:
+		*b = BigInt(v)
+	case int64:
+		*b = BigInt(strconv.FormatInt(v, 10))
+	case uint64:
+		*b = BigInt(strconv.FormatUint(v, 10))
+	case float64:
+		*b = BigInt(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return fmt.Errorf("不支持把%T转成BigInt", value)
+	}
+	return nil
+}
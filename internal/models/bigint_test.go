@@ -0,0 +1,46 @@
+package models
+
+import "testing"
+
+func TestBigIntScan(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		want  BigInt
+	}{
+		{"115792089237316195423570985008687907853269984665640564039457584007913129639935", "115792089237316195423570985008687907853269984665640564039457584007913129639935"},
+		{[]byte("-42"), "-42"},
+		{int64(-7), "-7"},
+		{uint64(18446744073709551615), "18446744073709551615"},
+		{float64(1e20), "100000000000000000000"},
+		{nil, ""},
+	}
+	for _, c := range cases {
+		var b BigInt
+		if err := b.Scan(c.value); err != nil {
+			t.Fatalf("Scan(%#v): %v", c.value, err)
+		}
+		if b != c.want {
+			t.Fatalf("Scan(%#v) = %q, want %q", c.value, b, c.want)
+		}
+	}
+	var b BigInt
+	if err := b.Scan(true); err == nil {
+		t.Fatal("Scan(bool) should fail")
+	}
+}
+
+func TestBigIntValueRoundTrip(t *testing.T) {
+	for _, in := range []BigInt{"0", "-57896044618658097711785492504343953926634992332820282019728792003956564819968", "1000"} {
+		value, err := in.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out BigInt
+		if err := out.Scan(value); err != nil {
+			t.Fatal(err)
+		}
+		if out != in {
+			t.Fatalf("round trip %q -> %q", in, out)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// 定义区块结构体 记录每个已扫描区块的哈希，用于检测链重组
+// logs模式下没有日志的区块不拿区块头，只记扫描记录，Hash/ParentHash为空、Timestamp为0
+
+type Block struct {
+	Number         uint64    `gorm:"primaryKey;autoIncrement:false;type:bigint" json:"number"`
+	Hash           string    `gorm:"type:varchar(66);not null" json:"hash"`
+	ParentHash     string    `gorm:"type:varchar(66);not null" json:"parent_hash"`
+	Timestamp      int64     `gorm:"type:bigint;not null" json:"timestamp"`
+	FinalityStatus string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
+	SwapCount      int       `gorm:"type:int;not null;default:0" json:"swap_count"` // 扫描时解析出的swap数，audit对账用
+	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Block) TableName() string {
+	return "blocks"
+}
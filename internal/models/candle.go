@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// 定义K线结构体，按池子和按交易对(两个代币地址小写排序)分别聚合
+// 价格为 token1/token0（交易对为地址大的代币/地址小的代币），已按代币精度换算
+
+type Candle struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	MarketType    string    `gorm:"type:varchar(8);not null;uniqueIndex:idx_candle_bucket" json:"market_type"` // pool/pair
+	Market        string    `gorm:"type:varchar(85);not null;uniqueIndex:idx_candle_bucket" json:"market"`     // 池子地址 或 token0-token1
+	Period        string    `gorm:"type:varchar(4);not null;uniqueIndex:idx_candle_bucket" json:"period"`      // 1m/5m/1h/1d
+	BucketStart   int64     `gorm:"type:bigint;not null;uniqueIndex:idx_candle_bucket" json:"bucket_start"`    // 周期开始时间(Unix秒)
+	Open          string    `gorm:"type:decimal(65,30);not null" json:"open"`
+	High          string    `gorm:"type:decimal(65,30);not null" json:"high"`
+	Low           string    `gorm:"type:decimal(65,30);not null" json:"low"`
+	Close         string    `gorm:"type:decimal(65,30);not null" json:"close"`
+	Volume0       string    `gorm:"type:decimal(65,30);not null" json:"volume0"` // token0成交量
+	Volume1       string    `gorm:"type:decimal(65,30);not null" json:"volume1"` // token1成交量
+	TradeCount    int       `gorm:"type:int;not null" json:"trade_count"`
+	OpenBlock     uint64    `gorm:"type:bigint;not null" json:"open_block"` // 开盘swap位置，多协程乱序写入时判断先后
+	OpenLogIndex  int       `gorm:"type:int;not null" json:"open_log_index"`
+	CloseBlock    uint64    `gorm:"type:bigint;not null" json:"close_block"` // 收盘swap位置
+	CloseLogIndex int       `gorm:"type:int;not null" json:"close_log_index"`
+	UpdatedAt     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Candle) TableName() string {
+	return "candles"
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// 定义原始事件归档结构体：跟踪的合约(工厂、池子、路由器)发出的每一条日志，保留原始topics/data和按ABI解码的参数
+
+type DecodedEvent struct {
+	ID              int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	BlockNumber     uint64    `gorm:"type:bigint;not null;index" json:"block_number"`
+	BlockTimeStamp  int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
+	TxHash          string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_decoded_tx_event" json:"tx_hash"`
+	LogIndex        int       `gorm:"type:int;not null;uniqueIndex:idx_decoded_tx_event" json:"log_index"`
+	ContractAddress string    `gorm:"type:varchar(42);not null;index:idx_decoded_contract_event" json:"contract_address"`
+	ContractKind    string    `gorm:"type:varchar(10);not null" json:"contract_kind"`                                          // factory/pool/router
+	EventName       string    `gorm:"type:varchar(64);not null;default:'';index:idx_decoded_contract_event" json:"event_name"` // ABI里没有的事件为空
+	Signature       string    `gorm:"type:varchar(255);not null;default:''" json:"signature"`                                  // 如 Swap(address,uint256,uint256,uint256,uint256,address)
+	Topic0          string    `gorm:"type:varchar(66);not null" json:"topic0"`
+	Topics          string    `gorm:"type:text;not null" json:"topics"` // 全部topics，JSON数组
+	Data            string    `gorm:"type:text;not null" json:"data"`   // 原始data，0x开头
+	Args            *string   `gorm:"type:text" json:"args"`            // 解码后的参数JSON，解码失败为NULL
+	FinalityStatus  string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
+	CreatedAt       time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName 指定表名
+func (DecodedEvent) TableName() string {
+	return "decoded_events"
+}
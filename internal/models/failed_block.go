@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// 定义扫描失败区块结构体（死信队列），后台按指数退避重试
+
+type FailedBlock struct {
+	ID          int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	BlockNumber uint64    `gorm:"type:bigint;uniqueIndex;not null" json:"block_number"`
+	Error       string    `gorm:"type:text" json:"error"`
+	Attempts    int       `gorm:"type:int;not null;default:0" json:"attempts"`                // 已重试次数
+	NextRetryAt time.Time `gorm:"type:timestamp;not null;index" json:"next_retry_at"`         // 下次重试时间
+	Status      string    `gorm:"type:varchar(16);not null;default:'retrying'" json:"status"` // retrying/dead
+	CreatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (FailedBlock) TableName() string {
+	return "failed_blocks"
+}
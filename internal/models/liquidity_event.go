@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// 定义流动性事件结构体（classic/stable/aqua 池子的 Mint/Burn）
+
+type LiquidityEvent struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	BlockNumber    uint64    `gorm:"type:bigint;not null;index" json:"block_number"`
+	BlockTimeStamp int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
+	TxHash         string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_liquidity_tx_event" json:"tx_hash"`
+	LogIndex       int       `gorm:"type:int;not null;uniqueIndex:idx_liquidity_tx_event" json:"log_index"`
+	PoolAddress    string    `gorm:"type:varchar(42);not null;index" json:"pool_address"`
+	EventType      string    `gorm:"type:varchar(8);not null" json:"event_type"` // mint/burn
+	Sender         string    `gorm:"type:varchar(42);not null" json:"sender"`
+	Recipient      string    `gorm:"type:varchar(42);not null" json:"recipient"` // LP接收者(mint)或代币接收者(burn)
+	Amount0        BigInt    `gorm:"not null" json:"amount0"`
+	Amount1        BigInt    `gorm:"not null" json:"amount1"`
+	Liquidity      BigInt    `gorm:"not null" json:"liquidity"` // LP数量
+	FinalityStatus string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
+	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName 指定表名
+func (LiquidityEvent) TableName() string {
+	return "liquidity_events"
+}
@@ -8,11 +8,13 @@ type Pool struct {
 	ID             int64      `gorm:"primaryKey;autoIncrement" json:"id"`
 	PoolAddress    string     `gorm:"type:varchar(42);uniqueIndex;not null" json:"pool_address"`
 	FactoryAddress string     `gorm:"type:varchar(42);not null" json:"factory_address"`
+	Protocol       string     `gorm:"type:varchar(32);not null;default:'syncswap';index" json:"protocol"` // 所属DEX协议
 	PoolType       string     `gorm:"type:varchar(20);not null" json:"pool_type"`
 	Version        string     `gorm:"type:varchar(10);not null" json:"version"`
 	Token0         string     `gorm:"type:varchar(42);not null" json:"token0"`
 	Token1         string     `gorm:"type:varchar(42);not null" json:"token1"`
-	FeeRate        *int       `gorm:"type:int" json:"fee_rate"` // 可为空，用指针。因为我们不知道到底还是为空指针还是为0，所以用指针默认为空 兼容性好一些。
+	FeeRate        *int       `gorm:"type:int" json:"fee_rate"`                        // 可为空，用指针。因为我们不知道到底还是为空指针还是为0，所以用指针默认为空 兼容性好一些。单位百万分之一
+	FeeBlock       uint64     `gorm:"type:bigint;not null;default:0" json:"fee_block"` // fee_rate 来自哪个区块，旧区块的费率变化不覆盖新的
 	CreatedAt      time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
 	CreatedTx      string     `gorm:"type:varchar(66);not null" json:"created_tx"`
 	CreatedBlock   uint64     `gorm:"type:bigint;not null" json:"created_block"`
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// 定义池子费率变化历史结构体
+
+/*
+费率来源：
+PoolCreated 创建池子时的费率(事件不带费率的，在创建区块上调用合约读取)
+SetTickSpacingDefaultSwapFee/TickSpacingEnabled range工厂按tickSpacing设置的默认费率，pool_address为空
+FeeAmount range池子每笔swap实际使用的费率，和上一次不同才记录
+Swapped aqua池子每笔swap实际使用的费率，和上一次不同才记录
+Fee aqua池子的手续费数量，只记录amount0/amount1
+*/
+type PoolFeeChange struct {
+	ID              int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	BlockNumber     uint64    `gorm:"type:bigint;not null;index" json:"block_number"`
+	BlockTimeStamp  int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
+	TxHash          string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_fee_tx_event" json:"tx_hash"`
+	LogIndex        int       `gorm:"type:int;not null;uniqueIndex:idx_fee_tx_event" json:"log_index"`
+	ContractAddress string    `gorm:"type:varchar(42);not null" json:"contract_address"`              // 发出事件的合约(池子或工厂)
+	PoolAddress     string    `gorm:"type:varchar(42);not null;default:'';index" json:"pool_address"` // 工厂级别的默认费率为空
+	EventName       string    `gorm:"type:varchar(40);not null" json:"event_name"`
+	TickSpacing     *int      `gorm:"type:int" json:"tick_spacing"` // 只有range有
+	FeeRate         *int      `gorm:"type:int" json:"fee_rate"`     // 百万分之一(1000000 = 100%)
+	Amount0         *BigInt   `json:"amount0"`                      // 只有aqua Fee事件有
+	Amount1         *BigInt   `json:"amount1"`
+	FinalityStatus  string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
+	CreatedAt       time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName 指定表名
+func (PoolFeeChange) TableName() string {
+	return "pool_fee_history"
+}
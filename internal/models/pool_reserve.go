@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// 定义池子储备量结构体，记录每个池子最近一次 Sync 事件的储备量
+// safe 和 pending 各一行，pending 行由 live worker 维护
+
+type PoolReserve struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	PoolAddress    string    `gorm:"type:varchar(42);not null;uniqueIndex:idx_pool_finality" json:"pool_address"`
+	FinalityStatus string    `gorm:"type:varchar(16);not null;default:'safe';uniqueIndex:idx_pool_finality" json:"finality_status"`
+	Reserve0       BigInt    `gorm:"not null" json:"reserve0"`
+	Reserve1       BigInt    `gorm:"not null" json:"reserve1"`
+	BlockNumber    uint64    `gorm:"type:bigint;not null" json:"block_number"` // 最近一次Sync所在区块
+	LogIndex       int       `gorm:"type:int;not null" json:"log_index"`
+	UpdatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (PoolReserve) TableName() string {
+	return "pool_reserves"
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// 定义池子快照结构体，每个池子每个快照周期一行(safe和pending分开)
+// Sync事件实时更新所在周期的快照，快照worker按区块时间的周期在定价过的区块上调用getReserves()补齐没有Sync的池子
+
+type PoolSnapshot struct {
+	ID              int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	PoolAddress     string    `gorm:"type:varchar(42);not null;uniqueIndex:idx_snapshot_bucket" json:"pool_address"`
+	PoolType        string    `gorm:"type:varchar(20);not null;index:idx_snapshot_type" json:"pool_type"` // 冗余池子类型和版本，按类型/版本统计不用联表
+	Version         string    `gorm:"type:varchar(10);not null;index:idx_snapshot_type" json:"version"`
+	BucketStart     int64     `gorm:"type:bigint;not null;uniqueIndex:idx_snapshot_bucket;index:idx_snapshot_type" json:"bucket_start"` // 快照周期开始时间(Unix秒)
+	FinalityStatus  string    `gorm:"type:varchar(16);not null;default:'safe';uniqueIndex:idx_snapshot_bucket" json:"finality_status"`
+	BlockNumber     uint64    `gorm:"type:bigint;not null;index" json:"block_number"`
+	BlockTimeStamp  int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
+	LogIndex        int       `gorm:"type:int;not null" json:"log_index"`     // Sync的日志索引，调用getReserves()的为区块末尾
+	Source          string    `gorm:"type:varchar(8);not null" json:"source"` // sync/call
+	Reserve0        BigInt    `gorm:"not null" json:"reserve0"`
+	Reserve1        BigInt    `gorm:"not null" json:"reserve1"`
+	Reserve0Decimal *string   `gorm:"type:decimal(65,30)" json:"reserve0_decimal"` // 按代币精度换算，精度未知时为NULL
+	Reserve1Decimal *string   `gorm:"type:decimal(65,30)" json:"reserve1_decimal"`
+	TvlUSD          *string   `gorm:"column:tvl_usd;type:decimal(65,30)" json:"tvl_usd"` // 定价进度经过快照区块、两个代币都有价格时才有值，pending快照没有
+	UpdatedAt       time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (PoolSnapshot) TableName() string {
+	return "pool_snapshots"
+}
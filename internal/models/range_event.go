@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// 定义range(v3集中流动性)池子相关结构体
+
+// Swap 事件，保留价格、流动性和tick，用来还原池子价格和活跃流动性
+type RangeSwap struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	BlockNumber    uint64    `gorm:"type:bigint;not null;index;index:idx_range_swap_pool_block,priority:2" json:"block_number"`
+	BlockTimeStamp int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
+	TxHash         string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_range_swap_tx_event" json:"tx_hash"`
+	LogIndex       int       `gorm:"type:int;not null;uniqueIndex:idx_range_swap_tx_event" json:"log_index"`
+	PoolAddress    string    `gorm:"type:varchar(42);not null;index:idx_range_swap_pool_block,priority:1" json:"pool_address"`
+	Protocol       string    `gorm:"type:varchar(32);not null;default:'syncswap'" json:"protocol"` // 冗余池子所属协议
+	Sender         string    `gorm:"type:varchar(42);not null" json:"sender"`
+	Recipient      string    `gorm:"type:varchar(42);not null" json:"recipient"`
+	Amount0        BigInt    `gorm:"size:79;not null" json:"amount0"` // 有符号，正数为池子收入，负数为池子支出
+	Amount1        BigInt    `gorm:"size:79;not null" json:"amount1"`
+	SqrtPriceX96   BigInt    `gorm:"column:sqrt_price_x96;not null" json:"sqrt_price_x96"` // swap后的价格
+	Liquidity      BigInt    `gorm:"not null" json:"liquidity"`                            // swap后的活跃流动性
+	Tick           int       `gorm:"type:int;not null" json:"tick"`                        // swap后的tick
+	FinalityStatus string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
+	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName 指定表名
+func (RangeSwap) TableName() string {
+	return "range_swaps"
+}
+
+// 头寸事件 Mint/Burn/Collect，按 owner + tick区间 还原每个头寸
+type RangePositionEvent struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	BlockNumber    uint64    `gorm:"type:bigint;not null;index" json:"block_number"`
+	BlockTimeStamp int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
+	TxHash         string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_range_position_tx_event" json:"tx_hash"`
+	LogIndex       int       `gorm:"type:int;not null;uniqueIndex:idx_range_position_tx_event" json:"log_index"`
+	PoolAddress    string    `gorm:"type:varchar(42);not null;index:idx_range_position" json:"pool_address"`
+	EventType      string    `gorm:"type:varchar(8);not null" json:"event_type"` // mint/burn/collect
+	Owner          string    `gorm:"type:varchar(42);not null;index:idx_range_position" json:"owner"`
+	Sender         string    `gorm:"type:varchar(42);not null;default:''" json:"sender"`    // 只有mint有
+	Recipient      string    `gorm:"type:varchar(42);not null;default:''" json:"recipient"` // 只有collect有
+	TickLower      int       `gorm:"type:int;not null;index:idx_range_position" json:"tick_lower"`
+	TickUpper      int       `gorm:"type:int;not null;index:idx_range_position" json:"tick_upper"`
+	Liquidity      BigInt    `gorm:"not null" json:"liquidity"` // mint/burn的流动性数量，collect为0
+	Amount0        BigInt    `gorm:"not null" json:"amount0"`
+	Amount1        BigInt    `gorm:"not null" json:"amount1"`
+	FinalityStatus string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
+	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName 指定表名
+func (RangePositionEvent) TableName() string {
+	return "range_position_events"
+}
+
+// 池子级事件 Initialize/CollectFees/Flash/SetFeeProtocol，不同事件用到的字段不同，其余为NULL
+type RangePoolEvent struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	BlockNumber    uint64    `gorm:"type:bigint;not null;index" json:"block_number"`
+	BlockTimeStamp int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
+	TxHash         string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_range_pool_tx_event" json:"tx_hash"`
+	LogIndex       int       `gorm:"type:int;not null;uniqueIndex:idx_range_pool_tx_event" json:"log_index"`
+	PoolAddress    string    `gorm:"type:varchar(42);not null;index" json:"pool_address"`
+	EventType      string    `gorm:"type:varchar(20);not null" json:"event_type"` // initialize/collect_fees/flash/set_fee_protocol
+	Sender         *string   `gorm:"type:varchar(42)" json:"sender"`              // flash
+	Recipient      *string   `gorm:"type:varchar(42)" json:"recipient"`           // collect_fees/flash
+	Amount0        *BigInt   `json:"amount0"`                                     // collect_fees/flash
+	Amount1        *BigInt   `json:"amount1"`                                     // collect_fees/flash
+	Paid0          *BigInt   `json:"paid0"`                                       // flash
+	Paid1          *BigInt   `json:"paid1"`                                       // flash
+	SqrtPriceX96   *BigInt   `gorm:"column:sqrt_price_x96" json:"sqrt_price_x96"` // initialize
+	Tick           *int      `gorm:"type:int" json:"tick"`                        // initialize
+	FeeProtocol0   *int      `gorm:"type:int" json:"fee_protocol0"`               // set_fee_protocol 新值
+	FeeProtocol1   *int      `gorm:"type:int" json:"fee_protocol1"`               // set_fee_protocol 新值
+	FinalityStatus string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
+	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName 指定表名
+func (RangePoolEvent) TableName() string {
+	return "range_pool_events"
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// 定义链重组日志结构体
+
+type ReorgLog struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	DetectedBlock  uint64    `gorm:"type:bigint;not null" json:"detected_block"`  // 发现分叉的区块高度
+	CommonAncestor uint64    `gorm:"type:bigint;not null" json:"common_ancestor"` // 回滚到的公共祖先
+	Depth          uint64    `gorm:"type:bigint;not null" json:"depth"`           // 重组深度
+	OldHash        string    `gorm:"type:varchar(66);not null" json:"old_hash"`   // 库里记录的哈希
+	NewHash        string    `gorm:"type:varchar(66);not null" json:"new_hash"`   // 链上最新的哈希
+	Worker         string    `gorm:"type:varchar(16);not null" json:"worker"`     // 哪个worker发现的(safe/pending)
+	SwapsDeleted   int64     `gorm:"type:bigint;not null;default:0" json:"swaps_deleted"`
+	PoolsDeleted   int64     `gorm:"type:bigint;not null;default:0" json:"pools_deleted"`
+	BlocksDeleted  int64     `gorm:"type:bigint;not null;default:0" json:"blocks_deleted"`
+	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName 指定表名
+func (ReorgLog) TableName() string {
+	return "reorg_logs"
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// 定义成交汇总结构体，按小时(1h)和天(1d)汇总swap；结束的周期只含safe区块，当前的小时和天还包括pending swap(USD为估算)
+// 成交人数按swap的接收地址去重(经过路由器的swap发送方都是路由器)，接收地址是池子(多跳的中间一跳)或路由器的不计入，手续费按swap所在位置的池子费率(pool_fee_history)估算
+
+// 按池子汇总
+type PoolRollup struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Period        string    `gorm:"type:varchar(4);not null;uniqueIndex:idx_pool_rollup" json:"period"` // 1h/1d
+	BucketStart   int64     `gorm:"type:bigint;not null;uniqueIndex:idx_pool_rollup" json:"bucket_start"`
+	PoolAddress   string    `gorm:"type:varchar(42);not null;uniqueIndex:idx_pool_rollup" json:"pool_address"`
+	PoolType      string    `gorm:"type:varchar(20);not null" json:"pool_type"`
+	Version       string    `gorm:"type:varchar(10);not null" json:"version"`
+	SwapCount     int       `gorm:"type:int;not null" json:"swap_count"`
+	Volume0       string    `gorm:"type:decimal(65,30);not null" json:"volume0"` // token0成交量(买入卖出合计)
+	Volume1       string    `gorm:"type:decimal(65,30);not null" json:"volume1"` // token1成交量
+	VolumeUSD     string    `gorm:"column:volume_usd;type:decimal(65,30);not null" json:"volume_usd"`
+	UniqueTraders int       `gorm:"type:int;not null" json:"unique_traders"`
+	FeesUSD       string    `gorm:"column:fees_usd;type:decimal(65,30);not null" json:"fees_usd"`
+	UpdatedAt     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (PoolRollup) TableName() string {
+	return "pool_rollups"
+}
+
+// 按代币汇总，一笔swap的两个代币各计一次
+type TokenRollup struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Period        string    `gorm:"type:varchar(4);not null;uniqueIndex:idx_token_rollup" json:"period"`
+	BucketStart   int64     `gorm:"type:bigint;not null;uniqueIndex:idx_token_rollup" json:"bucket_start"`
+	Token         string    `gorm:"type:varchar(42);not null;uniqueIndex:idx_token_rollup" json:"token"`
+	SwapCount     int       `gorm:"type:int;not null" json:"swap_count"`
+	Volume        string    `gorm:"type:decimal(65,30);not null" json:"volume"` // 代币成交量(买入卖出合计)
+	VolumeUSD     string    `gorm:"column:volume_usd;type:decimal(65,30);not null" json:"volume_usd"`
+	UniqueTraders int       `gorm:"type:int;not null" json:"unique_traders"`
+	FeesUSD       string    `gorm:"column:fees_usd;type:decimal(65,30);not null" json:"fees_usd"` // 手续费从输入代币收取，只计在输入代币上
+	UpdatedAt     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (TokenRollup) TableName() string {
+	return "token_rollups"
+}
+
+// 按协议+池子类型+版本汇总
+type PoolTypeRollup struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Period        string    `gorm:"type:varchar(4);not null;uniqueIndex:idx_pool_type_rollup" json:"period"`
+	BucketStart   int64     `gorm:"type:bigint;not null;uniqueIndex:idx_pool_type_rollup" json:"bucket_start"`
+	Protocol      string    `gorm:"type:varchar(32);not null;default:'syncswap';uniqueIndex:idx_pool_type_rollup" json:"protocol"`
+	PoolType      string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_pool_type_rollup" json:"pool_type"`
+	Version       string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_pool_type_rollup" json:"version"`
+	SwapCount     int       `gorm:"type:int;not null" json:"swap_count"`
+	VolumeUSD     string    `gorm:"column:volume_usd;type:decimal(65,30);not null" json:"volume_usd"`
+	UniqueTraders int       `gorm:"type:int;not null" json:"unique_traders"`
+	FeesUSD       string    `gorm:"column:fees_usd;type:decimal(65,30);not null" json:"fees_usd"`
+	UpdatedAt     time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (PoolTypeRollup) TableName() string {
+	return "pool_type_rollups"
+}
@@ -5,20 +5,24 @@ import "time"
 // 定义交换事件结构体
 
 type SwapEvent struct {
-	ID             int64     `gorm:"primaryKey;autoIncrement" json:"id"`
-	BlockNumber    uint64    `gorm:"type:bigint;not null" json:"block_number"`
-	BlockTimeStamp int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
-	TxHash         string    `gorm:"type:varchar(66);not null" json:"tx_hash"`
-	LogIndex       int       `gorm:"type:int;not null" json:"log_index"`
-	PoolAddress    string    `gorm:"type:varchar(42);not null" json:"pool_address"`
-	Sender         string    `gorm:"type:varchar(42);not null" json:"sender"`
-	Recipient      string    `gorm:"type:varchar(42);not null" json:"recipient"`
-	TokenIn        string    `gorm:"type:varchar(42);not null" json:"token_in"`
-	TokenOut       string    `gorm:"type:varchar(42);not null" json:"token_out"`
-	AmountIn       string    `gorm:"type:varchar(78);not null" json:"amount_in"`
-	AmountOut      string    `gorm:"type:varchar(78);not null" json:"amount_out"`
-	FinalityStatus string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
-	CreatedAt      time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
+	ID               int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	BlockNumber      uint64    `gorm:"type:bigint;not null" json:"block_number"`
+	BlockTimeStamp   int64     `gorm:"column:block_timestamp;type:bigint;not null" json:"block_timestamp"`
+	TxHash           string    `gorm:"type:varchar(66);not null;uniqueIndex:idx_tx_event" json:"tx_hash"`
+	LogIndex         int       `gorm:"type:int;not null;uniqueIndex:idx_tx_event" json:"log_index"`
+	PoolAddress      string    `gorm:"type:varchar(42);not null" json:"pool_address"`
+	Protocol         string    `gorm:"type:varchar(32);not null;default:'syncswap'" json:"protocol"` // 冗余池子所属协议，按协议统计不用联表
+	Sender           string    `gorm:"type:varchar(42);not null" json:"sender"`
+	Recipient        string    `gorm:"type:varchar(42);not null" json:"recipient"`
+	TokenIn          string    `gorm:"type:varchar(42);not null" json:"token_in"`
+	TokenOut         string    `gorm:"type:varchar(42);not null" json:"token_out"`
+	AmountIn         BigInt    `gorm:"not null" json:"amount_in"`
+	AmountOut        BigInt    `gorm:"not null" json:"amount_out"`
+	AmountInDecimal  *string   `gorm:"type:decimal(65,30)" json:"amount_in_decimal"`            // 按代币精度换算后的数量，精度未知时为NULL，之后回填
+	AmountOutDecimal *string   `gorm:"type:decimal(65,30)" json:"amount_out_decimal"`           // 同上
+	AmountUSD        *string   `gorm:"column:amount_usd;type:decimal(65,30)" json:"amount_usd"` // 成交额(USD)，由定价worker在safe区块上回填
+	FinalityStatus   string    `gorm:"type:varchar(16);not null;default:'safe'" json:"finality_status"`
+	CreatedAt        time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
 }
 
 // TableName 指定表名
@@ -9,7 +9,7 @@ type Token struct {
 	Address   string     `gorm:"type:varchar(42);uniqueIndex;not null" json:"address"`
 	Symbol    string     `gorm:"type:varchar(20);not null" json:"symbol"`
 	Name      string     `gorm:"type:varchar(100);not null" json:"name"`
-	Decimals  int        `gorm:"type:tinyint;not null" json:"decimals"`
+	Decimals  int        `gorm:"type:smallint;not null" json:"decimals"`
 	CreatedAt time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
 	DeletedAt *time.Time `gorm:"type:timestamp" json:"deleted_at"` // 软删除字段，指针类型可为NULL
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// 定义代币USD价格结构体，每个代币每分钟(1m K线周期)一行
+// 价格通过流动性最深的池子路由到稳定币(必要时经过WETH)得到
+
+type TokenPrice struct {
+	ID           int64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Token        string    `gorm:"type:varchar(42);not null;uniqueIndex:idx_token_bucket" json:"token"`
+	BucketStart  int64     `gorm:"type:bigint;not null;uniqueIndex:idx_token_bucket" json:"bucket_start"` // 分钟开始时间(Unix秒)
+	BlockNumber  uint64    `gorm:"type:bigint;not null;index" json:"block_number"`                        // 该分钟内最后一笔参与定价的swap所在区块
+	PriceUSD     string    `gorm:"column:price_usd;type:decimal(65,30);not null" json:"price_usd"`
+	Route        string    `gorm:"type:varchar(16);not null" json:"route"`        // stable/direct/weth
+	QuoteToken   string    `gorm:"type:varchar(42);not null" json:"quote_token"`  // 定价池子的另一个代币(稳定币或WETH)，稳定币自身为空
+	PoolAddress  string    `gorm:"type:varchar(42);not null" json:"pool_address"` // 定价池子，稳定币自身为空
+	LiquidityUSD string    `gorm:"column:liquidity_usd;type:decimal(65,30);not null" json:"liquidity_usd"`
+	UpdatedAt    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (TokenPrice) TableName() string {
+	return "token_prices"
+}
@@ -0,0 +1,546 @@
+package repository
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const batchInsertSize = 500 // 多行INSERT每条语句最多的行数
+
+/*
+一个区块(或一段区块)要写入的所有行
+扫描时处理器把解析结果攒在这里，SaveBatch 在一个事务里用多行 upsert(MySQL的 INSERT ... ON DUPLICATE KEY UPDATE)写入，
+blocks表的区块记录、扫描进度和新插入swap的K线增量也在同一个事务里提交，进程中途退出不会留下只写了一半的区块
+*/
+type Batch struct {
+	pools           []*models.Pool
+	swaps           []*models.SwapEvent
+	rangeSwaps      []*models.RangeSwap
+	liquidityEvents []*models.LiquidityEvent
+	reserves        []*models.PoolReserve
+	snapshots       []*models.PoolSnapshot
+	rangePositions  []*models.RangePositionEvent
+	rangePoolEvents []*models.RangePoolEvent
+	feeChanges      []*models.PoolFeeChange
+	decodedEvents   []*models.DecodedEvent
+	mappedEvents    map[string][]map[string]interface{} // 事件映射表 -> 行
+	blocks          []*models.Block
+	progress        map[string]uint64 // 任务名 -> 进度
+	advances        []progressAdvance
+	candles         CandleMerger
+}
+
+/*
+新插入的swap怎么计入K线，由扫描器提供
+SwapCandles 把一笔swap转成各市场、各周期只有这一笔成交的K线(市场、周期、开始时间已填好)，算不出价格返回nil；
+MergeCandle 把src合并进库里已有的dst
+*/
+type CandleMerger interface {
+	SwapCandles(swap *models.SwapEvent) []*models.Candle
+	MergeCandle(dst, src *models.Candle)
+}
+
+// 接在当前进度后面的一段区块，写入时进度正好停在这段之前才推进
+type progressAdvance struct {
+	task       string
+	from, to   uint64
+	parentHash string // from的父哈希，要和blocks表里 from-1 的哈希一致
+}
+
+func NewBatch() *Batch {
+	return &Batch{mappedEvents: make(map[string][]map[string]interface{}), progress: make(map[string]uint64)}
+}
+
+/*
+地址列统一存小写：链上地址解码出来是checksum格式，种子数据和配置里是小写，
+MySQL默认排序规则不区分大小写看不出来，PostgreSQL/SQLite上按地址关联就对不上了。
+批次里存的是副本，只改副本的地址，调用方手里的结构体(比如poolCache里的池子)不受影响
+*/
+func lowerAddress(address *string) {
+	*address = strings.ToLower(*address)
+}
+
+// 可选的地址列，换成新的字符串，不改原来指向的值
+func lowerOptionalAddress(address **string) {
+	if *address != nil {
+		lower := strings.ToLower(**address)
+		*address = &lower
+	}
+}
+
+func (b *Batch) AddPool(pool *models.Pool) {
+	row := *pool
+	for _, address := range []*string{&row.PoolAddress, &row.FactoryAddress, &row.Token0, &row.Token1} {
+		lowerAddress(address)
+	}
+	b.pools = append(b.pools, &row)
+}
+
+func (b *Batch) AddSwap(swap *models.SwapEvent) {
+	row := *swap
+	for _, address := range []*string{&row.PoolAddress, &row.Sender, &row.Recipient, &row.TokenIn, &row.TokenOut} {
+		lowerAddress(address)
+	}
+	b.swaps = append(b.swaps, &row)
+}
+
+func (b *Batch) AddRangeSwap(swap *models.RangeSwap) {
+	row := *swap
+	for _, address := range []*string{&row.PoolAddress, &row.Sender, &row.Recipient} {
+		lowerAddress(address)
+	}
+	b.rangeSwaps = append(b.rangeSwaps, &row)
+}
+
+func (b *Batch) AddBlock(block *models.Block) { b.blocks = append(b.blocks, block) }
+
+func (b *Batch) AddLiquidityEvent(event *models.LiquidityEvent) {
+	row := *event
+	for _, address := range []*string{&row.PoolAddress, &row.Sender, &row.Recipient} {
+		lowerAddress(address)
+	}
+	b.liquidityEvents = append(b.liquidityEvents, &row)
+}
+
+// 储备量只保留比库里更新的，写入时按位置(区块高度+日志索引)判断
+func (b *Batch) AddPoolReserve(reserve *models.PoolReserve) {
+	row := *reserve
+	lowerAddress(&row.PoolAddress)
+	b.reserves = append(b.reserves, &row)
+}
+
+// 快照同一周期只保留位置最新的，写入时判断
+func (b *Batch) AddPoolSnapshot(snapshot *models.PoolSnapshot) {
+	row := *snapshot
+	lowerAddress(&row.PoolAddress)
+	b.snapshots = append(b.snapshots, &row)
+}
+
+func (b *Batch) AddRangePositionEvent(event *models.RangePositionEvent) {
+	row := *event
+	for _, address := range []*string{&row.PoolAddress, &row.Owner, &row.Sender, &row.Recipient} {
+		lowerAddress(address)
+	}
+	b.rangePositions = append(b.rangePositions, &row)
+}
+
+func (b *Batch) AddRangePoolEvent(event *models.RangePoolEvent) {
+	row := *event
+	lowerAddress(&row.PoolAddress)
+	lowerOptionalAddress(&row.Sender)
+	lowerOptionalAddress(&row.Recipient)
+	b.rangePoolEvents = append(b.rangePoolEvents, &row)
+}
+
+func (b *Batch) AddPoolFeeChange(change *models.PoolFeeChange) {
+	row := *change
+	lowerAddress(&row.ContractAddress)
+	lowerAddress(&row.PoolAddress)
+	b.feeChanges = append(b.feeChanges, &row)
+}
+
+func (b *Batch) AddDecodedEvents(events ...*models.DecodedEvent) {
+	for _, event := range events {
+		row := *event
+		lowerAddress(&row.ContractAddress)
+		b.decodedEvents = append(b.decodedEvents, &row)
+	}
+}
+
+// 事件映射表的一行，表要先用 EnsureEventTable 建好
+func (b *Batch) AddMappedEvent(table string, row map[string]interface{}) {
+	copied := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		copied[column] = value
+	}
+	if address, ok := copied["contract_address"].(string); ok {
+		copied["contract_address"] = strings.ToLower(address)
+	}
+	b.mappedEvents[table] = append(b.mappedEvents[table], copied)
+}
+
+// 和数据一起提交的扫描进度
+func (b *Batch) SetProgress(taskName string, block uint64) { b.progress[taskName] = block }
+
+/*
+进度正好停在 from-1、from 的父哈希和库里 from-1 的区块一致、[0, to] 没有失败区块时，和数据一起推进到 to
+条件不满足(前面的段还没写完、有失败区块)不推进，由调用方之后统一推进
+*/
+func (b *Batch) AdvanceProgress(taskName string, from, to uint64, parentHash string) {
+	b.advances = append(b.advances, progressAdvance{task: taskName, from: from, to: to, parentHash: parentHash})
+}
+
+// 新插入的swap在同一个事务里计入K线
+func (b *Batch) SetCandleMerger(merger CandleMerger) { b.candles = merger }
+
+func (b *Batch) HasSwaps() bool { return len(b.swaps) > 0 }
+
+// 把另一个批次的行追加进来(按区块顺序合并)
+func (b *Batch) Merge(other *Batch) {
+	b.pools = append(b.pools, other.pools...)
+	b.swaps = append(b.swaps, other.swaps...)
+	b.rangeSwaps = append(b.rangeSwaps, other.rangeSwaps...)
+	b.liquidityEvents = append(b.liquidityEvents, other.liquidityEvents...)
+	b.reserves = append(b.reserves, other.reserves...)
+	b.snapshots = append(b.snapshots, other.snapshots...)
+	b.rangePositions = append(b.rangePositions, other.rangePositions...)
+	b.rangePoolEvents = append(b.rangePoolEvents, other.rangePoolEvents...)
+	b.feeChanges = append(b.feeChanges, other.feeChanges...)
+	b.decodedEvents = append(b.decodedEvents, other.decodedEvents...)
+	for table, rows := range other.mappedEvents {
+		b.mappedEvents[table] = append(b.mappedEvents[table], rows...)
+	}
+	b.blocks = append(b.blocks, other.blocks...)
+	for task, block := range other.progress {
+		b.progress[task] = block
+	}
+	b.advances = append(b.advances, other.advances...)
+}
+
+// 按 tx_hash + log_index 唯一的事件表，重复扫描覆盖这些列
+func txEventUpsert(columns ...string) clause.OnConflict {
+	return clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tx_hash"}, {Name: "log_index"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}
+}
+
+var (
+	// 只插入新的swap，已经存在的再用 swapUpsert 覆盖
+	swapInsert = clause.OnConflict{Columns: []clause.Column{{Name: "tx_hash"}, {Name: "log_index"}}, DoNothing: true}
+
+	// range池子事件，重复扫描整行覆盖
+	onTxEventConflict = clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tx_hash"}, {Name: "log_index"}},
+		UpdateAll: true,
+	}
+
+	// 池子已存在不覆盖，费率由费率历史刷新
+	poolUpsert = clause.OnConflict{Columns: []clause.Column{{Name: "pool_address"}}, DoNothing: true}
+
+	liquidityUpsert = txEventUpsert("block_number", "block_timestamp", "pool_address", "event_type", "sender", "recipient",
+		"amount0", "amount1", "liquidity", "finality_status")
+
+	feeChangeUpsert = txEventUpsert("block_number", "block_timestamp", "contract_address", "pool_address", "event_name",
+		"tick_spacing", "fee_rate", "amount0", "amount1", "finality_status")
+
+	decodedEventUpsert = txEventUpsert("block_number", "block_timestamp", "contract_address", "contract_kind", "event_name",
+		"signature", "topic0", "topics", "data", "args", "finality_status")
+
+	blockUpsert = clause.OnConflict{
+		Columns:   []clause.Column{{Name: "number"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hash", "parent_hash", "timestamp", "finality_status", "swap_count", "updated_at"}),
+	}
+)
+
+// 精度未知时不要把已经回填的换算数量覆盖成NULL，amount_usd由定价worker维护
+// 原值带上表名，PostgreSQL里不带会和excluded的同名列冲突
+func (r *Repository) swapUpsert() clause.OnConflict {
+	return clause.OnConflict{
+		Columns: []clause.Column{{Name: "tx_hash"}, {Name: "log_index"}},
+		DoUpdates: append(clause.AssignmentColumns([]string{
+			"block_number", "block_timestamp", "pool_address", "protocol", "sender", "recipient",
+			"token_in", "token_out", "amount_in", "amount_out", "finality_status",
+		}), clause.Assignment{
+			Column: clause.Column{Name: "amount_in_decimal"},
+			Value:  gorm.Expr(fmt.Sprintf("COALESCE(%s, swap_events.amount_in_decimal)", r.insertedValue("amount_in_decimal"))),
+		}, clause.Assignment{
+			Column: clause.Column{Name: "amount_out_decimal"},
+			Value:  gorm.Expr(fmt.Sprintf("COALESCE(%s, swap_events.amount_out_decimal)", r.insertedValue("amount_out_decimal"))),
+		}),
+	}
+}
+
+/*
+在一个事务里写入批次的所有行，返回新插入的swap(已经存在的是重复扫描，不能再计入K线)
+设置了 CandleMerger 时新插入的swap在同一个事务里计入K线；任何一张表失败整个批次回滚
+*/
+func (r *Repository) SaveBatch(b *Batch) ([]*models.SwapEvent, error) {
+	var inserted []*models.SwapEvent
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := createInBatches(tx, poolUpsert, b.pools); err != nil {
+			return fmt.Errorf("保存池子数据失败: %v", err)
+		}
+		if err := createInBatches(tx, feeChangeUpsert, b.feeChanges); err != nil {
+			return fmt.Errorf("保存费率变化失败: %v", err)
+		}
+		if pools := feeChangedPools(b.feeChanges); len(pools) > 0 {
+			if _, err := refreshPoolFees(tx, "pool_address IN ?", pools); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if inserted, err = r.saveSwaps(tx, b.swaps); err != nil {
+			return fmt.Errorf("保存swap事件失败: %v", err)
+		}
+		if b.candles != nil {
+			if err := mergeCandles(tx, b.candles, inserted); err != nil {
+				return err
+			}
+		}
+
+		if err := createInBatches(tx, onTxEventConflict, b.rangeSwaps); err != nil {
+			return fmt.Errorf("保存range Swap失败: %v", err)
+		}
+		if err := createInBatches(tx, liquidityUpsert, b.liquidityEvents); err != nil {
+			return fmt.Errorf("保存流动性事件失败: %v", err)
+		}
+		for _, reserve := range latestReserves(b.reserves) {
+			if err := savePoolReserve(tx, reserve); err != nil {
+				return err
+			}
+		}
+		for _, snapshot := range latestSnapshots(b.snapshots) {
+			if err := savePoolSnapshot(tx, snapshot); err != nil {
+				return err
+			}
+		}
+		if err := createInBatches(tx, onTxEventConflict, b.rangePositions); err != nil {
+			return fmt.Errorf("保存range头寸事件失败: %v", err)
+		}
+		if err := createInBatches(tx, onTxEventConflict, b.rangePoolEvents); err != nil {
+			return fmt.Errorf("保存range池子事件失败: %v", err)
+		}
+		if err := createInBatches(tx, decodedEventUpsert, b.decodedEvents); err != nil {
+			return fmt.Errorf("归档原始事件失败: %v", err)
+		}
+		if err := saveMappedEvents(tx, b.mappedEvents); err != nil {
+			return err
+		}
+		if err := createInBatches(tx, blockUpsert, b.blocks); err != nil {
+			return fmt.Errorf("保存区块失败: %v", err)
+		}
+		for task, block := range b.progress {
+			if err := updateScanProgress(tx, task, block); err != nil {
+				return err
+			}
+		}
+		for _, advance := range b.advances {
+			if err := advanceScanProgress(tx, advance); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// 多行 upsert，rows是模型切片
+func createInBatches(tx *gorm.DB, upsert clause.OnConflict, rows interface{}) error {
+	if reflect.ValueOf(rows).Len() == 0 {
+		return nil
+	}
+	return tx.Clauses(upsert).CreateInBatches(rows, batchInsertSize).Error
+}
+
+/*
+写入swap，返回新插入的(按实际插入的行判断，不是写入前查询，两个worker同时写同一个区块也只有一个算新插入)
+每组先 INSERT ... ON CONFLICT DO NOTHING 多行插入，影响行数等于组大小(全是新的)或者0(全是重复扫描)时直接确定；
+部分插入的组回滚到保存点后逐行插入判断。已经存在的行最后用 swapUpsert 覆盖
+*/
+func (r *Repository) saveSwaps(tx *gorm.DB, swaps []*models.SwapEvent) ([]*models.SwapEvent, error) {
+	var inserted, existing []*models.SwapEvent
+	for start := 0; start < len(swaps); start += batchInsertSize {
+		end := start + batchInsertSize
+		if end > len(swaps) {
+			end = len(swaps)
+		}
+		chunk := swaps[start:end]
+		resetSwapIDs(chunk) // 返回的自增ID在插入部分跳过时对不上行，不用
+		if err := tx.SavePoint("swaps").Error; err != nil {
+			return nil, err
+		}
+		result := tx.Clauses(swapInsert).Create(&chunk)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		switch result.RowsAffected {
+		case int64(len(chunk)):
+			inserted = append(inserted, chunk...)
+			continue
+		case 0:
+			existing = append(existing, chunk...)
+			continue
+		}
+		if err := tx.RollbackTo("swaps").Error; err != nil {
+			return nil, err
+		}
+		for _, swap := range chunk {
+			swap.ID = 0
+			result := tx.Clauses(swapInsert).Create(swap)
+			if result.Error != nil {
+				return nil, result.Error
+			}
+			if result.RowsAffected == 1 {
+				inserted = append(inserted, swap)
+			} else {
+				existing = append(existing, swap)
+			}
+		}
+	}
+	resetSwapIDs(existing)
+	if err := createInBatches(tx, r.swapUpsert(), existing); err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+func resetSwapIDs(swaps []*models.SwapEvent) {
+	for _, swap := range swaps {
+		swap.ID = 0
+	}
+}
+
+/*
+新插入的swap计入K线：同一根K线先在内存里合并，再和库里已有的合并后整根写回
+调用方要保证同一时间只有一个事务在合并K线(扫描器的 candleMu)
+*/
+func mergeCandles(tx *gorm.DB, merger CandleMerger, swaps []*models.SwapEvent) error {
+	merged := make(map[string]*models.Candle)
+	var candles []*models.Candle
+	for _, swap := range swaps {
+		for _, trade := range merger.SwapCandles(swap) {
+			key := fmt.Sprintf("%s:%s:%s:%d", trade.MarketType, trade.Market, trade.Period, trade.BucketStart)
+			if candle, ok := merged[key]; ok {
+				merger.MergeCandle(candle, trade)
+				continue
+			}
+			var stored []*models.Candle
+			err := tx.Where("market_type = ? AND market = ? AND period = ? AND bucket_start = ?",
+				trade.MarketType, trade.Market, trade.Period, trade.BucketStart).Limit(1).Find(&stored).Error
+			if err != nil {
+				return fmt.Errorf("获取K线失败: %v", err)
+			}
+			candle := trade
+			if len(stored) > 0 {
+				candle = stored[0]
+				merger.MergeCandle(candle, trade)
+			}
+			candle.ID = 0
+			merged[key] = candle
+			candles = append(candles, candle)
+		}
+	}
+	if err := createInBatches(tx, candleConflict, candles); err != nil {
+		return fmt.Errorf("保存K线失败: %v", err)
+	}
+	return nil
+}
+
+// 条件满足时推进进度，见 AdvanceProgress
+func advanceScanProgress(tx *gorm.DB, advance progressAdvance) error {
+	err := tx.Model(&models.ScanProgress{}).
+		Where("task_name = ? AND last_scanned_block = ?", advance.task, advance.from-1).
+		Where("EXISTS (?)", tx.Model(&models.Block{}).Select("1").
+			Where("number = ? AND hash = ?", advance.from-1, advance.parentHash)).
+		Where("NOT EXISTS (?)", tx.Model(&models.FailedBlock{}).Select("1").
+			Where("block_number <= ?", advance.to)).
+		Update("last_scanned_block", advance.to).Error
+	if err != nil {
+		return fmt.Errorf("推进进度失败: %v", err)
+	}
+	return nil
+}
+
+// 费率历史里带了费率的池子，写入后要刷新它们的当前费率
+func feeChangedPools(changes []*models.PoolFeeChange) []string {
+	seen := make(map[string]bool)
+	var pools []string
+	for _, change := range changes {
+		if change.PoolAddress != "" && change.FeeRate != nil && !seen[change.PoolAddress] {
+			seen[change.PoolAddress] = true
+			pools = append(pools, change.PoolAddress)
+		}
+	}
+	return pools
+}
+
+// 每个池子、每种状态只保留位置最新的储备量
+func latestReserves(reserves []*models.PoolReserve) []*models.PoolReserve {
+	latest := make(map[string]int)
+	var result []*models.PoolReserve
+	for _, reserve := range reserves {
+		key := strings.ToLower(reserve.PoolAddress) + ":" + reserve.FinalityStatus
+		if i, ok := latest[key]; ok {
+			if after(reserve.BlockNumber, reserve.LogIndex, result[i].BlockNumber, result[i].LogIndex) {
+				result[i] = reserve
+			}
+			continue
+		}
+		latest[key] = len(result)
+		result = append(result, reserve)
+	}
+	return result
+}
+
+// 每个池子、每个周期、每种状态只保留位置最新的快照
+func latestSnapshots(snapshots []*models.PoolSnapshot) []*models.PoolSnapshot {
+	latest := make(map[string]int)
+	var result []*models.PoolSnapshot
+	for _, snapshot := range snapshots {
+		key := fmt.Sprintf("%s:%d:%s", strings.ToLower(snapshot.PoolAddress), snapshot.BucketStart, snapshot.FinalityStatus)
+		if i, ok := latest[key]; ok {
+			if after(snapshot.BlockNumber, snapshot.LogIndex, result[i].BlockNumber, result[i].LogIndex) {
+				result[i] = snapshot
+			}
+			continue
+		}
+		latest[key] = len(result)
+		result = append(result, snapshot)
+	}
+	return result
+}
+
+// 位置(区块高度+日志索引) a 是否在 b 之后
+func after(blockA uint64, logA int, blockB uint64, logB int) bool {
+	return blockA > blockB || (blockA == blockB && logA > logB)
+}
+
+// 事件映射表按表、按列分组多行写入
+func saveMappedEvents(tx *gorm.DB, events map[string][]map[string]interface{}) error {
+	tables := make([]string, 0, len(events))
+	for table := range events {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		groups := make(map[string][]map[string]interface{})
+		var signatures []string
+		for _, row := range events[table] {
+			columns := make([]string, 0, len(row))
+			for column := range row {
+				columns = append(columns, column)
+			}
+			sort.Strings(columns)
+			signature := strings.Join(columns, ",")
+			if _, ok := groups[signature]; !ok {
+				signatures = append(signatures, signature)
+			}
+			groups[signature] = append(groups[signature], row)
+		}
+		for _, signature := range signatures {
+			var updates []string
+			for _, column := range strings.Split(signature, ",") {
+				if column != "tx_hash" && column != "log_index" {
+					updates = append(updates, column)
+				}
+			}
+			rows := groups[signature]
+			err := tx.Table(table).Clauses(txEventUpsert(updates...)).CreateInBatches(&rows, batchInsertSize).Error
+			if err != nil {
+				return fmt.Errorf("保存事件到%s失败: %v", table, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"testing"
+	"zk-sync-go-pool/internal/models"
+)
+
+// 每笔swap计一根成交数为1的K线
+type countingMerger struct{}
+
+func (countingMerger) SwapCandles(swap *models.SwapEvent) []*models.Candle {
+	return []*models.Candle{{MarketType: "pool", Market: swap.PoolAddress, Period: "1m", BucketStart: 0,
+		Open: "1", High: "1", Low: "1", Close: "1", Volume0: "1", Volume1: "1", TradeCount: 1}}
+}
+
+func (countingMerger) MergeCandle(dst, src *models.Candle) { dst.TradeCount += src.TradeCount }
+
+func TestSaveBatchIsIdempotent(t *testing.T) {
+	r := newTestRepository(t)
+	save := func(swaps ...*models.SwapEvent) int {
+		t.Helper()
+		batch := NewBatch()
+		for _, swap := range swaps {
+			batch.AddSwap(swap)
+		}
+		batch.SetCandleMerger(countingMerger{})
+		inserted, err := r.SaveBatch(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(inserted)
+	}
+	tradeCount := func() int {
+		t.Helper()
+		candle, err := r.GetCandle("pool", "0x00000000000000000000000000000000000000a1", "1m", 0)
+		if err != nil || candle == nil {
+			t.Fatalf("candle = %v, %v", candle, err)
+		}
+		return candle.TradeCount
+	}
+
+	if n := save(testSwap(100, "0xa", 0, "pending"), testSwap(100, "0xa", 1, "pending")); n != 2 {
+		t.Fatalf("first save inserted %d swaps", n)
+	}
+	// 重复扫描：不算新插入，K线不重复计入，但状态被覆盖
+	if n := save(testSwap(100, "0xa", 0, "safe"), testSwap(100, "0xa", 1, "safe")); n != 0 {
+		t.Fatalf("rescan inserted %d swaps", n)
+	}
+	// 一半重复一半新的：逐行判断
+	if n := save(testSwap(100, "0xa", 1, "safe"), testSwap(101, "0xb", 0, "safe")); n != 1 {
+		t.Fatalf("mixed save inserted %d swaps", n)
+	}
+
+	if got := countRows(t, r, &models.SwapEvent{}); got != 3 {
+		t.Fatalf("swap rows = %d", got)
+	}
+	if got := tradeCount(); got != 3 {
+		t.Fatalf("candle trade count = %d, want 3", got)
+	}
+	var pending int64
+	if err := r.db.Model(&models.SwapEvent{}).Where("finality_status = ?", "pending").Count(&pending).Error; err != nil {
+		t.Fatal(err)
+	}
+	if pending != 0 {
+		t.Fatalf("rescanned swaps should be safe, %d still pending", pending)
+	}
+}
+
+func TestAdvanceProgressOnlyFollowsContiguousBlocks(t *testing.T) {
+	r := newTestRepository(t)
+	if err := r.InitScanProgress("stable_scan", 99); err != nil {
+		t.Fatal(err)
+	}
+	batch := NewBatch()
+	batch.AddBlock(&models.Block{Number: 99, Hash: "0x99", ParentHash: "0x98", Timestamp: 990, FinalityStatus: "safe"})
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	advance := func(from, to uint64, parentHash string) uint64 {
+		t.Helper()
+		batch := NewBatch()
+		for number := from; number <= to; number++ {
+			batch.AddBlock(&models.Block{Number: number, Hash: "0x" + string(rune('a'+number-100)), ParentHash: "0xp",
+				Timestamp: int64(number) * 10, FinalityStatus: "safe"})
+		}
+		batch.AdvanceProgress("stable_scan", from, to, parentHash)
+		if _, err := r.SaveBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+		return progressOf(t, r, "stable_scan")
+	}
+
+	// 后面的段先写完：接不上，不推进
+	if got := advance(102, 103, "0xb"); got != 99 {
+		t.Fatalf("out of order span moved progress to %d", got)
+	}
+	// 父哈希和库里的区块对不上：不推进
+	if got := advance(100, 101, "0xother"); got != 99 {
+		t.Fatalf("mismatched parent moved progress to %d", got)
+	}
+	if got := advance(100, 101, "0x99"); got != 101 {
+		t.Fatalf("contiguous span progress = %d, want 101", got)
+	}
+	// 有失败区块：不推进
+	if err := r.SaveFailedBlock(103, errTest, testTime); err != nil {
+		t.Fatal(err)
+	}
+	if got := advance(102, 103, "0xb"); got != 101 {
+		t.Fatalf("span with failed block moved progress to %d", got)
+	}
+}
+
+func TestBatchLowercasesCopiesNotCallerStructs(t *testing.T) {
+	r := newTestRepository(t)
+	pool := testPool("0x00000000000000000000000000000000000000A1", 90)
+	swap := testSwap(100, "0xa", 0, "safe")
+	swap.PoolAddress = "0x00000000000000000000000000000000000000A1"
+	recipient := "0x00000000000000000000000000000000000000B2"
+	event := &models.RangePoolEvent{BlockNumber: 100, TxHash: "0xb", PoolAddress: pool.PoolAddress, EventType: "collect_fees",
+		Recipient: &recipient, FinalityStatus: "safe"}
+	row := map[string]interface{}{"contract_address": pool.PoolAddress}
+
+	batch := NewBatch()
+	batch.AddPool(pool)
+	batch.AddSwap(swap)
+	batch.AddRangePoolEvent(event)
+	NewBatch().AddMappedEvent("transfers", row)
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if pool.PoolAddress != "0x00000000000000000000000000000000000000A1" || swap.PoolAddress != pool.PoolAddress ||
+		recipient != "0x00000000000000000000000000000000000000B2" || row["contract_address"] != pool.PoolAddress {
+		t.Fatal("batch changed the caller's structs")
+	}
+	stored, err := r.GetPoolByAddress("0x00000000000000000000000000000000000000a1")
+	if err != nil || stored == nil {
+		t.Fatalf("pool not stored in lowercase: %v", err)
+	}
+	var storedRecipient string
+	if err := r.db.Model(&models.RangePoolEvent{}).Select("recipient").Scan(&storedRecipient).Error; err != nil {
+		t.Fatal(err)
+	}
+	if storedRecipient != "0x00000000000000000000000000000000000000b2" {
+		t.Fatalf("recipient stored as %s", storedRecipient)
+	}
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// 回滚结果，记录每张表删除的行数
+type RollbackResult struct {
+	SwapsDeleted     int64
+	PoolsDeleted     int64
+	BlocksDeleted    int64
+	PoolFeesRestored int64 // 费率改回分叉前的池子数
+	ReservesRestored int64 // 储备量改回分叉前的池子数
+}
+
+// 获取指定高度的区块记录，不存在返回 nil, nil
+func (r *Repository) GetBlock(number uint64) (*models.Block, error) {
+	var block models.Block
+	result := r.db.Where("number = ?", number).First(&block)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取区块记录失败: %v", result.Error)
+	}
+	return &block, nil
+}
+
+// 获取 [from, to] 范围内的区块记录，按高度升序
+func (r *Repository) GetBlocks(from, to uint64) ([]*models.Block, error) {
+	var blocks []*models.Block
+	result := r.db.Where("number BETWEEN ? AND ?", from, to).Order("number ASC").Find(&blocks)
+	if result.Error != nil {
+		return nil, fmt.Errorf("获取区块记录失败: %v", result.Error)
+	}
+	return blocks, nil
+}
+
+// 不超过 upto 的最后一个记了哈希的区块，没有时返回nil（logs模式没日志的区块只有扫描记录，没有哈希）
+func (r *Repository) GetLastHashedBlock(upto uint64) (*models.Block, error) {
+	var block models.Block
+	result := r.db.Where("number <= ? AND hash <> ?", upto, "").Order("number DESC").First(&block)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取区块记录失败: %v", result.Error)
+	}
+	return &block, nil
+}
+
+// 获取 after 之后、不超过 upto 的第一个有时间戳的区块，没有返回 nil, nil
+func (r *Repository) GetTimedBlockAfter(after, upto uint64) (*models.Block, error) {
+	return r.findBlock(r.db.Where("number > ? AND number <= ? AND timestamp > 0", after, upto).Order("number ASC"))
+}
+
+// 获取不超过 upto、时间早于 before 的最后一个有时间戳的区块，没有返回 nil, nil
+func (r *Repository) GetTimedBlockBefore(before int64, upto uint64) (*models.Block, error) {
+	return r.findBlock(r.db.Where("number <= ? AND timestamp > 0 AND timestamp < ?", upto, before).Order("number DESC"))
+}
+
+func (r *Repository) findBlock(query *gorm.DB) (*models.Block, error) {
+	var block models.Block
+	if err := query.First(&block).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取区块记录失败: %v", err)
+	}
+	return &block, nil
+}
+
+// 统计 [from, to] 范围内每个区块已入库的swap事件数
+func (r *Repository) CountSwapsByBlock(from, to uint64) (map[uint64]int, error) {
+	var rows []struct {
+		BlockNumber uint64
+		Count       int
+	}
+	err := r.db.Model(&models.SwapEvent{}).
+		Select("block_number, COUNT(*) AS count").
+		Where("block_number BETWEEN ? AND ?", from, to).
+		Group("block_number").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计区块swap数失败: %v", err)
+	}
+	counts := make(map[uint64]int, len(rows))
+	for _, row := range rows {
+		counts[row.BlockNumber] = row.Count
+	}
+	return counts, nil
+}
+
+/*
+链重组回滚：删除公共祖先之后的所有数据，并把扫描进度退回到公共祖先
+一个事务内完成，保证不会只回滚一半
+*/
+func (r *Repository) RollbackTo(ancestor uint64) (*RollbackResult, error) {
+	result := &RollbackResult{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// 储备量只保留最新一行，最新的Sync在分叉上的池子删掉之后按分叉前的快照恢复
+		var reservePools []string
+		if err := tx.Model(&models.PoolReserve{}).
+			Where("block_number > ? AND finality_status = ?", ancestor, "safe").
+			Pluck("pool_address", &reservePools).Error; err != nil {
+			return err
+		}
+		for _, model := range eventModels() {
+			res := tx.Where("block_number > ?", ancestor).Delete(model)
+			if res.Error != nil {
+				return res.Error
+			}
+			if _, ok := model.(*models.SwapEvent); ok {
+				result.SwapsDeleted = res.RowsAffected
+			}
+		}
+		if err := r.deleteFromEventTables(tx, "block_number > ?", ancestor); err != nil {
+			return err
+		}
+
+		res := tx.Where("created_block > ?", ancestor).Delete(&models.Pool{})
+		if res.Error != nil {
+			return res.Error
+		}
+		result.PoolsDeleted = res.RowsAffected
+
+		// 费率历史已经随事件表删掉，池子当前费率改回分叉前的
+		feesRestored, err := restorePoolFees(tx, ancestor)
+		if err != nil {
+			return err
+		}
+		result.PoolFeesRestored = feesRestored
+
+		reservesRestored, err := restorePoolReserves(tx, reservePools)
+		if err != nil {
+			return err
+		}
+		result.ReservesRestored = reservesRestored
+
+		res = tx.Where("number > ?", ancestor).Delete(&models.Block{})
+		if res.Error != nil {
+			return res.Error
+		}
+		result.BlocksDeleted = res.RowsAffected
+
+		// 分叉上算出的价格删掉，定价进度随下面的scan_progress一起回退后重新计算
+		if err := tx.Where("block_number > ?", ancestor).Delete(&models.TokenPrice{}).Error; err != nil {
+			return err
+		}
+
+		// 分叉上的失败区块随游标回退会重新扫描
+		if err := tx.Where("block_number > ?", ancestor).Delete(&models.FailedBlock{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.ScanProgress{}).
+			Where("last_scanned_block > ?", ancestor).
+			Update("last_scanned_block", ancestor).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("回滚到区块%d失败: %v", ancestor, err)
+	}
+	return result, nil
+}
+
+// 保存链重组日志
+func (r *Repository) SaveReorgLog(reorgLog *models.ReorgLog) error {
+	if err := r.db.Create(reorgLog).Error; err != nil {
+		return fmt.Errorf("保存重组日志失败: %v", err)
+	}
+	return nil
+}
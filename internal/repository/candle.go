@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var candleConflict = clause.OnConflict{
+	Columns: []clause.Column{{Name: "market_type"}, {Name: "market"}, {Name: "period"}, {Name: "bucket_start"}},
+	DoUpdates: clause.AssignmentColumns([]string{
+		"open", "high", "low", "close", "volume0", "volume1", "trade_count",
+		"open_block", "open_log_index", "close_block", "close_log_index", "updated_at",
+	}),
+}
+
+// 获取一根K线，不存在返回 nil, nil
+func (r *Repository) GetCandle(marketType, market, period string, bucketStart int64) (*models.Candle, error) {
+	var candle models.Candle
+	result := r.db.Where("market_type = ? AND market = ? AND period = ? AND bucket_start = ?",
+		marketType, market, period, bucketStart).First(&candle)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取K线失败: %v", result.Error)
+	}
+	return &candle, nil
+}
+
+// 批量保存K线，已存在则覆盖
+func (r *Repository) SaveCandles(candles []*models.Candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+	if err := r.db.Clauses(candleConflict).CreateInBatches(candles, 500).Error; err != nil {
+		return fmt.Errorf("保存K线失败: %v", err)
+	}
+	return nil
+}
+
+// 删除某个市场某个周期从 bucketFrom 开始的K线（重建前清理）
+func (r *Repository) DeleteCandlesFrom(marketType, market, period string, bucketFrom int64) error {
+	err := r.db.Where("market_type = ? AND market = ? AND period = ? AND bucket_start >= ?",
+		marketType, market, period, bucketFrom).Delete(&models.Candle{}).Error
+	if err != nil {
+		return fmt.Errorf("删除K线失败: %v", err)
+	}
+	return nil
+}
+
+// 按周期开始时间顺序分页获取K线（用小周期合成大周期）
+func (r *Repository) GetCandlesAfter(marketType, market, period string, afterBucket int64, limit int) ([]*models.Candle, error) {
+	var candles []*models.Candle
+	err := r.db.Where("market_type = ? AND market = ? AND period = ? AND bucket_start > ?",
+		marketType, market, period, afterBucket).
+		Order("bucket_start ASC").Limit(limit).Find(&candles).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取K线失败: %v", err)
+	}
+	return candles, nil
+}
+
+/*
+按链上顺序(区块高度+日志索引)分页获取一组池子从某个时间开始的swap
+after 为上一页最后一条的位置
+*/
+func (r *Repository) GetSwapsForCandles(pools []string, fromTimestamp int64, afterBlock uint64, afterLogIndex int, limit int) ([]*models.SwapEvent, error) {
+	var swaps []*models.SwapEvent
+	err := r.db.
+		Where("pool_address IN ? AND block_timestamp >= ?", pools, fromTimestamp).
+		Where("block_number > ? OR (block_number = ? AND log_index > ?)", afterBlock, afterBlock, afterLogIndex).
+		Order("block_number ASC, log_index ASC").Limit(limit).Find(&swaps).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取swap失败: %v", err)
+	}
+	return swaps, nil
+}
+
+/*
+统计区块 block 之后的swap涉及哪些池子、最早的时间，用于删除之后重建K线
+finality 为空表示不区分状态
+*/
+func (r *Repository) GetSwapScopeAfter(block uint64, finality string) ([]string, int64, error) {
+	query := r.db.Model(&models.SwapEvent{}).Where("block_number > ?", block)
+	if finality != "" {
+		query = query.Where("finality_status = ?", finality)
+	}
+	var rows []struct {
+		PoolAddress string
+		MinTs       int64
+	}
+	err := query.Select("pool_address, MIN(block_timestamp) AS min_ts").Group("pool_address").Scan(&rows).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("统计swap范围失败: %v", err)
+	}
+	var pools []string
+	var minTs int64
+	for i, row := range rows {
+		pools = append(pools, row.PoolAddress)
+		if i == 0 || row.MinTs < minTs {
+			minTs = row.MinTs
+		}
+	}
+	return pools, minTs, nil
+}
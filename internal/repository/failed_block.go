@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+扫描失败的区块写入死信队列，已存在则只更新错误信息，重试次数保持不变
+已经标记为dead的区块保持dead，不重新开始重试(等待人工处理)
+*/
+func (r *Repository) SaveFailedBlock(blockNum uint64, scanErr error, nextRetryAt time.Time) error {
+	failed := &models.FailedBlock{
+		BlockNumber: blockNum,
+		Error:       scanErr.Error(),
+		NextRetryAt: nextRetryAt,
+		Status:      "retrying",
+	}
+	// MySQL按顺序赋值，next_retry_at 要在 status 之前，判断的还是原来的状态
+	keepDead := func(column string) clause.Assignment {
+		return clause.Assignment{
+			Column: clause.Column{Name: column},
+			Value: gorm.Expr(fmt.Sprintf("CASE WHEN failed_blocks.status = 'dead' THEN failed_blocks.%s ELSE %s END",
+				column, r.insertedValue(column))),
+		}
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "block_number"}},
+		DoUpdates: append(clause.AssignmentColumns([]string{"error", "updated_at"}),
+			keepDead("next_retry_at"), keepDead("status")),
+	}).Create(failed).Error
+	if err != nil {
+		return fmt.Errorf("保存失败区块%d失败: %v", blockNum, err)
+	}
+	return nil
+}
+
+// 获取到期需要重试的失败区块
+func (r *Repository) GetDueFailedBlocks(now time.Time, limit int) ([]*models.FailedBlock, error) {
+	var blocks []*models.FailedBlock
+	result := r.db.Where("status = ? AND next_retry_at <= ?", "retrying", now).
+		Order("block_number ASC").Limit(limit).Find(&blocks)
+	if result.Error != nil {
+		return nil, fmt.Errorf("获取待重试区块失败: %v", result.Error)
+	}
+	return blocks, nil
+}
+
+// 重试失败，更新次数和下次重试时间；超过最大次数标记为dead，等待人工处理
+func (r *Repository) RescheduleFailedBlock(blockNum uint64, scanErr error, attempts int, nextRetryAt time.Time, dead bool) error {
+	status := "retrying"
+	if dead {
+		status = "dead"
+	}
+	err := r.db.Model(&models.FailedBlock{}).
+		Where("block_number = ?", blockNum).
+		Updates(map[string]interface{}{
+			"error":         scanErr.Error(),
+			"attempts":      attempts,
+			"next_retry_at": nextRetryAt,
+			"status":        status,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("更新失败区块%d失败: %v", blockNum, err)
+	}
+	return nil
+}
+
+// 重试成功，移出死信队列
+func (r *Repository) ResolveFailedBlock(blockNum uint64) error {
+	if err := r.db.Where("block_number = ?", blockNum).Delete(&models.FailedBlock{}).Error; err != nil {
+		return fmt.Errorf("移除失败区块%d失败: %v", blockNum, err)
+	}
+	return nil
+}
+
+// 死信队列中最小的区块高度（包括dead），没有返回 0, false
+func (r *Repository) GetMinFailedBlock() (uint64, bool, error) {
+	var minBlock *uint64
+	err := r.db.Model(&models.FailedBlock{}).Select("MIN(block_number)").Scan(&minBlock).Error
+	if err != nil {
+		return 0, false, fmt.Errorf("获取最小失败区块失败: %v", err)
+	}
+	if minBlock == nil {
+		return 0, false, nil
+	}
+	return *minBlock, true, nil
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"testing"
+	"time"
+	"zk-sync-go-pool/internal/models"
+)
+
+func TestSaveFailedBlockKeepsDeadRows(t *testing.T) {
+	r := newTestRepository(t)
+	if err := r.SaveFailedBlock(100, errTest, testTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RescheduleFailedBlock(100, errTest, 10, testTime, true); err != nil {
+		t.Fatal(err)
+	}
+	// 同一个区块再次扫描失败
+	if err := r.SaveFailedBlock(100, errTest, testTime.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed models.FailedBlock
+	if err := r.db.Where("block_number = ?", 100).First(&failed).Error; err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != "dead" || failed.Attempts != 10 || !failed.NextRetryAt.Equal(testTime) {
+		t.Fatalf("dead row was reset: status=%s attempts=%d next_retry_at=%v", failed.Status, failed.Attempts, failed.NextRetryAt)
+	}
+
+	// 还在重试中的区块更新下次重试时间
+	if err := r.SaveFailedBlock(101, errTest, testTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SaveFailedBlock(101, errTest, testTime.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	due, err := r.GetDueFailedBlocks(testTime.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("due blocks = %d, want 0 (101 rescheduled, 100 dead)", len(due))
+	}
+	if minBlock, ok, err := r.GetMinFailedBlock(); err != nil || !ok || minBlock != 100 {
+		t.Fatalf("min failed block = %d %v %v, want 100 (dead rows still hold progress)", minBlock, ok, err)
+	}
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+)
+
+/*
+池子当前费率取费率历史里位置最新(区块高度+日志索引)的一条，fee_block为它的区块高度
+多协程扫描不是按区块顺序写入的，每次都从历史里重新取，结果和写入顺序无关；
+没有历史(创建区块上也没读到)的恢复成NULL。scope 限定要刷新的池子
+*/
+func refreshPoolFees(tx *gorm.DB, scope string, args ...interface{}) (int64, error) {
+	latest := tx.Model(&models.PoolFeeChange{}).Select("fee_rate").
+		Where("pool_fee_history.pool_address = pools.pool_address AND fee_rate IS NOT NULL").
+		Order("block_number DESC, log_index DESC").Limit(1)
+	latestBlock := tx.Model(&models.PoolFeeChange{}).Select("COALESCE(MAX(block_number), 0)").
+		Where("pool_fee_history.pool_address = pools.pool_address AND fee_rate IS NOT NULL")
+	res := tx.Model(&models.Pool{}).Where(scope, args...).
+		Updates(map[string]interface{}{"fee_rate": latest, "fee_block": latestBlock})
+	if res.Error != nil {
+		return 0, fmt.Errorf("更新池子费率失败: %v", res.Error)
+	}
+	return res.RowsAffected, nil
+}
+
+// 链重组回滚、pending删除后恢复池子费率：fee_block在删掉的区块上的池子，改回剩下的费率历史里最新的一条
+func restorePoolFees(tx *gorm.DB, ancestor uint64) (int64, error) {
+	return refreshPoolFees(tx, "fee_block > ?", ancestor)
+}
+
+// 池子不超过区块 upto 的费率历史(有费率的)，按链上顺序；pending为false时只取safe的
+func (r *Repository) GetPoolFeeHistory(pool string, upto uint64, pending bool) ([]*models.PoolFeeChange, error) {
+	query := r.db.Where("pool_address = ? AND fee_rate IS NOT NULL AND block_number <= ?", strings.ToLower(pool), upto)
+	if !pending {
+		query = query.Where("finality_status = ?", "safe")
+	}
+	var changes []*models.PoolFeeChange
+	if err := query.Order("block_number ASC, log_index ASC").Find(&changes).Error; err != nil {
+		return nil, fmt.Errorf("获取费率历史失败: %v", err)
+	}
+	return changes, nil
+}
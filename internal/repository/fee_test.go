@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+)
+
+func feeChange(pool string, block uint64, logIndex int, rate int, finality string) *models.PoolFeeChange {
+	return &models.PoolFeeChange{
+		BlockNumber:     block,
+		BlockTimeStamp:  int64(block) * 10,
+		TxHash:          fmt.Sprintf("0xfee%d", block),
+		LogIndex:        logIndex,
+		ContractAddress: pool,
+		PoolAddress:     pool,
+		EventName:       "FeeAmount",
+		FeeRate:         &rate,
+		FinalityStatus:  finality,
+	}
+}
+
+func poolFee(t *testing.T, r *Repository, address string) (int, uint64) {
+	t.Helper()
+	pool, err := r.GetPoolByAddress(address)
+	if err != nil || pool == nil || pool.FeeRate == nil {
+		t.Fatalf("pool fee missing: %v", err)
+	}
+	return *pool.FeeRate, pool.FeeBlock
+}
+
+func TestPoolFeeFollowsLatestHistoryRow(t *testing.T) {
+	r := newTestRepository(t)
+	const address = "0x00000000000000000000000000000000000000a1"
+
+	// 多协程扫描，后面的区块先写入
+	first := NewBatch()
+	first.AddPool(testPool(address, 100))
+	first.AddPoolFeeChange(feeChange(address, 105, 5, 300, "safe"))
+	second := NewBatch()
+	second.AddPoolFeeChange(feeChange(address, 103, 0, 200, "safe"))
+	second.AddPoolFeeChange(feeChange(address, 105, 2, 250, "safe")) // 同一区块更早的日志
+	for _, batch := range []*Batch{first, second} {
+		if _, err := r.SaveBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rate, block := poolFee(t, r, address); rate != 300 || block != 105 {
+		t.Fatalf("pool fee = %d@%d, want 300@105", rate, block)
+	}
+	if n := countRows(t, r, &models.PoolFeeChange{}); n != 3 {
+		t.Fatalf("fee history rows = %d, want 3", n)
+	}
+
+	// pending上的费率删掉后恢复
+	pending := NewBatch()
+	pending.AddPoolFeeChange(feeChange(address, 110, 0, 500, "pending"))
+	if _, err := r.SaveBatch(pending); err != nil {
+		t.Fatal(err)
+	}
+	if rate, _ := poolFee(t, r, address); rate != 500 {
+		t.Fatalf("pool fee with pending change = %d, want 500", rate)
+	}
+	if err := r.DeletePendingAfter(106); err != nil {
+		t.Fatal(err)
+	}
+	if rate, block := poolFee(t, r, address); rate != 300 || block != 105 {
+		t.Fatalf("pool fee after pending delete = %d@%d, want 300@105", rate, block)
+	}
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"fmt"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+更新池子储备量
+多协程扫描不是按区块顺序完成的，只有比库里更新的Sync(区块高度+日志索引)才覆盖。
+先按条件更新，没有更新到再插入；插入撞上唯一索引说明别的协程刚插入，再按条件更新一次。
+*/
+func savePoolReserve(tx *gorm.DB, reserve *models.PoolReserve) error {
+	update := func() (int64, error) {
+		result := tx.Model(&models.PoolReserve{}).
+			Where("pool_address = ? AND finality_status = ?", reserve.PoolAddress, reserve.FinalityStatus).
+			Where("block_number < ? OR (block_number = ? AND log_index < ?)", reserve.BlockNumber, reserve.BlockNumber, reserve.LogIndex).
+			Updates(map[string]interface{}{
+				"reserve0":     reserve.Reserve0,
+				"reserve1":     reserve.Reserve1,
+				"block_number": reserve.BlockNumber,
+				"log_index":    reserve.LogIndex,
+			})
+		return result.RowsAffected, result.Error
+	}
+
+	updated, err := update()
+	if err != nil {
+		return fmt.Errorf("更新池子储备量失败: %v", err)
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reserve)
+	if result.Error != nil {
+		return fmt.Errorf("保存池子储备量失败: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	if _, err := update(); err != nil {
+		return fmt.Errorf("更新池子储备量失败: %v", err)
+	}
+	return nil
+}
+
+/*
+链重组回滚后恢复池子储备量：分叉上的Sync和快照已经删掉，用剩下的safe快照里最新的一条
+(Sync实时更新的快照或者快照worker调用getReserves()读到的)写回pool_reserves。
+快照每个周期只留最后一次，周期内分叉前的Sync被分叉上的覆盖时恢复的是更早的快照，重新扫描遇到下一次Sync会更正。
+池子已经随回滚删掉、或者没有分叉前快照的不恢复。
+*/
+func restorePoolReserves(tx *gorm.DB, pools []string) (int64, error) {
+	var restored int64
+	for _, address := range pools {
+		var snapshot models.PoolSnapshot
+		res := tx.Where("pool_address = ? AND finality_status = ?", address, "safe").
+			Where("EXISTS (?)", tx.Model(&models.Pool{}).Select("1").Where("pool_address = ?", address)).
+			Order("block_number DESC, log_index DESC").Limit(1).Find(&snapshot)
+		if res.Error != nil {
+			return 0, fmt.Errorf("获取池子快照失败: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			continue
+		}
+		err := savePoolReserve(tx, &models.PoolReserve{
+			PoolAddress:    address,
+			FinalityStatus: "safe",
+			Reserve0:       snapshot.Reserve0,
+			Reserve1:       snapshot.Reserve1,
+			BlockNumber:    snapshot.BlockNumber,
+			LogIndex:       snapshot.LogIndex,
+		})
+		if err != nil {
+			return 0, err
+		}
+		restored++
+	}
+	return restored, nil
+}
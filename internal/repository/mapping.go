@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// 事件映射表的列类型
+const (
+	ColumnAddress = "address" // 地址
+	ColumnInteger = "integer" // 不超过32位的整数
+	ColumnNumeric = "numeric" // 更大的整数，十进制字符串
+	ColumnBool    = "bool"
+	ColumnHash    = "hash" // 定长bytes或者indexed动态类型的哈希，0x开头
+	ColumnText    = "text" // string/bytes/数组等，数组和结构体存JSON
+)
+
+// 各数据库都支持的列类型，大整数在PostgreSQL上另外处理(见columnType)
+var columnTypes = map[string]string{
+	ColumnAddress: "VARCHAR(42)",
+	ColumnInteger: "BIGINT",
+	ColumnNumeric: "VARCHAR(79)",
+	ColumnBool:    "BOOLEAN",
+	ColumnHash:    "VARCHAR(66)",
+	ColumnText:    "TEXT",
+}
+
+// 映射列的类型；PostgreSQL的大整数和内置表的金额列一样用NUMERIC(78,0)，可以在库里做数值计算
+func (r *Repository) columnType(kind string) string {
+	if kind == ColumnNumeric && r.dialect == "postgres" {
+		return "NUMERIC(78,0)"
+	}
+	return columnTypes[kind]
+}
+
+// 按数据库的写法给表名、列名加引号，映射的列名可能是 from/to 之类的保留字
+func (r *Repository) quote(name string) string {
+	return r.db.Statement.Quote(name)
+}
+
+// 事件映射表的一列
+type EventColumn struct {
+	Name string
+	Kind string
+}
+
+// 事件映射表的固定列，映射列不能重名
+var EventTableColumns = []string{"block_number", "block_timestamp", "tx_hash", "log_index", "contract_address", "finality_status"}
+
+// 内置表和迁移记录表，事件映射不能用这些表名，否则回滚时会按区块删掉内置数据
+var builtinTables = func() map[string]bool {
+	tables := map[string]bool{"schema_migrations": true}
+	for _, model := range []interface{ TableName() string }{
+		models.Pool{}, models.Token{}, models.SwapEvent{}, models.ScanProgress{}, models.Block{}, models.ReorgLog{},
+		models.FailedBlock{}, models.LiquidityEvent{}, models.PoolReserve{}, models.RangeSwap{},
+		models.RangePositionEvent{}, models.RangePoolEvent{}, models.Candle{}, models.TokenPrice{},
+		models.PoolSnapshot{}, models.PoolRollup{}, models.TokenRollup{}, models.PoolTypeRollup{},
+		models.PoolFeeChange{}, models.DecodedEvent{},
+	} {
+		tables[model.TableName()] = true
+	}
+	return tables
+}()
+
+/*
+确保事件映射表存在：不存在就建表，已存在就补上缺少的映射列
+已有列只改一种情况：PostgreSQL上以前建成VARCHAR的大整数列转成NUMERIC，其他不动
+DDL只用各数据库通用的写法(大整数列除外，见columnType)，主键用 tx_hash + log_index，不依赖自增
+建好后登记为事件表，pending重建和链重组回滚时和其他事件表一起按区块删除
+*/
+func (r *Repository) EnsureEventTable(table string, columns []EventColumn) error {
+	if builtinTables[table] {
+		return fmt.Errorf("表名%s和内置表重名", table)
+	}
+	migrator := r.db.Migrator()
+	if !migrator.HasTable(table) {
+		defs := []string{
+			"block_number BIGINT NOT NULL",
+			"block_timestamp BIGINT NOT NULL",
+			"tx_hash VARCHAR(66) NOT NULL",
+			"log_index INT NOT NULL",
+			"contract_address VARCHAR(42) NOT NULL",
+		}
+		for _, column := range columns {
+			defs = append(defs, fmt.Sprintf("%s %s NULL", r.quote(column.Name), r.columnType(column.Kind)))
+		}
+		defs = append(defs, "finality_status VARCHAR(16) NOT NULL DEFAULT 'safe'", "PRIMARY KEY (tx_hash, log_index)")
+		ddl := fmt.Sprintf("CREATE TABLE %s (\n    %s\n)", r.quote(table), strings.Join(defs, ",\n    "))
+		if err := r.db.Exec(ddl).Error; err != nil {
+			return fmt.Errorf("创建事件表%s失败: %v", table, err)
+		}
+	} else {
+		// 已有的表必须是之前建好的事件表，不能借用别的业务表
+		for _, column := range []string{"tx_hash", "log_index", "contract_address", "finality_status"} {
+			if !migrator.HasColumn(table, column) {
+				return fmt.Errorf("表%s已存在且不是事件映射表(缺少%s列)", table, column)
+			}
+		}
+		for _, column := range columns {
+			if migrator.HasColumn(table, column.Name) {
+				continue
+			}
+			ddl := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s NULL", r.quote(table), r.quote(column.Name), r.columnType(column.Kind))
+			if err := r.db.Exec(ddl).Error; err != nil {
+				return fmt.Errorf("事件表%s添加列%s失败: %v", table, column.Name, err)
+			}
+		}
+		if err := r.convertNumericColumns(table, columns); err != nil {
+			return err
+		}
+	}
+
+	index := fmt.Sprintf("idx_%s_block_number", table)
+	if !migrator.HasIndex(table, index) {
+		if err := r.db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (block_number)", r.quote(index), r.quote(table))).Error; err != nil {
+			return fmt.Errorf("事件表%s创建索引失败: %v", table, err)
+		}
+	}
+	if r.dialect == "postgres" {
+		// 和内置事件表一样，pending的行单独建部分索引
+		ddl := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (block_number) WHERE finality_status = 'pending'",
+			r.quote("idx_"+table+"_pending"), r.quote(table))
+		if err := r.db.Exec(ddl).Error; err != nil {
+			return fmt.Errorf("事件表%s创建索引失败: %v", table, err)
+		}
+	}
+
+	for _, registered := range r.eventTables {
+		if registered == table {
+			return nil
+		}
+	}
+	r.eventTables = append(r.eventTables, table)
+	return nil
+}
+
+// PostgreSQL上把旧版本建成VARCHAR的大整数映射列转成NUMERIC(78,0)
+func (r *Repository) convertNumericColumns(table string, columns []EventColumn) error {
+	if r.dialect != "postgres" {
+		return nil
+	}
+	types, err := r.db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return fmt.Errorf("读取事件表%s的列失败: %v", table, err)
+	}
+	current := make(map[string]string, len(types))
+	for _, columnType := range types {
+		current[columnType.Name()] = strings.ToLower(columnType.DatabaseTypeName())
+	}
+	for _, column := range columns {
+		if column.Kind != ColumnNumeric || current[column.Name] == "numeric" {
+			continue
+		}
+		ddl := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %[2]s TYPE NUMERIC(78,0) USING %[2]s::NUMERIC(78,0)", r.quote(table), r.quote(column.Name))
+		if err := r.db.Exec(ddl).Error; err != nil {
+			return fmt.Errorf("事件表%s的列%s转成NUMERIC失败: %v", table, column.Name, err)
+		}
+	}
+	return nil
+}
+
+// 按条件删除所有事件映射表里的行
+func (r *Repository) deleteFromEventTables(tx *gorm.DB, where string, args ...interface{}) error {
+	for _, table := range r.eventTables {
+		if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", r.quote(table), where), args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEnsureEventTableRejectsBuiltinTables(t *testing.T) {
+	r := newTestRepository(t)
+	columns := []EventColumn{{Name: "sender", Kind: ColumnAddress}}
+	for _, table := range []string{"swap_events", "pools", "schema_migrations"} {
+		if err := r.EnsureEventTable(table, columns); err == nil {
+			t.Errorf("EnsureEventTable(%s) should fail", table)
+		}
+	}
+	if len(r.eventTables) != 0 {
+		t.Fatalf("builtin tables registered as event tables: %v", r.eventTables)
+	}
+
+	// 不是事件表的已有表也不能借用
+	if err := r.db.Exec("CREATE TABLE notes (id INT)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EnsureEventTable("notes", columns); err == nil {
+		t.Fatal("EnsureEventTable(notes) should fail")
+	}
+
+	if err := r.EnsureEventTable("evt_transfers", columns); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EnsureEventTable("evt_transfers", columns); err != nil {
+		t.Fatalf("existing event table should be accepted: %v", err)
+	}
+}
+
+func TestEventTableQuotesReservedWordsAndIndexesBlockNumber(t *testing.T) {
+	r := newTestRepository(t)
+	// ERC-20 Transfer 的字段 from/to 是SQL保留字
+	columns := []EventColumn{{Name: "from", Kind: ColumnAddress}, {Name: "to", Kind: ColumnAddress}, {Name: "value", Kind: ColumnNumeric}}
+	if err := r.EnsureEventTable("transfers", columns); err != nil {
+		t.Fatal(err)
+	}
+	// 已有的表补列时同样加引号
+	if err := r.EnsureEventTable("transfers", append(columns, EventColumn{Name: "order", Kind: ColumnInteger})); err != nil {
+		t.Fatal(err)
+	}
+	if !r.db.Migrator().HasColumn("transfers", "order") {
+		t.Fatal("column order not added")
+	}
+	if !r.db.Migrator().HasIndex("transfers", "idx_transfers_block_number") {
+		t.Fatal("block_number index missing")
+	}
+	// 索引被删掉的旧表，再次确保时补上
+	if err := r.db.Exec(`DROP INDEX idx_transfers_block_number`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EnsureEventTable("transfers", columns); err != nil {
+		t.Fatal(err)
+	}
+	if !r.db.Migrator().HasIndex("transfers", "idx_transfers_block_number") {
+		t.Fatal("block_number index not recreated")
+	}
+
+	batch := NewBatch()
+	for i, finality := range []string{"safe", "pending"} {
+		batch.AddMappedEvent("transfers", map[string]interface{}{
+			"block_number": 100 + i, "block_timestamp": 1700000000 + i, "tx_hash": fmt.Sprintf("0x%d", i), "log_index": 0,
+			"contract_address": "0xc1", "finality_status": finality, "from": "0xa1", "to": "0xa2", "value": "1000", "order": i,
+		})
+	}
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := r.GetSafeMappedEventsBetween("transfers", 0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["from"] != "0xa1" || rows[0]["to"] != "0xa2" {
+		t.Fatalf("safe rows = %v", rows)
+	}
+	if err := r.DeletePendingAfter(100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RollbackTo(99); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	if err := r.db.Table("transfers").Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("%d rows left after rollback", count)
+	}
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"fmt"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 获取 [from, to] 范围内的swap，按链上顺序
+func (r *Repository) GetSwapsBetween(from, to uint64) ([]*models.SwapEvent, error) {
+	var swaps []*models.SwapEvent
+	err := r.db.Where("block_number BETWEEN ? AND ?", from, to).
+		Order("block_number ASC, log_index ASC").Find(&swaps).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取swap失败: %v", err)
+	}
+	return swaps, nil
+}
+
+// 获取某个状态的全部池子储备量
+func (r *Repository) GetPoolReserves(finality string) ([]*models.PoolReserve, error) {
+	var reserves []*models.PoolReserve
+	if err := r.db.Where("finality_status = ?", finality).Find(&reserves).Error; err != nil {
+		return nil, fmt.Errorf("获取池子储备量失败: %v", err)
+	}
+	return reserves, nil
+}
+
+/*
+一组池子在区块 block 之前(不含)的最后一笔能算出价格的swap，同一区块的几笔都返回，按链上顺序
+只看 sinceTimestamp 之后的，更早的成交价已经过期
+*/
+func (r *Repository) GetLastSwapsBefore(pools []string, block uint64, sinceTimestamp int64) ([]*models.SwapEvent, error) {
+	if len(pools) == 0 {
+		return nil, nil
+	}
+	priced := "amount_in_decimal IS NOT NULL AND amount_out_decimal IS NOT NULL"
+	latest := r.db.Model(&models.SwapEvent{}).Select("pool_address, MAX(block_number) AS block_number").
+		Where("pool_address IN ? AND block_number < ? AND block_timestamp >= ?", pools, block, sinceTimestamp).
+		Where(priced).Group("pool_address")
+	var swaps []*models.SwapEvent
+	err := r.db.Joins("JOIN (?) latest ON latest.pool_address = swap_events.pool_address AND latest.block_number = swap_events.block_number", latest).
+		Where(priced).
+		Order("swap_events.block_number ASC, swap_events.log_index ASC").Find(&swaps).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取池子最近成交失败: %v", err)
+	}
+	return swaps, nil
+}
+
+/*
+定价用的safe快照：每个池子 from 之前最近的一个，加上 [from, to] 内的
+快照每个周期一行、周期内被更新的Sync覆盖，所以 from 之前最近的就是最后一个区块高度小于 from 的周期
+*/
+func (r *Repository) GetSnapshotsForPricing(pools []string, from, to uint64) ([]*models.PoolSnapshot, error) {
+	if len(pools) == 0 {
+		return nil, nil
+	}
+	latest := r.db.Model(&models.PoolSnapshot{}).Select("pool_address, MAX(bucket_start) AS bucket_start").
+		Where("pool_address IN ? AND finality_status = ? AND block_number < ?", pools, "safe", from).
+		Group("pool_address")
+	var snapshots []*models.PoolSnapshot
+	err := r.db.Joins("JOIN (?) latest ON latest.pool_address = pool_snapshots.pool_address AND latest.bucket_start = pool_snapshots.bucket_start", latest).
+		Where("pool_snapshots.finality_status = ?", "safe").Find(&snapshots).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取池子快照失败: %v", err)
+	}
+	var within []*models.PoolSnapshot
+	err = r.db.Where("pool_address IN ? AND finality_status = ? AND block_number BETWEEN ? AND ?", pools, "safe", from, to).
+		Find(&within).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取池子快照失败: %v", err)
+	}
+	return append(snapshots, within...), nil
+}
+
+// 批量保存代币价格，同一代币同一分钟重复计算则覆盖
+func (r *Repository) SaveTokenPrices(prices []*models.TokenPrice) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "token"}, {Name: "bucket_start"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"block_number", "price_usd", "route", "quote_token", "pool_address", "liquidity_usd", "updated_at",
+		}),
+	}).CreateInBatches(prices, 500).Error
+	if err != nil {
+		return fmt.Errorf("保存代币价格失败: %v", err)
+	}
+	return nil
+}
+
+// 批量写入swap成交额 id -> USD金额
+func (r *Repository) UpdateSwapAmountUSD(values map[int64]string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for id, value := range values {
+			if err := tx.Model(&models.SwapEvent{}).Where("id = ?", id).
+				Update("amount_usd", value).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("写入swap成交额失败: %v", err)
+	}
+	return nil
+}
@@ -4,19 +4,33 @@ import (
 	"errors"
 	"fmt"
 	"strings"
-	"zk-sync-go-pool/internal/database"
 	"zk-sync-go-pool/internal/models"
 
 	"gorm.io/gorm"
 )
 
+/*
+基于GORM的存储实现，MySQL、PostgreSQL、SQLite 共用
+数据库写法不一样的地方按 dialect 区分(见 insertedValue)
+*/
 type Repository struct {
+	db          *gorm.DB
+	dialect     string   // mysql / postgres / sqlite
+	eventTables []string // 配置里声明的事件映射表(event_mappings)，启动时登记
 }
 
 // 创建Repository 仓库 专注于与数据库交互
 // 就是写各种方法和调用各种方法，跟业务抽离出来。类似controller和service的关系。
-func NewRepository() *Repository {
-	return &Repository{}
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db, dialect: db.Dialector.Name()}
+}
+
+// 冲突更新时引用本次要插入的值：MySQL 是 VALUES(col)，PostgreSQL/SQLite 是 excluded.col
+func (r *Repository) insertedValue(column string) string {
+	if r.dialect == "mysql" {
+		return fmt.Sprintf("VALUES(%s)", column)
+	}
+	return "excluded." + column
 }
 
 // 获当前扫描进度
@@ -24,7 +38,7 @@ func (r *Repository) GetScanProgress(taskName string) (uint64, error) {
 	var progress models.ScanProgress
 
 	// 从数据库查询
-	result := database.DB.Where("task_name = ?", taskName).First(&progress)
+	result := r.db.Where("task_name = ?", taskName).First(&progress)
 
 	if result.Error != nil {
 		// 如果是"记录不存在"，返回 0（这不是错误）
@@ -46,7 +60,7 @@ func (r *Repository) InitScanProgress(taskName string, startBlock uint64) error
 		Status:           "running",
 	}
 	// 插入数据库
-	result := database.DB.Create(&progress)
+	result := r.db.Create(&progress)
 	if result.Error != nil {
 		return fmt.Errorf("初始化进度失败: %v", result.Error)
 	}
@@ -56,7 +70,11 @@ func (r *Repository) InitScanProgress(taskName string, startBlock uint64) error
 
 // UpdateScanProgress 更新扫描进度
 func (r *Repository) UpdateScanProgress(taskName string, blockNum uint64) error {
-	result := database.DB.Model(&models.ScanProgress{}).
+	return updateScanProgress(r.db, taskName, blockNum)
+}
+
+func updateScanProgress(tx *gorm.DB, taskName string, blockNum uint64) error {
+	result := tx.Model(&models.ScanProgress{}).
 		Where("task_name = ?", taskName).
 		Update("last_scanned_block", blockNum)
 
@@ -67,24 +85,53 @@ func (r *Repository) UpdateScanProgress(taskName string, blockNum uint64) error
 	return nil
 }
 
-// 保存池子数据
+// 查询扫描任务，不存在返回nil（进度为0时区分没开始和扫到了创世区块）
+func (r *Repository) GetScanTask(taskName string) (*models.ScanProgress, error) {
+	var progress models.ScanProgress
+	err := r.db.Where("task_name = ?", taskName).First(&progress).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
 
-func (r *Repository) SavePool(pool *models.Pool) error {
-	result := database.DB.Create(pool)
+// 更新扫描任务状态，一次性的导入、回填任务完成后标记为done
+func (r *Repository) SetScanStatus(taskName, status string) error {
+	result := r.db.Model(&models.ScanProgress{}).
+		Where("task_name = ?", taskName).
+		Update("status", status)
 	if result.Error != nil {
-		// 利用UNIQUE索引，防止重复保存
-		if strings.Contains(result.Error.Error(), "Duplicate entry") { // 如果数据库中已经存在该池子，则不进行保存，防止重复保存
-			return nil
-		}
-		return fmt.Errorf("保存池子数据失败: %v", result.Error)
+		return fmt.Errorf("更新任务状态失败: %v", result.Error)
+	}
+	return nil
+}
+
+// 把这些任务超过block的进度退回到block
+func (r *Repository) RewindScanProgress(taskNames []string, block uint64) error {
+	result := r.db.Model(&models.ScanProgress{}).
+		Where("task_name IN ? AND last_scanned_block > ?", taskNames, block).
+		Update("last_scanned_block", block)
+	if result.Error != nil {
+		return fmt.Errorf("退回进度失败: %v", result.Error)
 	}
 	return nil
 }
 
+// 保存池子数据，已经存在的不覆盖
+func (r *Repository) SavePool(pool *models.Pool) error {
+	batch := NewBatch()
+	batch.AddPool(pool)
+	_, err := r.SaveBatch(batch)
+	return err
+}
+
 // 获取全部池子信息（用于初始化内存缓存）
-func (s *Repository) GetAllPools() ([]*models.Pool, error) {
+func (r *Repository) GetAllPools() ([]*models.Pool, error) {
 	var pool []*models.Pool
-	result := database.DB.Find(&pool)
+	result := r.db.Find(&pool)
 	if result.Error != nil {
 		return nil, fmt.Errorf("获取全部池子信息失败: %v", result.Error)
 	}
@@ -92,37 +139,18 @@ func (s *Repository) GetAllPools() ([]*models.Pool, error) {
 
 }
 
-// 保存swap事件
-func (s *Repository) SaveSwapEvent(swapEvent *models.SwapEvent) error {
-	err := database.DB.Create(swapEvent).Error
-	if err == nil {
-		return nil
-	}
-	// 唯一约束冲突则更新
-	if strings.Contains(err.Error(), "Duplicate entry") {
-		return database.DB.Model(&models.SwapEvent{}).
-			Where("tx_hash = ? AND log_index = ?", swapEvent.TxHash, swapEvent.LogIndex).
-			Updates(map[string]interface{}{
-				"block_number":    swapEvent.BlockNumber,
-				"block_timestamp": swapEvent.BlockTimeStamp,
-				"pool_address":    swapEvent.PoolAddress,
-				"sender":          swapEvent.Sender,
-				"recipient":       swapEvent.Recipient,
-				"token_in":        swapEvent.TokenIn,
-				"token_out":       swapEvent.TokenOut,
-				"amount_in":       swapEvent.AmountIn,
-				"amount_out":      swapEvent.AmountOut,
-				"finality_status": swapEvent.FinalityStatus,
-			}).Error
-	}
-	return nil
-
+// 保存swap事件，返回是否为新插入（重复扫描覆盖的返回false）
+func (r *Repository) SaveSwapEvent(swapEvent *models.SwapEvent) (bool, error) {
+	batch := NewBatch()
+	batch.AddSwap(swapEvent)
+	inserted, err := r.SaveBatch(batch)
+	return len(inserted) > 0, err
 }
 
 // 根据池子地址获取池子信息
-func (s *Repository) GetPoolByAddress(poolAddress string) (*models.Pool, error) {
+func (r *Repository) GetPoolByAddress(poolAddress string) (*models.Pool, error) {
 	var pool models.Pool
-	result := database.DB.Where("pool_address = ?", poolAddress).First(&pool)
+	result := r.db.Where("pool_address = ?", strings.ToLower(poolAddress)).First(&pool)
 	if result.Error != nil {
 		// 如果是"记录不存在"，返回 nil, nil（这不是错误）
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -134,6 +162,21 @@ func (s *Repository) GetPoolByAddress(poolAddress string) (*models.Pool, error)
 	return &pool, nil
 }
 
+// 所有按 block_number + finality_status 存储的事件表，pending重建和链重组回滚都要处理
+func eventModels() []interface{} {
+	return []interface{}{
+		&models.SwapEvent{},
+		&models.LiquidityEvent{},
+		&models.PoolReserve{},
+		&models.PoolSnapshot{},
+		&models.RangeSwap{},
+		&models.RangePositionEvent{},
+		&models.RangePoolEvent{},
+		&models.PoolFeeChange{},
+		&models.DecodedEvent{},
+	}
+}
+
 /*
 删除所有高度大于safe且状态为pending的swap事件
 为什么要大于，不是小于safe呢？
@@ -143,7 +186,52 @@ func (s *Repository) GetPoolByAddress(poolAddress string) (*models.Pool, error)
 所以我们需要删除所有高度大于105且状态为pending的swap事件，然后重新入库106-115的swap事件。
 */
 func (r *Repository) DeletePendingAfter(safe uint64) error {
-	return database.DB.
-		Where("block_number > ? AND finality_status = ?", safe, "pending").
-		Delete(&models.SwapEvent{}).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// swap之外的其他事件表、储备量同样重建
+		for _, model := range eventModels() {
+			if err := tx.Where("block_number > ? AND finality_status = ?", safe, "pending").
+				Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := r.deleteFromEventTables(tx, "block_number > ? AND finality_status = ?", safe, "pending"); err != nil {
+			return err
+		}
+		// pending的费率历史删掉了，池子当前费率改回剩下的
+		if _, err := restorePoolFees(tx, safe); err != nil {
+			return err
+		}
+		// pending区块记录同样重建
+		return tx.Where("number > ? AND finality_status = ?", safe, "pending").
+			Delete(&models.Block{}).Error
+	})
+}
+
+// 区块段 [from, to] 内safe状态的事件，dest是事件模型切片的指针(如 *[]*models.SwapEvent)，同步到ClickHouse用
+func (r *Repository) GetSafeEventsBetween(from, to uint64, dest interface{}) error {
+	err := r.db.Where("block_number BETWEEN ? AND ? AND finality_status = ?", from, to, "safe").
+		Order("block_number ASC, log_index ASC").Find(dest).Error
+	if err != nil {
+		return fmt.Errorf("获取区块%d-%d的事件失败: %v", from, to, err)
+	}
+	return nil
+}
+
+// 事件映射表 [from, to] 内safe状态的行，列名 -> 值；文本列统一转成string(MySQL驱动返回[]byte)
+func (r *Repository) GetSafeMappedEventsBetween(table string, from, to uint64) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	err := r.db.Table(table).Where("block_number BETWEEN ? AND ? AND finality_status = ?", from, to, "safe").
+		Order("block_number ASC, log_index ASC").Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取事件表%s区块%d-%d的数据失败: %v", table, from, to, err)
+	}
+	for _, row := range rows {
+		delete(row, "finality_status")
+		for column, value := range row {
+			if data, ok := value.([]byte); ok {
+				row[column] = string(data)
+			}
+		}
+	}
+	return rows, nil
 }
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/testsupport"
+)
+
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	return NewRepository(testsupport.NewDB(t))
+}
+
+func testSwap(block uint64, txHash string, logIndex int, finality string) *models.SwapEvent {
+	return &models.SwapEvent{
+		BlockNumber:    block,
+		BlockTimeStamp: int64(block) * 10,
+		TxHash:         txHash,
+		LogIndex:       logIndex,
+		PoolAddress:    "0x00000000000000000000000000000000000000a1",
+		Protocol:       "syncswap",
+		Sender:         "0x00000000000000000000000000000000000000b1",
+		Recipient:      "0x00000000000000000000000000000000000000b2",
+		TokenIn:        "0x00000000000000000000000000000000000000c1",
+		TokenOut:       "0x00000000000000000000000000000000000000c2",
+		AmountIn:       "1000",
+		AmountOut:      "2000",
+		FinalityStatus: finality,
+	}
+}
+
+func testPool(address string, createdBlock uint64) *models.Pool {
+	return &models.Pool{
+		PoolAddress:    address,
+		FactoryAddress: "0x00000000000000000000000000000000000000f1",
+		Protocol:       "syncswap",
+		PoolType:       "classic",
+		Version:        "v2",
+		Token0:         "0x00000000000000000000000000000000000000c1",
+		Token1:         "0x00000000000000000000000000000000000000c2",
+		CreatedTx:      "0xpool",
+		CreatedBlock:   createdBlock,
+	}
+}
+
+func testBlock(number uint64, finality string) *models.Block {
+	return &models.Block{Number: number, Hash: "0xhash", ParentHash: "0xparent", Timestamp: int64(number) * 10, FinalityStatus: finality}
+}
+
+func countRows(t *testing.T, r *Repository, model interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := r.db.Model(model).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func progressOf(t *testing.T, r *Repository, task string) uint64 {
+	t.Helper()
+	progress, err := r.GetScanProgress(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return progress
+}
+
+func TestRollbackTo(t *testing.T) {
+	r := newTestRepository(t)
+	batch := NewBatch()
+	batch.AddPool(testPool("0x00000000000000000000000000000000000000a1", 90))
+	batch.AddPool(testPool("0x00000000000000000000000000000000000000a2", 102))
+	for n := uint64(99); n <= 103; n++ {
+		batch.AddBlock(testBlock(n, "safe"))
+	}
+	batch.AddSwap(testSwap(100, "0x01", 0, "safe"))
+	batch.AddSwap(testSwap(102, "0x02", 0, "safe"))
+	batch.AddSwap(testSwap(103, "0x03", 1, "safe"))
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	for task, block := range map[string]uint64{"stable_scan": 103, "pricing": 101, "rollup": 50} {
+		if err := r.InitScanProgress(task, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.SaveFailedBlock(102, errTest, testTime); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := r.RollbackTo(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SwapsDeleted != 2 || result.PoolsDeleted != 1 || result.BlocksDeleted != 3 {
+		t.Fatalf("rollback result = %+v", result)
+	}
+	if n := countRows(t, r, &models.SwapEvent{}); n != 1 {
+		t.Fatalf("swaps left = %d, want 1", n)
+	}
+	if n := countRows(t, r, &models.FailedBlock{}); n != 0 {
+		t.Fatalf("failed blocks left = %d, want 0", n)
+	}
+	for task, want := range map[string]uint64{"stable_scan": 100, "pricing": 100, "rollup": 50} {
+		if got := progressOf(t, r, task); got != want {
+			t.Errorf("progress %s = %d, want %d", task, got, want)
+		}
+	}
+	block, err := r.GetBlock(100)
+	if err != nil || block == nil {
+		t.Fatalf("block 100 should survive the rollback: %v", err)
+	}
+}
+
+func TestRollbackRestoresReservesFromSnapshots(t *testing.T) {
+	r := newTestRepository(t)
+	synced := "0x00000000000000000000000000000000000000a1"    // 分叉上有Sync
+	untouched := "0x00000000000000000000000000000000000000a3" // 最后一次Sync在分叉前
+	forked := "0x00000000000000000000000000000000000000a2"    // 分叉上创建的池子
+	snapshot := func(pool string, block uint64, reserve0, reserve1 string) *models.PoolSnapshot {
+		return &models.PoolSnapshot{PoolAddress: pool, PoolType: "classic", Version: "v2", BucketStart: int64(block/10) * 100,
+			FinalityStatus: "safe", BlockNumber: block, BlockTimeStamp: int64(block) * 10, LogIndex: 1, Source: "sync",
+			Reserve0: models.BigInt(reserve0), Reserve1: models.BigInt(reserve1)}
+	}
+	reserve := func(pool string, block uint64, reserve0, reserve1 string) *models.PoolReserve {
+		return &models.PoolReserve{PoolAddress: pool, FinalityStatus: "safe", Reserve0: models.BigInt(reserve0),
+			Reserve1: models.BigInt(reserve1), BlockNumber: block, LogIndex: 1}
+	}
+	batch := NewBatch()
+	batch.AddPool(testPool(synced, 90))
+	batch.AddPool(testPool(untouched, 90))
+	batch.AddPool(testPool(forked, 102))
+	batch.AddPoolSnapshot(snapshot(synced, 95, "10", "20"))
+	batch.AddPoolSnapshot(snapshot(synced, 102, "30", "40"))
+	batch.AddPoolSnapshot(snapshot(forked, 103, "1", "1"))
+	batch.AddPoolReserve(reserve(synced, 102, "30", "40"))
+	batch.AddPoolReserve(reserve(untouched, 98, "50", "60"))
+	batch.AddPoolReserve(reserve(forked, 103, "1", "1"))
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := r.RollbackTo(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ReservesRestored != 1 {
+		t.Fatalf("reserves restored = %d, want 1", result.ReservesRestored)
+	}
+	var reserves []models.PoolReserve
+	if err := r.db.Order("pool_address").Find(&reserves).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(reserves) != 2 {
+		t.Fatalf("reserves left = %+v, want 2 rows", reserves)
+	}
+	for _, got := range reserves {
+		want := map[string][3]string{synced: {"10", "20", "95"}, untouched: {"50", "60", "98"}}[got.PoolAddress]
+		if [3]string{string(got.Reserve0), string(got.Reserve1), fmt.Sprint(got.BlockNumber)} != want {
+			t.Fatalf("reserve of %s = %s/%s at %d, want %v", got.PoolAddress, got.Reserve0, got.Reserve1, got.BlockNumber, want)
+		}
+	}
+}
+
+func TestDeletePendingAfterKeepsSafeRows(t *testing.T) {
+	r := newTestRepository(t)
+	batch := NewBatch()
+	batch.AddBlock(testBlock(101, "safe"))
+	batch.AddBlock(testBlock(102, "pending"))
+	batch.AddSwap(testSwap(101, "0x01", 0, "safe"))
+	batch.AddSwap(testSwap(102, "0x02", 0, "pending"))
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeletePendingAfter(100); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, r, &models.SwapEvent{}); n != 1 {
+		t.Fatalf("swaps left = %d, want 1", n)
+	}
+	if n := countRows(t, r, &models.Block{}); n != 1 {
+		t.Fatalf("blocks left = %d, want 1", n)
+	}
+}
+
+var (
+	errTest  = errors.New("test error")
+	testTime = time.Unix(1700000000, 0)
+)
+
+func TestDecimalsKeepFullPrecision(t *testing.T) {
+	r := newTestRepository(t)
+	amount := "123456789012345678.123456789012345678"
+	swap := testSwap(100, "0x01", 0, "safe")
+	swap.AmountInDecimal = &amount
+	batch := NewBatch()
+	batch.AddSwap(swap)
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	var saved models.SwapEvent
+	if err := r.db.First(&saved).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.AmountInDecimal == nil || *saved.AmountInDecimal != amount {
+		t.Fatalf("amount_in_decimal = %v, want %s", saved.AmountInDecimal, amount)
+	}
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"fmt"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// [from, to] 范围内已扫描区块的最早和最晚时间，没有区块记录时返回 0, 0（没拿区块头的空区块没有时间，不算）
+func (r *Repository) GetBlockTimeRange(from, to uint64) (int64, int64, error) {
+	var row struct {
+		MinTs int64
+		MaxTs int64
+	}
+	err := r.db.Model(&models.Block{}).
+		Select("COALESCE(MIN(timestamp), 0) AS min_ts, COALESCE(MAX(timestamp), 0) AS max_ts").
+		Where("number BETWEEN ? AND ? AND timestamp > 0", from, to).
+		Scan(&row).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("获取区块时间范围失败: %v", err)
+	}
+	return row.MinTs, row.MaxTs, nil
+}
+
+/*
+按id分页获取 [fromTs, toTs) 时间段内、不超过区块 upto 的safe swap，pending为true时也包括pending swap
+*/
+func (r *Repository) GetSwapsInWindow(fromTs, toTs int64, upto uint64, pending bool, afterID int64, limit int) ([]*models.SwapEvent, error) {
+	var swaps []*models.SwapEvent
+	err := swapWindow(r.db, fromTs, toTs, upto, pending).Where("id > ?", afterID).
+		Order("id ASC").Limit(limit).Find(&swaps).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取swap失败: %v", err)
+	}
+	return swaps, nil
+}
+
+// 整体替换某个周期的汇总（先删后插，重算后消失的池子/代币不会残留）
+func (r *Repository) ReplaceRollups(period string, bucketStart int64, pools []*models.PoolRollup, tokens []*models.TokenRollup, poolTypes []*models.PoolTypeRollup) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.PoolRollup{}, &models.TokenRollup{}, &models.PoolTypeRollup{}} {
+			if err := tx.Where("period = ? AND bucket_start = ?", period, bucketStart).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if len(pools) > 0 {
+			if err := tx.CreateInBatches(pools, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(tokens) > 0 {
+			if err := tx.CreateInBatches(tokens, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(poolTypes) > 0 {
+			if err := tx.CreateInBatches(poolTypes, 500).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("保存%s汇总失败: %v", period, err)
+	}
+	return nil
+}
+
+// 获取某个周期 [fromBucket, toBucket) 内的汇总，dest 为 *[]*models.PoolRollup 等
+func (r *Repository) GetRollups(period string, fromBucket, toBucket int64, dest interface{}) error {
+	err := r.db.Where("period = ? AND bucket_start >= ? AND bucket_start < ?", period, fromBucket, toBucket).
+		Order("bucket_start ASC").Find(dest).Error
+	if err != nil {
+		return fmt.Errorf("获取%s汇总失败: %v", period, err)
+	}
+	return nil
+}
+
+// 删除某个周期从 bucketFrom 开始的汇总（回滚之后比最新区块还晚的周期）
+func (r *Repository) DeleteRollupsFrom(period string, bucketFrom int64) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.PoolRollup{}, &models.TokenRollup{}, &models.PoolTypeRollup{}} {
+			if err := tx.Where("period = ? AND bucket_start >= ?", period, bucketFrom).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("删除%s汇总失败: %v", period, err)
+	}
+	return nil
+}
+
+// 时间段内的swap条件，和 GetSwapsInWindow 一致
+func swapWindow(tx *gorm.DB, fromTs, toTs int64, upto uint64, pending bool) *gorm.DB {
+	tx = tx.Where("block_timestamp >= ? AND block_timestamp < ? AND block_number <= ?", fromTs, toTs, upto)
+	if !pending {
+		tx = tx.Where("finality_status = ?", "safe")
+	}
+	return tx
+}
+
+/*
+成交人数按swap的接收地址去重；接收地址是池子(多跳兑换的中间一跳)或路由器(routers，小写)的不是交易者，不计入
+*/
+func traderWindow(tx *gorm.DB, fromTs, toTs int64, upto uint64, pending bool, routers []string) *gorm.DB {
+	tx = swapWindow(tx, fromTs, toTs, upto, pending).Where("recipient NOT IN (SELECT pool_address FROM pools)")
+	if len(routers) > 0 {
+		tx = tx.Where("recipient NOT IN ?", routers)
+	}
+	return tx
+}
+
+// 时间段内每个池子的成交人数(接收地址去重)
+func (r *Repository) CountTradersByPool(fromTs, toTs int64, upto uint64, pending bool, routers []string) (map[string]int, error) {
+	var rows []struct {
+		PoolAddress string
+		Traders     int
+	}
+	err := traderWindow(r.db.Model(&models.SwapEvent{}), fromTs, toTs, upto, pending, routers).
+		Select("pool_address, COUNT(DISTINCT recipient) AS traders").
+		Group("pool_address").Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计成交人数失败: %v", err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.PoolAddress] = row.Traders
+	}
+	return counts, nil
+}
+
+// 时间段内每个代币的成交人数，作为输入或输出代币都算
+func (r *Repository) CountTradersByToken(fromTs, toTs int64, upto uint64, pending bool, routers []string) (map[string]int, error) {
+	var rows []struct {
+		Token   string
+		Traders int
+	}
+	in := traderWindow(r.db.Model(&models.SwapEvent{}), fromTs, toTs, upto, pending, routers).Select("token_in AS token, recipient")
+	out := traderWindow(r.db.Model(&models.SwapEvent{}), fromTs, toTs, upto, pending, routers).Select("token_out AS token, recipient")
+	// 子查询各自包一层SELECT，SQLite的UNION不接受带括号的SELECT
+	err := r.db.Raw("SELECT token, COUNT(DISTINCT recipient) AS traders FROM (SELECT * FROM (?) AS t_in UNION ALL SELECT * FROM (?) AS t_out) AS t GROUP BY token", in, out).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计成交人数失败: %v", err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Token] = row.Traders
+	}
+	return counts, nil
+}
+
+// 时间段内一组池子合计的成交人数(按池子类型统计用)
+func (r *Repository) CountTradersInPools(pools []string, fromTs, toTs int64, upto uint64, pending bool, routers []string) (int, error) {
+	if len(pools) == 0 {
+		return 0, nil
+	}
+	var count int64
+	err := traderWindow(r.db.Model(&models.SwapEvent{}), fromTs, toTs, upto, pending, routers).
+		Where("pool_address IN ?", pools).
+		Distinct("recipient").Count(&count).Error
+	if err != nil {
+		return 0, fmt.Errorf("统计成交人数失败: %v", err)
+	}
+	return int(count), nil
+}
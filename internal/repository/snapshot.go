@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+保存池子快照
+和储备量一样，同一周期只有更新的位置(区块高度+日志索引)才覆盖；
+先按条件更新，没有更新到再插入，插入撞上唯一索引再按条件更新一次
+*/
+func (r *Repository) SavePoolSnapshot(snapshot *models.PoolSnapshot) error {
+	row := *snapshot
+	lowerAddress(&row.PoolAddress)
+	return savePoolSnapshot(r.db, &row)
+}
+
+func savePoolSnapshot(tx *gorm.DB, snapshot *models.PoolSnapshot) error {
+	update := func() (int64, error) {
+		result := tx.Model(&models.PoolSnapshot{}).
+			Where("pool_address = ? AND bucket_start = ? AND finality_status = ?",
+				snapshot.PoolAddress, snapshot.BucketStart, snapshot.FinalityStatus).
+			Where("block_number < ? OR (block_number = ? AND log_index < ?)", snapshot.BlockNumber, snapshot.BlockNumber, snapshot.LogIndex).
+			Updates(map[string]interface{}{
+				"block_number":     snapshot.BlockNumber,
+				"block_timestamp":  snapshot.BlockTimeStamp,
+				"log_index":        snapshot.LogIndex,
+				"source":           snapshot.Source,
+				"reserve0":         snapshot.Reserve0,
+				"reserve1":         snapshot.Reserve1,
+				"reserve0_decimal": snapshot.Reserve0Decimal,
+				"reserve1_decimal": snapshot.Reserve1Decimal,
+				"tvl_usd":          snapshot.TvlUSD,
+			})
+		return result.RowsAffected, result.Error
+	}
+
+	updated, err := update()
+	if err != nil {
+		return fmt.Errorf("更新池子快照失败: %v", err)
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(snapshot)
+	if result.Error != nil {
+		return fmt.Errorf("保存池子快照失败: %v", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	if _, err := update(); err != nil {
+		return fmt.Errorf("更新池子快照失败: %v", err)
+	}
+	return nil
+}
+
+// 获取代币在某个时间点(含)之前最近的价格，没有返回 nil, nil
+func (r *Repository) GetLatestTokenPrice(token string, atOrBefore int64) (*models.TokenPrice, error) {
+	var price models.TokenPrice
+	result := r.db.Where("token = ? AND bucket_start <= ?", strings.ToLower(token), atOrBefore).
+		Order("bucket_start DESC").First(&price)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取代币价格失败: %v", result.Error)
+	}
+	return &price, nil
+}
+
+// 获取 [from, to] 内的safe快照，按链上顺序（定价时计算TVL）
+func (r *Repository) GetSnapshotsBetween(from, to uint64) ([]*models.PoolSnapshot, error) {
+	var snapshots []*models.PoolSnapshot
+	err := r.db.Where("finality_status = ? AND block_number BETWEEN ? AND ?", "safe", from, to).
+		Order("block_number ASC, log_index ASC").Find(&snapshots).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取池子快照失败: %v", err)
+	}
+	return snapshots, nil
+}
+
+// 批量写入快照TVL id -> USD金额，nil表示定不了价
+func (r *Repository) UpdateSnapshotTVL(values map[int64]*string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for id, value := range values {
+			if err := tx.Model(&models.PoolSnapshot{}).Where("id = ?", id).
+				Update("tvl_usd", value).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("写入快照TVL失败: %v", err)
+	}
+	return nil
+}
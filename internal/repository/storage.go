@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"time"
+	"zk-sync-go-pool/internal/models"
+)
+
+/*
+扫描器依赖的存储接口
+扫描器只通过这个接口读写数据，不直接碰GORM；*Repository 是 MySQL/PostgreSQL/SQLite 的实现。
+按领域拆成几个小接口，新增存储后端时对照着实现
+*/
+type Storage interface {
+	ProgressStore
+	PoolStore
+	SwapStore
+	BlockStore
+	RollbackStore
+	CandleStore
+	PriceStore
+	RollupStore
+	TokenStore
+	EventTableStore
+	ExportStore
+}
+
+// 扫描进度(scan_progress)
+type ProgressStore interface {
+	GetScanProgress(taskName string) (uint64, error)
+	InitScanProgress(taskName string, startBlock uint64) error
+	UpdateScanProgress(taskName string, blockNum uint64) error
+	GetScanTask(taskName string) (*models.ScanProgress, error)
+	SetScanStatus(taskName, status string) error
+	RewindScanProgress(taskNames []string, block uint64) error
+}
+
+// 池子
+type PoolStore interface {
+	SavePool(pool *models.Pool) error
+	GetAllPools() ([]*models.Pool, error)
+	GetPoolByAddress(poolAddress string) (*models.Pool, error)
+	GetPoolReserves(finality string) ([]*models.PoolReserve, error)
+	SavePoolSnapshot(snapshot *models.PoolSnapshot) error
+	GetSnapshotsBetween(from, to uint64) ([]*models.PoolSnapshot, error)
+	UpdateSnapshotTVL(values map[int64]*string) error
+}
+
+// swap和批量写入
+type SwapStore interface {
+	SaveBatch(b *Batch) ([]*models.SwapEvent, error) // 一个事务写入，返回新插入的swap
+	SaveSwapEvent(swapEvent *models.SwapEvent) (bool, error)
+	GetSwapsBetween(from, to uint64) ([]*models.SwapEvent, error)
+	UpdateSwapAmountUSD(values map[int64]string) error
+	GetSwapAmountsMissingDecimal(side, token string, maxDigits int, afterID int64, limit int) ([]SwapAmount, error)
+	UpdateSwapAmountDecimals(side string, values map[int64]string) error
+}
+
+// 区块记录和失败区块(死信队列)
+type BlockStore interface {
+	GetBlock(number uint64) (*models.Block, error)
+	GetBlocks(from, to uint64) ([]*models.Block, error)
+	GetLastHashedBlock(upto uint64) (*models.Block, error)
+	GetTimedBlockAfter(after, upto uint64) (*models.Block, error)
+	GetTimedBlockBefore(before int64, upto uint64) (*models.Block, error)
+	CountSwapsByBlock(from, to uint64) (map[uint64]int, error)
+	GetBlockTimeRange(from, to uint64) (int64, int64, error)
+	SaveFailedBlock(blockNum uint64, scanErr error, nextRetryAt time.Time) error
+	GetDueFailedBlocks(now time.Time, limit int) ([]*models.FailedBlock, error)
+	RescheduleFailedBlock(blockNum uint64, scanErr error, attempts int, nextRetryAt time.Time, dead bool) error
+	ResolveFailedBlock(blockNum uint64) error
+	GetMinFailedBlock() (uint64, bool, error)
+}
+
+// 链重组回滚和pending数据重建
+type RollbackStore interface {
+	RollbackTo(ancestor uint64) (*RollbackResult, error)
+	SaveReorgLog(reorgLog *models.ReorgLog) error
+	DeletePendingAfter(safe uint64) error
+	GetSwapScopeAfter(block uint64, finality string) ([]string, int64, error)
+}
+
+// K线
+type CandleStore interface {
+	GetCandle(marketType, market, period string, bucketStart int64) (*models.Candle, error)
+	SaveCandles(candles []*models.Candle) error
+	DeleteCandlesFrom(marketType, market, period string, bucketFrom int64) error
+	GetCandlesAfter(marketType, market, period string, afterBucket int64, limit int) ([]*models.Candle, error)
+	GetSwapsForCandles(pools []string, fromTimestamp int64, afterBlock uint64, afterLogIndex int, limit int) ([]*models.SwapEvent, error)
+}
+
+// 代币价格
+type PriceStore interface {
+	SaveTokenPrices(prices []*models.TokenPrice) error
+	GetLastSwapsBefore(pools []string, block uint64, sinceTimestamp int64) ([]*models.SwapEvent, error)
+	GetSnapshotsForPricing(pools []string, from, to uint64) ([]*models.PoolSnapshot, error)
+	GetLatestTokenPrice(token string, atOrBefore int64) (*models.TokenPrice, error)
+}
+
+// 成交汇总
+type RollupStore interface {
+	GetSwapsInWindow(fromTs, toTs int64, upto uint64, pending bool, afterID int64, limit int) ([]*models.SwapEvent, error)
+	ReplaceRollups(period string, bucketStart int64, pools []*models.PoolRollup, tokens []*models.TokenRollup, poolTypes []*models.PoolTypeRollup) error
+	DeleteRollupsFrom(period string, bucketFrom int64) error
+	GetRollups(period string, fromBucket, toBucket int64, dest interface{}) error
+	CountTradersByPool(fromTs, toTs int64, upto uint64, pending bool, routers []string) (map[string]int, error)
+	CountTradersByToken(fromTs, toTs int64, upto uint64, pending bool, routers []string) (map[string]int, error)
+	CountTradersInPools(pools []string, fromTs, toTs int64, upto uint64, pending bool, routers []string) (int, error)
+	GetPoolFeeHistory(pool string, upto uint64, pending bool) ([]*models.PoolFeeChange, error)
+}
+
+// 代币元数据
+type TokenStore interface {
+	SaveToken(token *models.Token) error
+	GetTokenByAddress(address string) (*models.Token, error)
+	GetUnknownTokenAddresses() ([]string, error)
+	GetAllTokens() ([]*models.Token, error)
+	GetTokensMissingDecimal(maxIntDigits int) ([]string, error)
+}
+
+// 配置里声明的事件映射表
+type EventTableStore interface {
+	EnsureEventTable(table string, columns []EventColumn) error
+}
+
+// 同步到分析库(ClickHouse)
+type ExportStore interface {
+	GetSafeEventsBetween(from, to uint64, dest interface{}) error
+	GetSafeMappedEventsBetween(table string, from, to uint64) ([]map[string]interface{}, error)
+}
+
+var _ Storage = (*Repository)(nil)
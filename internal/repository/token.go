@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 保存代币元数据，已存在则覆盖
+func (r *Repository) SaveToken(token *models.Token) error {
+	row := *token
+	lowerAddress(&row.Address)
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "address"}},
+		DoUpdates: clause.AssignmentColumns([]string{"symbol", "name", "decimals", "status", "updated_at"}),
+	}).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("保存代币%s失败: %v", token.Address, err)
+	}
+	return nil
+}
+
+// 根据地址获取代币，不存在返回 nil, nil
+func (r *Repository) GetTokenByAddress(address string) (*models.Token, error) {
+	var token models.Token
+	result := r.db.Where("address = ?", strings.ToLower(address)).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取代币失败: %v", result.Error)
+	}
+	return &token, nil
+}
+
+// 池子里出现过但tokens表还没有的代币地址（启动时补齐历史池子的代币）
+func (r *Repository) GetUnknownTokenAddresses() ([]string, error) {
+	var addresses []string
+	err := r.db.Raw(`
+		SELECT token0 FROM pools WHERE NOT EXISTS (SELECT 1 FROM tokens WHERE tokens.address = pools.token0)
+		UNION
+		SELECT token1 FROM pools WHERE NOT EXISTS (SELECT 1 FROM tokens WHERE tokens.address = pools.token1)
+	`).Scan(&addresses).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取未知代币地址失败: %v", err)
+	}
+	return addresses, nil
+}
+
+// 获取全部代币（启动时加载精度到内存）
+func (r *Repository) GetAllTokens() ([]*models.Token, error) {
+	var tokens []*models.Token
+	if err := r.db.Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("获取全部代币失败: %v", err)
+	}
+	return tokens, nil
+}
+
+// 待回填的swap数量，带上池子和时间，回填后只重建受影响的K线
+type SwapAmount struct {
+	ID             int64
+	Amount         string
+	PoolAddress    string
+	BlockNumber    uint64
+	BlockTimeStamp int64 `gorm:"column:block_timestamp"`
+}
+
+// swap数量的两侧：in 对应 token_in/amount_in，out 对应 token_out/amount_out
+var swapAmountSides = map[string]bool{"in": true, "out": true}
+
+/*
+获取某个代币还没换算精度的swap数量，按id分页
+side 为 in/out；位数超过 maxDigits 的数量换算后放不进小数列，永远是NULL，不再选出来
+*/
+func (r *Repository) GetSwapAmountsMissingDecimal(side, token string, maxDigits int, afterID int64, limit int) ([]SwapAmount, error) {
+	if !swapAmountSides[side] {
+		return nil, fmt.Errorf("未知的swap数量字段: %s", side)
+	}
+	var amounts []SwapAmount
+	err := r.db.Model(&models.SwapEvent{}).
+		Select("id, amount_"+side+" AS amount, pool_address, block_number, block_timestamp").
+		Where("token_"+side+" = ? AND amount_"+side+"_decimal IS NULL AND id > ?", strings.ToLower(token), afterID).
+		Where(r.digits("amount_"+side)+" <= ?", maxDigits).
+		Order("id ASC").Limit(limit).
+		Scan(&amounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取待回填swap失败: %v", err)
+	}
+	return amounts, nil
+}
+
+// 数量列的位数，PostgreSQL上数量列是NUMERIC，先转成文本
+func (r *Repository) digits(column string) string {
+	if r.db.Dialector.Name() == "postgres" {
+		return "LENGTH(" + column + "::text)"
+	}
+	return "LENGTH(" + column + ")"
+}
+
+// 批量回填换算后的swap数量 id -> 小数字符串
+func (r *Repository) UpdateSwapAmountDecimals(side string, values map[int64]string) error {
+	if !swapAmountSides[side] {
+		return fmt.Errorf("未知的swap数量字段: %s", side)
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for id, value := range values {
+			if err := tx.Model(&models.SwapEvent{}).Where("id = ?", id).
+				Update("amount_"+side+"_decimal", value).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("回填swap数量失败: %v", err)
+	}
+	return nil
+}
+
+/*
+还有未换算数量的swap涉及的、精度已知的代币
+整数部分超过 maxIntDigits 位的数量换算不了，只剩这种数量的代币不再返回
+*/
+func (r *Repository) GetTokensMissingDecimal(maxIntDigits int) ([]string, error) {
+	var addresses []string
+	err := r.db.Raw(`
+		SELECT DISTINCT s.token_in FROM swap_events s JOIN tokens t ON t.address = s.token_in
+		WHERE s.amount_in_decimal IS NULL AND `+r.digits("s.amount_in")+` <= t.decimals + ?
+		UNION
+		SELECT DISTINCT s.token_out FROM swap_events s JOIN tokens t ON t.address = s.token_out
+		WHERE s.amount_out_decimal IS NULL AND `+r.digits("s.amount_out")+` <= t.decimals + ?
+	`, maxIntDigits, maxIntDigits).Scan(&addresses).Error
+	if err != nil {
+		return nil, fmt.Errorf("获取待回填代币失败: %v", err)
+	}
+	return addresses, nil
+}
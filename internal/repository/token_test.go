@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+)
+
+func TestGetUnknownTokenAddressesIgnoresCase(t *testing.T) {
+	r := newTestRepository(t)
+	// 手工导入的代币是小写，池子事件里的代币是checksum地址
+	if err := r.SaveToken(&models.Token{Address: "0x5aea5775959fbc2557cc8789bc1bf90a239d9a91", Symbol: "WETH", Name: "Wrapped Ether", Decimals: 18}); err != nil {
+		t.Fatal(err)
+	}
+	pool := testPool("0x80115c708E12eDd42E504c1cD52Aea96C547c05c", 100)
+	pool.Token0 = "0x5AEa5775959fBC2557Cc8789bC1bf90A239D9a91"
+	pool.Token1 = "0x1d17CBcF0D6D143135aE902365D2E5e2A16538D4"
+	batch := NewBatch()
+	batch.AddPool(pool)
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	unknown, err := r.GetUnknownTokenAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unknown) != 1 || unknown[0] != "0x1d17cbcf0d6d143135ae902365d2e5e2a16538d4" {
+		t.Fatalf("unknown tokens = %v", unknown)
+	}
+	if stored, err := r.GetPoolByAddress("0x80115c708E12eDd42E504c1cD52Aea96C547c05c"); err != nil || stored == nil {
+		t.Fatalf("checksummed lookup should find the pool: %v", err)
+	}
+}
+
+func TestMissingDecimalSkipsAmountsTooLargeForTheColumn(t *testing.T) {
+	r := newTestRepository(t)
+	for _, token := range []*models.Token{
+		{Address: "0x00000000000000000000000000000000000000c1", Symbol: "A", Name: "A", Decimals: 0},
+		{Address: "0x00000000000000000000000000000000000000c2", Symbol: "B", Name: "B", Decimals: 0},
+	} {
+		if err := r.SaveToken(token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// c1 两笔：一笔能换算，一笔40位放不进 DECIMAL(65,30)；c2 只有超大数量
+	normal := testSwap(100, "0xnormal", 0, "safe")
+	huge := testSwap(101, "0xhuge", 0, "safe")
+	huge.AmountIn = models.BigInt(strings.Repeat("9", 40))
+	huge.AmountOut = models.BigInt(strings.Repeat("9", 40))
+	normal.TokenOut = "0x00000000000000000000000000000000000000c3"
+	batch := NewBatch()
+	batch.AddSwap(normal)
+	batch.AddSwap(huge)
+	if _, err := r.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := r.GetTokensMissingDecimal(35)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0] != "0x00000000000000000000000000000000000000c1" {
+		t.Fatalf("tokens missing decimal = %v, want only c1", tokens)
+	}
+	amounts, err := r.GetSwapAmountsMissingDecimal("in", tokens[0], 35, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amounts) != 1 || amounts[0].Amount != "1000" {
+		t.Fatalf("amounts missing decimal = %+v, want only the normal swap", amounts)
+	}
+}
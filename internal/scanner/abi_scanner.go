@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"zk-sync-go-pool/internal/blockchain"
+	"zk-sync-go-pool/internal/clickhouse"
 	"zk-sync-go-pool/internal/config"
 	"zk-sync-go-pool/internal/models"
 	"zk-sync-go-pool/internal/repository"
@@ -21,79 +24,146 @@ import (
 
 // 映射工厂地址
 type factoryInfo struct {
-	PoolType  string
-	Version   string
-	EventName string // 默认 PoolCreated 可为空
-	FeeField  string // 某些事件会带fee/feeTier 可为空
+	Protocol         string // 所属协议，SyncSwap为 syncswap
+	PoolType         string
+	Version          string
+	EventName        string // 默认 PoolCreated 可为空
+	PoolField        string // 事件里的池子地址字段，默认 pool
+	FeeField         string // 某些事件会带fee/feeTier 可为空，为空时在创建区块上调用合约读取
+	TickSpacingField string // range工厂的事件带tickSpacing 可为空
+	Swap             string // 兑换语义 v2/v3
+	FeeScale         int    // 合约里的费率乘以多少换算成百万分之一
+	FeeRate          int    // 固定费率(百万分之一)，读不到费率时使用，0表示没有
 }
 
 /*
 基于ABI扫描解析
 */
 type ABIScanner struct {
-	cfg            *config.Config          //引用config指针地址
-	repo           *repository.Repository  // 引用repo方法集指针地址
-	poolCache      map[string]*models.Pool // 池子地址集合
-	poolCacheMu    sync.RWMutex
-	factoryInfoMap map[string]factoryInfo
-	poolABIMap     map[string]string
+	cfg             *config.Config             //引用config指针地址
+	repo            repository.Storage         // 存储接口，MySQL/PostgreSQL/SQLite都实现了
+	poolCache       map[string]*models.Pool    // 池子地址集合
+	pairPools       map[string]map[string]bool // 交易对 -> 池子地址，K线的交易对市场用，和poolCache一起更新
+	poolCacheMu     sync.RWMutex
+	factoryInfoMap  map[string]factoryInfo
+	poolABIMap      map[string]string
+	fetcher         logFetcher                      // 区块日志获取策略(scanner.fetch_mode)
+	tokens          *tokenResolver                  // 新代币元数据解析
+	mappings        map[common.Hash][]*eventMapping // 配置里声明的事件映射，按事件签名索引
+	routers         map[string]bool                 // 路由器地址(小写)，归档原始事件用
+	handlers        []registeredHandler             // 日志处理器，按顺序执行
+	clickhouse      *clickhouse.Client              // 可选的分析库，没开启为nil
+	missingABIs     sync.Map                        // 已经提示过没有事件ABI的池子类型
+	unreadablePools sync.Map                        // 读不到储备量的池子(小写地址)，快照worker之后跳过
+
+	reorgMu  sync.Mutex
+	reorgTip *uint64 // live worker发现的已经波及safe区块的链重组，交给stable worker回滚
+
+	stableCursor atomic.Uint64 // stable worker已处理到的区块(失败区块交给死信队列)
+
+	candleMu        sync.Mutex   // K线读改写
+	candleRebuildMu sync.RWMutex // swap入库+K线增量更新持读锁，删除数据后重建K线持写锁
+	rewinds         uint64       // 回滚、退回推导进度的次数，持 candleRebuildMu 写锁修改
 }
 
-func NewABIScanner(cfg *config.Config, repo *repository.Repository) *ABIScanner {
+// 一个扫描任务的区块范围 [from, to]
+type blockSpan struct {
+	from, to uint64
+}
+
+func NewABIScanner(cfg *config.Config, repo repository.Storage) *ABIScanner {
 	s := &ABIScanner{ //结构体赋值
 		cfg:  cfg,
 		repo: repo,
 	}
 	s.initFatoryInfo()
 	s.initPoolABIMap()
+	s.initProtocols()
 	s.initPoolCache()
+	s.initEventMappings()
+	s.routers = s.routerAddresses()
+	s.registerBuiltinHandlers()
+	s.fetcher = newLogFetcher(s)
+	s.tokens = newTokenResolver(repo)
+	s.tokens.onBackfill = s.afterDecimalBackfill
 	return s
 }
 
-// 初始化映射版本+池类型地址
+// 初始化映射版本+池类型地址，key为 协议:类型:版本
 func (s *ABIScanner) initPoolABIMap() {
 	s.poolABIMap = make(map[string]string)
 	masters := s.cfg.Syncswap.PoolMasters
-	s.poolABIMap["classic:v1"] = strings.ToLower(masters.ClassicV1)
-	s.poolABIMap["stable:v1"] = strings.ToLower(masters.StableV1)
-	s.poolABIMap["classic:v2"] = strings.ToLower(masters.ClassicV2)
-	s.poolABIMap["stable:v2"] = strings.ToLower(masters.StableV2)
-	s.poolABIMap["aqua:v2"] = strings.ToLower(masters.AquaV2)
-	s.poolABIMap["classic:v2.1"] = strings.ToLower(masters.ClassicV2_1)
-	s.poolABIMap["stable:v2.1"] = strings.ToLower(masters.StableV2_1)
-	s.poolABIMap["aqua:v2.1"] = strings.ToLower(masters.AquaV2_1)
-	s.poolABIMap["range:v3"] = strings.ToLower(masters.RangeV3)
+	s.poolABIMap[poolABIKey(defaultProtocol, "classic", "v1")] = strings.ToLower(masters.ClassicV1)
+	s.poolABIMap[poolABIKey(defaultProtocol, "stable", "v1")] = strings.ToLower(masters.StableV1)
+	s.poolABIMap[poolABIKey(defaultProtocol, "classic", "v2")] = strings.ToLower(masters.ClassicV2)
+	s.poolABIMap[poolABIKey(defaultProtocol, "stable", "v2")] = strings.ToLower(masters.StableV2)
+	s.poolABIMap[poolABIKey(defaultProtocol, "aqua", "v2")] = strings.ToLower(masters.AquaV2)
+	s.poolABIMap[poolABIKey(defaultProtocol, "classic", "v2.1")] = strings.ToLower(masters.ClassicV2_1)
+	s.poolABIMap[poolABIKey(defaultProtocol, "stable", "v2.1")] = strings.ToLower(masters.StableV2_1)
+	s.poolABIMap[poolABIKey(defaultProtocol, "aqua", "v2.1")] = strings.ToLower(masters.AquaV2_1)
+	s.poolABIMap[poolABIKey(defaultProtocol, "range", "v3")] = strings.ToLower(masters.RangeV3)
 }
 
-// 初始化映射工厂合约地址
+/*
+初始化映射工厂合约地址
+classic/stable/aqua 的费率精度是十万分之一，换算成百万分之一乘10；range和v3一样是百万分之一
+*/
 func (s *ABIScanner) initFatoryInfo() {
 	s.factoryInfoMap = make(map[string]factoryInfo)
 	factories := s.cfg.Syncswap.Factories
-	s.factoryInfoMap[strings.ToLower(factories.ClassicV1)] = factoryInfo{PoolType: "classic", Version: "v1", EventName: "PoolCreated"}
-	s.factoryInfoMap[strings.ToLower(factories.StableV1)] = factoryInfo{PoolType: "stable", Version: "v1", EventName: "PoolCreated"}
-	s.factoryInfoMap[strings.ToLower(factories.ClassicV2)] = factoryInfo{PoolType: "classic", Version: "v2", EventName: "PoolCreated"}
-	s.factoryInfoMap[strings.ToLower(factories.StableV2)] = factoryInfo{PoolType: "stable", Version: "v2", EventName: "PoolCreated"}
-	s.factoryInfoMap[strings.ToLower(factories.AquaV2)] = factoryInfo{PoolType: "aqua", Version: "v2", EventName: "PoolCreated"}
-	s.factoryInfoMap[strings.ToLower(factories.ClassicV2_1)] = factoryInfo{PoolType: "classic", Version: "v2.1", EventName: "PoolCreated"}
-	s.factoryInfoMap[strings.ToLower(factories.StableV2_1)] = factoryInfo{PoolType: "stable", Version: "v2.1", EventName: "PoolCreated"}
-	s.factoryInfoMap[strings.ToLower(factories.AquaV2_1)] = factoryInfo{PoolType: "aqua", Version: "v2.1", EventName: "PoolCreated"}
-	s.factoryInfoMap[strings.ToLower(factories.RangeV3)] = factoryInfo{PoolType: "range", Version: "v3", EventName: "PoolCreated"}
+	s.factoryInfoMap[strings.ToLower(factories.ClassicV1)] = syncswapFactory("classic", "v1")
+	s.factoryInfoMap[strings.ToLower(factories.StableV1)] = syncswapFactory("stable", "v1")
+	s.factoryInfoMap[strings.ToLower(factories.ClassicV2)] = syncswapFactory("classic", "v2")
+	s.factoryInfoMap[strings.ToLower(factories.StableV2)] = syncswapFactory("stable", "v2")
+	s.factoryInfoMap[strings.ToLower(factories.AquaV2)] = syncswapFactory("aqua", "v2")
+	s.factoryInfoMap[strings.ToLower(factories.ClassicV2_1)] = syncswapFactory("classic", "v2.1")
+	s.factoryInfoMap[strings.ToLower(factories.StableV2_1)] = syncswapFactory("stable", "v2.1")
+	s.factoryInfoMap[strings.ToLower(factories.AquaV2_1)] = syncswapFactory("aqua", "v2.1")
+	s.factoryInfoMap[strings.ToLower(factories.RangeV3)] = syncswapFactory("range", "v3")
 }
 
 // 初始化映射池子地址
 func (s *ABIScanner) initPoolCache() {
-	s.poolCache = make(map[string]*models.Pool)
 	pools, err := s.repo.GetAllPools()
 	if err != nil {
 		fmt.Printf("加载历史池子失败%v", err)
-		return
 	}
+
+	s.poolCacheMu.Lock()
+	// 链重组回滚后会重新加载，整体替换
+	s.poolCache = make(map[string]*models.Pool, len(pools))
+	s.pairPools = make(map[string]map[string]bool)
 	for _, pool := range pools {
-		addr := strings.ToLower(pool.PoolAddress)
-		s.poolCache[addr] = pool
+		s.setCachedPoolLocked(pool)
+	}
+	s.poolCacheMu.Unlock()
+	fmt.Printf("初始化池子缓存: %d 条\n", len(pools))
+}
+
+// 写入poolCache并更新交易对索引，调用方持 poolCacheMu 写锁
+func (s *ABIScanner) setCachedPoolLocked(pool *models.Pool) {
+	key := strings.ToLower(pool.PoolAddress)
+	s.deleteCachedPoolLocked(key)
+	s.poolCache[key] = pool
+	pair := pairKey(pool)
+	if s.pairPools[pair] == nil {
+		s.pairPools[pair] = make(map[string]bool)
 	}
+	s.pairPools[pair][pool.PoolAddress] = true
+}
 
-	fmt.Printf("初始化池子缓存: %d 条\n", len(s.poolCache))
+// 从poolCache和交易对索引里删掉池子，调用方持 poolCacheMu 写锁
+func (s *ABIScanner) deleteCachedPoolLocked(key string) {
+	pool, ok := s.poolCache[key]
+	if !ok {
+		return
+	}
+	delete(s.poolCache, key)
+	pair := pairKey(pool)
+	delete(s.pairPools[pair], pool.PoolAddress)
+	if len(s.pairPools[pair]) == 0 {
+		delete(s.pairPools, pair)
+	}
 }
 
 /*
@@ -101,6 +171,13 @@ func (s *ABIScanner) initPoolCache() {
 */
 func (s *ABIScanner) Start(ctx context.Context) error {
 	fmt.Println("启动ABI扫描器...")
+	if err := s.initClickhouse(); err != nil {
+		return err
+	}
+	// 老池子要在扫描开始前进poolCache
+	if err := s.bootstrapPools(ctx); err != nil {
+		return err
+	}
 	stableCursor, err := s.repo.GetScanProgress("stable_scan")
 	if err != nil {
 		return err
@@ -116,9 +193,24 @@ func (s *ABIScanner) Start(ctx context.Context) error {
 		fmt.Printf("从上次扫描的区块%v开始", stableCursor)
 	}
 
+	s.stableCursor.Store(stableCursor)
+
+	// 其他协议在当前进度之前的池子也要在扫描开始前进poolCache，历史事件后台回填
+	if err := s.bootstrapProtocols(ctx, stableCursor); err != nil {
+		return err
+	}
+	go s.runProtocolBackfills(ctx, stableCursor)
+
 	// 开启双worker模式
 	go s.runStableWorker(ctx, stableCursor)
 	go s.runLiveWorker(ctx)
+	go s.runRetryWorker(ctx)    // 失败区块后台重试
+	go s.tokens.Run(ctx)        // 新代币元数据解析
+	go s.runPricingWorker(ctx)  // swap定价(USD)
+	go s.runSnapshotWorker(ctx) // 池子储备量/TVL定时快照
+	if s.clickhouse != nil {
+		go s.runClickhouseWorker(ctx) // safe区块的事件同步到ClickHouse
+	}
 
 	<-ctx.Done() //监听信号取消
 	return nil
@@ -169,6 +261,21 @@ func (s *ABIScanner) runStableWorker(ctx context.Context, cursor uint64) {
 			return
 		default:
 		}
+		// safe数据的链重组回滚只在这里做，不会和正在进行的扫描交错
+		if tip, ok := s.takeSafeReorg(); ok {
+			ancestor, err := s.handleReorg(tip, "pending")
+			if err != nil {
+				fmt.Printf("链重组回滚失败:%v，1s后重试\n", err)
+				s.requestSafeReorg(tip)
+				time.Sleep(time.Second)
+				continue
+			}
+			if ancestor < cursor {
+				fmt.Printf("链重组，stable游标回退: %d -> %d\n", cursor, ancestor)
+				cursor = ancestor
+				s.stableCursor.Store(cursor)
+			}
+		}
 		safeHead, err := blockchain.GetSafeBlockNumber()
 		if err != nil {
 			fmt.Printf("获取safe头高度失败:%v，1s后重试", err)
@@ -186,16 +293,47 @@ func (s *ABIScanner) runStableWorker(ctx context.Context, cursor uint64) {
 			to = safeHead
 		}
 
+		// 扫描前检查上一批最后一个区块是否还在主链上
+		if rolledBack, ancestor, err := s.checkReorg(form, "safe"); err != nil {
+			fmt.Printf("链重组检查失败:%v，1s后重试\n", err)
+			time.Sleep(time.Second)
+			continue
+		} else if rolledBack {
+			cursor = ancestor
+			s.stableCursor.Store(cursor)
+			continue
+		}
+
 		if err := s.scanRange(form, to, "safe"); err != nil { // 扫描区块范围
 			fmt.Printf("扫描区块范围%v-%v失败:%v\n", form, to, err)
 			time.Sleep(time.Second) // 1s后重试
 			continue
 		}
 
+		// 批次内的各段并发扫描，扫完再检查段与段之间父哈希是否连续
+		// 检查失败或者回滚失败游标都不能前进，否则分叉上的数据会被当成safe留下，下一轮重新扫描这一批再检查
+		if broken, err := s.checkLedger(form, to); err != nil {
+			fmt.Printf("区块哈希连续性检查失败:%v，1s后重试\n", err)
+			time.Sleep(time.Second)
+			continue
+		} else if broken > 0 {
+			fmt.Printf("⚠️ 区块%d父哈希不连续，检测到链重组\n", broken)
+			ancestor, err := s.handleReorg(broken-1, "safe")
+			if err != nil {
+				fmt.Printf("链重组回滚失败:%v，1s后重试\n", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			cursor = ancestor
+			s.stableCursor.Store(cursor)
+			continue
+		}
+
 		cursor = to //更新cursor
-		// 一次批量之后更新进度一次
-		if err := s.repo.UpdateScanProgress("stable_scan", to); err != nil {
-			fmt.Printf("更新最新进度失败:%v", to)
+		s.stableCursor.Store(cursor)
+		// 一次批量之后更新进度一次（失败区块进了死信队列，进度停在最小失败区块之前）
+		if err := s.commitStableProgress(to); err != nil {
+			fmt.Printf("更新最新进度失败:%v\n", err)
 		}
 
 	}
@@ -231,8 +369,15 @@ func (s *ABIScanner) runLiveWorker(ctx context.Context) {
 
 		from, to := safeHead+1, latest // 扫描区块范围 safeHead+1 到 latest
 
-		// 先清理旧的也就是上次的pending数据
-		if err := s.repo.DeletePendingAfter(safeHead); err != nil {
+		// 上一轮pending区块可能已经被重组掉，检查失败不能接着写，否则新数据会接在分叉上
+		if err := s.checkPendingReorg(from); err != nil {
+			fmt.Printf("链重组检查失败:%v，1s后重试\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		// 先清理旧的也就是上次的pending数据，并重建受影响的K线
+		if err := s.deletePending(safeHead); err != nil {
 			fmt.Printf("清理pending状态Swap事件失败:%v", err)
 		}
 
@@ -260,32 +405,52 @@ func (s *ABIScanner) scanRange(start, end uint64, finality string) error {
 		workers = 5 // 获取不到则默认5个协程
 	}
 
-	tasks := make(chan uint64, workers*2) // 通道设置内存大小
+	tasks := make(chan blockSpan, workers*2) // 通道设置内存大小
 	var wg sync.WaitGroup
 	var mu sync.Mutex        //互斥锁
 	var errorCount int       // 协程解析单个区块错误数量
-	maxScannedBlock := start // 记录当前扫描最新的区块高度(因为多协程扫描不是按照顺序来的)
+	var unrecorded uint64    // 没能写进死信队列的最小失败区块，进度不能越过它
+	maxScannedBlock := start // 记录从start开始连续处理完的最高区块(多协程扫描不是按照顺序完成的，不能直接取最大值)
 	if start > 0 {
 		maxScannedBlock = start - 1
 	}
+	finishedSpans := make(map[uint64]uint64) // 已完成但前面还有未完成任务的段 from -> to
 
 	// 开启消费者（等待生产者生产数据）
 	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for blockNum := range tasks {
-				if err := s.scanBlock(blockNum, finality); err != nil {
-					fmt.Printf("扫描区块:%v失败\n", blockNum)
-					mu.Lock()
-					errorCount++
-					mu.Unlock()
-					continue
+			for span := range tasks {
+				failed := s.scanSpan(span.from, span.to, finality)
+				var lost uint64
+				for blockNum, err := range failed {
+					fmt.Printf("扫描区块:%v失败:%v\n", blockNum, err)
+					if finality == "safe" {
+						// 失败区块进死信队列，由后台重试，游标照常前进；写不进队列的区块会丢，进度停在它前面
+						if err := s.repo.SaveFailedBlock(blockNum, err, time.Now().Add(s.retryDelay(0))); err != nil {
+							fmt.Printf("%v\n", err)
+							if lost == 0 || blockNum < lost {
+								lost = blockNum
+							}
+						}
+					}
 				}
 
 				mu.Lock()
-				if blockNum > maxScannedBlock {
-					maxScannedBlock = blockNum // 取最大的高度
+				errorCount += len(failed)
+				if lost > 0 && (unrecorded == 0 || lost < unrecorded) {
+					unrecorded = lost
+				}
+				// 推进连续完成的高度
+				finishedSpans[span.from] = span.to
+				for {
+					to, ok := finishedSpans[maxScannedBlock+1]
+					if !ok {
+						break
+					}
+					delete(finishedSpans, maxScannedBlock+1)
+					maxScannedBlock = to
 				}
 				mu.Unlock()
 
@@ -294,12 +459,7 @@ func (s *ABIScanner) scanRange(start, end uint64, finality string) error {
 	}
 
 	// 开启生产者
-	go func() {
-		defer close(tasks) // 协程结束前关闭通道
-		for blockNum := start; blockNum <= end; blockNum++ {
-			tasks <- blockNum
-		}
-	}()
+	go s.produceSpans(start, end, tasks)
 
 	// 批量扫描断点记录 每隔一定数据区块记录一次，防止进程异常进度丢失
 	batchIntervalSize := s.cfg.Scanner.BatchIntervarSize
@@ -314,13 +474,16 @@ func (s *ABIScanner) scanRange(start, end uint64, finality string) error {
 			case <-ticker.C: // 5s触发
 				mu.Lock()
 				currectMax := maxScannedBlock
+				if unrecorded > 0 && currectMax >= unrecorded {
+					currectMax = unrecorded - 1
+				}
 				mu.Unlock()
 				// 当前的进度，大于一开始的进度+间隔，说明有新的进度需要更新
 				if currectMax >= lastUpdatedBlock+uint64(batchIntervalSize) {
 					// 更新数据库进度
 					if finality == "safe" {
 						// 只有safe扫描任务才更新进度
-						if err := s.repo.UpdateScanProgress("stable_scan", currectMax); err != nil {
+						if err := s.commitStableProgress(currectMax); err != nil {
 							fmt.Printf("定时更新扫描进度失败:%v", err)
 						} else {
 							fmt.Printf("定时更新扫描进度到区块:%d\n", currectMax)
@@ -340,9 +503,13 @@ func (s *ABIScanner) scanRange(start, end uint64, finality string) error {
 	mu.Lock()
 	finalBlock := maxScannedBlock
 	finalErrors := errorCount
+	firstLost := unrecorded
 	mu.Unlock()
 
-	fmt.Printf("%d区域，批次完成，扫描区块 %d-%d，错误数 %d\n", finality, start, finalBlock, finalErrors)
+	fmt.Printf("%s区域，批次完成，扫描区块 %d-%d，错误数 %d\n", finality, start, finalBlock, finalErrors)
+	if firstLost > 0 {
+		return fmt.Errorf("失败区块%d没能写进死信队列", firstLost)
+	}
 	return nil
 
 }
@@ -350,7 +517,7 @@ func (s *ABIScanner) scanRange(start, end uint64, finality string) error {
 func (s *ABIScanner) scanRangeLive(start, end uint64, finality string) error {
 	workers := 5 // 固定5个协程
 
-	tasks := make(chan uint64, workers*2) // 通道设置内存大小
+	tasks := make(chan blockSpan, workers*2) // 通道设置内存大小
 	var wg sync.WaitGroup
 	var mu sync.Mutex  //互斥锁
 	var errorCount int // 协程解析单个区块错误数量
@@ -360,25 +527,20 @@ func (s *ABIScanner) scanRangeLive(start, end uint64, finality string) error {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for blockNum := range tasks {
-				if err := s.scanBlock(blockNum, finality); err != nil {
-					fmt.Printf("扫描区块:%v失败\n", blockNum)
-					mu.Lock()
-					errorCount++
-					mu.Unlock()
-					continue
+			for span := range tasks {
+				failed := s.scanSpan(span.from, span.to, finality)
+				for blockNum, err := range failed {
+					fmt.Printf("扫描区块:%v失败:%v\n", blockNum, err)
 				}
+				mu.Lock()
+				errorCount += len(failed)
+				mu.Unlock()
 			}
 		}()
 	}
 
 	// 开启生产者
-	go func() {
-		defer close(tasks) // 协程结束前关闭通道
-		for blockNum := start; blockNum <= end; blockNum++ {
-			tasks <- blockNum
-		}
-	}()
+	go s.produceSpans(start, end, tasks)
 
 	wg.Wait() // 阻塞进程消费者完成才会走下面业务
 
@@ -386,56 +548,198 @@ func (s *ABIScanner) scanRangeLive(start, end uint64, finality string) error {
 	finalErrors := errorCount
 	mu.Unlock()
 
-	fmt.Printf("%d区域，批次完成，扫描区块 %d-%d，错误数 %d\n", finality, start, end, finalErrors)
+	fmt.Printf("%s区域，批次完成，扫描区块 %d-%d，错误数 %d\n", finality, start, end, finalErrors)
 	return nil
 
 }
 
+// 生产者：按fetcher的span把 [start, end] 切成扫描任务
+func (s *ABIScanner) produceSpans(start, end uint64, tasks chan<- blockSpan) {
+	defer close(tasks) // 协程结束前关闭通道
+	span := s.fetcher.SpanSize()
+	for from := start; from <= end; from += span {
+		to := from + span - 1
+		if to > end {
+			to = end
+		}
+		tasks <- blockSpan{from: from, to: to}
+	}
+}
+
 /*
 单区块开始解析日志
 */
 func (s *ABIScanner) scanBlock(blockNum uint64, finality string) error {
-	receipts, err := blockchain.GetBlockReceipts(blockNum)
-	if err != nil {
-		return err
+	return s.scanSpan(blockNum, blockNum, finality)[blockNum]
+}
+
+/*
+一段区块 [from, to] 拉日志，再逐块解析
+区块头批量获取，用来校验段内父哈希连续、拿时间戳；解析成功的区块连同blocks表的记录攒进一个批次，
+最后在一个事务里写入，进程中途退出不会留下只写了一半的区块。
+logs模式没日志的区块没有区块头，blocks表只记扫描记录(audit对账用)，不记哈希。
+返回处理失败的区块及原因，整段拉取失败时段内所有区块都算失败。
+*/
+func (s *ABIScanner) scanSpan(from, to uint64, finality string) map[uint64]error {
+	failed := make(map[uint64]error)
+	failAll := func(err error) map[uint64]error {
+		for blockNum := from; blockNum <= to; blockNum++ {
+			failed[blockNum] = err
+		}
+		return failed
 	}
-	// 获取区块时间戳
-	blockTimestamp, err := blockchain.GetBlockTimestamp(blockNum)
+
+	headers, logsByBlock, err := s.fetchSpan(from, to)
 	if err != nil {
-		return err
+		return failAll(err)
 	}
-
-	var poolCount int
-	var swapCount int
-	for _, receipt := range receipts {
-		for _, log := range receipt.Logs {
-			if s.handlePoolLog(blockNum, receipt.TxHash.Hex(), log) {
-				poolCount++
-				continue
-			}
-			if s.handleSwapLog(blockNum, blockTimestamp, receipt.TxHash.Hex(), log, finality) {
-				swapCount++
+	for i := 1; i < len(headers); i++ {
+		if headers[i].Number == headers[i-1].Number+1 && headers[i].ParentHash != headers[i-1].Hash {
+			return failAll(fmt.Errorf("区块%d父哈希不连续，链可能正在重组", uint64(headers[i].Number)))
+		}
+	}
+	headerByNumber := make(map[uint64]*blockchain.BlockHeader, len(headers))
+	for _, header := range headers {
+		headerByNumber[uint64(header.Number)] = header
+	}
+
+	batch := repository.NewBatch()
+	var undo []func()
+	var processed []uint64
+	spanFees := make(map[string]int)
+	for blockNum := from; blockNum <= to; blockNum++ {
+		header := headerByNumber[blockNum]
+		if header == nil {
+			// 没日志也没拿区块头的区块，只记一条扫描记录
+			batch.AddBlock(&models.Block{Number: blockNum, FinalityStatus: finality})
+			processed = append(processed, blockNum)
+			continue
+		}
+		logs := logsByBlock[blockNum]
+		if err := checkLogsHash(blockNum, header, logs); err != nil {
+			failed[blockNum] = err
+			continue
+		}
+		block := &BlockContext{Number: blockNum, Timestamp: int64(header.Timestamp), Finality: finality, Logs: logs,
+			Batch: repository.NewBatch(), spanFees: spanFees}
+		var swapCount int
+		if len(logs) > 0 || !s.fetcher.SkipEmptyBlocks() {
+			swapCount, err = s.processBlockLogs(block)
+			if err != nil {
+				undoCache(block.undo) // 这个区块攒的行直接丢掉
+				failed[blockNum] = err
 				continue
 			}
 		}
+		block.Batch.AddBlock(&models.Block{
+			Number:         blockNum,
+			Hash:           header.Hash.Hex(),
+			ParentHash:     header.ParentHash.Hex(),
+			Timestamp:      int64(header.Timestamp),
+			FinalityStatus: finality,
+			SwapCount:      swapCount,
+		})
+		batch.Merge(block.Batch)
+		undo = append(undo, block.undo...)
+		processed = append(processed, blockNum)
+	}
+	// 整段都成功、正好接在stable进度后面时进度和数据一起提交；接不上的由stable worker扫完一批后统一推进
+	if finality == "safe" && len(failed) == 0 {
+		batch.AdvanceProgress("stable_scan", from, to, headers[0].ParentHash.Hex())
+	}
+	if err := s.flushBatch(batch, undo); err != nil {
+		for _, blockNum := range processed {
+			failed[blockNum] = err
+		}
 	}
-	if poolCount > 0 || swapCount > 0 {
-		fmt.Printf("✅ 扫描区块 %d: 发现 %d 个池子, %d 个Swap事件\n", blockNum, poolCount, swapCount)
-	} else {
-		fmt.Printf("  区块 %d: %d 笔交易\n", blockNum, len(receipts))
+	return failed
+}
+
+/*
+拉一段区块 [from, to] 的区块头和日志，区块头按区块号升序
+block_receipts 模式先拿整段区块头(里面有交易哈希)再拿回执；
+logs 模式先按范围拉日志，只拿有日志的区块和段首、段尾的区块头(段首的父哈希接上一段，段尾给下一段接)，
+没日志的区块不在返回的区块头里
+*/
+func (s *ABIScanner) fetchSpan(from, to uint64) ([]*blockchain.BlockHeader, map[uint64][]*types.Log, error) {
+	if !s.fetcher.SkipEmptyBlocks() {
+		headers, err := blockchain.GetBlockHeaders(from, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		logsByBlock, err := s.fetcher.FetchLogs(from, to, headers)
+		if err != nil {
+			return nil, nil, err
+		}
+		return headers, logsByBlock, nil
+	}
+
+	logsByBlock, err := s.fetcher.FetchLogs(from, to, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	numbers := []uint64{from}
+	for blockNum := range logsByBlock {
+		if blockNum > from && blockNum < to {
+			numbers = append(numbers, blockNum)
+		}
+	}
+	if to > from {
+		numbers = append(numbers, to)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	headers, err := blockchain.GetBlockHeadersAt(numbers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("批量获取区块头失败 %d-%d: %v", from, to, err)
+	}
+	return headers, logsByBlock, nil
+}
+
+// 日志所属区块哈希必须和区块头一致，否则日志和区块头来自不同的分叉
+func checkLogsHash(blockNum uint64, header *blockchain.BlockHeader, logs []*types.Log) error {
+	for _, log := range logs {
+		if log.BlockHash != header.Hash {
+			return fmt.Errorf("区块%d日志哈希与区块头不一致，链可能正在重组", blockNum)
+		}
 	}
 	return nil
+}
+
+// 解析单个区块的日志，要写入的行加进block.Batch，返回swap数；失败返回错误（该区块会进死信队列重试）
+func (s *ABIScanner) processBlockLogs(block *BlockContext) (int, error) {
+	blockNum, logs := block.Number, block.Logs
+	counts := make(map[string]int)
+	for _, log := range logs {
+		if err := s.processLog(block, log, counts); err != nil {
+			return 0, err
+		}
+	}
+	// 放在最后，这个区块新创建的池子也已经进了poolCache
+	s.archiveLogs(block)
+	if len(counts) > 0 {
+		fmt.Printf("✅ 扫描区块 %d: 发现 %s\n", blockNum, s.handlerSummary(counts))
+	} else {
+		fmt.Printf("  区块 %d: %d 条日志\n", blockNum, len(logs))
+	}
+	return counts[swapHandlerName], nil
+}
 
+// 解码出来的池子创建事件
+type poolCreation struct {
+	pool        *models.Pool
+	eventName   string
+	tickSpacing *int
 }
 
 /*
 解析Pool创建池类型日志
+解析不了的日志返回nil直接跳过
 */
-func (s *ABIScanner) handlePoolLog(blockNum uint64, txHash string, log *types.Log) bool {
+func (s *ABIScanner) decodePoolLog(block *BlockContext, log *types.Log) (interface{}, error) {
 	factoryAddr := strings.ToLower(log.Address.Hex()) // 如果是创建池子，log.address为工厂地址
 	info, ok := s.factoryInfoMap[factoryAddr]
 	if !ok {
-		return false // 不是我们跟踪的工厂
+		return nil, nil // 不是我们跟踪的工厂
 	}
 
 	eventName := info.EventName
@@ -445,72 +749,139 @@ func (s *ABIScanner) handlePoolLog(blockNum uint64, txHash string, log *types.Lo
 
 	contracABI := s.getABI(factoryAddr) // 获取对应ABI解析的日志信息
 	if contracABI == nil {
-		return false
+		return nil, nil
 	}
 
 	event, ok := contracABI.Events[eventName]
 	if !ok || log.Topics[0] != event.ID {
-		return false
+		return nil, nil
 	}
 
-	indexedCount := 0
-	for _, input := range event.Inputs {
-		if input.Indexed {
-			indexedCount++
-		}
+	// 解析indexed和非indexed数据，fee/tickSpacing 可能是indexed参数
+	data, err := decodeEvent(&event, log)
+	if err != nil {
+		fmt.Printf("解析PoolCreated失败:%v", err)
+		return nil, nil
 	}
-	if len(log.Topics) < indexedCount+1 {
-		return false
+	// token0 token1 从解码结果里取(配置的事件里不一定是indexed)，池子要进poolCache，地址和库里一样用小写
+	tokenA, okA := data["token0"].(common.Address)
+	tokenB, okB := data["token1"].(common.Address)
+	if !okA || !okB {
+		fmt.Printf("解析%s失败: 没有token0/token1字段\n", eventName)
+		return nil, nil
 	}
-
-	// 解析indexed参数 哈希截取创建池子的token0 token1代币类型地址
-	token0 := common.BytesToAddress(log.Topics[1].Bytes()).Hex()
-	token1 := common.BytesToAddress(log.Topics[2].Bytes()).Hex()
-
-	// 解析非indexed数据
-	data := make(map[string]interface{})
-	if err := contracABI.UnpackIntoMap(data, eventName, log.Data); err != nil {
-		fmt.Printf("解析PoolCreated失败:%v", err)
-		return false
+	token0, token1 := strings.ToLower(tokenA.Hex()), strings.ToLower(tokenB.Hex())
+	poolField := info.PoolField
+	if poolField == "" {
+		poolField = "pool"
 	}
-	poolAddr, _ := data["pool"].(common.Address) //获取到池子地址（创建池类型，池子地址在data中）
-
-	pool := &models.Pool{
-		PoolAddress:    poolAddr.Hex(),
-		FactoryAddress: log.Address.Hex(),
-		PoolType:       info.PoolType,
-		Version:        info.Version,
-		Token0:         token0,
-		Token1:         token1,
-		CreatedTx:      txHash,
-		CreatedBlock:   blockNum,
+	poolAddr, ok := data[poolField].(common.Address) //获取到池子地址（创建池类型，池子地址在data中）
+	if !ok {
+		fmt.Printf("解析%s失败: 没有池子地址字段%s\n", eventName, poolField)
+		return nil, nil
+	}
+
+	created := &poolCreation{
+		pool: &models.Pool{
+			PoolAddress:    strings.ToLower(poolAddr.Hex()),
+			FactoryAddress: strings.ToLower(log.Address.Hex()),
+			Protocol:       info.Protocol,
+			PoolType:       info.PoolType,
+			Version:        info.Version,
+			Token0:         token0,
+			Token1:         token1,
+			CreatedTx:      log.TxHash.Hex(),
+			CreatedBlock:   block.Number,
+		},
+		eventName: eventName,
+	}
+
+	if info.TickSpacingField != "" {
+		if v, ok := data[info.TickSpacingField].(*big.Int); ok && v != nil {
+			spacing := int(v.Int64())
+			created.tickSpacing = &spacing
+		}
 	}
 
-	// 创建池子默认会带着这个池子手续费
+	// 创建池子默认会带着这个池子手续费，事件不带的入库前在创建区块上读取
 	if info.FeeField != "" {
 		if v, ok := data[info.FeeField].(*big.Int); ok && v != nil {
-			fee := int(v.Int64())
-			pool.FeeRate = &fee
+			fee := info.feeToPPM(v)
+			created.pool.FeeRate = &fee
 		}
 	}
+	return created, nil
+}
 
-	if err := s.repo.SavePool(pool); err != nil {
-		fmt.Printf("保存池子失败：%v", err)
-		return false
+// 保存新池子和创建时的费率，加入poolCache
+func (s *ABIScanner) savePoolCreation(block *BlockContext, log *types.Log, decoded interface{}) error {
+	created := decoded.(*poolCreation)
+	pool := created.pool
+	var read *poolFeeRead
+	if pool.FeeRate == nil && block.feeReads != nil {
+		read = s.newPoolFeeRead(pool, created.tickSpacing)
+		*block.feeReads = append(*block.feeReads, read)
+	} else if pool.FeeRate == nil {
+		fee, err := s.fetchPoolFee(pool, created.tickSpacing, block.Number)
+		if err != nil {
+			return err
+		}
+		pool.FeeRate = fee
+	}
+	if pool.FeeRate != nil || read != nil {
+		pool.FeeBlock = block.Number
+	}
+
+	// 费率要批量读的池子，读到之后再和创建事件一起加进批次(批次里存的是副本)
+	if read == nil {
+		block.Batch.AddPool(pool)
+	}
+	if pool.FeeRate != nil || created.tickSpacing != nil || read != nil {
+		change := &models.PoolFeeChange{
+			BlockNumber:     block.Number,
+			BlockTimeStamp:  block.Timestamp,
+			TxHash:          log.TxHash.Hex(),
+			LogIndex:        int(log.Index),
+			ContractAddress: log.Address.Hex(),
+			PoolAddress:     pool.PoolAddress,
+			EventName:       created.eventName,
+			TickSpacing:     created.tickSpacing,
+			FeeRate:         pool.FeeRate,
+			FinalityStatus:  block.Finality,
+		}
+		if read != nil {
+			read.change = change
+		} else {
+			block.Batch.AddPoolFeeChange(change)
+		}
 	}
 
-	s.poolCacheMu.Lock()
-	s.poolCache[strings.ToLower(pool.PoolAddress)] = pool // 将池子信息缓存到内存中
-	s.poolCacheMu.Unlock()
+	s.cachePool(block, pool) // 将池子信息缓存到内存中，同一批次后面区块的swap要用
 
-	return true
+	s.tokens.Enqueue(pool.Token0, pool.Token1) // 没见过的代币交给后台解析元数据
+	return nil
+}
 
+/*
+兑换swap入库，批次写入后新插入的swap增量更新K线(flushBatch)
+*/
+func (s *ABIScanner) saveSwap(block *BlockContext, log *types.Log, decoded interface{}) error {
+	swap := decoded.(*models.SwapEvent)
+	pool := s.cachedPool(log.Address)
+
+	block.Batch.AddSwap(swap)
+	if s.poolFactory(pool).Swap == swapV3 {
+		if rangeSwap := s.decodeRangeSwap(swap, pool, log); rangeSwap != nil {
+			block.Batch.AddRangeSwap(rangeSwap)
+		}
+	}
+	return nil
 }
 
 /*
-解析兑换swap类型日志
+只解析不入库，不是我们跟踪的池子或解析不了返回nil（audit重新解码对账也用这个）
 */
-func (s *ABIScanner) handleSwapLog(blockNum uint64, blockTimestamp int64, txHash string, log *types.Log, finality string) bool {
+func (s *ABIScanner) decodeSwapLog(blockNum uint64, blockTimestamp int64, txHash string, log *types.Log, finality string) *models.SwapEvent {
 	poolAddress := strings.ToLower(log.Address.Hex()) //如果是swap类型，log.address为池子地址
 
 	s.poolCacheMu.RLock()
@@ -519,7 +890,7 @@ func (s *ABIScanner) handleSwapLog(blockNum uint64, blockTimestamp int64, txHash
 	if !ok { // 缓存中没有则从数据库获取
 		// poolFromDB, _ := s.repo.GetPoolByAddress(poolAddress)
 		// if poolFromDB == nil {
-		return false
+		return nil
 		// }
 		// s.poolCacheMu.Lock()
 		// s.poolCache[poolAddress] = poolFromDB
@@ -527,23 +898,16 @@ func (s *ABIScanner) handleSwapLog(blockNum uint64, blockTimestamp int64, txHash
 		// pool = poolFromDB
 	}
 
-	// 找到对应的 pool master ABI
-	key := fmt.Sprintf("%s:%s", pool.PoolType, pool.Version) // 如 classic:v2
-
-	masterAddr, ok := s.poolABIMap[key]
-	if !ok {
-		return false // 不支持此类型
-	}
-
-	contractABI := s.getABI(masterAddr)
+	// 找到对应的 pool master ABI（如 syncswap:classic:v2）
+	contractABI := s.poolEventABI(pool, "Swap")
 	if contractABI == nil {
-		return false
+		return nil // 不支持此类型
 	}
 
 	// 3. 校验事件签名（这里默认事件名都是 "Swap"，不同版本可做映射）
 	event, ok := contractABI.Events["Swap"]
 	if !ok || log.Topics[0] != event.ID {
-		return false
+		return nil
 	}
 
 	// 4. 解析 indexed & non-indexed 数据
@@ -553,16 +917,17 @@ func (s *ABIScanner) handleSwapLog(blockNum uint64, blockTimestamp int64, txHash
 	fields := make(map[string]interface{}) //解析log.data
 	if err := contractABI.UnpackIntoMap(fields, "Swap", log.Data); err != nil {
 		fmt.Printf("解析 Swap 失败: %v\n", err)
-		return false
+		return nil
 	}
 
+	// 按池子所属工厂的兑换语义解析数量
 	var tokenIn, tokenOut, amountIn, amountOut string
-	switch pool.PoolType {
-	case "range":
+	switch s.poolFactory(pool).Swap {
+	case swapV3:
 		amt0, _ := fields["amount0"].(*big.Int)
 		amt1, _ := fields["amount1"].(*big.Int)
 		if amt0 == nil || amt1 == nil {
-			return false
+			return nil
 		}
 		if amt0.Sign() < 0 {
 			tokenIn, tokenOut = pool.Token1, pool.Token0
@@ -577,7 +942,7 @@ func (s *ABIScanner) handleSwapLog(blockNum uint64, blockTimestamp int64, txHash
 		amt0Out, _ := fields["amount0Out"].(*big.Int)
 		amt1Out, _ := fields["amount1Out"].(*big.Int)
 		if amt0In == nil || amt1In == nil || amt0Out == nil || amt1Out == nil {
-			return false
+			return nil
 		}
 		if amt0In.Sign() > 0 {
 			tokenIn, tokenOut = pool.Token0, pool.Token1
@@ -595,22 +960,18 @@ func (s *ABIScanner) handleSwapLog(blockNum uint64, blockTimestamp int64, txHash
 		TxHash:         txHash,
 		LogIndex:       int(log.Index),
 		PoolAddress:    pool.PoolAddress,
+		Protocol:       pool.Protocol,
 		Sender:         sender,
 		Recipient:      recipient,
 		TokenIn:        tokenIn,
 		TokenOut:       tokenOut,
-		AmountIn:       amountIn,
-		AmountOut:      amountOut,
+		AmountIn:       models.BigInt(amountIn),
+		AmountOut:      models.BigInt(amountOut),
 		FinalityStatus: finality,
 	}
-
-	if err := s.repo.SaveSwapEvent(swap); err != nil {
-		fmt.Printf("保存 Swap 失败: %v\n", err)
-		return false
-	}
-
-	return true
-
+	swap.AmountInDecimal = s.normalizeAmount(tokenIn, amountIn)
+	swap.AmountOutDecimal = s.normalizeAmount(tokenOut, amountOut)
+	return swap
 }
 
 /*
@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"testing"
+	"zk-sync-go-pool/internal/abi"
+	"zk-sync-go-pool/internal/config"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+	"zk-sync-go-pool/internal/testsupport"
+)
+
+const (
+	testUSDC = "0x3355df6d4c9c3035724fd0e3914de96a5a83aaf4"
+	testWETH = "0x5aea5775959fbc2557cc8789bc1bf90a239d9a91"
+)
+
+func newTestStorage(t *testing.T) repository.Storage {
+	t.Helper()
+	return repository.NewRepository(testsupport.NewDB(t))
+}
+
+func newTestScanner(t *testing.T, pools ...*models.Pool) *ABIScanner {
+	repo := newTestStorage(t)
+	s := &ABIScanner{cfg: &config.Config{}, repo: repo, poolCache: make(map[string]*models.Pool), pairPools: make(map[string]map[string]bool)}
+	s.tokens = newTokenResolver(repo)
+	for _, pool := range pools {
+		s.setCachedPoolLocked(pool)
+	}
+	return s
+}
+
+// 按 config/config.yaml 的工厂、pool master 和 abi/ 目录里的ABI创建扫描器，能解码真实的池子事件
+func newConfiguredScanner(t *testing.T, pools ...*models.Pool) *ABIScanner {
+	t.Helper()
+	cfg, err := config.Load("../../config/config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Abi.SaveDir = "../../abi"
+	cfg.Abi.AutoDownload = false
+	if err := abi.DownloadABIs(&cfg.Abi); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Scanner.FetchMode = FetchModeLogs
+	cfg.Clickhouse.Enabled = false
+
+	repo := newTestStorage(t)
+	batch := repository.NewBatch()
+	for _, pool := range pools {
+		batch.AddPool(pool)
+	}
+	if _, err := repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	return NewABIScanner(cfg, repo)
+}
+
+func wethUSDCPool(address string) *models.Pool {
+	return &models.Pool{PoolAddress: address, Protocol: "syncswap", PoolType: "classic", Version: "v2", Token0: testWETH, Token1: testUSDC}
+}
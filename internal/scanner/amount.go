@@ -0,0 +1,58 @@
+package scanner
+
+import (
+	"math/big"
+	"strings"
+)
+
+const (
+	decimalIntDigits   = 35 // DECIMAL(65,30) 整数部分最多35位
+	decimalScaleDigits = 30 // DECIMAL(65,30) 小数部分30位
+)
+
+/*
+把wei字符串按decimals换算成精确小数字符串（纯字符串运算，不经过float）
+整数部分超出DECIMAL(65,30)范围返回false（一般是垃圾代币的超大数量），小数部分超过30位截断
+*/
+func formatUnits(raw string, decimals int) (string, bool) {
+	v, ok := new(big.Int).SetString(raw, 10)
+	if !ok || decimals < 0 {
+		return "", false
+	}
+	neg := v.Sign() < 0
+	digits := new(big.Int).Abs(v).String()
+
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	intPart := digits[:len(digits)-decimals]
+	fracPart := strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if len(intPart) > decimalIntDigits {
+		return "", false
+	}
+	if len(fracPart) > decimalScaleDigits {
+		fracPart = strings.TrimRight(fracPart[:decimalScaleDigits], "0")
+	}
+
+	result := intPart
+	if fracPart != "" {
+		result += "." + fracPart
+	}
+	if neg && strings.Trim(result, "0.") != "" {
+		result = "-" + result
+	}
+	return result, true
+}
+
+// 按代币精度换算，精度未知返回nil（等代币元数据解析后回填）；超出范围也返回nil，回填时按位数跳过这些数量
+func (s *ABIScanner) normalizeAmount(token, raw string) *string {
+	decimals, ok := s.tokens.Decimals(token)
+	if !ok {
+		return nil
+	}
+	amount, ok := formatUnits(raw, decimals)
+	if !ok {
+		return nil
+	}
+	return &amount
+}
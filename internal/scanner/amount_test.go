@@ -0,0 +1,34 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		decimals int
+		want     string
+		ok       bool
+	}{
+		{"zero decimals", "12345", 0, "12345", true},
+		{"18 decimals", "1500000000000000000", 18, "1.5", true},
+		{"18 decimals below one", "1", 18, "0.000000000000000001", true},
+		{"zero", "0", 18, "0", true},
+		{"negative", "-2500000", 6, "-2.5", true},
+		{"fraction truncated to 30 digits", "1" + strings.Repeat("0", 35) + "1", 36, "1", true},
+		{"largest integer part", strings.Repeat("9", 35), 0, strings.Repeat("9", 35), true},
+		{"integer part too large", strings.Repeat("9", 36), 0, "", false},
+		{"too large after decimals", strings.Repeat("9", 54), 18, "", false},
+		{"not a number", "0x10", 18, "", false},
+		{"negative decimals", "1", -1, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := formatUnits(tt.raw, tt.decimals)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: formatUnits(%s, %d) = %q, %v; want %q, %v", tt.name, tt.raw, tt.decimals, got, ok, tt.want, tt.ok)
+		}
+	}
+}
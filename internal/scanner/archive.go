@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 路由器地址(小写)
+func (s *ABIScanner) routerAddresses() map[string]bool {
+	routers := s.cfg.Syncswap.Routers
+	addresses := make(map[string]bool)
+	for _, address := range []string{routers.V1, routers.V2, routers.V3} {
+		if address != "" {
+			addresses[strings.ToLower(address)] = true
+		}
+	}
+	return addresses
+}
+
+/*
+日志来自哪类跟踪的合约，以及解码用的ABI
+工厂和路由器用合约自身的ABI，池子用对应的pool master；不是跟踪的合约返回空
+*/
+func (s *ABIScanner) trackedContract(log *types.Log) (string, *ethabi.ABI) {
+	address := strings.ToLower(log.Address.Hex())
+	if _, ok := s.factoryInfoMap[address]; ok {
+		return "factory", s.getABI(address)
+	}
+	if s.routers[address] {
+		return "router", s.getABI(address)
+	}
+	if pool := s.cachedPool(log.Address); pool != nil {
+		return "pool", s.poolEventABIByID(pool, log.Topics[0])
+	}
+	return "", nil
+}
+
+// 按事件签名找池子的ABI，和 poolEventABI 一样先找自己类型的pool master，再找同版本classic的
+func (s *ABIScanner) poolEventABIByID(pool *models.Pool, topic common.Hash) *ethabi.ABI {
+	for _, key := range s.poolABIKeys(pool) {
+		masterAddr, ok := s.poolABIMap[key]
+		if !ok {
+			continue
+		}
+		if contractABI := s.getABI(masterAddr); contractABI != nil {
+			if _, err := contractABI.EventByID(topic); err == nil {
+				return contractABI
+			}
+		}
+	}
+	return nil
+}
+
+/*
+归档一个区块里跟踪合约的日志(scanner.archive_events)
+保留原始topics/data，ABI里有的事件同时存解码后的参数，之后新增的表可以直接从库里推导，不用再请求RPC
+*/
+func (s *ABIScanner) archiveLogs(block *BlockContext) {
+	if !s.cfg.Scanner.ArchiveEvents {
+		return
+	}
+	var events []*models.DecodedEvent
+	for _, log := range block.Logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		kind, contractABI := s.trackedContract(log)
+		if kind == "" {
+			continue
+		}
+		topics := make([]string, len(log.Topics))
+		for i, topic := range log.Topics {
+			topics[i] = topic.Hex()
+		}
+		topicsJSON, _ := json.Marshal(topics)
+		event := &models.DecodedEvent{
+			BlockNumber:     block.Number,
+			BlockTimeStamp:  block.Timestamp,
+			TxHash:          log.TxHash.Hex(),
+			LogIndex:        int(log.Index),
+			ContractAddress: log.Address.Hex(),
+			ContractKind:    kind,
+			Topic0:          log.Topics[0].Hex(),
+			Topics:          string(topicsJSON),
+			Data:            hexutil.Encode(log.Data),
+			FinalityStatus:  block.Finality,
+		}
+		if contractABI != nil {
+			if abiEvent, err := contractABI.EventByID(log.Topics[0]); err == nil {
+				event.EventName, event.Signature = abiEvent.Name, abiEvent.Sig
+				if fields, err := decodeEvent(abiEvent, log); err == nil {
+					args := make(map[string]interface{}, len(fields))
+					for name, value := range fields {
+						args[name] = archiveValue(value)
+					}
+					if data, err := json.Marshal(args); err == nil {
+						value := string(data)
+						event.Args = &value
+					}
+				}
+			}
+		}
+		events = append(events, event)
+	}
+	block.Batch.AddDecodedEvents(events...)
+}
+
+// 参数转成JSON里好用的形式：大整数用十进制字符串，地址和字节用0x十六进制
+func archiveValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *big.Int:
+		return v.String()
+	case common.Address:
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	case []byte:
+		return hexutil.Encode(v)
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return hexutil.Encode(b)
+		}
+		fallthrough
+	case reflect.Slice:
+		items := make([]interface{}, rv.Len())
+		for i := range items {
+			items[i] = archiveValue(rv.Index(i).Interface())
+		}
+		return items
+	}
+	return value
+}
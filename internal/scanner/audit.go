@@ -0,0 +1,210 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const auditChunkSize = 10000 // 每次从blocks表读取的区块数
+
+// audit 参数
+type AuditOptions struct {
+	From    uint64 // 为0则从 scanner.start_block 的下一个区块开始(起始区块本身不扫描)
+	To      uint64 // 为0则使用 stable_scan 进度
+	Verify  bool   // 重新从链上拉日志解码，和库里的swap数对比
+	Reindex bool   // 发现问题的区块走scanRange重新索引
+}
+
+// swap数对不上的区块
+type AuditMismatch struct {
+	BlockNumber uint64
+	Ledger      int // 扫描时记录的swap数
+	Stored      int // swap_events表里实际的条数
+	Decoded     int // 重新解码得到的条数，没开Verify时为-1
+}
+
+type AuditReport struct {
+	From       uint64
+	To         uint64
+	Missing    []uint64 // blocks表里没有记录的区块
+	Mismatched []AuditMismatch
+}
+
+/*
+数据完整性审计
+1. blocks表(每个区块的扫描记录)对比 (start_block, stable_scan]，找出没扫过的区块
+2. 扫描时记录的swap数和swap_events表实际条数对比，pending删除重建、入库失败都会造成不一致
+3. Verify时重新拉日志解码(不入库)，和swap_events表对比
+Reindex时把有问题的区块合并成连续区间，按原来的scanRange流程重新扫描，失败的照样进死信队列，
+之后推导任务(定价、汇总、ClickHouse)的进度退回到第一个重新索引的区块之前。
+*/
+func (s *ABIScanner) Audit(opts AuditOptions) (*AuditReport, error) {
+	report := &AuditReport{From: opts.From, To: opts.To}
+	if report.From == 0 {
+		report.From = uint64(s.cfg.Scanner.StartBlock) + 1
+	}
+	if report.To == 0 {
+		progress, err := s.repo.GetScanProgress("stable_scan")
+		if err != nil {
+			return nil, err
+		}
+		report.To = progress
+	}
+	if report.To < report.From {
+		return nil, fmt.Errorf("审计范围不正确: %d-%d", report.From, report.To)
+	}
+	fmt.Printf("开始审计区块 %d-%d\n", report.From, report.To)
+
+	for from := report.From; from <= report.To; from += auditChunkSize {
+		to := from + auditChunkSize - 1
+		if to > report.To {
+			to = report.To
+		}
+		if err := s.auditChunk(from, to, opts.Verify, report); err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Printf("审计完成: 缺失区块 %d 个，swap数不一致区块 %d 个\n", len(report.Missing), len(report.Mismatched))
+	for _, span := range report.spans(false) {
+		fmt.Printf("  缺失区块: %d-%d\n", span.from, span.to)
+	}
+	for _, m := range report.Mismatched {
+		fmt.Printf("  区块 %d: 扫描记录 %d，已入库 %d，重新解码 %d\n", m.BlockNumber, m.Ledger, m.Stored, m.Decoded)
+	}
+
+	if opts.Reindex {
+		spans := report.spans(true)
+		for _, span := range spans {
+			fmt.Printf("重新索引区块 %d-%d\n", span.from, span.to)
+			if err := s.scanRange(span.from, span.to, "safe"); err != nil {
+				return report, err
+			}
+		}
+		// 补写的swap要重新定价、汇总、同步ClickHouse
+		if len(spans) > 0 {
+			if err := s.rewindDerivedProgress(spans[0].from - 1); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+func (s *ABIScanner) auditChunk(from, to uint64, verify bool, report *AuditReport) error {
+	blocks, err := s.repo.GetBlocks(from, to)
+	if err != nil {
+		return err
+	}
+	stored, err := s.repo.CountSwapsByBlock(from, to)
+	if err != nil {
+		return err
+	}
+	var decoded map[uint64]int
+	if verify {
+		if decoded, err = s.decodeSwapCounts(from, to); err != nil {
+			return err
+		}
+	}
+
+	ledger := make(map[uint64]int, len(blocks))
+	for _, block := range blocks {
+		ledger[block.Number] = block.SwapCount
+	}
+	for n := from; n <= to; n++ {
+		count, ok := ledger[n]
+		if !ok {
+			report.Missing = append(report.Missing, n)
+			continue
+		}
+		m := AuditMismatch{BlockNumber: n, Ledger: count, Stored: stored[n], Decoded: -1}
+		if verify {
+			m.Decoded = decoded[n]
+		}
+		if m.Ledger != m.Stored || (verify && m.Decoded != m.Stored) {
+			report.Mismatched = append(report.Mismatched, m)
+		}
+	}
+	return nil
+}
+
+// 并发拉取 [from, to] 的日志重新解码，返回每个区块的swap数
+func (s *ABIScanner) decodeSwapCounts(from, to uint64) (map[uint64]int, error) {
+	workers := s.cfg.Scanner.Workers
+	if workers == 0 {
+		workers = 5
+	}
+
+	counts := make(map[uint64]int)
+	tasks := make(chan blockSpan, workers*2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for span := range tasks {
+				spanCounts, err := s.decodeSpanSwaps(span.from, span.to)
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("重新解码区块 %d-%d 失败: %v", span.from, span.to, err)
+				}
+				for n, c := range spanCounts {
+					counts[n] = c
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	go s.produceSpans(from, to, tasks)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return counts, nil
+}
+
+func (s *ABIScanner) decodeSpanSwaps(from, to uint64) (map[uint64]int, error) {
+	headers, logsByBlock, err := s.fetchSpan(from, to)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint64]int)
+	for _, header := range headers {
+		blockNum := uint64(header.Number)
+		for _, log := range logsByBlock[blockNum] {
+			if len(log.Topics) == 0 {
+				continue
+			}
+			if s.decodeSwapLog(blockNum, int64(header.Timestamp), log.TxHash.Hex(), log, "safe") != nil {
+				counts[blockNum]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+// 把有问题的区块合并成连续区间，withMismatched为false时只看缺失区块
+func (r *AuditReport) spans(withMismatched bool) []blockSpan {
+	numbers := append([]uint64(nil), r.Missing...)
+	if withMismatched {
+		for _, m := range r.Mismatched {
+			numbers = append(numbers, m.BlockNumber)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	var spans []blockSpan
+	for _, n := range numbers {
+		if len(spans) > 0 && spans[len(spans)-1].to+1 == n {
+			spans[len(spans)-1].to = n
+			continue
+		}
+		spans = append(spans, blockSpan{from: n, to: n})
+	}
+	return spans
+}
@@ -0,0 +1,128 @@
+package scanner
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// classic池子的Swap日志，用USDC买WETH(池子token0=WETH)
+func classicSwapLog(t *testing.T, s *ABIScanner, pool *models.Pool, block uint64, index uint, usdcIn, wethOut int64) types.Log {
+	t.Helper()
+	event := s.poolEventABI(pool, "Swap").Events["Swap"]
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(0), big.NewInt(usdcIn), big.NewInt(wethOut), big.NewInt(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Log{
+		Address:     common.HexToAddress(pool.PoolAddress),
+		Topics:      []common.Hash{event.ID, common.HexToHash("0x01"), common.HexToHash("0x02")},
+		Data:        data,
+		BlockNumber: block,
+		TxHash:      common.BigToHash(new(big.Int).SetUint64(block*100 + uint64(index))),
+		Index:       index,
+	}
+}
+
+func TestAuditFindsGapsAndMismatchesAndReindexes(t *testing.T) {
+	chain := newFakeChain(t, 300)
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000a1")
+	s := newConfiguredScanner(t, pool)
+	chain.addLog(classicSwapLog(t, s, pool, 103, 0, 2000, 1))
+	chain.addLog(classicSwapLog(t, s, pool, 107, 0, 2000, 1))
+
+	// 105 没扫过
+	for _, span := range []blockSpan{{100, 104}, {106, 110}} {
+		if failed := s.scanSpan(span.from, span.to, "safe"); len(failed) > 0 {
+			t.Fatalf("scanSpan %d-%d failed: %v", span.from, span.to, failed)
+		}
+	}
+	// 107 扫描时记了2条，库里只有1条
+	stored, err := s.repo.GetBlock(107)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.SwapCount = 2
+	batch := repository.NewBatch()
+	batch.AddBlock(stored)
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range derivedTasks {
+		if err := s.repo.InitScanProgress(task, 110); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := s.Audit(AuditOptions{From: 100, To: 110})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Missing, []uint64{105}) {
+		t.Fatalf("missing = %v, want [105]", report.Missing)
+	}
+	want := []AuditMismatch{{BlockNumber: 107, Ledger: 2, Stored: 1, Decoded: -1}}
+	if !reflect.DeepEqual(report.Mismatched, want) {
+		t.Fatalf("mismatched = %+v, want %+v", report.Mismatched, want)
+	}
+
+	// 链上107确实有2条，重新解码能对上扫描记录
+	chain.addLog(classicSwapLog(t, s, pool, 107, 1, 4000, 2))
+	report, err = s.Audit(AuditOptions{From: 100, To: 110, Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []AuditMismatch{{BlockNumber: 107, Ledger: 2, Stored: 1, Decoded: 2}}
+	if !reflect.DeepEqual(report.Mismatched, want) {
+		t.Fatalf("verified mismatched = %+v, want %+v", report.Mismatched, want)
+	}
+
+	// 重新索引补上缺的区块和swap，推导任务退回到第一个重新索引的区块之前
+	if _, err := s.Audit(AuditOptions{From: 100, To: 110, Reindex: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range derivedTasks {
+		if progress, _ := s.repo.GetScanProgress(task); progress != 104 {
+			t.Fatalf("%s progress = %d after reindex, want 104", task, progress)
+		}
+	}
+	report, err = s.Audit(AuditOptions{From: 100, To: 110, Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Missing) != 0 || len(report.Mismatched) != 0 {
+		t.Fatalf("after reindex: missing %v, mismatched %+v", report.Missing, report.Mismatched)
+	}
+}
+
+func TestAuditDefaultRangeStartsAfterStartBlock(t *testing.T) {
+	newFakeChain(t, 300)
+	s := newConfiguredScanner(t)
+	s.cfg.Scanner.StartBlock = 99
+	// stable进度初始化在起始区块，起始区块本身不扫描
+	if err := s.repo.InitScanProgress("stable_scan", 99); err != nil {
+		t.Fatal(err)
+	}
+	if failed := s.scanSpan(100, 110, "safe"); len(failed) > 0 {
+		t.Fatalf("scanSpan failed: %v", failed)
+	}
+	if err := s.repo.UpdateScanProgress("stable_scan", 110); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.Audit(AuditOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.From != 100 || report.To != 110 {
+		t.Fatalf("default range = %d-%d, want 100-110", report.From, report.To)
+	}
+	if len(report.Missing) != 0 || len(report.Mismatched) != 0 {
+		t.Fatalf("missing %v, mismatched %+v; want a clean audit", report.Missing, report.Mismatched)
+	}
+}
@@ -0,0 +1,179 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"zk-sync-go-pool/internal/blockchain"
+	"zk-sync-go-pool/internal/repository"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const defaultBootstrapSpan = 10000 // 默认每次 eth_getLogs 扫描的区块数
+
+/*
+导入 start_block 之前创建的池子
+从创世区块到 start_block 按SyncSwap工厂地址 + PoolCreated(以及range工厂的默认费率事件)拉日志，
+和正常扫描一样交给日志处理器入库，之后这些池子的swap才不会因为不在poolCache里被丢掉。
+classic/stable/aqua工厂没有枚举池子的view方法(只有range工厂有allPools)，所以统一用日志扫描；
+池子费率不在各自的创建区块上一个个读，每段日志里的新池子在 start_block 上合成一个批量请求读取，
+扫描从 start_block 开始，用到的也是这时的费率；
+进度记在 scan_progress(pool_bootstrap)，中断后重启从上次的位置继续。
+*/
+func (s *ABIScanner) bootstrapPools(ctx context.Context) error {
+	end := uint64(s.cfg.Scanner.StartBlock)
+	if !s.cfg.Scanner.BootstrapPools || end == 0 {
+		return nil
+	}
+	state, err := s.repo.GetScanTask("pool_bootstrap")
+	if err != nil {
+		return err
+	}
+	if state != nil && state.LastScannedBlock >= end {
+		return nil
+	}
+
+	// 其他协议的池子由 bootstrapProtocols 按各自的进度导入
+	factoryAddrs, factoryTopics := s.factoryFilters(defaultProtocol)
+	if len(factoryAddrs) == 0 || len(factoryTopics) == 0 {
+		return nil
+	}
+	query := ethereum.FilterQuery{Addresses: factoryAddrs, Topics: [][]common.Hash{factoryTopics}}
+
+	fmt.Printf("导入起始区块之前的池子: 区块 0-%d\n", end)
+	counts, err := s.sweepLogs(ctx, "pool_bootstrap", []ethereum.FilterQuery{query}, 0, end, end)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ 导入起始区块之前的池子完成: %d 个\n", counts[poolHandlerName])
+	return nil
+}
+
+/*
+按 bootstrap_span 分段用 eth_getLogs 扫描 [start, end]，每段用所有查询条件拉日志后一起交给处理器入库
+feeAt 不为0时新池子的费率统一在这个区块上批量读取，为0在各自的创建区块上读；
+进度记在 scan_progress(task)，中断后重启从上次的位置继续。
+返回各处理器处理的条数
+*/
+func (s *ABIScanner) sweepLogs(ctx context.Context, task string, queries []ethereum.FilterQuery, start, end uint64,
+	feeAt uint64) (map[string]int, error) {
+	counts := make(map[string]int)
+	state, err := s.repo.GetScanTask(task)
+	if err != nil {
+		return nil, err
+	}
+	from := start
+	if state == nil {
+		// 进度记的是处理完的最后一个区块
+		progress := start
+		if progress > 0 {
+			progress--
+		}
+		if err := s.repo.InitScanProgress(task, progress); err != nil {
+			return nil, err
+		}
+	} else if state.LastScannedBlock >= from {
+		from = state.LastScannedBlock + 1
+	}
+	span := uint64(s.cfg.Scanner.BootstrapSpan)
+	if span == 0 {
+		span = defaultBootstrapSpan
+	}
+
+	for from <= end {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		to := from + span - 1
+		if to > end {
+			to = end
+		}
+		var logs []types.Log
+		for _, query := range queries {
+			queried, err := getLogsAdaptive(query, from, to)
+			if err != nil {
+				return nil, fmt.Errorf("拉取区块%d-%d日志失败: %v", from, to, err)
+			}
+			logs = append(logs, queried...)
+		}
+		// 这一段的数据和进度在一个事务里写入
+		batch := repository.NewBatch()
+		undo, err := s.processLogSweep(logs, batch, counts, feeAt)
+		if err != nil {
+			undoCache(undo)
+			return nil, err
+		}
+		batch.SetProgress(task, to)
+		if err := s.flushBatch(batch, undo); err != nil {
+			return nil, err
+		}
+		from = to + 1
+	}
+	return counts, nil
+}
+
+// 按链上顺序处理一段日志，要写入的行加进batch，counts按处理器累计；返回对poolCache改动的撤销
+func (s *ABIScanner) processLogSweep(logs []types.Log, batch *repository.Batch, counts map[string]int, feeAt uint64) ([]func(), error) {
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	var undo []func()
+	var block *BlockContext
+	var feeReads []*poolFeeRead
+	spanFees := make(map[string]int)
+	for i := range logs {
+		log := &logs[i]
+		if log.Removed {
+			continue
+		}
+		if block == nil || block.Number != log.BlockNumber {
+			// 不是所有节点都在日志里返回区块时间
+			blockTimestamp := int64(log.BlockTimestamp)
+			if blockTimestamp == 0 {
+				var err error
+				if blockTimestamp, err = blockchain.GetBlockTimestamp(log.BlockNumber); err != nil {
+					return undo, err
+				}
+			}
+			block = &BlockContext{Number: log.BlockNumber, Timestamp: blockTimestamp, Finality: "safe", Batch: batch, spanFees: spanFees}
+			if feeAt > 0 {
+				block.feeReads = &feeReads
+			}
+		}
+		block.Logs = append(block.Logs, log)
+		err := s.processLog(block, log, counts)
+		undo = append(undo, block.undo...)
+		block.undo = nil
+		if err != nil {
+			return undo, err
+		}
+	}
+
+	if len(feeReads) == 0 {
+		return undo, nil
+	}
+	if err := s.readPoolFees(feeReads, feeAt); err != nil {
+		return undo, err
+	}
+	for _, read := range feeReads {
+		read.pool.FeeRate = read.fee
+		if read.fee == nil {
+			read.pool.FeeBlock = 0
+		}
+		batch.AddPool(read.pool)
+		if read.change != nil {
+			read.change.FeeRate = read.fee
+			batch.AddPoolFeeChange(read.change)
+		}
+	}
+	return undo, nil
+}
@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"zk-sync-go-pool/internal/abi"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	classicV2Factory = "0x0a34FBDf37C246C0B401da5f00ABd6529d906193"
+	rangeV3Factory   = "0x9D63d318143cF14FF05f8AAA7491904A494e6f13"
+)
+
+// 按工厂ABI编码一条 PoolCreated 日志，token0/token1(以及tickSpacing)是indexed参数
+func poolCreatedLog(t *testing.T, s *ABIScanner, factory string, block uint64, pool common.Address, topics ...common.Hash) types.Log {
+	t.Helper()
+	event := s.getABI(factory).Events["PoolCreated"]
+	data, err := event.Inputs.NonIndexed().Pack(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types.Log{
+		Address:     common.HexToAddress(factory),
+		Topics:      append([]common.Hash{event.ID}, topics...),
+		Data:        data,
+		BlockNumber: block,
+		// 和 fakeChain 的区块时间一致
+		BlockTimestamp: 1700000000 + block,
+		TxHash:         common.BigToHash(new(big.Int).SetUint64(block)),
+	}
+}
+
+func TestBootstrapImportsPoolsCreatedBeforeStartBlock(t *testing.T) {
+	chain := newFakeChain(t, 1000)
+	getSwapFee, fee := poolFeeABI.Methods["getSwapFee"], poolFeeABI.Methods["fee"]
+	chain.call = func(to common.Address, data []byte) ([]byte, error) {
+		switch {
+		case bytes.HasPrefix(data, getSwapFee.ID):
+			return getSwapFee.Outputs.Pack(big.NewInt(300)) // 0.3%，十万分之一
+		case bytes.HasPrefix(data, fee.ID):
+			return fee.Outputs.Pack(big.NewInt(500))
+		}
+		return nil, errUnsupported
+	}
+	s := newConfiguredScanner(t)
+	s.cfg.Scanner.StartBlock = 500
+	s.cfg.Scanner.BootstrapPools = true
+	s.cfg.Scanner.BootstrapSpan = 100
+
+	weth, usdc := common.BytesToHash(common.HexToAddress(testWETH).Bytes()), common.BytesToHash(common.HexToAddress(testUSDC).Bytes())
+	classic := common.HexToAddress("0x00000000000000000000000000000000000000e1")
+	rangePool := common.HexToAddress("0x00000000000000000000000000000000000000e2")
+	later := common.HexToAddress("0x00000000000000000000000000000000000000e3")
+	chain.addLog(poolCreatedLog(t, s, classicV2Factory, 50, classic, weth, usdc))
+	chain.addLog(poolCreatedLog(t, s, rangeV3Factory, 320, rangePool, weth, usdc, signedTopic(10)))
+	// start_block 之后创建的池子由正常扫描处理
+	chain.addLog(poolCreatedLog(t, s, classicV2Factory, 600, later, weth, usdc))
+
+	if err := s.bootstrapPools(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		address  common.Address
+		poolType string
+		block    uint64
+		fee      int
+	}{{classic, "classic", 50, 3000}, {rangePool, "range", 320, 500}} {
+		pool, err := s.repo.GetPoolByAddress(want.address.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pool == nil {
+			t.Fatalf("pool %s created at block %d not imported", want.address.Hex(), want.block)
+		}
+		if pool.PoolType != want.poolType || pool.CreatedBlock != want.block || pool.Token0 != testWETH || pool.Token1 != testUSDC {
+			t.Fatalf("pool %s = %s created at %d tokens %s/%s", want.address.Hex(), pool.PoolType, pool.CreatedBlock, pool.Token0, pool.Token1)
+		}
+		// 费率在 start_block 上批量读取
+		if pool.FeeRate == nil || *pool.FeeRate != want.fee {
+			t.Fatalf("pool %s fee = %v, want %d", want.address.Hex(), pool.FeeRate, want.fee)
+		}
+		if s.cachedPool(want.address) == nil {
+			t.Fatalf("pool %s not in poolCache", want.address.Hex())
+		}
+	}
+	if pool, _ := s.repo.GetPoolByAddress(later.Hex()); pool != nil {
+		t.Fatal("pool created after start_block imported by bootstrap")
+	}
+	if progress, _ := s.repo.GetScanProgress("pool_bootstrap"); progress != 500 {
+		t.Fatalf("bootstrap progress = %d, want 500", progress)
+	}
+
+	// 已经导入完成，重启不再拉日志
+	chain.addLog(poolCreatedLog(t, s, classicV2Factory, 400, later, weth, usdc))
+	if err := s.bootstrapPools(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pool, _ := s.repo.GetPoolByAddress(later.Hex()); pool != nil {
+		t.Fatal("bootstrap ran again after completing")
+	}
+}
+
+func TestConfiguredFactoryEventReadsTokensFromDecodedFields(t *testing.T) {
+	const factory = "0x00000000000000000000000000000000000000f1"
+	// token1 不是indexed；Deployed 只有一个indexed参数，也没有token字段
+	factoryABI, err := ethabi.JSON(strings.NewReader(`[
+		{"type":"event","name":"PairCreated","inputs":[{"name":"token0","type":"address","indexed":true},{"name":"token1","type":"address","indexed":false},{"name":"pair","type":"address","indexed":false}]},
+		{"type":"event","name":"Deployed","inputs":[{"name":"pool","type":"address","indexed":true}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	abi.ABIs[factory] = &factoryABI
+	t.Cleanup(func() { delete(abi.ABIs, factory) })
+
+	s := newTestScanner(t)
+	s.factoryInfoMap = map[string]factoryInfo{factory: {Protocol: "uniswap", PoolType: "classic", Version: "v2", EventName: "PairCreated", PoolField: "pair"}}
+	token0, token1, pair := common.HexToAddress(testWETH), common.HexToAddress(testUSDC), common.HexToAddress("0xe1")
+	event := factoryABI.Events["PairCreated"]
+	data, err := event.Inputs.NonIndexed().Pack(token1, pair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &BlockContext{Number: 100}
+	log := &types.Log{Address: common.HexToAddress(factory), Topics: []common.Hash{event.ID, common.BytesToHash(token0.Bytes())}, Data: data}
+	decoded, err := s.decodePoolLog(block, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, ok := decoded.(*poolCreation)
+	if !ok || created.pool.Token0 != testWETH || created.pool.Token1 != testUSDC || created.pool.PoolAddress != strings.ToLower(pair.Hex()) {
+		t.Fatalf("decoded %+v", decoded)
+	}
+
+	// 事件里没有token字段时跳过，不能按topic下标越界
+	s.factoryInfoMap[factory] = factoryInfo{Protocol: "uniswap", PoolType: "classic", Version: "v2", EventName: "Deployed"}
+	deployed := factoryABI.Events["Deployed"]
+	log = &types.Log{Address: common.HexToAddress(factory), Topics: []common.Hash{deployed.ID, common.BytesToHash(pair.Bytes())}}
+	if decoded, err := s.decodePoolLog(block, log); err != nil || decoded != nil {
+		t.Fatalf("event without tokens = %+v, %v", decoded, err)
+	}
+}
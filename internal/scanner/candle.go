@@ -0,0 +1,408 @@
+package scanner
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const candleBatchSize = 1000 // 重建K线时每批读取/写入条数
+
+// K线周期，从小到大，大周期由前一个小周期合成
+var candlePeriods = []struct {
+	name    string
+	seconds int64
+}{
+	{"1m", 60},
+	{"5m", 300},
+	{"1h", 3600},
+	{"1d", 86400},
+}
+
+// 一个K线市场：单个池子，或者同一交易对的所有池子
+type candleMarket struct {
+	marketType string   // pool/pair
+	market     string   // 池子地址 或 token0-token1（小写）
+	base       string   // 计价的token0，价格 = token1数量/token0数量
+	pools      []string // 参与聚合的池子地址
+}
+
+// 池子所属的两个市场
+func (s *ABIScanner) candleMarkets(pool *models.Pool) []candleMarket {
+	lo, _ := pairTokens(pool)
+	pair := pairKey(pool)
+	pairPools := []string{}
+	s.poolCacheMu.RLock()
+	for address := range s.pairPools[pair] {
+		pairPools = append(pairPools, address)
+	}
+	s.poolCacheMu.RUnlock()
+	sort.Strings(pairPools)
+
+	return []candleMarket{
+		{marketType: "pool", market: strings.ToLower(pool.PoolAddress), base: strings.ToLower(pool.Token0), pools: []string{pool.PoolAddress}},
+		{marketType: "pair", market: pair, base: lo, pools: pairPools},
+	}
+}
+
+// 交易对的两个代币，小写后地址小的在前
+func pairTokens(pool *models.Pool) (string, string) {
+	t0, t1 := strings.ToLower(pool.Token0), strings.ToLower(pool.Token1)
+	if t0 > t1 {
+		t0, t1 = t1, t0
+	}
+	return t0, t1
+}
+
+// 交易对市场的名称，也是 pairPools 的键
+func pairKey(pool *models.Pool) string {
+	lo, hi := pairTokens(pool)
+	return lo + "-" + hi
+}
+
+/*
+把一笔swap转成只有一笔成交的K线，方便和已有K线合并
+换算数量未知(代币精度还没解析)或者价格超出DECIMAL(65,30)范围的返回nil
+*/
+func swapCandle(swap *models.SwapEvent, base string) *models.Candle {
+	if swap.AmountInDecimal == nil || swap.AmountOutDecimal == nil {
+		return nil
+	}
+	amountIn, ok1 := new(big.Rat).SetString(*swap.AmountInDecimal)
+	amountOut, ok2 := new(big.Rat).SetString(*swap.AmountOutDecimal)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	amount0, amount1 := amountOut, amountIn
+	if strings.EqualFold(swap.TokenIn, base) {
+		amount0, amount1 = amountIn, amountOut
+	}
+	if amount0.Sign() == 0 || amount1.Sign() == 0 {
+		return nil
+	}
+	price, ok := ratDecimal(new(big.Rat).Quo(amount1, amount0))
+	if !ok || price == "0" {
+		return nil
+	}
+	return &models.Candle{
+		Open:          price,
+		High:          price,
+		Low:           price,
+		Close:         price,
+		Volume0:       addRat("0", amount0.FloatString(decimalScaleDigits)),
+		Volume1:       addRat("0", amount1.FloatString(decimalScaleDigits)),
+		TradeCount:    1,
+		OpenBlock:     swap.BlockNumber,
+		OpenLogIndex:  swap.LogIndex,
+		CloseBlock:    swap.BlockNumber,
+		CloseLogIndex: swap.LogIndex,
+	}
+}
+
+/*
+合并K线：高低取极值、成交量相加，开盘/收盘按swap在链上的先后决定
+src 可以是单笔swap，也可以是小周期K线
+*/
+func mergeCandle(dst, src *models.Candle) {
+	if compareRat(src.High, dst.High) > 0 {
+		dst.High = src.High
+	}
+	if compareRat(src.Low, dst.Low) < 0 {
+		dst.Low = src.Low
+	}
+	dst.Volume0 = addRat(dst.Volume0, src.Volume0)
+	dst.Volume1 = addRat(dst.Volume1, src.Volume1)
+	dst.TradeCount += src.TradeCount
+	if before(src.OpenBlock, src.OpenLogIndex, dst.OpenBlock, dst.OpenLogIndex) {
+		dst.Open, dst.OpenBlock, dst.OpenLogIndex = src.Open, src.OpenBlock, src.OpenLogIndex
+	}
+	if before(dst.CloseBlock, dst.CloseLogIndex, src.CloseBlock, src.CloseLogIndex) {
+		dst.Close, dst.CloseBlock, dst.CloseLogIndex = src.Close, src.CloseBlock, src.CloseLogIndex
+	}
+}
+
+// 新开一根K线
+func newCandle(market candleMarket, period string, bucketStart int64, src *models.Candle) *models.Candle {
+	candle := *src
+	candle.ID = 0
+	candle.MarketType = market.marketType
+	candle.Market = market.market
+	candle.Period = period
+	candle.BucketStart = bucketStart
+	return &candle
+}
+
+/*
+新入库的swap增量更新K线（每个市场每个周期一根），SaveBatch 在写入swap的事务里调用
+只对新插入的swap调用，重复扫描的swap不会被重复计入
+*/
+type candleMerger struct {
+	s *ABIScanner
+}
+
+func (m candleMerger) SwapCandles(swap *models.SwapEvent) []*models.Candle {
+	pool := m.s.cachedPool(common.HexToAddress(swap.PoolAddress))
+	if pool == nil {
+		return nil
+	}
+	var candles []*models.Candle
+	for _, market := range m.s.candleMarkets(pool) {
+		trade := swapCandle(swap, market.base)
+		if trade == nil {
+			return nil // 价格算不出来，两个市场都一样
+		}
+		for _, period := range candlePeriods {
+			bucket := swap.BlockTimeStamp - swap.BlockTimeStamp%period.seconds
+			candles = append(candles, newCandle(market, period.name, bucket, trade))
+		}
+	}
+	return candles
+}
+
+func (m candleMerger) MergeCandle(dst, src *models.Candle) { mergeCandle(dst, src) }
+
+/*
+重建一组池子从 fromTimestamp 开始的K线（包括它们所属交易对的K线）
+pending数据删除、链重组回滚之后调用，调用方需要持有 candleRebuildMu 写锁
+*/
+func (s *ABIScanner) rebuildCandlesForPools(pools []string, fromTimestamp int64) error {
+	s.candleMu.Lock()
+	defer s.candleMu.Unlock()
+
+	done := make(map[string]bool)
+	for _, address := range pools {
+		pool := s.cachedPool(common.HexToAddress(address))
+		if pool == nil {
+			// 池子本身被回滚掉了，只能清掉它自己的K线
+			for _, period := range candlePeriods {
+				bucketFrom := fromTimestamp - fromTimestamp%period.seconds
+				if err := s.repo.DeleteCandlesFrom("pool", strings.ToLower(address), period.name, bucketFrom); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for _, market := range s.candleMarkets(pool) {
+			key := market.marketType + ":" + market.market
+			if done[key] {
+				continue
+			}
+			done[key] = true
+			if err := s.rebuildMarket(market, fromTimestamp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 全量重建所有K线（rebuild-candles 命令）；candleRebuildMu 只管同一进程，命令要在 database.WithScannerLock 里执行
+func (s *ABIScanner) RebuildCandles(pool string) error {
+	s.candleRebuildMu.Lock()
+	defer s.candleRebuildMu.Unlock()
+
+	var pools []string
+	s.poolCacheMu.RLock()
+	for _, p := range s.poolCache {
+		if pool == "" || strings.EqualFold(p.PoolAddress, pool) {
+			pools = append(pools, p.PoolAddress)
+		}
+	}
+	s.poolCacheMu.RUnlock()
+	if len(pools) == 0 {
+		return fmt.Errorf("没有找到池子: %s", pool)
+	}
+	sort.Strings(pools)
+
+	fmt.Printf("开始重建K线: %d 个池子\n", len(pools))
+	return s.rebuildCandlesForPools(pools, 0)
+}
+
+/*
+重建一个市场的K线
+1m 直接从swap_events按链上顺序流式聚合，之后每个周期都由前一个周期的K线合成，
+这样删除pending后重建只需要读取最近的swap，不用把整天的swap都读一遍
+*/
+func (s *ABIScanner) rebuildMarket(market candleMarket, fromTimestamp int64) error {
+	if len(market.pools) == 0 {
+		return nil
+	}
+	first := candlePeriods[0]
+	bucketFrom := fromTimestamp - fromTimestamp%first.seconds
+	if err := s.repo.DeleteCandlesFrom(market.marketType, market.market, first.name, bucketFrom); err != nil {
+		return err
+	}
+
+	var batch []*models.Candle
+	var current *models.Candle
+	var afterBlock uint64
+	afterLogIndex := -1
+	for {
+		swaps, err := s.repo.GetSwapsForCandles(market.pools, bucketFrom, afterBlock, afterLogIndex, candleBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, swap := range swaps {
+			trade := swapCandle(swap, market.base)
+			if trade == nil {
+				continue
+			}
+			bucket := swap.BlockTimeStamp - swap.BlockTimeStamp%first.seconds
+			if current != nil && current.BucketStart == bucket {
+				mergeCandle(current, trade)
+				continue
+			}
+			if current != nil {
+				batch = append(batch, current)
+			}
+			current = newCandle(market, first.name, bucket, trade)
+		}
+		if len(batch) >= candleBatchSize {
+			if err := s.repo.SaveCandles(batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+		if len(swaps) < candleBatchSize {
+			break
+		}
+		last := swaps[len(swaps)-1]
+		afterBlock, afterLogIndex = last.BlockNumber, last.LogIndex
+	}
+	if current != nil {
+		batch = append(batch, current)
+	}
+	if err := s.repo.SaveCandles(batch); err != nil {
+		return err
+	}
+
+	for i := 1; i < len(candlePeriods); i++ {
+		if err := s.composeCandles(market, candlePeriods[i-1].name, candlePeriods[i].name, candlePeriods[i].seconds, fromTimestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 用小周期K线合成大周期K线
+func (s *ABIScanner) composeCandles(market candleMarket, childPeriod, period string, seconds int64, fromTimestamp int64) error {
+	bucketFrom := fromTimestamp - fromTimestamp%seconds
+	if err := s.repo.DeleteCandlesFrom(market.marketType, market.market, period, bucketFrom); err != nil {
+		return err
+	}
+
+	var batch []*models.Candle
+	var current *models.Candle
+	after := bucketFrom - 1
+	for {
+		children, err := s.repo.GetCandlesAfter(market.marketType, market.market, childPeriod, after, candleBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			bucket := child.BucketStart - child.BucketStart%seconds
+			if current != nil && current.BucketStart == bucket {
+				mergeCandle(current, child)
+				continue
+			}
+			if current != nil {
+				batch = append(batch, current)
+			}
+			current = newCandle(market, period, bucket, child)
+		}
+		if len(batch) >= candleBatchSize {
+			if err := s.repo.SaveCandles(batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+		if len(children) < candleBatchSize {
+			break
+		}
+		after = children[len(children)-1].BucketStart
+	}
+	if current != nil {
+		batch = append(batch, current)
+	}
+	return s.repo.SaveCandles(batch)
+}
+
+/*
+代币精度回填后，之前算不出价格的swap可以计入K线了
+只重建回填到的池子，从回填到的最早那笔swap所在的周期开始，持写锁的时间和回填量成正比；
+这些swap的USD成交额、汇总和ClickHouse里的行也要重新算，推导任务的进度退回到最早那笔swap之前
+*/
+func (s *ABIScanner) afterDecimalBackfill(token string, pools []string, fromBlock uint64, fromTimestamp int64) {
+	s.candleRebuildMu.Lock()
+	defer s.candleRebuildMu.Unlock()
+
+	if err := s.rebuildCandlesForPools(pools, fromTimestamp); err != nil {
+		fmt.Printf("重建代币%s的K线失败: %v\n", token, err)
+	}
+	if err := s.rewindDerivedLocked(fromBlock - 1); err != nil {
+		fmt.Printf("代币%s回填后退回推导进度失败: %v\n", token, err)
+	}
+}
+
+/*
+删除pending数据，并重建受影响池子的K线
+加写锁，保证重建期间没有swap在入库和增量更新（否则会重复计入）
+*/
+func (s *ABIScanner) deletePending(safe uint64) error {
+	s.candleRebuildMu.Lock()
+	defer s.candleRebuildMu.Unlock()
+
+	pools, fromTimestamp, err := s.repo.GetSwapScopeAfter(safe, "pending")
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeletePendingAfter(safe); err != nil {
+		return err
+	}
+	if err := s.rollbackHandlers(safe, true); err != nil {
+		return err
+	}
+	if len(pools) == 0 {
+		return nil
+	}
+	return s.rebuildCandlesForPools(pools, fromTimestamp)
+}
+
+// a 是否在 b 之前（区块高度+日志索引）
+func before(blockA uint64, logA int, blockB uint64, logB int) bool {
+	return blockA < blockB || (blockA == blockB && logA < logB)
+}
+
+// 精确小数转DECIMAL(65,30)字符串，整数部分超过35位返回false
+func ratDecimal(r *big.Rat) (string, bool) {
+	str := r.FloatString(decimalScaleDigits)
+	if strings.Contains(str, ".") {
+		str = strings.TrimRight(strings.TrimRight(str, "0"), ".")
+	}
+	intPart := strings.TrimPrefix(strings.SplitN(str, ".", 2)[0], "-")
+	if len(intPart) > decimalIntDigits {
+		return "", false
+	}
+	return str, true
+}
+
+func parseRat(s string) *big.Rat {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return new(big.Rat)
+	}
+	return r
+}
+
+func compareRat(a, b string) int {
+	return parseRat(a).Cmp(parseRat(b))
+}
+
+func addRat(a, b string) string {
+	sum, _ := ratDecimal(new(big.Rat).Add(parseRat(a), parseRat(b)))
+	return sum
+}
@@ -0,0 +1,186 @@
+package scanner
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+)
+
+// 用USDC买WETH，价格 = usdc/weth
+func buyWETH(pool string, block uint64, logIndex int, weth, usdc string) *models.SwapEvent {
+	return &models.SwapEvent{
+		BlockNumber: block, BlockTimeStamp: 1700000000 + int64(block-100), TxHash: fmt.Sprintf("0x%s%d%d", pool[len(pool)-2:], block, logIndex),
+		LogIndex: logIndex, PoolAddress: pool, Protocol: "syncswap", Sender: "0x01", Recipient: "0x02",
+		TokenIn: testUSDC, TokenOut: testWETH, AmountIn: "1", AmountOut: "1",
+		AmountInDecimal: &usdc, AmountOutDecimal: &weth, FinalityStatus: "safe",
+	}
+}
+
+// 带K线增量合并保存一批swap，和扫描时一样
+func saveSwapsWithCandles(t *testing.T, s *ABIScanner, swaps ...*models.SwapEvent) {
+	t.Helper()
+	batch := repository.NewBatch()
+	batch.SetCandleMerger(candleMerger{s})
+	for _, swap := range swaps {
+		batch.AddSwap(swap)
+	}
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getCandle(t *testing.T, s *ABIScanner, marketType, market, period string, timestamp int64) *models.Candle {
+	t.Helper()
+	seconds := map[string]int64{"1m": 60, "5m": 300, "1h": 3600, "1d": 86400}[period]
+	candle, err := s.repo.GetCandle(marketType, market, period, timestamp-timestamp%seconds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if candle == nil {
+		t.Fatalf("%s %s candle %s at %d missing", marketType, market, period, timestamp)
+	}
+	return candle
+}
+
+// 开高低收、成交量、笔数
+func checkCandle(t *testing.T, name string, candle *models.Candle, open, high, low, close, volume0, volume1 string, trades int) {
+	t.Helper()
+	got := []string{candle.Open, candle.High, candle.Low, candle.Close, candle.Volume0, candle.Volume1}
+	want := []string{open, high, low, close, volume0, volume1}
+	for i := range got {
+		if parseRat(got[i]).Cmp(parseRat(want[i])) != 0 {
+			t.Fatalf("%s = o%s h%s l%s c%s v%s/%s, want o%s h%s l%s c%s v%s/%s", name,
+				got[0], got[1], got[2], got[3], got[4], got[5], want[0], want[1], want[2], want[3], want[4], want[5])
+		}
+	}
+	if candle.TradeCount != trades {
+		t.Fatalf("%s trade count = %d, want %d", name, candle.TradeCount, trades)
+	}
+}
+
+func TestCandleMergesOutOfOrderSwapsIntoExistingBucket(t *testing.T) {
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newTestScanner(t, pool)
+
+	// 多协程扫描时后面的区块先入库，再写入同一分钟里更早的两笔
+	saveSwapsWithCandles(t, s, buyWETH(pool.PoolAddress, 110, 0, "1", "2100"))
+	saveSwapsWithCandles(t, s, buyWETH(pool.PoolAddress, 105, 1, "1", "1900"), buyWETH(pool.PoolAddress, 105, 0, "1", "2000"))
+
+	ts := buyWETH(pool.PoolAddress, 105, 0, "1", "1").BlockTimeStamp
+	incremental := getCandle(t, s, "pool", pool.PoolAddress, "1m", ts)
+	checkCandle(t, "incremental 1m", incremental, "2000", "2100", "1900", "2100", "3", "6000", 3)
+	if incremental.OpenBlock != 105 || incremental.OpenLogIndex != 0 || incremental.CloseBlock != 110 {
+		t.Fatalf("open at %d/%d close at %d, want 105/0 and 110", incremental.OpenBlock, incremental.OpenLogIndex, incremental.CloseBlock)
+	}
+
+	// 按链上顺序重建的结果要和增量合并的一样
+	if err := s.RebuildCandles(""); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt := getCandle(t, s, "pool", pool.PoolAddress, "1m", ts)
+	checkCandle(t, "rebuilt 1m", rebuilt, incremental.Open, incremental.High, incremental.Low, incremental.Close,
+		incremental.Volume0, incremental.Volume1, incremental.TradeCount)
+}
+
+func TestPairCandlesComposeAllPoolsOfThePair(t *testing.T) {
+	a := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	// 另一个池子token顺序反过来，交易对市场按地址小的USDC计价
+	b := wethUSDCPool("0x00000000000000000000000000000000000000d2")
+	b.Token0, b.Token1 = testUSDC, testWETH
+	s := newTestScanner(t, a, b)
+
+	first := buyWETH(a.PoolAddress, 100, 0, "1", "2000")
+	second := buyWETH(b.PoolAddress, 101, 0, "1", "2500")
+	later := buyWETH(a.PoolAddress, 300, 0, "2", "5000") // 200秒之后，另一根1m K线
+	saveSwapsWithCandles(t, s, first, second, later)
+
+	pair := testUSDC + "-" + testWETH
+	checkCandle(t, "pool b 1m", getCandle(t, s, "pool", b.PoolAddress, "1m", second.BlockTimeStamp),
+		"0.0004", "0.0004", "0.0004", "0.0004", "2500", "1", 1)
+	checkCandle(t, "pair 1m", getCandle(t, s, "pair", pair, "1m", first.BlockTimeStamp),
+		"0.0005", "0.0005", "0.0004", "0.0004", "4500", "2", 2)
+	checkCandle(t, "pair 1h", getCandle(t, s, "pair", pair, "1h", first.BlockTimeStamp),
+		"0.0005", "0.0005", "0.0004", "0.0004", "9500", "4", 3)
+
+	// 重建时大周期由1m合成，和增量更新的结果一样
+	if err := s.RebuildCandles(b.PoolAddress); err != nil {
+		t.Fatal(err)
+	}
+	for _, period := range []string{"1m", "5m", "1h", "1d"} {
+		candle := getCandle(t, s, "pair", pair, period, later.BlockTimeStamp)
+		if period == "1m" || period == "5m" { // 和前两笔不在同一个5m
+			checkCandle(t, "rebuilt pair "+period, candle, "0.0004", "0.0004", "0.0004", "0.0004", "5000", "2", 1)
+			continue
+		}
+		checkCandle(t, "rebuilt pair "+period, candle, "0.0005", "0.0005", "0.0004", "0.0004", "9500", "4", 3)
+	}
+}
+
+func TestPairMarketFollowsPoolCacheChanges(t *testing.T) {
+	a := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newTestScanner(t, a)
+	pairPools := func() []string { return s.candleMarkets(a)[1].pools }
+
+	// 区块里新建的同交易对池子进交易对市场，批次没写进库撤销后移出
+	b := wethUSDCPool("0x00000000000000000000000000000000000000d2")
+	b.Token0, b.Token1 = testUSDC, testWETH
+	block := &BlockContext{}
+	s.cachePool(block, b)
+	if got, want := pairPools(), []string{a.PoolAddress, b.PoolAddress}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pair pools = %v, want %v", got, want)
+	}
+	undoCache(block.undo)
+	if got, want := pairPools(), []string{a.PoolAddress}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pair pools after undo = %v, want %v", got, want)
+	}
+
+	// 链重组回滚后按库里的池子重新加载，没入库的池子不在交易对市场里
+	batch := repository.NewBatch()
+	batch.AddPool(a)
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	s.cachePool(&BlockContext{}, b)
+	s.initPoolCache()
+	if got, want := pairPools(), []string{a.PoolAddress}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pair pools after reload = %v, want %v", got, want)
+	}
+}
+
+func TestDecimalBackfillRebuildsCandlesFromEarliestBackfilledSwap(t *testing.T) {
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newTestScanner(t, pool)
+	s.tokens.onBackfill = s.afterDecimalBackfill
+
+	early := buyWETH(pool.PoolAddress, 100, 0, "1", "2000")
+	// WETH精度还不知道的两笔，换算数量是NULL，不计入K线
+	unknown := buyWETH(pool.PoolAddress, 160, 0, "1", "2200")
+	unknown.AmountOut, unknown.AmountOutDecimal = "1000000000000000000", nil
+	unknownLater := buyWETH(pool.PoolAddress, 170, 0, "1", "2400")
+	unknownLater.AmountOut, unknownLater.AmountOutDecimal = "1000000000000000000", nil
+	saveSwapsWithCandles(t, s, early, unknown, unknownLater)
+	if candle, _ := s.repo.GetCandle("pool", pool.PoolAddress, "1m", unknown.BlockTimeStamp-unknown.BlockTimeStamp%60); candle != nil {
+		t.Fatalf("swap with unknown decimals counted in candle: %+v", candle)
+	}
+
+	// 改掉回填之前的那根1m，只有从最早回填的swap开始的K线才会重建
+	sentinel := getCandle(t, s, "pool", pool.PoolAddress, "1m", early.BlockTimeStamp)
+	sentinel.TradeCount = 99
+	if err := s.repo.SaveCandles([]*models.Candle{sentinel}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.tokens.backfill(testWETH, 18)
+
+	if got := getCandle(t, s, "pool", pool.PoolAddress, "1m", early.BlockTimeStamp).TradeCount; got != 99 {
+		t.Fatalf("candle before the backfilled swaps rebuilt: trade count %d", got)
+	}
+	checkCandle(t, "backfilled 1m", getCandle(t, s, "pool", pool.PoolAddress, "1m", unknown.BlockTimeStamp),
+		"2200", "2400", "2200", "2400", "2", "4600", 2)
+	// 1h 由1m合成，包括回填之前的那根
+	if got := getCandle(t, s, "pool", pool.PoolAddress, "1h", early.BlockTimeStamp).TradeCount; got != 101 {
+		t.Fatalf("1h trade count = %d, want 101", got)
+	}
+}
@@ -0,0 +1,217 @@
+package scanner
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"zk-sync-go-pool/internal/blockchain"
+	"zk-sync-go-pool/internal/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const testChainID = 324
+
+/*
+测试用的链节点
+区块哈希由区块号和分叉号推出，eth_getLogs 按区块范围、地址、topic0 过滤 logs，
+eth_call 交给 call 处理；测试期间 blockchain.Client 指向它
+*/
+type fakeChain struct {
+	mu             sync.Mutex
+	head           uint64
+	fork           map[uint64]byte // 区块号 -> 分叉号，改了之后这个区块的哈希就变了
+	logs           []types.Log
+	headerRequests []uint64 // eth_getBlockByNumber 请求过的区块
+	call           func(to common.Address, data []byte) ([]byte, error)
+}
+
+func newFakeChain(t *testing.T, head uint64) *fakeChain {
+	t.Helper()
+	chain := &fakeChain{head: head, fork: make(map[uint64]byte)}
+	server := httptest.NewServer(chain)
+	old := blockchain.Client
+	if err := blockchain.InitClient(&config.BlockchainConfig{ChainID: testChainID, RPCURL: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		blockchain.Client.Close()
+		blockchain.Client = old
+		server.Close()
+	})
+	return chain
+}
+
+func (c *fakeChain) hash(number uint64) common.Hash {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashLocked(number)
+}
+
+func (c *fakeChain) hashLocked(number uint64) common.Hash {
+	var hash common.Hash
+	hash[0] = 0xbb
+	hash[1] = c.fork[number]
+	copy(hash[24:], common.BigToHash(new(big.Int).SetUint64(number)).Bytes()[24:])
+	return hash
+}
+
+// 加一条日志，区块哈希按当前分叉填
+func (c *fakeChain) addLog(log types.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	log.BlockHash = c.hashLocked(log.BlockNumber)
+	c.logs = append(c.logs, log)
+}
+
+// 从 number 开始换成另一条分叉
+func (c *fakeChain) reorg(number uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n := number; n <= c.head; n++ {
+		c.fork[n]++
+	}
+	for i := range c.logs {
+		if c.logs[i].BlockNumber >= number {
+			c.logs[i].BlockHash = c.hashLocked(c.logs[i].BlockNumber)
+		}
+	}
+}
+
+func (c *fakeChain) requestedHeaders() []uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	numbers := append([]uint64(nil), c.headerRequests...)
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	c.headerRequests = nil
+	return numbers
+}
+
+type chainRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func (c *fakeChain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	if len(body) > 0 && body[0] == '[' {
+		var reqs []chainRequest
+		json.Unmarshal(body, &reqs)
+		resps := make([]map[string]interface{}, len(reqs))
+		for i, req := range reqs {
+			resps[i] = c.respond(req)
+		}
+		json.NewEncoder(w).Encode(resps)
+		return
+	}
+	var req chainRequest
+	json.Unmarshal(body, &req)
+	json.NewEncoder(w).Encode(c.respond(req))
+}
+
+func (c *fakeChain) respond(req chainRequest) map[string]interface{} {
+	result, err := c.handle(req)
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if err != nil {
+		resp["error"] = map[string]interface{}{"code": 3, "message": err.Error()}
+	} else {
+		resp["result"] = result
+	}
+	return resp
+}
+
+func (c *fakeChain) handle(req chainRequest) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch req.Method {
+	case "eth_chainId":
+		return hexutil.Uint64(testChainID), nil
+	case "eth_blockNumber":
+		return hexutil.Uint64(c.head), nil
+	case "eth_getBlockByNumber":
+		var number hexutil.Uint64
+		json.Unmarshal(req.Params[0], &number)
+		n := uint64(number)
+		if n > c.head {
+			return nil, nil
+		}
+		c.headerRequests = append(c.headerRequests, n)
+		parent := common.Hash{}
+		if n > 0 {
+			parent = c.hashLocked(n - 1)
+		}
+		return map[string]interface{}{
+			"number": hexutil.Uint64(n), "hash": c.hashLocked(n), "parentHash": parent,
+			"timestamp": hexutil.Uint64(1700000000 + n), "transactions": []common.Hash{},
+		}, nil
+	case "eth_getLogs":
+		var filter struct {
+			FromBlock hexutil.Uint64   `json:"fromBlock"`
+			ToBlock   hexutil.Uint64   `json:"toBlock"`
+			Address   []common.Address `json:"address"`
+			Topics    [][]common.Hash  `json:"topics"`
+		}
+		json.Unmarshal(req.Params[0], &filter)
+		logs := []types.Log{}
+		for _, log := range c.logs {
+			if log.BlockNumber < uint64(filter.FromBlock) || log.BlockNumber > uint64(filter.ToBlock) {
+				continue
+			}
+			if len(filter.Address) > 0 && !containsAddress(filter.Address, log.Address) {
+				continue
+			}
+			if len(filter.Topics) > 0 && len(filter.Topics[0]) > 0 && !containsHash(filter.Topics[0], log.Topics[0]) {
+				continue
+			}
+			logs = append(logs, log)
+		}
+		return logs, nil
+	case "eth_call":
+		// ethclient 发的是 input，老节点用 data
+		var call struct {
+			To    common.Address `json:"to"`
+			Data  hexutil.Bytes  `json:"data"`
+			Input hexutil.Bytes  `json:"input"`
+		}
+		json.Unmarshal(req.Params[0], &call)
+		if c.call == nil {
+			return nil, errUnsupported
+		}
+		if len(call.Input) > 0 {
+			call.Data = call.Input
+		}
+		out, err := c.call(call.To, call.Data)
+		return hexutil.Bytes(out), err
+	}
+	return nil, errUnsupported
+}
+
+var errUnsupported = errors.New("execution reverted: unsupported")
+
+func containsAddress(list []common.Address, address common.Address) bool {
+	for _, a := range list {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+func containsHash(list []common.Hash, hash common.Hash) bool {
+	for _, h := range list {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
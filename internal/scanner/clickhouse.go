@@ -0,0 +1,179 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"zk-sync-go-pool/internal/clickhouse"
+	"zk-sync-go-pool/internal/repository"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+const (
+	clickhouseTask             = "clickhouse"
+	defaultClickhouseInterval  = 30   // 默认每30秒检查一次
+	defaultClickhouseBlockSpan = 2000 // 默认每次同步2000个区块
+	clickhouseUpstreamProgress = "pricing"
+)
+
+// 开启了clickhouse时连接并建表，事件映射表也一起建
+func (s *ABIScanner) initClickhouse() error {
+	if !s.cfg.Clickhouse.Enabled || s.clickhouse != nil {
+		return nil
+	}
+	client, err := clickhouse.New(&s.cfg.Clickhouse)
+	if err != nil {
+		return err
+	}
+	for _, mapping := range s.sortedMappings() {
+		columns := []string{"contract_address String"}
+		for _, column := range mapping.columns {
+			columns = append(columns, clickhouse.Quote(column.column)+" "+clickhouseColumnType(mapping, column))
+		}
+		if err := client.EnsureTable(mapping.table, columns); err != nil {
+			return err
+		}
+	}
+	s.clickhouse = client
+	return nil
+}
+
+// 所有事件映射，按名称排序
+func (s *ABIScanner) sortedMappings() []*eventMapping {
+	var mappings []*eventMapping
+	for _, list := range s.mappings {
+		mappings = append(mappings, list...)
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].name < mappings[j].name })
+	return mappings
+}
+
+// 映射列在ClickHouse里的类型，列都可以为NULL；大整数按ABI里的有无符号区分
+func clickhouseColumnType(mapping *eventMapping, column mappedColumn) string {
+	switch column.kind {
+	case repository.ColumnInteger:
+		return "Nullable(Int64)"
+	case repository.ColumnNumeric:
+		for _, input := range mapping.event.Inputs {
+			if input.Name == column.field && input.Type.T == ethabi.IntTy {
+				return "Nullable(Int256)"
+			}
+		}
+		return "Nullable(UInt256)"
+	case repository.ColumnBool:
+		return "Nullable(UInt8)"
+	}
+	return "Nullable(String)"
+}
+
+/*
+ClickHouse同步worker
+跟在定价进度后面(swap的amount_usd已经回填)，只同步safe区块，pending数据不会进ClickHouse；
+链重组回滚后进度和定价进度一起退回，重新同步时整段替换，分叉上的行被删除标记覆盖。
+之后才回填的数据(代币精度回填、协议历史回填、audit -reindex)会退回推导任务的进度，同步进度也一起退回重新同步。
+读库时持读锁，写ClickHouse的HTTP请求不持锁，不会因为ClickHouse慢挡住扫描写入
+*/
+func (s *ABIScanner) runClickhouseWorker(ctx context.Context) {
+	interval := s.cfg.Clickhouse.Interval
+	if interval <= 0 {
+		interval = defaultClickhouseInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.followSpans(ctx, clickhouseTask, clickhouseUpstreamProgress, s.clickhouseBlockSpan(), func(from, to uint64) (bool, error) {
+				return s.processSpanOutside(clickhouseTask, clickhouseUpstreamProgress, from, to, s.readExport)
+			})
+			if err != nil {
+				fmt.Printf("⚠️ 同步ClickHouse失败: %v\n", err)
+			}
+		}
+	}
+}
+
+func (s *ABIScanner) clickhouseBlockSpan() uint64 {
+	if s.cfg.Clickhouse.BlockSpan > 0 {
+		return uint64(s.cfg.Clickhouse.BlockSpan)
+	}
+	return defaultClickhouseBlockSpan
+}
+
+// 读出 [from, to] 内safe状态的事件，返回的函数把它们写入ClickHouse
+func (s *ABIScanner) readExport(from, to uint64) (func() error, error) {
+	events := &clickhouse.Events{Mapped: make(map[string][]map[string]interface{})}
+	for _, dest := range []interface{}{
+		&events.Swaps,
+		&events.RangeSwaps,
+		&events.LiquidityEvents,
+		&events.RangePositions,
+		&events.RangePoolEvents,
+		&events.FeeChanges,
+		&events.DecodedEvents,
+	} {
+		if err := s.repo.GetSafeEventsBetween(from, to, dest); err != nil {
+			return nil, err
+		}
+	}
+	for _, mapping := range s.sortedMappings() {
+		if _, ok := events.Mapped[mapping.table]; ok {
+			continue
+		}
+		rows, err := s.repo.GetSafeMappedEventsBetween(mapping.table, from, to)
+		if err != nil {
+			return nil, err
+		}
+		events.Mapped[mapping.table] = rows
+	}
+	return func() error { return s.clickhouse.ReplaceBlocks(from, to, events) }, nil
+}
+
+// 把 [from, to] 内safe状态的事件同步到ClickHouse
+func (s *ABIScanner) exportBlocks(from, to uint64) error {
+	write, err := s.readExport(from, to)
+	if err != nil {
+		return err
+	}
+	return write()
+}
+
+/*
+重新同步一段区块到ClickHouse(sync-clickhouse 子命令)
+不改变同步进度，整段替换是幂等的，可以反复执行
+*/
+func (s *ABIScanner) SyncClickhouse(from, to uint64) error {
+	if !s.cfg.Clickhouse.Enabled {
+		return fmt.Errorf("没有开启clickhouse")
+	}
+	if err := s.initClickhouse(); err != nil {
+		return err
+	}
+	if from == 0 {
+		from = uint64(s.cfg.Scanner.StartBlock) + 1
+	}
+	if to == 0 {
+		progress, err := s.repo.GetScanProgress(clickhouseTask)
+		if err != nil {
+			return err
+		}
+		to = progress
+	}
+	span := s.clickhouseBlockSpan()
+	for start := from; start <= to; start += span {
+		end := start + span - 1
+		if end > to {
+			end = to
+		}
+		if err := s.exportBlocks(start, end); err != nil {
+			return err
+		}
+		fmt.Printf("同步ClickHouse: 区块 %d-%d\n", start, end)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 记录收到的INSERT请求，第一次写swap时检查锁并模拟一次回退
+type fakeClickhouse struct {
+	s        *ABIScanner
+	mu       sync.Mutex
+	inserts  map[string]string // 表名 -> 最后一次写入的数据
+	ddl      []string          // 放在请求体里的语句(建表、删除标记)
+	rewound  bool
+	lockHeld bool
+}
+
+func (f *fakeClickhouse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	query := r.URL.Query().Get("query")
+	if query == "" {
+		f.mu.Lock()
+		f.ddl = append(f.ddl, string(body))
+		f.mu.Unlock()
+		return
+	}
+	if !strings.HasPrefix(query, "INSERT INTO zksync.") {
+		return
+	}
+	table := strings.Trim(strings.Fields(strings.TrimPrefix(query, "INSERT INTO zksync."))[0], "`")
+	f.mu.Lock()
+	f.inserts[table] = string(body)
+	f.mu.Unlock()
+	if table != "swap_events" || f.rewound {
+		return
+	}
+	// 导出期间扫描还能拿写锁；回退之后这一段不能推进进度
+	if !f.s.candleRebuildMu.TryLock() {
+		f.lockHeld = true
+		return
+	}
+	f.s.candleRebuildMu.Unlock()
+	f.rewound = true
+	if err := f.s.rewindDerivedProgress(100); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func TestClickhouseExportsOutsideLockAndRetriesAfterRewind(t *testing.T) {
+	s := newTestScanner(t)
+	s.cfg.Scanner.StartBlock = 100
+	fake := &fakeClickhouse{s: s, inserts: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s.cfg.Clickhouse.Enabled = true
+	s.cfg.Clickhouse.URL = server.URL
+
+	columns := []repository.EventColumn{{Name: "from", Kind: repository.ColumnAddress}, {Name: "value", Kind: repository.ColumnNumeric}}
+	if err := s.repo.EnsureEventTable("transfers", columns); err != nil {
+		t.Fatal(err)
+	}
+	s.mappings = map[common.Hash][]*eventMapping{{1}: {{
+		name: "transfers", table: "transfers",
+		columns: []mappedColumn{
+			{column: "from", field: "from", kind: repository.ColumnAddress},
+			{column: "value", field: "value", kind: repository.ColumnNumeric},
+		},
+	}}}
+	if err := s.initClickhouse(); err != nil {
+		t.Fatal(err)
+	}
+	// from 是关键字，建表和补列时都要加引号
+	var quoted bool
+	for _, ddl := range fake.ddl {
+		if strings.Contains(ddl, "`transfers`") && strings.Contains(ddl, "`from` Nullable(String)") {
+			quoted = true
+		}
+	}
+	if !quoted {
+		t.Fatalf("transfers DDL does not quote the from column: %q", fake.ddl)
+	}
+
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	batch := repository.NewBatch()
+	batch.AddSwap(buyWETH(pool.PoolAddress, 105, 0, "1", "2000"))
+	batch.AddDecodedEvents(&models.DecodedEvent{
+		BlockNumber: 106, BlockTimeStamp: 1700000006, TxHash: "0xdecoded", LogIndex: 0, ContractAddress: pool.PoolAddress,
+		ContractKind: "pool", Topic0: "0xtopic", Topics: "[]", Data: "0x", FinalityStatus: "safe",
+	})
+	batch.AddMappedEvent("transfers", map[string]interface{}{
+		"block_number": 107, "block_timestamp": 1700000007, "tx_hash": "0xmapped", "log_index": 0,
+		"contract_address": pool.PoolAddress, "finality_status": "safe", "from": "0xa1", "value": "12345",
+	})
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repo.InitScanProgress("pricing", 110); err != nil {
+		t.Fatal(err)
+	}
+
+	step := func(from, to uint64) (bool, error) {
+		return s.processSpanOutside(clickhouseTask, clickhouseUpstreamProgress, from, to, s.readExport)
+	}
+	if err := s.followSpans(context.Background(), clickhouseTask, clickhouseUpstreamProgress, 100, step); err != nil {
+		t.Fatal(err)
+	}
+	if fake.lockHeld {
+		t.Fatal("candleRebuildMu held during the ClickHouse request")
+	}
+	if progress, _ := s.repo.GetScanProgress(clickhouseTask); progress != 100 {
+		t.Fatalf("progress after rewind = %d, want 100", progress)
+	}
+	// 回退把定价进度也退回了，定价追上之后再同步
+	if err := s.repo.UpdateScanProgress("pricing", 110); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.followSpans(context.Background(), clickhouseTask, clickhouseUpstreamProgress, 100, step); err != nil {
+		t.Fatal(err)
+	}
+	if progress, _ := s.repo.GetScanProgress(clickhouseTask); progress != 110 {
+		t.Fatalf("progress = %d, want 110", progress)
+	}
+	for table, want := range map[string]string{
+		"swap_events":    `"block_number":105`,
+		"decoded_events": `"tx_hash":"0xdecoded"`,
+		"transfers":      `"value":"12345"`,
+	} {
+		if !strings.Contains(fake.inserts[table], want) {
+			t.Fatalf("%s insert = %q, want %s", table, fake.inserts[table], want)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package scanner
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"zk-sync-go-pool/internal/blockchain"
+	"zk-sync-go-pool/internal/models"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// pools.fee_rate 和 pool_fee_history.fee_rate 的单位：百万分之一(1000000 = 100%)
+const feeRateDenominator = 1000000
+
+// range工厂按tickSpacing设置默认费率的事件
+var factoryFeeEventNames = []string{"SetTickSpacingDefaultSwapFee", "TickSpacingEnabled"}
+
+// 读取池子费率的方法：range池子 fee()，取不到再用工厂的 defaultSwapFeeByTickSpacing；其他池子 getSwapFee
+const poolFeeABIJSON = `[
+	{"type":"function","name":"fee","inputs":[],"outputs":[{"name":"","type":"uint24"}],"stateMutability":"view"},
+	{"type":"function","name":"defaultSwapFeeByTickSpacing","inputs":[{"name":"","type":"int24"}],"outputs":[{"name":"","type":"uint24"}],"stateMutability":"view"},
+	{"type":"function","name":"getSwapFee","inputs":[{"name":"_sender","type":"address"},{"name":"_tokenIn","type":"address"},{"name":"_tokenOut","type":"address"},{"name":"data","type":"bytes"}],"outputs":[{"name":"","type":"uint24"}],"stateMutability":"view"}
+]`
+
+var poolFeeABI, _ = ethabi.JSON(strings.NewReader(poolFeeABIJSON))
+
+/*
+合约里的费率换算成百万分之一
+classic/stable/aqua 的 getSwapFee 和 Swapped.swapFee 精度是十万分之一(300 = 0.3%)，FeeScale为10；
+range池子的 fee 和v3一样是百万分之一，不用换算
+*/
+func (info factoryInfo) feeToPPM(raw *big.Int) int {
+	if info.FeeScale == 0 {
+		return int(raw.Int64())
+	}
+	return int(raw.Int64()) * info.FeeScale
+}
+
+// 配置的固定费率，没有配置返回nil
+func (info factoryInfo) fixedFee() *int {
+	if info.FeeRate <= 0 {
+		return nil
+	}
+	fee := info.FeeRate
+	return &fee
+}
+
+// 一个池子的费率读取：要发的调用和结果
+type poolFeeRead struct {
+	pool    *models.Pool
+	info    factoryInfo
+	calls   []blockchain.ContractCall
+	methods []string
+	change  *models.PoolFeeChange // 导入时先记下创建事件，读到费率后补上
+	fee     *int
+}
+
+/*
+准备读取池子费率的调用
+classic/stable/aqua 的费率由fee manager按方向和调用者决定，这里取默认调用者 token0 -> token1 方向；
+其他协议v2语义的池子没有读取费率的方法，不发调用，用配置的固定费率
+*/
+func (s *ABIScanner) newPoolFeeRead(pool *models.Pool, tickSpacing *int) *poolFeeRead {
+	read := &poolFeeRead{pool: pool, info: s.poolFactory(pool)}
+	if read.info.Protocol != defaultProtocol && read.info.Swap != swapV3 {
+		return read
+	}
+	address := common.HexToAddress(pool.PoolAddress)
+	if read.info.Swap == swapV3 {
+		data, _ := poolFeeABI.Pack("fee")
+		read.calls = append(read.calls, blockchain.ContractCall{To: address, Data: data})
+		read.methods = append(read.methods, "fee")
+		if tickSpacing != nil {
+			data, _ := poolFeeABI.Pack("defaultSwapFeeByTickSpacing", big.NewInt(int64(*tickSpacing)))
+			read.calls = append(read.calls, blockchain.ContractCall{To: common.HexToAddress(pool.FactoryAddress), Data: data})
+			read.methods = append(read.methods, "defaultSwapFeeByTickSpacing")
+		}
+	} else {
+		data, _ := poolFeeABI.Pack("getSwapFee", common.Address{},
+			common.HexToAddress(pool.Token0), common.HexToAddress(pool.Token1), []byte{})
+		read.calls = append(read.calls, blockchain.ContractCall{To: address, Data: data})
+		read.methods = append(read.methods, "getSwapFee")
+	}
+	return read
+}
+
+/*
+在同一个区块上批量读取一组池子的费率，所有调用合在一个批量请求里
+合约读不到的费率为nil(之后的费率事件会补上)；节点请求失败返回error
+*/
+func (s *ABIScanner) readPoolFees(reads []*poolFeeRead, blockNum uint64) error {
+	var calls []blockchain.ContractCall
+	for _, read := range reads {
+		calls = append(calls, read.calls...)
+	}
+	var results []hexutil.Bytes
+	var errs []error
+	if len(calls) > 0 {
+		var err error
+		if results, errs, err = blockchain.BatchCallContracts(calls, blockNum); err != nil {
+			return err // 节点没读到，稍后重试，不能当成池子没有费率
+		}
+	}
+	i := 0
+	for _, read := range reads {
+		n := len(read.calls)
+		read.fee = read.parse(results[i:i+n], errs[i:i+n])
+		i += n
+	}
+	return nil
+}
+
+// 按顺序取第一个读到的费率，都读不到用配置的固定费率
+func (read *poolFeeRead) parse(results []hexutil.Bytes, errs []error) *int {
+	for i, method := range read.methods {
+		if errs[i] != nil {
+			continue
+		}
+		values, err := poolFeeABI.Unpack(method, results[i])
+		if err != nil || len(values) == 0 {
+			continue
+		}
+		if v, ok := values[0].(*big.Int); ok && v != nil {
+			fee := read.info.feeToPPM(v)
+			return &fee
+		}
+	}
+	if fee := read.info.fixedFee(); fee != nil {
+		return fee
+	}
+	if len(errs) > 0 {
+		fmt.Printf("⚠️ 读取池子%s费率失败: %v\n", read.pool.PoolAddress, errs[0])
+	}
+	return nil
+}
+
+// 在池子创建区块上读取费率
+func (s *ABIScanner) fetchPoolFee(pool *models.Pool, tickSpacing *int, blockNum uint64) (*int, error) {
+	read := s.newPoolFeeRead(pool, tickSpacing)
+	if err := s.readPoolFees([]*poolFeeRead{read}, blockNum); err != nil {
+		return nil, err
+	}
+	return read.fee, nil
+}
+
+/*
+解析费率相关事件，记录到 pool_fee_history
+range工厂的 SetTickSpacingDefaultSwapFee/TickSpacingEnabled 只记录，不知道哪些池子单独设置过费率，不改池子；
+range池子的 FeeAmount、aqua池子的 Swapped 每笔swap都带实际费率，和上一次不同才记录，池子当前费率取位置最新的一条；
+aqua池子的 Fee 记录手续费数量。
+*/
+func (s *ABIScanner) decodeFeeLog(block *BlockContext, log *types.Log) (interface{}, error) {
+	change := &models.PoolFeeChange{
+		BlockNumber:     block.Number,
+		BlockTimeStamp:  block.Timestamp,
+		TxHash:          log.TxHash.Hex(),
+		LogIndex:        int(log.Index),
+		ContractAddress: log.Address.Hex(),
+		FinalityStatus:  block.Finality,
+	}
+
+	if info, ok := s.factoryInfoMap[strings.ToLower(log.Address.Hex())]; ok {
+		event, fields := s.decodeFeeEvent(s.getABI(log.Address.Hex()), factoryFeeEventNames, log)
+		if event == "" {
+			return nil, nil
+		}
+		spacing, _ := fields["tickSpacing"].(*big.Int)
+		fee, _ := fields["fee"].(*big.Int)
+		if spacing == nil || fee == nil {
+			return nil, nil
+		}
+		tickSpacing, feeRate := int(spacing.Int64()), info.feeToPPM(fee)
+		change.EventName, change.TickSpacing, change.FeeRate = event, &tickSpacing, &feeRate
+		return change, nil
+	}
+
+	pool := s.cachedPool(log.Address)
+	if pool == nil {
+		return nil, nil
+	}
+	event, fields := s.decodeFeeEvent(s.poolEventABI(pool, "Swap"), []string{"FeeAmount", "Swapped", "Fee"}, log)
+	change.EventName, change.PoolAddress = event, pool.PoolAddress
+	var raw *big.Int
+	switch event {
+	case "FeeAmount":
+		raw, _ = fields["feeRate"].(*big.Int)
+	case "Swapped":
+		raw, _ = fields["swapFee"].(*big.Int)
+	case "Fee":
+		amount0, _ := fields["amount0"].(*big.Int)
+		amount1, _ := fields["amount1"].(*big.Int)
+		if amount0 == nil || amount1 == nil {
+			return nil, nil
+		}
+		a0, a1 := models.BigInt(amount0.String()), models.BigInt(amount1.String())
+		change.Amount0, change.Amount1 = &a0, &a1
+		return change, nil
+	default:
+		return nil, nil
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	feeRate := s.poolFactory(pool).feeToPPM(raw)
+	change.FeeRate = &feeRate
+	return change, nil
+}
+
+/*
+保存费率事件到费率历史
+FeeAmount/Swapped 的费率和上一次一样时不记录；工厂和池子管理员的费率事件每条都记录
+池子当前费率由 SaveBatch 从历史里位置最新的一条刷新，这里只更新缓存
+*/
+func (s *ABIScanner) saveFeeChange(block *BlockContext, log *types.Log, decoded interface{}) error {
+	change := decoded.(*models.PoolFeeChange)
+	perSwap := change.EventName == "FeeAmount" || change.EventName == "Swapped"
+	if perSwap && change.FeeRate != nil && !block.feeChanged(change.PoolAddress, *change.FeeRate) {
+		return nil
+	}
+	block.Batch.AddPoolFeeChange(change)
+	if change.PoolAddress == "" || change.FeeRate == nil {
+		return nil
+	}
+
+	pool := s.cachedPool(log.Address)
+	if pool.FeeBlock <= block.Number {
+		// 和库里一样，只有不早于fee_block的费率才覆盖
+		next := *pool
+		next.FeeRate, next.FeeBlock = change.FeeRate, block.Number
+		s.cachePool(block, &next)
+	}
+	return nil
+}
+
+// 按事件签名匹配names里的事件，解析indexed和非indexed参数，匹配不上返回空事件名
+func (s *ABIScanner) decodeFeeEvent(contractABI *ethabi.ABI, names []string, log *types.Log) (string, map[string]interface{}) {
+	if contractABI == nil {
+		return "", nil
+	}
+	for _, name := range names {
+		event, ok := contractABI.Events[name]
+		if !ok || log.Topics[0] != event.ID {
+			continue
+		}
+		fields, err := decodeEvent(&event, log)
+		if err != nil {
+			fmt.Printf("解析 %s 失败: %v\n", name, err)
+			return "", nil
+		}
+		return name, fields
+	}
+	return "", nil
+}
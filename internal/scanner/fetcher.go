@@ -0,0 +1,264 @@
+package scanner
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"zk-sync-go-pool/internal/blockchain"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	FetchModeBlockReceipts = "block_receipts" // 整块拉交易回执再解析日志
+	FetchModeLogs          = "logs"           // eth_getLogs 按地址/事件过滤拉日志
+
+	defaultLogsSpan = 1000 // logs模式默认每个任务的区块范围
+)
+
+/*
+区块日志获取策略
+scanRange 把区块切成一段一段的任务，每段交给 fetcher 拉日志，再逐块解析。
+*/
+type logFetcher interface {
+	// 获取 [from, to] 内的日志，按区块号分组，组内按logIndex升序；headers 为整段的区块头，SkipEmptyBlocks 时传nil
+	FetchLogs(from, to uint64, headers []*blockchain.BlockHeader) (map[uint64][]*types.Log, error)
+	// 每个扫描任务包含的区块数
+	SpanSize() uint64
+	// 没有日志的区块是否可以跳过（logs模式只拿到过滤后的日志，没日志的区块无需处理，也不用拿区块头）
+	SkipEmptyBlocks() bool
+}
+
+func newLogFetcher(s *ABIScanner) logFetcher {
+	span := uint64(s.cfg.Scanner.FetchSpan)
+	switch s.cfg.Scanner.FetchMode {
+	case FetchModeLogs:
+		if s.cfg.Scanner.ArchiveEvents {
+			// 归档原始事件要跟踪合约的每条日志：池子地址太多放不进过滤条件，同一段里新建的池子也还不在地址列表里，
+			// 不加过滤又会拉到链上所有日志，所以改用整块回执
+			fmt.Printf("⚠️ archive_events 开启时 logs 模式拿不全跟踪合约的日志，使用 %s\n", FetchModeBlockReceipts)
+			break
+		}
+		if span == 0 {
+			span = defaultLogsSpan
+		}
+		f := &logsFetcher{span: span}
+		f.factoryAddrs, f.factoryTopics, f.poolTopics = s.logFilters()
+		f.contractAddrs, f.contractTopics = s.mappingFilters()
+		return f
+	case FetchModeBlockReceipts, "":
+	default:
+		fmt.Printf("⚠️ 未知的fetch_mode: %s，使用 %s\n", s.cfg.Scanner.FetchMode, FetchModeBlockReceipts)
+	}
+	if span == 0 {
+		span = 1
+	}
+	return &receiptsFetcher{span: span}
+}
+
+/*
+block_receipts 模式：批量拉整段区块的交易回执，拿到区块内全部日志
+*/
+type receiptsFetcher struct {
+	span uint64
+}
+
+func (f *receiptsFetcher) FetchLogs(from, to uint64, headers []*blockchain.BlockHeader) (map[uint64][]*types.Log, error) {
+	receipts, err := blockchain.GetReceiptsForHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint64][]*types.Log, len(receipts))
+	for blockNum, blockReceipts := range receipts {
+		logs := make([]*types.Log, 0)
+		for _, receipt := range blockReceipts {
+			logs = append(logs, receipt.Logs...)
+		}
+		result[blockNum] = logs
+	}
+	return result, nil
+}
+
+func (f *receiptsFetcher) SpanSize() uint64 { return f.span }
+
+func (f *receiptsFetcher) SkipEmptyBlocks() bool { return false }
+
+/*
+logs 模式：eth_getLogs 只拉我们关心的日志
+1. 工厂地址 + PoolCreated 事件
+2. Swap 等池子事件和按 pool_types 配置的事件映射（池子地址太多不放进过滤条件，只按topic过滤，解析时再用poolCache筛）
+3. 按 contracts 配置的事件映射：合约地址 + 映射的事件
+归档原始事件(archive_events)时不用这个模式，见 newLogFetcher。
+节点返回结果太多时把区块范围对半拆开重试。
+*/
+type logsFetcher struct {
+	span           uint64
+	factoryAddrs   []common.Address // 工厂地址
+	factoryTopics  []common.Hash    // 工厂事件签名，为空则不按事件过滤
+	poolTopics     []common.Hash    // 池子事件签名
+	contractAddrs  []common.Address // 事件映射配置的合约地址
+	contractTopics []common.Hash    // 这些合约上映射的事件签名
+}
+
+func (f *logsFetcher) FetchLogs(from, to uint64, headers []*blockchain.BlockHeader) (map[uint64][]*types.Log, error) {
+	var queries []ethereum.FilterQuery
+	if len(f.factoryAddrs) > 0 {
+		query := ethereum.FilterQuery{Addresses: f.factoryAddrs}
+		if len(f.factoryTopics) > 0 {
+			query.Topics = [][]common.Hash{f.factoryTopics}
+		}
+		queries = append(queries, query)
+	}
+	if len(f.poolTopics) > 0 {
+		queries = append(queries, ethereum.FilterQuery{Topics: [][]common.Hash{f.poolTopics}})
+	}
+	if len(f.contractAddrs) > 0 {
+		queries = append(queries, ethereum.FilterQuery{Addresses: f.contractAddrs, Topics: [][]common.Hash{f.contractTopics}})
+	}
+	var all []types.Log
+	for _, query := range queries {
+		logs, err := getLogsAdaptive(query, from, to)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, logs...)
+	}
+
+	result := make(map[uint64][]*types.Log)
+	seen := make(map[string]bool) // 几次查询可能返回同一条日志
+	for i := range all {
+		log := &all[i]
+		key := fmt.Sprintf("%s:%d", log.TxHash.Hex(), log.Index)
+		if seen[key] || log.Removed {
+			continue
+		}
+		seen[key] = true
+		result[log.BlockNumber] = append(result[log.BlockNumber], log)
+	}
+	for _, logs := range result {
+		sort.Slice(logs, func(i, j int) bool { return logs[i].Index < logs[j].Index })
+	}
+	return result, nil
+}
+
+func (f *logsFetcher) SpanSize() uint64 { return f.span }
+
+func (f *logsFetcher) SkipEmptyBlocks() bool { return true }
+
+// 区块范围太大就对半拆分递归拉取，直到单个区块仍然超限才报错
+func getLogsAdaptive(query ethereum.FilterQuery, from, to uint64) ([]types.Log, error) {
+	query.FromBlock = new(big.Int).SetUint64(from)
+	query.ToBlock = new(big.Int).SetUint64(to)
+	logs, err := blockchain.GetLogs(query)
+	if err == nil {
+		return logs, nil
+	}
+	if !blockchain.IsTooManyResultsError(err) || from == to {
+		return nil, err
+	}
+
+	mid := from + (to-from)/2
+	left, err := getLogsAdaptive(query, from, mid)
+	if err != nil {
+		return nil, err
+	}
+	right, err := getLogsAdaptive(query, mid+1, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+/*
+logs模式的过滤条件，从已加载的ABI里取事件签名
+*/
+func (s *ABIScanner) logFilters() (factoryAddrs []common.Address, factoryTopics []common.Hash, poolTopics []common.Hash) {
+	factoryAddrs, factoryTopics = s.factoryFilters("")
+	return factoryAddrs, factoryTopics, s.poolTopics("")
+}
+
+// 工厂地址和创建池子/默认费率事件的topic，protocol为空时返回所有协议的
+func (s *ABIScanner) factoryFilters(protocol string) (factoryAddrs []common.Address, factoryTopics []common.Hash) {
+	factoryTopicSet := make(map[common.Hash]bool)
+	for addr, info := range s.factoryInfoMap {
+		if addr == "" || (protocol != "" && info.Protocol != protocol) {
+			continue
+		}
+		factoryAddrs = append(factoryAddrs, common.HexToAddress(addr))
+		eventName := info.EventName
+		if eventName == "" {
+			eventName = "PoolCreated"
+		}
+		if contractABI := s.getABI(addr); contractABI != nil {
+			for _, name := range append([]string{eventName}, factoryFeeEventNames...) {
+				if event, ok := contractABI.Events[name]; ok {
+					factoryTopicSet[event.ID] = true
+				}
+			}
+		}
+	}
+	for topic := range factoryTopicSet {
+		factoryTopics = append(factoryTopics, topic)
+	}
+	return factoryAddrs, factoryTopics
+}
+
+// 池子事件和按 pool_types 配置的事件映射的topic，protocol为空时返回所有协议的
+func (s *ABIScanner) poolTopics(protocol string) []common.Hash {
+	poolTopicSet := make(map[common.Hash]bool)
+	for key, masterAddr := range s.poolABIMap {
+		if protocol != "" && !strings.HasPrefix(key, protocol+":") {
+			continue
+		}
+		contractABI := s.getABI(masterAddr)
+		if contractABI == nil {
+			continue
+		}
+		for _, eventName := range poolEventNames {
+			if event, ok := contractABI.Events[eventName]; ok {
+				poolTopicSet[event.ID] = true
+			}
+		}
+	}
+	// 按池子类型的映射跟池子事件一样只按topic过滤，解析时再按池子类型筛
+	for topic, mappings := range s.mappings {
+		for _, mapping := range mappings {
+			if len(mapping.poolTypes) > 0 && (protocol == "" || mapping.protocol == protocol) {
+				poolTopicSet[topic] = true
+			}
+		}
+	}
+	poolTopics := make([]common.Hash, 0, len(poolTopicSet))
+	for topic := range poolTopicSet {
+		poolTopics = append(poolTopics, topic)
+	}
+	return poolTopics
+}
+
+// 按 contracts 配置的事件映射的合约地址和事件topic，单独按地址过滤，不放进只按topic过滤的池子事件查询
+func (s *ABIScanner) mappingFilters() (contractAddrs []common.Address, contractTopics []common.Hash) {
+	addrSet := make(map[string]bool)
+	topicSet := make(map[common.Hash]bool)
+	for topic, mappings := range s.mappings {
+		for _, mapping := range mappings {
+			for address := range mapping.contracts {
+				addrSet[address] = true
+				topicSet[topic] = true
+			}
+		}
+	}
+	for address := range addrSet {
+		contractAddrs = append(contractAddrs, common.HexToAddress(address))
+	}
+	for topic := range topicSet {
+		contractTopics = append(contractTopics, topic)
+	}
+	return contractAddrs, contractTopics
+}
+
+// 池子上需要索引的事件
+var poolEventNames = []string{"Swap", "Mint", "Burn", "Sync", "Collect", "Initialize", "CollectFees", "Flash", "SetFeeProtocol",
+	"FeeAmount", "Swapped", "Fee"}
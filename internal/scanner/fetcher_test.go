@@ -0,0 +1,136 @@
+package scanner
+
+import (
+	"reflect"
+	"testing"
+	"zk-sync-go-pool/internal/config"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// logs模式的扫描器，stable进度和区块记录停在 tip
+func newLogsModeScanner(t *testing.T, chain *fakeChain, topic common.Hash, tip uint64) *ABIScanner {
+	t.Helper()
+	s := newTestScanner(t)
+	s.fetcher = &logsFetcher{span: 100, poolTopics: []common.Hash{topic}}
+	if err := s.repo.InitScanProgress("stable_scan", tip); err != nil {
+		t.Fatal(err)
+	}
+	batch := repository.NewBatch()
+	batch.AddBlock(&models.Block{Number: tip, Hash: chain.hash(tip).Hex(), ParentHash: chain.hash(tip - 1).Hex(),
+		Timestamp: 1700000000 + int64(tip), FinalityStatus: "safe"})
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLogsModeFetchesHeadersOnlyForBlocksWithLogs(t *testing.T) {
+	chain := newFakeChain(t, 300)
+	topic := common.Hash{0xee}
+	chain.addLog(types.Log{Address: common.Address{1}, Topics: []common.Hash{topic}, BlockNumber: 150, TxHash: common.Hash{1}})
+	chain.addLog(types.Log{Address: common.Address{1}, Topics: []common.Hash{{0xff}}, BlockNumber: 160, TxHash: common.Hash{2}})
+	s := newLogsModeScanner(t, chain, topic, 99)
+	chain.requestedHeaders()
+
+	if failed := s.scanSpan(100, 199, "safe"); len(failed) > 0 {
+		t.Fatalf("scanSpan failed: %v", failed)
+	}
+	// 段首、有日志的区块、段尾
+	if got, want := chain.requestedHeaders(), []uint64{100, 150, 199}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("headers requested for %v, want %v", got, want)
+	}
+	blocks, err := s.repo.GetBlocks(100, 199)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 100 {
+		t.Fatalf("recorded %d blocks, want all 100 for the audit", len(blocks))
+	}
+	for _, block := range blocks {
+		hashed := block.Number == 100 || block.Number == 150 || block.Number == 199
+		if hashed != (block.Hash != "") {
+			t.Fatalf("block %d hash = %q", block.Number, block.Hash)
+		}
+	}
+	if progress, _ := s.repo.GetScanProgress("stable_scan"); progress != 199 {
+		t.Fatalf("stable progress = %d, want 199", progress)
+	}
+	if broken, err := s.checkLedger(100, 199); err != nil || broken != 0 {
+		t.Fatalf("checkLedger = %d, %v; want continuous", broken, err)
+	}
+	if rolledBack, _, err := s.checkReorg(200, "safe"); err != nil || rolledBack {
+		t.Fatalf("checkReorg = %v, %v; want no reorg", rolledBack, err)
+	}
+}
+
+func TestPendingReorgCheckFallsBackToLastHashedBlock(t *testing.T) {
+	chain := newFakeChain(t, 300)
+	topic := common.Hash{0xee}
+	chain.addLog(types.Log{Address: common.Address{1}, Topics: []common.Hash{topic}, BlockNumber: 150, TxHash: common.Hash{1}})
+	s := newLogsModeScanner(t, chain, topic, 99)
+	if failed := s.scanSpan(100, 199, "pending"); len(failed) > 0 {
+		t.Fatalf("scanSpan failed: %v", failed)
+	}
+
+	// 180 没有哈希，往前用150比较
+	if err := s.checkPendingReorg(181); err != nil {
+		t.Fatal(err)
+	}
+	if blocks, _ := s.repo.GetBlocks(100, 199); len(blocks) != 100 {
+		t.Fatalf("pending blocks deleted without a reorg: %d left", len(blocks))
+	}
+
+	// 150 被换掉，往回能确认的公共祖先是记了哈希的100
+	chain.reorg(140)
+	if err := s.checkPendingReorg(181); err != nil {
+		t.Fatal(err)
+	}
+	if blocks, _ := s.repo.GetBlocks(100, 199); len(blocks) != 1 || blocks[0].Number != 100 {
+		t.Fatalf("%d pending blocks left after the reorg, want only 100", len(blocks))
+	}
+}
+
+func TestArchiveEventsForcesBlockReceipts(t *testing.T) {
+	s := newTestScanner(t)
+	s.cfg.Scanner.FetchMode = FetchModeLogs
+	if _, ok := newLogFetcher(s).(*logsFetcher); !ok {
+		t.Fatal("logs mode without archive_events should filter logs")
+	}
+	// 归档要跟踪合约的每条日志，不能按过滤条件拉，也不能拉全链的日志
+	s.cfg.Scanner.ArchiveEvents = true
+	if _, ok := newLogFetcher(s).(*receiptsFetcher); !ok {
+		t.Fatal("archive_events in logs mode should fall back to block receipts")
+	}
+}
+
+func TestContractMappingsQueryByAddress(t *testing.T) {
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newConfiguredScanner(t, pool)
+	master := s.poolABIMap["syncswap:classic:v2"]
+	s.cfg.Mappings = []config.MappingConfig{
+		{Name: "lp_transfers", Event: "Transfer", PoolTypes: []string{"classic"}, Table: "lp_transfers"},
+		{Name: "usdc_approvals", Event: "Approval", Contracts: []string{testUSDC}, ABI: master, Table: "usdc_approvals"},
+	}
+	s.initEventMappings()
+	poolABI := s.poolEventABI(pool, "Transfer")
+	transfer, approval := poolABI.Events["Transfer"].ID, poolABI.Events["Approval"].ID
+
+	f, ok := newLogFetcher(s).(*logsFetcher)
+	if !ok {
+		t.Fatal("want a logs fetcher")
+	}
+	// 按池子类型的映射跟池子事件一起只按topic查，按合约的映射单独按地址查
+	if !containsHash(f.poolTopics, transfer) || containsHash(f.poolTopics, approval) {
+		t.Fatalf("pool topics = %v, want Transfer without Approval", f.poolTopics)
+	}
+	if want := []common.Address{common.HexToAddress(testUSDC)}; !reflect.DeepEqual(f.contractAddrs, want) {
+		t.Fatalf("contract addresses = %v, want %v", f.contractAddrs, want)
+	}
+	if want := []common.Hash{approval}; !reflect.DeepEqual(f.contractTopics, want) {
+		t.Fatalf("contract topics = %v, want %v", f.contractTopics, want)
+	}
+}
@@ -0,0 +1,277 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+/*
+日志处理器
+每条日志按注册顺序交给所有处理器：Match 粗筛，Decode 解码(返回nil表示不是自己的事件)，
+Persist 把要写入的行加进 block.Batch，整个区块(或一段区块)处理完后在一个事务里写入；
+不是第一个匹配的处理器独占：同一条日志可以被多个处理器处理(例如事件映射和Swap处理器都处理Swap事件)，
+处理器之间不要往同一张表写同一条日志。
+链重组回滚、pending重建时按注册顺序调用 Rollback 清理处理器自己维护的数据。
+内置处理器的表都在 repository 的事件表里统一按区块删除，Rollback 什么都不做；
+自定义处理器如果把数据写在别处(不是 block.Batch)，要在 Rollback 里自己删除。
+*/
+type LogHandler interface {
+	Name() string                                                           // 统计输出用，如 "Swap事件"
+	Match(log *types.Log) bool                                              // 只看地址和事件签名，判断可能是自己的日志
+	Decode(block *BlockContext, log *types.Log) (interface{}, error)        // 解码，解析不了返回nil跳过；只有需要重试的错误才返回error
+	Persist(block *BlockContext, log *types.Log, decoded interface{}) error // 入库(加进block.Batch)，失败整个区块进死信队列重试
+	Rollback(after uint64, pendingOnly bool) error                          // 删除区块号大于after的数据，pendingOnly为true只删pending状态的
+}
+
+// 同一个区块的日志共享的上下文
+type BlockContext struct {
+	Number    uint64
+	Timestamp int64
+	Finality  string       // safe/pending
+	Logs      []*types.Log // 区块内的全部日志(logs模式下只有过滤条件里的)，按logIndex升序
+	Batch     *repository.Batch
+
+	undo     []func()        // 处理器对poolCache的改动，区块失败或批次写入失败时撤销
+	feeReads *[]*poolFeeRead // 不为nil时新池子不在创建区块上读费率，收集起来由调用方批量读
+	spanFees map[string]int  // 同一段里按顺序记下的每个池子最近一次swap费率，为nil时每条都记录
+}
+
+/*
+swap带的费率和这一段里这个池子上一次记录的不同时返回true，并记下新费率
+多协程扫描时各段乱序入库，池子缓存里的费率可能来自后面的区块，不能拿来比较；
+只在同一段里按链上顺序去重，每段第一次出现的费率照常记录
+*/
+func (b *BlockContext) feeChanged(pool string, feeRate int) bool {
+	if b.spanFees == nil {
+		return true
+	}
+	if last, ok := b.spanFees[pool]; ok && last == feeRate {
+		return false
+	}
+	b.spanFees[pool] = feeRate
+	return true
+}
+
+// 同一笔交易里的日志，按logIndex升序
+func (b *BlockContext) TxLogs(txHash common.Hash) []*types.Log {
+	var logs []*types.Log
+	for _, log := range b.Logs {
+		if log.TxHash == txHash {
+			logs = append(logs, log)
+		}
+	}
+	return logs
+}
+
+/*
+写入poolCache，批次没写进库时恢复成原来的
+缓存里的池子可能正在被别的协程读，改动要换成新对象
+*/
+func (s *ABIScanner) cachePool(block *BlockContext, pool *models.Pool) {
+	key := strings.ToLower(pool.PoolAddress)
+	s.poolCacheMu.Lock()
+	prev, existed := s.poolCache[key]
+	s.setCachedPoolLocked(pool)
+	s.poolCacheMu.Unlock()
+
+	block.undo = append(block.undo, func() {
+		s.poolCacheMu.Lock()
+		defer s.poolCacheMu.Unlock()
+		if s.poolCache[key] != pool {
+			return // 已经被后面的区块改过
+		}
+		if existed {
+			s.setCachedPoolLocked(prev)
+		} else {
+			s.deleteCachedPoolLocked(key)
+		}
+	})
+}
+
+// 按相反顺序撤销缓存改动
+func undoCache(undo []func()) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		undo[i]()
+	}
+}
+
+/*
+在一个事务里写入批次，新插入的swap在同一个事务里增量更新K线
+持 candleRebuildMu 读锁，写入和K线更新期间不会有pending重建、链重组回滚；
+有swap的批次再持 candleMu，K线的读改写不会和别的批次交错；写入失败撤销缓存改动
+*/
+func (s *ABIScanner) flushBatch(batch *repository.Batch, undo []func()) error {
+	s.candleRebuildMu.RLock()
+	defer s.candleRebuildMu.RUnlock()
+
+	if batch.HasSwaps() {
+		s.candleMu.Lock()
+		defer s.candleMu.Unlock()
+		batch.SetCandleMerger(candleMerger{s})
+	}
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		undoCache(undo)
+		return fmt.Errorf("批量入库失败: %v", err)
+	}
+	return nil
+}
+
+// 内置处理器的顺序，自定义处理器按需要插在中间
+const (
+	HandlerOrderMapping   = 100 // 配置里声明的事件映射
+	HandlerOrderPool      = 200 // 工厂创建池子
+	HandlerOrderSwap      = 300
+	HandlerOrderLiquidity = 400 // classic/stable/aqua Mint/Burn/Sync
+	HandlerOrderRange     = 500 // range池子的其他事件
+	HandlerOrderFee       = 600 // 费率变化
+)
+
+const (
+	poolHandlerName = "池子"
+	swapHandlerName = "Swap事件"
+)
+
+type registeredHandler struct {
+	order   int
+	handler LogHandler
+}
+
+/*
+注册日志处理器，同一顺序按注册先后执行
+只能在 Start 之前调用
+*/
+func (s *ABIScanner) RegisterHandler(order int, handler LogHandler) {
+	s.handlers = append(s.handlers, registeredHandler{order: order, handler: handler})
+	sort.SliceStable(s.handlers, func(i, j int) bool { return s.handlers[i].order < s.handlers[j].order })
+}
+
+// 内置处理器：各自的解码和入库函数在对应的文件里
+func (s *ABIScanner) registerBuiltinHandlers() {
+	s.RegisterHandler(HandlerOrderMapping, &builtinHandler{
+		name:    "映射事件",
+		match:   func(log *types.Log) bool { return len(s.mappings[log.Topics[0]]) > 0 },
+		decode:  s.decodeMappedLog,
+		persist: s.saveMappedRows,
+	})
+	s.RegisterHandler(HandlerOrderPool, &builtinHandler{
+		name:    poolHandlerName,
+		match:   s.isFactoryLog,
+		decode:  s.decodePoolLog,
+		persist: s.savePoolCreation,
+	})
+	s.RegisterHandler(HandlerOrderSwap, &builtinHandler{
+		name:  swapHandlerName,
+		match: s.isPoolLog,
+		decode: func(block *BlockContext, log *types.Log) (interface{}, error) {
+			if swap := s.decodeSwapLog(block.Number, block.Timestamp, log.TxHash.Hex(), log, block.Finality); swap != nil {
+				return swap, nil
+			}
+			return nil, nil
+		},
+		persist: s.saveSwap,
+	})
+	s.RegisterHandler(HandlerOrderLiquidity, &builtinHandler{
+		name:    "Mint/Burn/Sync事件",
+		match:   s.isPoolLog,
+		decode:  s.decodeLiquidityLog,
+		persist: s.saveLiquidityLog,
+	})
+	s.RegisterHandler(HandlerOrderRange, &builtinHandler{
+		name:    "range事件",
+		match:   s.isPoolLog,
+		decode:  s.decodeRangeLog,
+		persist: s.saveRangeLog,
+	})
+	s.RegisterHandler(HandlerOrderFee, &builtinHandler{
+		name:    "费率事件",
+		match:   func(log *types.Log) bool { return s.isFactoryLog(log) || s.isPoolLog(log) },
+		decode:  s.decodeFeeLog,
+		persist: s.saveFeeChange,
+	})
+}
+
+func (s *ABIScanner) isFactoryLog(log *types.Log) bool {
+	_, ok := s.factoryInfoMap[strings.ToLower(log.Address.Hex())]
+	return ok
+}
+
+func (s *ABIScanner) isPoolLog(log *types.Log) bool {
+	return s.cachedPool(log.Address) != nil
+}
+
+/*
+一条日志按顺序交给所有匹配的处理器(不会在第一个匹配的处理器后停下)，counts按处理器名称累计处理条数
+任何一个处理器入库失败都返回错误，整个区块重试(批次写入都是幂等的upsert)
+*/
+func (s *ABIScanner) processLog(block *BlockContext, log *types.Log, counts map[string]int) error {
+	if len(log.Topics) == 0 {
+		return nil // 匿名事件，不是我们关心的
+	}
+	for _, entry := range s.handlers {
+		handler := entry.handler
+		if !handler.Match(log) {
+			continue
+		}
+		decoded, err := handler.Decode(block, log)
+		if err != nil {
+			return fmt.Errorf("%s解码失败: %v", handler.Name(), err)
+		}
+		if decoded == nil {
+			continue
+		}
+		if err := handler.Persist(block, log, decoded); err != nil {
+			return err
+		}
+		if counts != nil {
+			counts[handler.Name()]++
+		}
+	}
+	return nil
+}
+
+// 链重组回滚/pending重建后通知所有处理器
+func (s *ABIScanner) rollbackHandlers(after uint64, pendingOnly bool) error {
+	for _, entry := range s.handlers {
+		if err := entry.handler.Rollback(after, pendingOnly); err != nil {
+			return fmt.Errorf("%s回滚失败: %v", entry.handler.Name(), err)
+		}
+	}
+	return nil
+}
+
+// 处理统计，按处理器顺序输出，如 "1 个池子, 3 个Swap事件"
+func (s *ABIScanner) handlerSummary(counts map[string]int) string {
+	parts := make([]string, 0, len(s.handlers))
+	for _, entry := range s.handlers {
+		parts = append(parts, fmt.Sprintf("%d 个%s", counts[entry.handler.Name()], entry.handler.Name()))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// 内置处理器，数据都在事件表里由repository统一回滚
+type builtinHandler struct {
+	name    string
+	match   func(log *types.Log) bool
+	decode  func(block *BlockContext, log *types.Log) (interface{}, error)
+	persist func(block *BlockContext, log *types.Log, decoded interface{}) error
+}
+
+func (h *builtinHandler) Name() string { return h.name }
+
+func (h *builtinHandler) Match(log *types.Log) bool { return h.match(log) }
+
+func (h *builtinHandler) Decode(block *BlockContext, log *types.Log) (interface{}, error) {
+	return h.decode(block, log)
+}
+
+func (h *builtinHandler) Persist(block *BlockContext, log *types.Log, decoded interface{}) error {
+	return h.persist(block, log, decoded)
+}
+
+func (h *builtinHandler) Rollback(after uint64, pendingOnly bool) error { return nil }
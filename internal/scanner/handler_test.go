@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 记录调用顺序的处理器
+type recordingHandler struct {
+	name   string
+	skip   bool // Decode返回nil
+	calls  *[]string
+	rolled *[]string
+}
+
+func (h *recordingHandler) Name() string { return h.name }
+
+func (h *recordingHandler) Match(log *types.Log) bool { return true }
+
+func (h *recordingHandler) Decode(block *BlockContext, log *types.Log) (interface{}, error) {
+	if h.skip {
+		return nil, nil
+	}
+	return log, nil
+}
+
+func (h *recordingHandler) Persist(block *BlockContext, log *types.Log, decoded interface{}) error {
+	*h.calls = append(*h.calls, h.name)
+	return nil
+}
+
+func (h *recordingHandler) Rollback(after uint64, pendingOnly bool) error {
+	if !pendingOnly || after != 100 {
+		*h.rolled = append(*h.rolled, "unexpected")
+	}
+	*h.rolled = append(*h.rolled, h.name)
+	return nil
+}
+
+func TestHandlersRunInOrderAndRollBack(t *testing.T) {
+	s := newTestScanner(t)
+	var calls, rolled []string
+	handler := func(name string, skip bool) *recordingHandler {
+		return &recordingHandler{name: name, skip: skip, calls: &calls, rolled: &rolled}
+	}
+	s.RegisterHandler(300, handler("c", false))
+	s.RegisterHandler(100, handler("a", false))
+	s.RegisterHandler(300, handler("d", false))
+	s.RegisterHandler(200, handler("b", true))
+
+	// 所有匹配的处理器都执行，同一顺序按注册先后，Decode返回nil的不入库
+	counts := make(map[string]int)
+	log := &types.Log{Address: common.HexToAddress("0x01"), Topics: []common.Hash{{1}}}
+	if err := s.processLog(&BlockContext{Number: 101}, log, counts); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c", "d"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("persist order = %v, want %v", calls, want)
+	}
+	if counts["b"] != 0 || counts["a"] != 1 {
+		t.Fatalf("counts = %v", counts)
+	}
+
+	// pending重建后按顺序通知每个处理器
+	if err := s.deletePending(100); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(rolled, want) {
+		t.Fatalf("rollback order = %v, want %v", rolled, want)
+	}
+}
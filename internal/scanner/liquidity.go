@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+/*
+找到池子对应的事件ABI
+配置里stable的pool master地址下载下来的ABI不带池子事件，
+SyncSwap的stable/aqua池子和classic池子的 Swap/Mint/Burn/Sync 事件签名一致，找不到时退回同版本classic的ABI。
+其他池子类型不退回，找不到返回nil，这类池子的事件跳过(用别的ABI解码数量可能是错的)
+*/
+func (s *ABIScanner) poolEventABI(pool *models.Pool, eventName string) *ethabi.ABI {
+	for _, key := range s.poolABIKeys(pool) {
+		masterAddr, ok := s.poolABIMap[key]
+		if !ok {
+			continue
+		}
+		contractABI := s.getABI(masterAddr)
+		if contractABI == nil {
+			continue
+		}
+		if _, ok := contractABI.Events[eventName]; ok {
+			return contractABI
+		}
+	}
+	// 每种池子类型、每个事件只提示一次
+	key := poolABIKey(pool.Protocol, pool.PoolType, pool.Version) + ":" + eventName
+	if _, warned := s.missingABIs.LoadOrStore(key, true); !warned {
+		fmt.Printf("⚠️ 池子类型%s没有%s事件的ABI，跳过这类池子的%s事件\n",
+			poolABIKey(pool.Protocol, pool.PoolType, pool.Version), eventName, eventName)
+	}
+	return nil
+}
+
+// 和classic池子事件结构一样的SyncSwap池子类型
+var classicCompatiblePoolTypes = map[string]bool{"stable": true, "aqua": true}
+
+// 池子按顺序尝试的pool master key
+func (s *ABIScanner) poolABIKeys(pool *models.Pool) []string {
+	keys := []string{poolABIKey(pool.Protocol, pool.PoolType, pool.Version)}
+	if pool.Protocol == defaultProtocol && classicCompatiblePoolTypes[pool.PoolType] {
+		keys = append(keys, poolABIKey(pool.Protocol, "classic", pool.Version))
+	}
+	return keys
+}
+
+// 从缓存中取池子，不是我们跟踪的池子返回nil
+func (s *ABIScanner) cachedPool(address common.Address) *models.Pool {
+	s.poolCacheMu.RLock()
+	defer s.poolCacheMu.RUnlock()
+	return s.poolCache[strings.ToLower(address.Hex())]
+}
+
+/*
+解析classic/stable/aqua池子(以及其他协议v2语义的池子)的 Mint/Burn/Sync 日志
+Mint/Burn 解码成liquidity_events，Sync 解码成pool_reserves（只保留最新一次），同时更新所在周期的pool_snapshots
+range池子的Mint/Burn结构不一样，不在这里处理
+*/
+func (s *ABIScanner) decodeLiquidityLog(block *BlockContext, log *types.Log) (interface{}, error) {
+	pool := s.cachedPool(log.Address)
+	if pool == nil || s.poolFactory(pool).Swap == swapV3 {
+		return nil, nil
+	}
+
+	for _, eventName := range []string{"Mint", "Burn", "Sync"} {
+		contractABI := s.poolEventABI(pool, eventName)
+		if contractABI == nil || log.Topics[0] != contractABI.Events[eventName].ID {
+			continue
+		}
+
+		fields := make(map[string]interface{})
+		if err := contractABI.UnpackIntoMap(fields, eventName, log.Data); err != nil {
+			fmt.Printf("解析 %s 失败: %v\n", eventName, err)
+			return nil, nil
+		}
+
+		if eventName == "Sync" {
+			reserve0, _ := fields["reserve0"].(*big.Int)
+			reserve1, _ := fields["reserve1"].(*big.Int)
+			if reserve0 == nil || reserve1 == nil {
+				return nil, nil
+			}
+			return &models.PoolReserve{
+				PoolAddress:    pool.PoolAddress,
+				FinalityStatus: block.Finality,
+				Reserve0:       models.BigInt(reserve0.String()),
+				Reserve1:       models.BigInt(reserve1.String()),
+				BlockNumber:    block.Number,
+				LogIndex:       int(log.Index),
+			}, nil
+		}
+
+		// Mint/Burn: sender、to 是indexed；uniswap v2分叉的Mint没有to，Mint/Burn都不带liquidity，记为接收者=sender、liquidity=0
+		if len(log.Topics) < 2 {
+			return nil, nil
+		}
+		amount0, _ := fields["amount0"].(*big.Int)
+		amount1, _ := fields["amount1"].(*big.Int)
+		if amount0 == nil || amount1 == nil {
+			return nil, nil
+		}
+		liquidity, _ := fields["liquidity"].(*big.Int)
+		if liquidity == nil {
+			liquidity = new(big.Int)
+		}
+		recipient := log.Topics[1]
+		if len(log.Topics) > 2 {
+			recipient = log.Topics[2]
+		}
+		return &models.LiquidityEvent{
+			BlockNumber:    block.Number,
+			BlockTimeStamp: block.Timestamp,
+			TxHash:         log.TxHash.Hex(),
+			LogIndex:       int(log.Index),
+			PoolAddress:    pool.PoolAddress,
+			EventType:      strings.ToLower(eventName),
+			Sender:         common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+			Recipient:      common.BytesToAddress(recipient.Bytes()).Hex(),
+			Amount0:        models.BigInt(amount0.String()),
+			Amount1:        models.BigInt(amount1.String()),
+			Liquidity:      models.BigInt(liquidity.String()),
+			FinalityStatus: block.Finality,
+		}, nil
+	}
+	return nil, nil
+}
+
+func (s *ABIScanner) saveLiquidityLog(block *BlockContext, log *types.Log, decoded interface{}) error {
+	switch record := decoded.(type) {
+	case *models.PoolReserve:
+		block.Batch.AddPoolReserve(record)
+		return s.saveSyncSnapshot(block, s.cachedPool(log.Address), record)
+	case *models.LiquidityEvent:
+		block.Batch.AddLiquidityEvent(record)
+	}
+	return nil
+}
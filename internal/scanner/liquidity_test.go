@@ -0,0 +1,32 @@
+package scanner
+
+import (
+	"reflect"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+)
+
+func TestPoolABIKeysFallBackOnlyForClassicCompatibleTypes(t *testing.T) {
+	s := &ABIScanner{factoryInfoMap: map[string]factoryInfo{}, poolABIMap: map[string]string{}}
+	cases := []struct {
+		pool *models.Pool
+		want []string
+	}{
+		{&models.Pool{Protocol: "syncswap", PoolType: "stable", Version: "v2"}, []string{"syncswap:stable:v2", "syncswap:classic:v2"}},
+		{&models.Pool{Protocol: "syncswap", PoolType: "aqua", Version: "v2.1"}, []string{"syncswap:aqua:v2.1", "syncswap:classic:v2.1"}},
+		{&models.Pool{Protocol: "syncswap", PoolType: "classic", Version: "v2"}, []string{"syncswap:classic:v2"}},
+		{&models.Pool{Protocol: "syncswap", PoolType: "range", Version: "v3"}, []string{"syncswap:range:v3"}},
+		{&models.Pool{Protocol: "syncswap", PoolType: "weighted", Version: "v2"}, []string{"syncswap:weighted:v2"}},
+		{&models.Pool{Protocol: "other", PoolType: "stable", Version: "v1"}, []string{"other:stable:v1"}},
+	}
+	for _, c := range cases {
+		if got := s.poolABIKeys(c.pool); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("poolABIKeys(%s:%s:%s) = %v, want %v", c.pool.Protocol, c.pool.PoolType, c.pool.Version, got, c.want)
+		}
+	}
+
+	// 没有ABI的池子类型跳过，不会用classic的ABI解码
+	if abi := s.poolEventABI(&models.Pool{Protocol: "syncswap", PoolType: "weighted", Version: "v2"}, "Swap"); abi != nil {
+		t.Fatal("unknown pool type should not get an ABI")
+	}
+}
@@ -0,0 +1,312 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"zk-sync-go-pool/internal/config"
+	"zk-sync-go-pool/internal/repository"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 表名和列名只允许小写字母、数字、下划线，加上引号拼进DDL(from/to 之类的保留字也能用)
+var identifierPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// 配置里声明的一个事件映射(event_mappings)
+type eventMapping struct {
+	name      string
+	table     string
+	event     ethabi.Event
+	contracts map[string]bool // 合约地址(小写)
+	protocol  string          // poolTypes 所属的协议
+	poolTypes map[string]bool // classic 或 classic:v2
+	columns   []mappedColumn
+}
+
+type mappedColumn struct {
+	column string
+	field  string
+	kind   string
+}
+
+/*
+加载 event_mappings：找到事件ABI，推断列类型，确保目标表存在
+配置有问题的映射打印警告后跳过，不影响其他映射和正常扫描
+*/
+func (s *ABIScanner) initEventMappings() {
+	s.mappings = make(map[common.Hash][]*eventMapping)
+	for _, cfg := range s.cfg.Mappings {
+		mapping, err := s.newEventMapping(cfg)
+		if err != nil {
+			fmt.Printf("⚠️ 事件映射%s无效: %v\n", cfg.Name, err)
+			continue
+		}
+		columns := make([]repository.EventColumn, len(mapping.columns))
+		for i, column := range mapping.columns {
+			columns[i] = repository.EventColumn{Name: column.column, Kind: column.kind}
+		}
+		if err := s.repo.EnsureEventTable(mapping.table, columns); err != nil {
+			fmt.Printf("⚠️ 事件映射%s: %v\n", cfg.Name, err)
+			continue
+		}
+		s.mappings[mapping.event.ID] = append(s.mappings[mapping.event.ID], mapping)
+		fmt.Printf("✅ 事件映射 %s: %s -> %s(%d 列)\n", mapping.name, mapping.event.Name, mapping.table, len(mapping.columns))
+	}
+}
+
+func (s *ABIScanner) newEventMapping(cfg config.MappingConfig) (*eventMapping, error) {
+	if !identifierPattern.MatchString(cfg.Table) {
+		return nil, fmt.Errorf("表名%q只能用小写字母、数字和下划线", cfg.Table)
+	}
+	if len(cfg.Contracts) == 0 && len(cfg.PoolTypes) == 0 {
+		return nil, fmt.Errorf("contracts 和 pool_types 至少配置一个")
+	}
+	mapping := &eventMapping{
+		name:      cfg.Name,
+		table:     cfg.Table,
+		contracts: make(map[string]bool),
+		protocol:  mappingProtocol(cfg),
+		poolTypes: make(map[string]bool),
+	}
+	for _, address := range cfg.Contracts {
+		mapping.contracts[strings.ToLower(address)] = true
+	}
+	for _, poolType := range cfg.PoolTypes {
+		mapping.poolTypes[strings.ToLower(poolType)] = true
+	}
+
+	contractABI := s.mappingABI(cfg)
+	if contractABI == nil {
+		return nil, fmt.Errorf("找不到包含事件%s的ABI", cfg.Event)
+	}
+	event := contractABI.Events[cfg.Event]
+	mapping.event = event
+
+	inputs := make(map[string]ethabi.Argument, len(event.Inputs))
+	for _, input := range event.Inputs {
+		inputs[input.Name] = input
+	}
+	columns := cfg.Columns
+	if len(columns) == 0 {
+		columns = make(map[string]string, len(event.Inputs))
+		for _, input := range event.Inputs {
+			columns[snakeCase(input.Name)] = input.Name
+		}
+	}
+	for column, field := range columns {
+		input, ok := inputs[field]
+		if !ok {
+			return nil, fmt.Errorf("事件%s没有字段%s", cfg.Event, field)
+		}
+		if !identifierPattern.MatchString(column) {
+			return nil, fmt.Errorf("列名%q只能用小写字母、数字和下划线", column)
+		}
+		for _, reserved := range repository.EventTableColumns {
+			if column == reserved {
+				return nil, fmt.Errorf("列名%s和固定列重名", column)
+			}
+		}
+		mapping.columns = append(mapping.columns, mappedColumn{column: column, field: field, kind: columnKind(input)})
+	}
+	sort.Slice(mapping.columns, func(i, j int) bool { return mapping.columns[i].column < mapping.columns[j].column })
+	return mapping, nil
+}
+
+// 解析映射事件用的ABI：指定的abi地址 > 第一个合约自身 > 池子类型对应的pool master
+func (s *ABIScanner) mappingABI(cfg config.MappingConfig) *ethabi.ABI {
+	var candidates []string
+	if cfg.ABI != "" {
+		candidates = append(candidates, cfg.ABI)
+	} else if len(cfg.Contracts) > 0 {
+		candidates = append(candidates, cfg.Contracts[0])
+	}
+	protocol := mappingProtocol(cfg)
+	for _, poolType := range cfg.PoolTypes {
+		poolType = strings.ToLower(poolType)
+		var keys []string
+		for key := range s.poolABIMap {
+			keyProtocol, typeKey, _ := strings.Cut(key, ":")
+			if keyProtocol != protocol {
+				continue
+			}
+			if typeKey == poolType || strings.HasPrefix(typeKey, poolType+":") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			candidates = append(candidates, s.poolABIMap[key])
+		}
+	}
+	for _, address := range candidates {
+		if contractABI := s.getABI(address); contractABI != nil {
+			if _, ok := contractABI.Events[cfg.Event]; ok {
+				return contractABI
+			}
+		}
+	}
+	return nil
+}
+
+// 按池子类型匹配时的协议，不填是SyncSwap
+func mappingProtocol(cfg config.MappingConfig) string {
+	if cfg.Protocol == "" {
+		return defaultProtocol
+	}
+	return strings.ToLower(cfg.Protocol)
+}
+
+// 一条映射事件要写入的行
+type mappedRow struct {
+	table string
+	row   map[string]interface{}
+}
+
+/*
+按配置的事件映射解码，一条日志可能命中多个映射
+同一条日志可以同时被内置处理器和映射处理
+*/
+func (s *ABIScanner) decodeMappedLog(block *BlockContext, log *types.Log) (interface{}, error) {
+	address := strings.ToLower(log.Address.Hex())
+	pool := s.cachedPool(log.Address)
+
+	var rows []mappedRow
+	for _, mapping := range s.mappings[log.Topics[0]] {
+		matched := mapping.contracts[address]
+		if !matched && pool != nil && pool.Protocol == mapping.protocol {
+			matched = mapping.poolTypes[pool.PoolType] || mapping.poolTypes[pool.PoolType+":"+pool.Version]
+		}
+		if !matched {
+			continue
+		}
+		fields, err := decodeEvent(&mapping.event, log)
+		if err != nil {
+			fmt.Printf("事件映射%s解析失败: %v\n", mapping.name, err)
+			continue
+		}
+		row := map[string]interface{}{
+			"block_number":     block.Number,
+			"block_timestamp":  block.Timestamp,
+			"tx_hash":          log.TxHash.Hex(),
+			"log_index":        int(log.Index),
+			"contract_address": log.Address.Hex(),
+			"finality_status":  block.Finality,
+		}
+		for _, column := range mapping.columns {
+			row[column.column] = columnValue(column.kind, fields[column.field])
+		}
+		rows = append(rows, mappedRow{table: mapping.table, row: row})
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows, nil
+}
+
+func (s *ABIScanner) saveMappedRows(block *BlockContext, log *types.Log, decoded interface{}) error {
+	for _, row := range decoded.([]mappedRow) {
+		block.Batch.AddMappedEvent(row.table, row.row)
+	}
+	return nil
+}
+
+// 解析事件的indexed和非indexed参数
+func decodeEvent(event *ethabi.Event, log *types.Log) (map[string]interface{}, error) {
+	var indexed ethabi.Arguments
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if len(log.Topics) < len(indexed)+1 {
+		return nil, fmt.Errorf("%s 的topic数量不对", event.Name)
+	}
+	fields := make(map[string]interface{})
+	if err := event.Inputs.UnpackIntoMap(fields, log.Data); err != nil {
+		return nil, err
+	}
+	if err := ethabi.ParseTopicsIntoMap(fields, indexed, log.Topics[1:]); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// 事件字段对应的列类型
+func columnKind(input ethabi.Argument) string {
+	switch input.Type.T {
+	case ethabi.AddressTy:
+		return repository.ColumnAddress
+	case ethabi.IntTy, ethabi.UintTy:
+		if input.Type.Size <= 32 {
+			return repository.ColumnInteger
+		}
+		return repository.ColumnNumeric
+	case ethabi.BoolTy:
+		return repository.ColumnBool
+	case ethabi.FixedBytesTy:
+		return repository.ColumnHash
+	}
+	// indexed的动态类型只剩哈希
+	if input.Indexed {
+		return repository.ColumnHash
+	}
+	return repository.ColumnText
+}
+
+// 解码出来的值转成列里存的值
+func columnValue(kind string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch kind {
+	case repository.ColumnAddress:
+		if address, ok := value.(common.Address); ok {
+			return address.Hex()
+		}
+	case repository.ColumnInteger:
+		if v, ok := value.(*big.Int); ok {
+			return v.Int64()
+		}
+		return value // uint8/int32等，驱动直接支持
+	case repository.ColumnNumeric:
+		return fmt.Sprint(value)
+	case repository.ColumnBool:
+		return value
+	case repository.ColumnHash:
+		return fmt.Sprintf("0x%x", value)
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return fmt.Sprintf("0x%x", v)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// 事件字段名转蛇形列名 feeRecipient -> fee_recipient，_sender -> sender，连续的大写算一个词 tokenID -> token_id
+func snakeCase(name string) string {
+	runes := []rune(strings.TrimLeft(name, "_"))
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
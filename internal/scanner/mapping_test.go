@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"zk-sync-go-pool/internal/config"
+	"zk-sync-go-pool/internal/repository"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestSnakeCaseKeepsAcronymsTogether(t *testing.T) {
+	cases := map[string]string{
+		"feeRecipient": "fee_recipient",
+		"_sender":      "sender",
+		"tokenID":      "token_id",
+		"HTTPServer":   "http_server",
+		"amount0In":    "amount0_in",
+		"to":           "to",
+	}
+	for name, want := range cases {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestTransferMappingWithReservedColumnNames(t *testing.T) {
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newConfiguredScanner(t, pool)
+	// LP代币的 ERC-20 Transfer(from, to, amount)，不配置列时字段名直接做列名
+	s.cfg.Mappings = []config.MappingConfig{{Name: "lp_transfers", Event: "Transfer", PoolTypes: []string{"classic"}, Table: "lp_transfers"}}
+	s.initEventMappings()
+	event := s.poolEventABI(pool, "Transfer").Events["Transfer"]
+	mappings := s.mappings[event.ID]
+	if len(mappings) != 1 {
+		t.Fatalf("Transfer mappings = %d, want 1", len(mappings))
+	}
+	var names []string
+	for _, column := range mappings[0].columns {
+		names = append(names, column.column)
+	}
+	if want := []string{"amount", "from", "to"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("columns = %v, want %v", names, want)
+	}
+
+	from, to := common.HexToAddress("0xa1"), common.HexToAddress("0xa2")
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &types.Log{
+		Address:     common.HexToAddress(pool.PoolAddress),
+		Topics:      []common.Hash{event.ID, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+		Data:        data,
+		BlockNumber: 100,
+		TxHash:      common.HexToHash("0xabc"),
+	}
+	block := &BlockContext{Number: 100, Timestamp: 1700000000, Finality: "safe", Batch: repository.NewBatch()}
+	if err := s.processLog(block, log, make(map[string]int)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.repo.SaveBatch(block.Batch); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := s.repo.GetSafeMappedEventsBetween("lp_transfers", 100, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("lp_transfers rows = %d, want 1", len(rows))
+	}
+	if rows[0]["from"] != from.Hex() || rows[0]["to"] != to.Hex() || rows[0]["amount"] != "1000" {
+		t.Fatalf("row = %v", rows[0])
+	}
+}
@@ -0,0 +1,481 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"zk-sync-go-pool/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	defaultPricingInterval  = 30    // 默认每30秒检查一次
+	defaultPricingBlockSpan = 2000  // 默认每次处理2000个区块
+	defaultMinLiquidityUSD  = 10000 // 默认流动性低于1万美元的池子不参与定价
+	pricingWindow           = 86400 // 超过这个时间没有成交的池子价格视为过期
+)
+
+var (
+	defaultStablecoins = []string{
+		"0x3355df6D4c9C3035724Fd0e3914dE96A5a83aaf4", // USDC
+		"0x493257fD37EDB34451f62EDf8D2a0C418852bA4C", // USDT
+	}
+	defaultWETH = "0x5AEa5775959fBC2557Cc8789bC1bf90A239D9a91"
+)
+
+// 定价路径优先级，越小越可信：稳定币本身 > 直接对稳定币 > 经过WETH
+var routeRank = map[string]int{"stable": 0, "direct": 1, "weth": 2}
+
+// 一个代币在某个位置的USD价格
+type usdPrice struct {
+	price     *big.Rat
+	route     string
+	quote     string // 定价池子的另一个代币
+	pool      string // 定价池子
+	liquidity *big.Rat
+}
+
+// 池子截至某个位置的最新成交价(token1/token0)
+type poolPrice struct {
+	price     *big.Rat
+	timestamp int64
+}
+
+/*
+一段区块内的定价状态，按链上顺序(区块高度+日志索引)逐笔swap推进
+每笔swap用截至它本身(含)的最新成交价和储备量定价，不会用到同一分钟里之后的成交；
+每个代币在所有对稳定币的池子里选流动性最深的，没有达标的稳定币池子再经过WETH定价。
+用到的池子成交价和储备量在开始时一次读出来，之后只在内存里推进。
+*/
+type priceState struct {
+	s            *ABIScanner
+	stables      map[string]bool
+	weth         string
+	minLiquidity *big.Rat
+	pairs        map[string][]*models.Pool         // 代币地址(小写) -> 对稳定币/WETH的池子
+	reserves     map[string]*models.PoolReserve    // 池子地址(小写) -> 最新的safe储备量
+	snapshots    map[string][]*models.PoolSnapshot // 池子地址(小写) -> safe快照，按链上顺序
+	last         map[string]*poolPrice             // 池子地址(小写) -> 最新成交价
+	block        uint64                            // 当前位置
+	logIndex     int
+	timestamp    int64
+	prices       map[string]*usdPrice // 当前位置的代币价格，nil表示定不了价；位置变化时清空
+}
+
+/*
+定价worker
+只处理stable进度以内的区块，这些swap不会再被pending删除重建；
+按分钟给出现过的代币定价写入token_prices，并回填swap的amount_usd；
+定价之后接着做成交汇总(rollup.go)，再连同pending数据重算没结束的汇总周期。
+*/
+func (s *ABIScanner) runPricingWorker(ctx context.Context) {
+	interval := s.cfg.Pricing.Interval
+	if interval <= 0 {
+		interval = defaultPricingInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.priceSwaps(ctx); err != nil {
+				fmt.Printf("⚠️ 定价失败: %v\n", err)
+			}
+			if err := s.rollupSwaps(ctx); err != nil {
+				fmt.Printf("⚠️ 成交汇总失败: %v\n", err)
+			}
+			if err := s.refreshOpenRollups(); err != nil {
+				fmt.Printf("⚠️ 当前周期成交汇总失败: %v\n", err)
+			}
+		}
+	}
+}
+
+func (s *ABIScanner) priceSwaps(ctx context.Context) error {
+	span := uint64(s.cfg.Pricing.BlockSpan)
+	if span == 0 {
+		span = defaultPricingBlockSpan
+	}
+	return s.followProgress(ctx, "pricing", "stable_scan", span, s.priceBlocks)
+}
+
+/*
+给 [from, to] 内的swap定价，每个代币每分钟记录最后一次定出的价格
+区间内的safe快照按链上顺序穿插在swap之间，用快照位置的价格计算TVL
+*/
+func (s *ABIScanner) priceBlocks(from, to uint64) error {
+	swaps, err := s.repo.GetSwapsBetween(from, to)
+	if err != nil {
+		return err
+	}
+	snapshots, err := s.repo.GetSnapshotsBetween(from, to)
+	if err != nil {
+		return err
+	}
+	if len(swaps) == 0 && len(snapshots) == 0 {
+		return nil
+	}
+	fromTimestamp := int64(math.MaxInt64)
+	if len(swaps) > 0 {
+		fromTimestamp = swaps[0].BlockTimeStamp
+	}
+	if len(snapshots) > 0 && snapshots[0].BlockTimeStamp < fromTimestamp {
+		fromTimestamp = snapshots[0].BlockTimeStamp
+	}
+	state, err := s.newPriceState(from, to, fromTimestamp)
+	if err != nil {
+		return err
+	}
+
+	tvl := make(map[int64]*string, len(snapshots))
+	next := 0
+	// 位置在 (block, logIndex) 之前、还没算过的快照
+	priceSnapshots := func(block uint64, logIndex int) error {
+		for ; next < len(snapshots) && before(snapshots[next].BlockNumber, snapshots[next].LogIndex, block, logIndex); next++ {
+			value, err := state.snapshotTVL(snapshots[next])
+			if err != nil {
+				return err
+			}
+			tvl[snapshots[next].ID] = value
+		}
+		return nil
+	}
+
+	amounts := make(map[int64]string)
+	var prices []*models.TokenPrice
+	minute := make(map[string]*usdPrice)
+	var bucket int64
+	var lastBlock uint64
+	for _, swap := range swaps {
+		if err := priceSnapshots(swap.BlockNumber, swap.LogIndex); err != nil {
+			return err
+		}
+		if b := swap.BlockTimeStamp - swap.BlockTimeStamp%candlePeriods[0].seconds; b != bucket {
+			prices = append(prices, priceRows(bucket, lastBlock, minute)...)
+			minute = make(map[string]*usdPrice)
+			bucket = b
+		}
+		state.advance(swap)
+		usd, err := state.swapUSD(swap)
+		if err != nil {
+			return err
+		}
+		if usd != "" {
+			amounts[swap.ID] = usd
+		}
+		for token, p := range state.prices {
+			if p != nil {
+				minute[token] = p
+			}
+		}
+		lastBlock = swap.BlockNumber
+	}
+	prices = append(prices, priceRows(bucket, lastBlock, minute)...)
+	if err := priceSnapshots(to+1, 0); err != nil {
+		return err
+	}
+
+	if err := s.repo.SaveTokenPrices(prices); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateSwapAmountUSD(amounts); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateSnapshotTVL(tvl); err != nil {
+		return err
+	}
+	fmt.Printf("定价区块 %d-%d: swap %d 条(已定价 %d 条)，代币价格 %d 条，快照 %d 个\n", from, to, len(swaps), len(amounts), len(prices), len(snapshots))
+	return nil
+}
+
+/*
+准备 [from, to] 的定价状态：能参与定价的池子只有对稳定币/WETH的池子，
+它们在 from 之前的最后一笔成交价、之前最近的一个快照和区间内的快照各用一条查询读出来
+*/
+func (s *ABIScanner) newPriceState(from, to uint64, fromTimestamp int64) (*priceState, error) {
+	cfg := s.cfg.Pricing
+	stablecoins := cfg.Stablecoins
+	if len(stablecoins) == 0 {
+		stablecoins = defaultStablecoins
+	}
+	stables := make(map[string]bool, len(stablecoins))
+	for _, address := range stablecoins {
+		stables[strings.ToLower(address)] = true
+	}
+	weth := cfg.WETH
+	if weth == "" {
+		weth = defaultWETH
+	}
+	weth = strings.ToLower(weth)
+	minLiquidity := cfg.MinLiquidityUSD
+	if minLiquidity <= 0 {
+		minLiquidity = defaultMinLiquidityUSD
+	}
+
+	pairs := make(map[string][]*models.Pool)
+	var pools []string
+	s.poolCacheMu.RLock()
+	for _, pool := range s.poolCache {
+		t0, t1 := strings.ToLower(pool.Token0), strings.ToLower(pool.Token1)
+		if !stables[t0] && !stables[t1] && t0 != weth && t1 != weth {
+			continue
+		}
+		pairs[t0] = append(pairs[t0], pool)
+		pairs[t1] = append(pairs[t1], pool)
+		pools = append(pools, strings.ToLower(pool.PoolAddress))
+	}
+	s.poolCacheMu.RUnlock()
+	for _, candidates := range pairs {
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].PoolAddress < candidates[j].PoolAddress })
+	}
+	sort.Strings(pools)
+
+	state := &priceState{
+		s:            s,
+		stables:      stables,
+		weth:         weth,
+		minLiquidity: new(big.Rat).SetFloat64(minLiquidity),
+		pairs:        pairs,
+		reserves:     make(map[string]*models.PoolReserve),
+		snapshots:    make(map[string][]*models.PoolSnapshot),
+		last:         make(map[string]*poolPrice),
+		prices:       make(map[string]*usdPrice),
+	}
+	if len(pools) == 0 {
+		return state, nil
+	}
+
+	reserves, err := s.repo.GetPoolReserves("safe")
+	if err != nil {
+		return nil, err
+	}
+	for _, reserve := range reserves {
+		state.reserves[strings.ToLower(reserve.PoolAddress)] = reserve
+	}
+	snapshots, err := s.repo.GetSnapshotsForPricing(pools, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		address := strings.ToLower(snapshot.PoolAddress)
+		state.snapshots[address] = append(state.snapshots[address], snapshot)
+	}
+	for _, list := range state.snapshots {
+		sort.Slice(list, func(i, j int) bool {
+			return before(list[i].BlockNumber, list[i].LogIndex, list[j].BlockNumber, list[j].LogIndex)
+		})
+	}
+	lastSwaps, err := s.repo.GetLastSwapsBefore(pools, from, fromTimestamp-pricingWindow)
+	if err != nil {
+		return nil, err
+	}
+	for _, swap := range lastSwaps {
+		state.trade(swap)
+	}
+	return state, nil
+}
+
+// 记录池子的最新成交价
+func (st *priceState) trade(swap *models.SwapEvent) {
+	pool := st.s.cachedPool(common.HexToAddress(swap.PoolAddress))
+	if pool == nil {
+		return
+	}
+	if trade := swapCandle(swap, strings.ToLower(pool.Token0)); trade != nil {
+		st.last[strings.ToLower(swap.PoolAddress)] = &poolPrice{price: parseRat(trade.Close), timestamp: swap.BlockTimeStamp}
+	}
+}
+
+// 推进到一笔swap(含)：更新它所在池子的成交价，之前算出的代币价格作废
+func (st *priceState) advance(swap *models.SwapEvent) {
+	st.moveTo(swap.BlockNumber, swap.LogIndex, swap.BlockTimeStamp)
+	st.trade(swap)
+}
+
+// 移到某个位置，之前算出的代币价格作废
+func (st *priceState) moveTo(block uint64, logIndex int, timestamp int64) {
+	st.block, st.logIndex, st.timestamp = block, logIndex, timestamp
+	st.prices = make(map[string]*usdPrice)
+}
+
+// 代币的USD价格，定不了价返回nil
+func (st *priceState) price(token string) (*usdPrice, error) {
+	key := strings.ToLower(token)
+	if p, ok := st.prices[key]; ok {
+		return p, nil
+	}
+	if st.stables[key] {
+		p := &usdPrice{price: big.NewRat(1, 1), route: "stable", liquidity: new(big.Rat)}
+		st.prices[key] = p
+		return p, nil
+	}
+
+	quotes := make(map[string]*big.Rat, len(st.stables))
+	for stable := range st.stables {
+		quotes[stable] = big.NewRat(1, 1)
+	}
+	p := st.bestRoute(key, quotes, "direct")
+	if p == nil && key != st.weth {
+		wethPrice, err := st.price(st.weth)
+		if err != nil {
+			return nil, err
+		}
+		if wethPrice != nil {
+			p = st.bestRoute(key, map[string]*big.Rat{st.weth: wethPrice.price}, "weth")
+		}
+	}
+	st.prices[key] = p
+	return p, nil
+}
+
+/*
+在 token 和 quotes 之间的池子里选流动性最深的定价
+流动性低于阈值、或者一天内没有成交的池子跳过，防止用很浅的池子操纵价格
+*/
+func (st *priceState) bestRoute(token string, quotes map[string]*big.Rat, route string) *usdPrice {
+	var best *usdPrice
+	for _, pool := range st.pairs[token] {
+		tokenIs0 := strings.EqualFold(pool.Token0, token)
+		quote := strings.ToLower(pool.Token0)
+		if tokenIs0 {
+			quote = strings.ToLower(pool.Token1)
+		}
+		quotePrice := quotes[quote]
+		if quotePrice == nil {
+			continue
+		}
+
+		address := strings.ToLower(pool.PoolAddress)
+		last := st.last[address]
+		if last == nil || last.timestamp < st.timestamp-pricingWindow || last.price.Sign() == 0 {
+			continue
+		}
+		liquidity := st.liquidity(pool, quote, quotePrice)
+		if liquidity == nil || liquidity.Cmp(st.minLiquidity) < 0 || (best != nil && liquidity.Cmp(best.liquidity) <= 0) {
+			continue
+		}
+		// 成交价是 token1/token0
+		price := last.price
+		if !tokenIs0 {
+			price = new(big.Rat).Inv(price)
+		}
+		best = &usdPrice{
+			price:     new(big.Rat).Mul(price, quotePrice),
+			route:     route,
+			quote:     quote,
+			pool:      address,
+			liquidity: liquidity,
+		}
+	}
+	return best
+}
+
+/*
+池子里报价代币一侧的流动性(USD)，报价代币余额x2
+余额取当前位置(含)之前最近的储备量：最新的safe储备量不晚于当前位置就用它，否则在快照里找；
+range池子没有Sync，快照里是两个代币的balanceOf。找不到储备量或者精度未知返回nil，不参与定价
+*/
+func (st *priceState) liquidity(pool *models.Pool, quote string, quotePrice *big.Rat) *big.Rat {
+	address := strings.ToLower(pool.PoolAddress)
+	var reserve0, reserve1 models.BigInt
+	found := false
+	if reserve, ok := st.reserves[address]; ok && !before(st.block, st.logIndex, reserve.BlockNumber, reserve.LogIndex) {
+		reserve0, reserve1, found = reserve.Reserve0, reserve.Reserve1, true
+	} else {
+		snapshots := st.snapshots[address]
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			if !before(st.block, st.logIndex, snapshots[i].BlockNumber, snapshots[i].LogIndex) {
+				reserve0, reserve1, found = snapshots[i].Reserve0, snapshots[i].Reserve1, true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	decimals, known := st.s.tokens.Decimals(quote)
+	if !known {
+		return nil
+	}
+	raw := reserve1
+	if strings.EqualFold(pool.Token0, quote) {
+		raw = reserve0
+	}
+	amount, ok := formatUnits(raw.String(), decimals)
+	if !ok {
+		return nil
+	}
+	value := new(big.Rat).Mul(parseRat(amount), quotePrice)
+	return value.Mul(value, big.NewRat(2, 1))
+}
+
+/*
+swap的成交额(USD)，两侧都能定价时取定价路径更可信的一侧
+数量未换算或者两侧都定不了价返回空字符串
+*/
+func (st *priceState) swapUSD(swap *models.SwapEvent) (string, error) {
+	var amount *big.Rat
+	var chosen *usdPrice
+	sides := []struct {
+		token  string
+		amount *string
+	}{
+		{swap.TokenIn, swap.AmountInDecimal},
+		{swap.TokenOut, swap.AmountOutDecimal},
+	}
+	for _, side := range sides {
+		p, err := st.price(side.token)
+		if err != nil {
+			return "", err
+		}
+		if p == nil || side.amount == nil {
+			continue
+		}
+		if chosen == nil || routeRank[p.route] < routeRank[chosen.route] {
+			amount, chosen = parseRat(*side.amount), p
+		}
+	}
+	if chosen == nil {
+		return "", nil
+	}
+	usd, ok := ratDecimal(new(big.Rat).Mul(amount, chosen.price))
+	if !ok {
+		return "", nil
+	}
+	return usd, nil
+}
+
+// 一分钟内定出的代币价格，按代币地址排序
+func priceRows(bucket int64, block uint64, prices map[string]*usdPrice) []*models.TokenPrice {
+	var rows []*models.TokenPrice
+	for token, p := range prices {
+		price, ok := ratDecimal(p.price)
+		if !ok || price == "0" {
+			continue
+		}
+		liquidity, ok := ratDecimal(p.liquidity)
+		if !ok {
+			continue
+		}
+		rows = append(rows, &models.TokenPrice{
+			Token:        token,
+			BucketStart:  bucket,
+			BlockNumber:  block,
+			PriceUSD:     price,
+			Route:        p.route,
+			QuoteToken:   p.quote,
+			PoolAddress:  p.pool,
+			LiquidityUSD: liquidity,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Token < rows[j].Token })
+	return rows
+}
@@ -0,0 +1,57 @@
+package scanner
+
+import (
+	"testing"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+)
+
+func TestPriceStateUsesPriceAtSwapPosition(t *testing.T) {
+	deep := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	shallow := wethUSDCPool("0x00000000000000000000000000000000000000d2")
+	s := newTestScanner(t, deep, shallow)
+
+	batch := repository.NewBatch()
+	// 深池子：1000万USDC；浅池子：只有100 USDC，成交价被拉到了10倍
+	batch.AddPoolReserve(&models.PoolReserve{PoolAddress: deep.PoolAddress, Reserve0: "5000000000000000000000", Reserve1: "10000000000000", BlockNumber: 99, FinalityStatus: "safe"})
+	batch.AddPoolReserve(&models.PoolReserve{PoolAddress: shallow.PoolAddress, Reserve0: "1000000000000000000", Reserve1: "100000000", BlockNumber: 99, FinalityStatus: "safe"})
+	// 同一分钟内：先按2000成交，浅池子20000成交，最后按3000成交
+	batch.AddSwap(buyWETH(deep.PoolAddress, 100, 0, "1", "2000"))
+	batch.AddSwap(buyWETH(shallow.PoolAddress, 101, 0, "1", "20000"))
+	batch.AddSwap(buyWETH(deep.PoolAddress, 102, 0, "2", "6000"))
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	// 从101开始：深池子的成交价从之前的成交里读出来，浅池子流动性不够不参与
+	state, err := s.newPriceState(101, 102, 1700000001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swaps, err := s.repo.GetSwapsBetween(101, 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"2000", "3000"} {
+		state.advance(swaps[i])
+		p, err := state.price(testWETH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == nil || p.price.Cmp(parseRat(want)) != 0 || p.pool != deep.PoolAddress {
+			t.Fatalf("weth price at block %d = %+v, want %s via the deep pool", swaps[i].BlockNumber, p, want)
+		}
+	}
+
+	// 同一分钟的价格记最后一笔之后的
+	if err := s.priceBlocks(100, 102); err != nil {
+		t.Fatal(err)
+	}
+	price, err := s.repo.GetLatestTokenPrice(testWETH, 1700000100)
+	if err != nil || price == nil {
+		t.Fatalf("weth price missing: %v", err)
+	}
+	if parseRat(price.PriceUSD).Cmp(parseRat("3000")) != 0 || price.PoolAddress != deep.PoolAddress {
+		t.Fatalf("weth price = %s via %s, want 3000 via the deep pool", price.PriceUSD, price.PoolAddress)
+	}
+}
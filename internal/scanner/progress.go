@@ -0,0 +1,131 @@
+package scanner
+
+import "context"
+
+/*
+跟在上游进度后面、按区块段推进的后台任务(定价、汇总)
+进度记在scan_progress(task)，不超过上游任务的进度；链重组回滚时和其他进度一起退回
+*/
+func (s *ABIScanner) followProgress(ctx context.Context, task, upstream string, span uint64, process func(from, to uint64) error) error {
+	return s.followSpans(ctx, task, upstream, span, func(from, to uint64) (bool, error) {
+		return s.processSpan(task, upstream, from, to, process)
+	})
+}
+
+// 按区块段推进进度，step处理一段并推进进度，返回false表示进度变了(回滚)，这一轮先停下
+func (s *ABIScanner) followSpans(ctx context.Context, task, upstream string, span uint64, step func(from, to uint64) (bool, error)) error {
+	progress, err := s.repo.GetScanProgress(task)
+	if err != nil {
+		return err
+	}
+	if progress == 0 {
+		progress = uint64(s.cfg.Scanner.StartBlock)
+		if err := s.repo.InitScanProgress(task, progress); err != nil {
+			return err
+		}
+	}
+	limit, err := s.repo.GetScanProgress(upstream)
+	if err != nil {
+		return err
+	}
+
+	for progress < limit {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		to := progress + span
+		if to > limit {
+			to = limit
+		}
+		if ok, err := step(progress+1, to); err != nil || !ok {
+			return err
+		}
+		progress = to
+	}
+	return nil
+}
+
+/*
+处理一段区块并推进进度
+持 candleRebuildMu 读锁，期间不会有链重组回滚；拿到锁后再确认一次进度，
+如果刚刚发生过回滚(进度被退回)返回false，下一轮从新的进度开始
+*/
+func (s *ABIScanner) processSpan(task, upstream string, from, to uint64, process func(from, to uint64) error) (bool, error) {
+	s.candleRebuildMu.RLock()
+	defer s.candleRebuildMu.RUnlock()
+
+	if ok, err := s.spanReady(task, upstream, from, to); err != nil || !ok {
+		return false, err
+	}
+	if err := process(from, to); err != nil {
+		return false, err
+	}
+	return true, s.repo.UpdateScanProgress(task, to)
+}
+
+// 进度还停在 from-1 并且上游已经到了 to，调用方持 candleRebuildMu 读锁
+func (s *ABIScanner) spanReady(task, upstream string, from, to uint64) (bool, error) {
+	progress, err := s.repo.GetScanProgress(task)
+	if err != nil {
+		return false, err
+	}
+	limit, err := s.repo.GetScanProgress(upstream)
+	if err != nil {
+		return false, err
+	}
+	return progress == from-1 && limit >= to, nil
+}
+
+/*
+分两步处理一段区块：read 持读锁从库里读数据，返回的 write 不持锁执行(写外部系统，可能很慢)
+write 期间发生了回退(rewinds变了)时这一段的结果可能已经过时，不推进进度，下一轮从新的进度重做；write 要能重复执行
+*/
+func (s *ABIScanner) processSpanOutside(task, upstream string, from, to uint64, read func(from, to uint64) (func() error, error)) (bool, error) {
+	s.candleRebuildMu.RLock()
+	rewinds := s.rewinds
+	ok, err := s.spanReady(task, upstream, from, to)
+	var write func() error
+	if ok && err == nil {
+		write, err = read(from, to)
+	}
+	s.candleRebuildMu.RUnlock()
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if err := write(); err != nil {
+		return false, err
+	}
+
+	s.candleRebuildMu.RLock()
+	defer s.candleRebuildMu.RUnlock()
+	if s.rewinds != rewinds {
+		return false, nil
+	}
+	if ok, err := s.spanReady(task, upstream, from, to); err != nil || !ok {
+		return false, err
+	}
+	return true, s.repo.UpdateScanProgress(task, to)
+}
+
+// 跟在stable进度后面、由扫描结果推导出来的任务，按上下游顺序
+var derivedTasks = []string{"pricing", "rollup", clickhouseTask}
+
+/*
+把推导任务的进度退回到block(只退不进)，之后重新计算 block 之后的区块
+用于在stable进度以内补写了数据(协议历史回填、代币精度回填、audit -reindex)的情况；
+持 candleRebuildMu 写锁，正在处理的区块段会在提交前发现进度变了
+*/
+func (s *ABIScanner) rewindDerivedProgress(block uint64) error {
+	s.candleRebuildMu.Lock()
+	defer s.candleRebuildMu.Unlock()
+	return s.rewindDerivedLocked(block)
+}
+
+// 同上，调用方持 candleRebuildMu 写锁
+func (s *ABIScanner) rewindDerivedLocked(block uint64) error {
+	s.rewinds++
+	return s.repo.RewindScanProgress(derivedTasks, block)
+}
@@ -0,0 +1,229 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"zk-sync-go-pool/internal/config"
+	"zk-sync-go-pool/internal/models"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SyncSwap 的协议名，由 syncswap 配置固定生成；其他协议在 protocols 里配置
+const defaultProtocol = "syncswap"
+
+// 兑换语义
+const (
+	swapV2 = "v2" // Swap(amount0In, amount1In, amount0Out, amount1Out)，池子有 getReserves 和 Sync
+	swapV3 = "v3" // Swap(amount0, amount1, sqrtPriceX96, liquidity, tick)，数量有符号，正数是转入池子
+)
+
+// 一次性的导入、回填任务完成后的状态
+const scanTaskDone = "done"
+
+// 按池子地址拉日志时每次查询的地址数
+const logAddressChunk = 500
+
+// SyncSwap 的工厂
+func syncswapFactory(poolType, version string) factoryInfo {
+	info := factoryInfo{Protocol: defaultProtocol, PoolType: poolType, Version: version, EventName: "PoolCreated", Swap: swapV2, FeeScale: 10}
+	if poolType == "range" {
+		info.Swap, info.FeeScale, info.TickSpacingField = swapV3, 1, "tickSpacing"
+	}
+	return info
+}
+
+// poolABIMap 的key：协议:类型:版本
+func poolABIKey(protocol, poolType, version string) string {
+	return protocol + ":" + poolType + ":" + version
+}
+
+/*
+加载 protocols 里配置的其他DEX协议
+工厂进 factoryInfoMap，池子事件ABI进 poolABIMap，之后和SyncSwap的工厂、池子走同一套处理器；
+配置有问题的工厂打印警告后跳过，不影响其他工厂和正常扫描
+*/
+func (s *ABIScanner) initProtocols() {
+	seen := map[string]bool{defaultProtocol: true}
+	for _, protocol := range s.cfg.Protocols {
+		if !identifierPattern.MatchString(protocol.Name) || len(protocol.Name) > 32 {
+			fmt.Printf("⚠️ 协议名%q只能用小写字母、数字和下划线，最长32个字符\n", protocol.Name)
+			continue
+		}
+		if seen[protocol.Name] {
+			fmt.Printf("⚠️ 协议%s重复配置\n", protocol.Name)
+			continue
+		}
+		seen[protocol.Name] = true
+
+		var count int
+		for _, factory := range protocol.Factories {
+			info, err := newProtocolFactory(protocol.Name, factory)
+			if err != nil {
+				fmt.Printf("⚠️ 协议%s的工厂%s无效: %v\n", protocol.Name, factory.Address, err)
+				continue
+			}
+			address := strings.ToLower(factory.Address)
+			if _, ok := s.factoryInfoMap[address]; ok {
+				fmt.Printf("⚠️ 协议%s的工厂%s已经配置过\n", protocol.Name, factory.Address)
+				continue
+			}
+			s.factoryInfoMap[address] = info
+			s.poolABIMap[poolABIKey(info.Protocol, info.PoolType, info.Version)] = strings.ToLower(factory.PoolABI)
+			count++
+		}
+		fmt.Printf("✅ 协议 %s: %d 个工厂\n", protocol.Name, count)
+	}
+}
+
+func newProtocolFactory(protocol string, cfg config.ProtocolFactoryConfig) (factoryInfo, error) {
+	if !common.IsHexAddress(cfg.Address) {
+		return factoryInfo{}, fmt.Errorf("工厂地址格式不对")
+	}
+	if cfg.PoolType == "" || cfg.Version == "" {
+		return factoryInfo{}, fmt.Errorf("pool_type 和 version 必须配置")
+	}
+	if !common.IsHexAddress(cfg.PoolABI) {
+		return factoryInfo{}, fmt.Errorf("pool_abi 必须配置成合约地址")
+	}
+	swap := strings.ToLower(cfg.Swap)
+	if swap == "" {
+		swap = swapV2
+	}
+	if swap != swapV2 && swap != swapV3 {
+		return factoryInfo{}, fmt.Errorf("兑换语义只能是 v2 或 v3: %s", cfg.Swap)
+	}
+	return factoryInfo{
+		Protocol:         protocol,
+		PoolType:         strings.ToLower(cfg.PoolType),
+		Version:          strings.ToLower(cfg.Version),
+		EventName:        cfg.Event,
+		PoolField:        cfg.PoolField,
+		FeeField:         cfg.FeeField,
+		TickSpacingField: cfg.TickSpacingField,
+		Swap:             swap,
+		FeeScale:         1,
+		FeeRate:          cfg.FeeRate,
+	}, nil
+}
+
+// 池子所属工厂的信息；工厂已经不在配置里的按SyncSwap的池子类型推断
+func (s *ABIScanner) poolFactory(pool *models.Pool) factoryInfo {
+	if info, ok := s.factoryInfoMap[strings.ToLower(pool.FactoryAddress)]; ok {
+		return info
+	}
+	info := syncswapFactory(pool.PoolType, pool.Version)
+	info.Protocol = pool.Protocol
+	return info
+}
+
+/*
+导入其他协议在当前扫描进度之前创建的池子
+协议加入时stable进度可能早就超过了它的部署区块，从协议的 start_block 到 handoff(启动时的stable进度)
+按这个协议的工厂拉日志导入池子；进度记在 scan_progress(pool_bootstrap:协议名)，完成后标记done，
+之后的新池子由正常扫描发现。要在扫描worker启动前做完，不然这些池子的swap会因为不在poolCache里被丢掉。
+*/
+func (s *ABIScanner) bootstrapProtocols(ctx context.Context, handoff uint64) error {
+	for _, protocol := range s.cfg.Protocols {
+		task := "pool_bootstrap:" + protocol.Name
+		state, err := s.repo.GetScanTask(task)
+		if err != nil {
+			return err
+		}
+		if state != nil && state.Status == scanTaskDone {
+			continue
+		}
+		factoryAddrs, factoryTopics := s.factoryFilters(protocol.Name)
+		if len(factoryAddrs) == 0 || len(factoryTopics) == 0 {
+			continue // 协议配置无效或者工厂ABI没加载
+		}
+		query := ethereum.FilterQuery{Addresses: factoryAddrs, Topics: [][]common.Hash{factoryTopics}}
+
+		fmt.Printf("导入协议%s的池子: 区块 %d-%d\n", protocol.Name, protocol.StartBlock, handoff)
+		counts, err := s.sweepLogs(ctx, task, []ethereum.FilterQuery{query}, uint64(protocol.StartBlock), handoff, 0)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.SetScanStatus(task, scanTaskDone); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 导入协议%s的池子完成: %d 个\n", protocol.Name, counts[poolHandlerName])
+	}
+	return nil
+}
+
+// 后台回填所有协议的历史事件，失败的下次启动从进度处继续
+func (s *ABIScanner) runProtocolBackfills(ctx context.Context, handoff uint64) {
+	for _, protocol := range s.cfg.Protocols {
+		if err := s.backfillProtocol(ctx, protocol, handoff); err != nil {
+			fmt.Printf("⚠️ 回填协议%s失败: %v\n", protocol.Name, err)
+		}
+	}
+}
+
+/*
+回填协议加入之前的历史事件
+范围是协议 start_block(不早于扫描器的起始区块) 到 handoff，之后的区块正常扫描已经包含这个协议；
+按这个协议的池子地址和池子事件topic拉日志，进度记在 scan_progress(protocol_scan:协议名)，完成后标记done。
+这些区块都在stable进度以内，回填的swap照常增量更新K线；定价、成交汇总的进度可能已经过去了，
+完成后把它们退回到回填的起点，重新计算这段区块
+*/
+func (s *ABIScanner) backfillProtocol(ctx context.Context, protocol config.ProtocolConfig, handoff uint64) error {
+	task := "protocol_scan:" + protocol.Name
+	state, err := s.repo.GetScanTask(task)
+	if err != nil {
+		return err
+	}
+	if state != nil && state.Status == scanTaskDone {
+		return nil
+	}
+	topics := s.poolTopics(protocol.Name)
+	pools := s.protocolPoolAddresses(protocol.Name)
+	if len(topics) == 0 || len(pools) == 0 {
+		return nil
+	}
+	// 池子地址太多时分几次查询，节点对单次查询的地址数有限制
+	var queries []ethereum.FilterQuery
+	for i := 0; i < len(pools); i += logAddressChunk {
+		end := i + logAddressChunk
+		if end > len(pools) {
+			end = len(pools)
+		}
+		queries = append(queries, ethereum.FilterQuery{Addresses: pools[i:end], Topics: [][]common.Hash{topics}})
+	}
+
+	// 起始区块本身不扫描，stable进度从它的下一个区块开始
+	start := uint64(s.cfg.Scanner.StartBlock) + 1
+	if uint64(protocol.StartBlock) > start {
+		start = uint64(protocol.StartBlock)
+	}
+	counts, err := s.sweepLogs(ctx, task, queries, start, handoff, 0)
+	if err != nil {
+		return err
+	}
+	if err := s.rewindDerivedProgress(start - 1); err != nil {
+		return err
+	}
+	if err := s.repo.SetScanStatus(task, scanTaskDone); err != nil {
+		return err
+	}
+	fmt.Printf("✅ 回填协议%s完成: %s\n", protocol.Name, s.handlerSummary(counts))
+	return nil
+}
+
+// 协议在poolCache里的池子地址
+func (s *ABIScanner) protocolPoolAddresses(protocol string) []common.Address {
+	s.poolCacheMu.RLock()
+	defer s.poolCacheMu.RUnlock()
+	var addresses []common.Address
+	for _, pool := range s.poolCache {
+		if pool.Protocol == protocol {
+			addresses = append(addresses, common.HexToAddress(pool.PoolAddress))
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].Hex() < addresses[j].Hex() })
+	return addresses
+}
@@ -0,0 +1,205 @@
+package scanner
+
+import (
+	"fmt"
+	"math/big"
+	"zk-sync-go-pool/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// range池子除Swap之外需要解析的事件，事件名 -> 入库的event_type
+var rangeEventTypes = map[string]string{
+	"Mint":           "mint",
+	"Burn":           "burn",
+	"Collect":        "collect",
+	"Initialize":     "initialize",
+	"CollectFees":    "collect_fees",
+	"Flash":          "flash",
+	"SetFeeProtocol": "set_fee_protocol",
+}
+
+/*
+range池子Swap额外记录swap后的 sqrtPriceX96 / liquidity / tick
+swap_events表里已经记录了方向和数量，这里只补充v3特有字段，解析失败返回nil
+*/
+func (s *ABIScanner) decodeRangeSwap(swap *models.SwapEvent, pool *models.Pool, log *types.Log) *models.RangeSwap {
+	contractABI := s.poolEventABI(pool, "Swap")
+	if contractABI == nil {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	if err := contractABI.UnpackIntoMap(fields, "Swap", log.Data); err != nil {
+		fmt.Printf("解析 range Swap 失败: %v\n", err)
+		return nil
+	}
+	amount0, _ := fields["amount0"].(*big.Int)
+	amount1, _ := fields["amount1"].(*big.Int)
+	sqrtPriceX96, _ := fields["sqrtPriceX96"].(*big.Int)
+	liquidity, _ := fields["liquidity"].(*big.Int)
+	tick, _ := fields["tick"].(*big.Int)
+	if amount0 == nil || amount1 == nil || sqrtPriceX96 == nil || liquidity == nil || tick == nil {
+		return nil
+	}
+
+	return &models.RangeSwap{
+		BlockNumber:    swap.BlockNumber,
+		BlockTimeStamp: swap.BlockTimeStamp,
+		TxHash:         swap.TxHash,
+		LogIndex:       swap.LogIndex,
+		PoolAddress:    swap.PoolAddress,
+		Protocol:       swap.Protocol,
+		Sender:         swap.Sender,
+		Recipient:      swap.Recipient,
+		Amount0:        models.BigInt(amount0.String()),
+		Amount1:        models.BigInt(amount1.String()),
+		SqrtPriceX96:   models.BigInt(sqrtPriceX96.String()),
+		Liquidity:      models.BigInt(liquidity.String()),
+		Tick:           int(tick.Int64()),
+		FinalityStatus: swap.FinalityStatus,
+	}
+}
+
+/*
+解析range池子(以及其他协议v3语义的池子)的 Mint/Burn/Collect（头寸事件）和 Initialize/CollectFees/Flash/SetFeeProtocol（池子级事件）
+*/
+func (s *ABIScanner) decodeRangeLog(block *BlockContext, log *types.Log) (interface{}, error) {
+	pool := s.cachedPool(log.Address)
+	if pool == nil || s.poolFactory(pool).Swap != swapV3 {
+		return nil, nil
+	}
+	contractABI := s.poolEventABI(pool, "Swap")
+	if contractABI == nil {
+		return nil, nil
+	}
+	event, err := contractABI.EventByID(log.Topics[0])
+	if err != nil {
+		return nil, nil
+	}
+	eventType, ok := rangeEventTypes[event.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	fields := make(map[string]interface{})
+	if err := contractABI.UnpackIntoMap(fields, event.Name, log.Data); err != nil {
+		fmt.Printf("解析 range %s 失败: %v\n", event.Name, err)
+		return nil, nil
+	}
+
+	switch event.Name {
+	case "Mint", "Burn", "Collect":
+		// owner、tickLower、tickUpper 都是indexed
+		if len(log.Topics) < 4 {
+			return nil, nil
+		}
+		position := &models.RangePositionEvent{
+			BlockNumber:    block.Number,
+			BlockTimeStamp: block.Timestamp,
+			TxHash:         log.TxHash.Hex(),
+			LogIndex:       int(log.Index),
+			PoolAddress:    pool.PoolAddress,
+			EventType:      eventType,
+			Owner:          common.BytesToAddress(log.Topics[1].Bytes()).Hex(),
+			TickLower:      topicToInt24(log.Topics[2]),
+			TickUpper:      topicToInt24(log.Topics[3]),
+			Liquidity:      bigString(fields["amount"]),
+			Amount0:        bigString(fields["amount0"]),
+			Amount1:        bigString(fields["amount1"]),
+			FinalityStatus: block.Finality,
+		}
+		if sender, ok := fields["sender"].(common.Address); ok {
+			position.Sender = sender.Hex()
+		}
+		if recipient, ok := fields["recipient"].(common.Address); ok {
+			position.Recipient = recipient.Hex()
+		}
+		return position, nil
+	}
+
+	poolEvent := &models.RangePoolEvent{
+		BlockNumber:    block.Number,
+		BlockTimeStamp: block.Timestamp,
+		TxHash:         log.TxHash.Hex(),
+		LogIndex:       int(log.Index),
+		PoolAddress:    pool.PoolAddress,
+		EventType:      eventType,
+		FinalityStatus: block.Finality,
+	}
+	switch event.Name {
+	case "Initialize":
+		poolEvent.SqrtPriceX96 = bigStringPtr(fields["sqrtPriceX96"])
+		if tick, ok := fields["tick"].(*big.Int); ok {
+			t := int(tick.Int64())
+			poolEvent.Tick = &t
+		}
+	case "CollectFees":
+		// recipient 是indexed
+		if len(log.Topics) < 2 {
+			return nil, nil
+		}
+		recipient := common.BytesToAddress(log.Topics[1].Bytes()).Hex()
+		poolEvent.Recipient = &recipient
+		poolEvent.Amount0 = bigStringPtr(fields["amount0"])
+		poolEvent.Amount1 = bigStringPtr(fields["amount1"])
+	case "Flash":
+		// sender、recipient 都是indexed
+		if len(log.Topics) < 3 {
+			return nil, nil
+		}
+		sender := common.BytesToAddress(log.Topics[1].Bytes()).Hex()
+		recipient := common.BytesToAddress(log.Topics[2].Bytes()).Hex()
+		poolEvent.Sender = &sender
+		poolEvent.Recipient = &recipient
+		poolEvent.Amount0 = bigStringPtr(fields["amount0"])
+		poolEvent.Amount1 = bigStringPtr(fields["amount1"])
+		poolEvent.Paid0 = bigStringPtr(fields["paid0"])
+		poolEvent.Paid1 = bigStringPtr(fields["paid1"])
+	case "SetFeeProtocol":
+		if v, ok := fields["feeProtocol0New"].(uint8); ok {
+			fee0 := int(v)
+			poolEvent.FeeProtocol0 = &fee0
+		}
+		if v, ok := fields["feeProtocol1New"].(uint8); ok {
+			fee1 := int(v)
+			poolEvent.FeeProtocol1 = &fee1
+		}
+	}
+	return poolEvent, nil
+}
+
+func (s *ABIScanner) saveRangeLog(block *BlockContext, log *types.Log, decoded interface{}) error {
+	switch record := decoded.(type) {
+	case *models.RangePositionEvent:
+		block.Batch.AddRangePositionEvent(record)
+	case *models.RangePoolEvent:
+		block.Batch.AddRangePoolEvent(record)
+	}
+	return nil
+}
+
+// indexed的int24参数，topic里是32字节补码
+func topicToInt24(topic common.Hash) int {
+	v := new(big.Int).SetBytes(topic.Bytes())
+	if topic[0]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return int(v.Int64())
+}
+
+// 解析出来的uint128/uint256转字符串，没有该字段返回"0"
+func bigString(v interface{}) models.BigInt {
+	if b, ok := v.(*big.Int); ok && b != nil {
+		return models.BigInt(b.String())
+	}
+	return "0"
+}
+
+func bigStringPtr(v interface{}) *models.BigInt {
+	if b, ok := v.(*big.Int); ok && b != nil {
+		str := models.BigInt(b.String())
+		return &str
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package scanner
+
+import (
+	"math/big"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func wethUSDCRangePool(address string) *models.Pool {
+	return &models.Pool{PoolAddress: address, Protocol: "syncswap", PoolType: "range", Version: "v3", Token0: testWETH, Token1: testUSDC}
+}
+
+// int24之类有符号的indexed参数，topic里是32字节补码
+func signedTopic(v int64) common.Hash {
+	return common.BytesToHash(math.U256Bytes(big.NewInt(v)))
+}
+
+// 按range pool master的ABI编码一条事件日志，topics为indexed参数
+func rangeLog(t *testing.T, s *ABIScanner, pool *models.Pool, name string, topics []common.Hash, args ...interface{}) *types.Log {
+	t.Helper()
+	event := s.poolEventABI(pool, name).Events[name]
+	data, err := event.Inputs.NonIndexed().Pack(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &types.Log{
+		Address:     common.HexToAddress(pool.PoolAddress),
+		Topics:      append([]common.Hash{event.ID}, topics...),
+		Data:        data,
+		BlockNumber: 100,
+		TxHash:      common.HexToHash("0xabc"),
+		Index:       uint(len(topics)),
+	}
+}
+
+func TestDecodeRangeSwap(t *testing.T) {
+	pool := wethUSDCRangePool("0x00000000000000000000000000000000000000c1")
+	s := newConfiguredScanner(t, pool)
+	sender, recipient := common.HexToAddress("0xb1"), common.HexToAddress("0xb2")
+	sqrtPrice, _ := new(big.Int).SetString("3543191142285914205922034323214", 10)
+
+	// 用2000 USDC换出1 WETH：池子付出token0(amount0为负)，收到token1
+	log := rangeLog(t, s, pool, "Swap", []common.Hash{common.BytesToHash(sender.Bytes()), common.BytesToHash(recipient.Bytes())},
+		big.NewInt(-1e18), big.NewInt(2000e6), sqrtPrice, big.NewInt(123456789), big.NewInt(-201000))
+	swap := s.decodeSwapLog(100, 1700000000, log.TxHash.Hex(), log, "safe")
+	if swap == nil {
+		t.Fatal("range Swap not decoded")
+	}
+	if swap.TokenIn != testUSDC || swap.TokenOut != testWETH || swap.AmountIn != "2000000000" || swap.AmountOut != "1000000000000000000" {
+		t.Fatalf("swap = %s %s -> %s %s", swap.AmountIn, swap.TokenIn, swap.AmountOut, swap.TokenOut)
+	}
+	if swap.AmountInDecimal == nil || *swap.AmountInDecimal != "2000" || swap.AmountOutDecimal == nil || *swap.AmountOutDecimal != "1" {
+		t.Fatalf("decimals = %v, %v", swap.AmountInDecimal, swap.AmountOutDecimal)
+	}
+
+	rangeSwap := s.decodeRangeSwap(swap, pool, log)
+	if rangeSwap == nil {
+		t.Fatal("range swap fields not decoded")
+	}
+	if rangeSwap.Amount0 != "-1000000000000000000" || rangeSwap.Amount1 != "2000000000" ||
+		rangeSwap.SqrtPriceX96 != models.BigInt(sqrtPrice.String()) || rangeSwap.Liquidity != "123456789" || rangeSwap.Tick != -201000 {
+		t.Fatalf("range swap = %+v", rangeSwap)
+	}
+}
+
+func TestDecodeRangePositionEvents(t *testing.T) {
+	pool := wethUSDCRangePool("0x00000000000000000000000000000000000000c1")
+	s := newConfiguredScanner(t, pool)
+	owner, sender, recipient := common.HexToAddress("0xa1"), common.HexToAddress("0xa2"), common.HexToAddress("0xa3")
+	position := []common.Hash{common.BytesToHash(owner.Bytes()), signedTopic(-887220), signedTopic(600)}
+	block := &BlockContext{Number: 100, Timestamp: 1700000000, Finality: "safe"}
+
+	cases := []struct {
+		name string
+		log  *types.Log
+		want models.RangePositionEvent
+	}{
+		{"Mint", rangeLog(t, s, pool, "Mint", position, sender, big.NewInt(5000), big.NewInt(7), big.NewInt(8)),
+			models.RangePositionEvent{EventType: "mint", Sender: sender.Hex(), Liquidity: "5000", Amount0: "7", Amount1: "8"}},
+		{"Burn", rangeLog(t, s, pool, "Burn", position, big.NewInt(3000), big.NewInt(4), big.NewInt(5)),
+			models.RangePositionEvent{EventType: "burn", Liquidity: "3000", Amount0: "4", Amount1: "5"}},
+		{"Collect", rangeLog(t, s, pool, "Collect", position, recipient, big.NewInt(11), big.NewInt(12)),
+			models.RangePositionEvent{EventType: "collect", Recipient: recipient.Hex(), Liquidity: "0", Amount0: "11", Amount1: "12"}},
+	}
+	for _, c := range cases {
+		decoded, err := s.decodeRangeLog(block, c.log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := decoded.(*models.RangePositionEvent)
+		if !ok {
+			t.Fatalf("%s decoded as %T", c.name, decoded)
+		}
+		want := c.want
+		want.BlockNumber, want.BlockTimeStamp, want.TxHash, want.LogIndex = 100, 1700000000, c.log.TxHash.Hex(), int(c.log.Index)
+		want.PoolAddress, want.Owner, want.TickLower, want.TickUpper, want.FinalityStatus = pool.PoolAddress, owner.Hex(), -887220, 600, "safe"
+		if *got != want {
+			t.Fatalf("%s = %+v\nwant %+v", c.name, *got, want)
+		}
+	}
+
+	// classic池子的日志不归range处理器
+	classic := wethUSDCPool("0x00000000000000000000000000000000000000c2")
+	s.setCachedPoolLocked(classic)
+	log := rangeLog(t, s, pool, "Mint", position, sender, big.NewInt(1), big.NewInt(1), big.NewInt(1))
+	log.Address = common.HexToAddress(classic.PoolAddress)
+	if decoded, _ := s.decodeRangeLog(block, log); decoded != nil {
+		t.Fatalf("classic pool log decoded as %T", decoded)
+	}
+}
+
+func TestDecodeRangePoolEventsSkipMissingTopics(t *testing.T) {
+	pool := wethUSDCRangePool("0x00000000000000000000000000000000000000c1")
+	s := newConfiguredScanner(t, pool)
+	sender, recipient := common.BytesToHash(common.HexToAddress("0xa2").Bytes()), common.BytesToHash(common.HexToAddress("0xa3").Bytes())
+	block := &BlockContext{Number: 100, Timestamp: 1700000000, Finality: "safe"}
+	one := big.NewInt(1)
+
+	cases := []struct {
+		name   string
+		topics []common.Hash
+		args   []interface{}
+	}{
+		{"CollectFees", []common.Hash{recipient}, []interface{}{one, one}},
+		{"Flash", []common.Hash{sender, recipient}, []interface{}{one, one, one, one}},
+	}
+	for _, c := range cases {
+		decoded, err := s.decodeRangeLog(block, rangeLog(t, s, pool, c.name, c.topics, c.args...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := decoded.(*models.RangePoolEvent); !ok || got.Recipient == nil || *got.Recipient != common.HexToAddress("0xa3").Hex() {
+			t.Fatalf("%s decoded as %+v", c.name, decoded)
+		}
+		// indexed参数不全的日志(非标准实现)跳过，不能越界
+		truncated := rangeLog(t, s, pool, c.name, c.topics[:len(c.topics)-1], c.args...)
+		if decoded, err := s.decodeRangeLog(block, truncated); err != nil || decoded != nil {
+			t.Fatalf("%s with missing topics = %+v, %v", c.name, decoded, err)
+		}
+	}
+}
+
+func TestRangeFeeAmountRecordedOnlyWhenRateChanges(t *testing.T) {
+	pool := wethUSDCRangePool("0x00000000000000000000000000000000000000c1")
+	s := newConfiguredScanner(t, pool)
+	token := common.BytesToHash(common.HexToAddress(testUSDC).Bytes())
+
+	// 一段里5笔swap，费率 500 500 3000 3000 500
+	spanFees := make(map[string]int)
+	batch := repository.NewBatch()
+	for i, rate := range []int64{500, 500, 3000, 3000, 500} {
+		block := &BlockContext{Number: uint64(100 + i), Timestamp: int64(1700000000 + i), Finality: "safe", Batch: batch, spanFees: spanFees}
+		log := rangeLog(t, s, pool, "FeeAmount", []common.Hash{token, common.BigToHash(big.NewInt(rate))}, big.NewInt(1000), big.NewInt(100))
+		log.BlockNumber, log.TxHash = block.Number, common.BigToHash(big.NewInt(int64(i+1)))
+		if err := s.processLog(block, log, make(map[string]int)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	history, err := s.repo.GetPoolFeeHistory(pool.PoolAddress, 200, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		block uint64
+		rate  int
+	}{{100, 500}, {102, 3000}, {104, 500}}
+	if len(history) != len(want) {
+		t.Fatalf("fee history = %d rows, want %d", len(history), len(want))
+	}
+	for i, w := range want {
+		if history[i].BlockNumber != w.block || *history[i].FeeRate != w.rate {
+			t.Fatalf("fee change %d = block %d rate %d, want block %d rate %d", i, history[i].BlockNumber, *history[i].FeeRate, w.block, w.rate)
+		}
+	}
+	cached := s.cachedPool(common.HexToAddress(pool.PoolAddress))
+	if cached.FeeRate == nil || *cached.FeeRate != 500 || cached.FeeBlock != 104 {
+		t.Fatalf("cached fee = %v at %d, want 500 at 104", cached.FeeRate, cached.FeeBlock)
+	}
+}
@@ -0,0 +1,250 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+	"zk-sync-go-pool/internal/blockchain"
+	"zk-sync-go-pool/internal/models"
+)
+
+const (
+	defaultMaxReorgDepth = 1000 // 默认最多往回找1000个区块的公共祖先
+	reorgSearchWindow    = 50   // 往回找公共祖先时每次批量比对的区块数
+)
+
+/*
+链重组检测
+每个扫描过的区块都在blocks表记录了 hash/parent_hash。
+扫描下一批之前，用链上 from-1 区块的 hash 对比库里记录的 hash(没记哈希的空区块往前找最近一个记了的)，
+不一致说明 from-1 及之前的一段已经不在主链上了，需要往回找公共祖先并回滚。
+*/
+func (s *ABIScanner) checkReorg(from uint64, worker string) (rolledBack bool, ancestor uint64, err error) {
+	if from == 0 {
+		return false, 0, nil
+	}
+	stored, chainHash, err := s.compareLastHashedBlock(from - 1)
+	if err != nil || stored == nil || strings.EqualFold(chainHash, stored.Hash) {
+		return false, 0, err // 没记录过的区块无从比较
+	}
+
+	fmt.Printf("⚠️ 检测到链重组: 区块%d 库里哈希 %s，链上 %s\n", stored.Number, stored.Hash, chainHash)
+	ancestor, err = s.handleReorg(from-1, worker)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, ancestor, nil
+}
+
+/*
+取不超过 upto 的最后一个记了哈希的区块和它在链上的当前哈希，没有记录时返回nil
+logs模式没日志的区块不记哈希，往前找最近一个有哈希的区块比较
+*/
+func (s *ABIScanner) compareLastHashedBlock(upto uint64) (*models.Block, string, error) {
+	stored, err := s.repo.GetLastHashedBlock(upto)
+	if err != nil || stored == nil {
+		return nil, "", err
+	}
+	headers, err := blockchain.GetBlockHeaders(stored.Number, stored.Number)
+	if err != nil {
+		return nil, "", err
+	}
+	return stored, headers[0].Hash.Hex(), nil
+}
+
+/*
+live worker 的链重组检查
+只回滚pending数据；分叉已经到了safe区块时不自己回滚，交给stable worker(safe数据的回滚和stable扫描在同一个协程里，不会交错)
+*/
+func (s *ABIScanner) checkPendingReorg(from uint64) error {
+	if from == 0 {
+		return nil
+	}
+	stored, chainHash, err := s.compareLastHashedBlock(from - 1)
+	if err != nil || stored == nil || strings.EqualFold(chainHash, stored.Hash) {
+		return err
+	}
+
+	fmt.Printf("⚠️ 检测到链重组: 区块%d 库里哈希 %s，链上 %s\n", stored.Number, stored.Hash, chainHash)
+	ancestor, _, _, err := s.findCommonAncestor(from - 1)
+	if err != nil {
+		return err
+	}
+	blocks, err := s.repo.GetBlocks(ancestor+1, from-1)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		if block.FinalityStatus == "safe" {
+			fmt.Printf("⚠️ 链重组波及safe区块%d，交给stable worker回滚\n", block.Number)
+			s.requestSafeReorg(from - 1)
+			return nil
+		}
+	}
+	if err := s.deletePending(ancestor); err != nil {
+		return err
+	}
+	// 没结束的汇总周期里有删掉的pending swap，马上重算
+	return s.refreshOpenRollups()
+}
+
+/*
+批次内各段是并发扫描的，段与段之间的衔接要等整批扫完后再按库里的区块记录检查一遍。
+返回第一个父哈希对不上的区块高度，0 表示连续。
+*/
+func (s *ABIScanner) checkLedger(from, to uint64) (uint64, error) {
+	if from == 0 {
+		from = 1
+	}
+	blocks, err := s.repo.GetBlocks(from-1, to)
+	if err != nil {
+		return 0, err
+	}
+	for i := 1; i < len(blocks); i++ {
+		prev, cur := blocks[i-1], blocks[i]
+		if cur.Number != prev.Number+1 || cur.ParentHash == "" || prev.Hash == "" {
+			continue // 中间有扫描失败的区块，或者没拿区块头的空区块，跳过
+		}
+		if !strings.EqualFold(cur.ParentHash, prev.Hash) {
+			return cur.Number, nil
+		}
+	}
+	return 0, nil
+}
+
+/*
+从 tip 往回找公共祖先，回滚数据库、记录重组日志、刷新池子缓存，返回公共祖先
+会删除safe数据，只能在stable worker里调用
+*/
+func (s *ABIScanner) handleReorg(tip uint64, worker string) (uint64, error) {
+	ancestor, oldHash, newHash, err := s.findCommonAncestor(tip)
+	if err != nil {
+		return 0, err
+	}
+
+	// 回滚和K线重建期间不能有swap入库
+	s.candleRebuildMu.Lock()
+	defer s.candleRebuildMu.Unlock()
+
+	pools, fromTimestamp, err := s.repo.GetSwapScopeAfter(ancestor, "")
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.repo.RollbackTo(ancestor)
+	if err != nil {
+		return 0, err
+	}
+	s.rewinds++
+	if err := s.rollbackHandlers(ancestor, false); err != nil {
+		return 0, err
+	}
+
+	reorgLog := &models.ReorgLog{
+		DetectedBlock:  tip,
+		CommonAncestor: ancestor,
+		Depth:          tip - ancestor,
+		OldHash:        oldHash,
+		NewHash:        newHash,
+		Worker:         worker,
+		SwapsDeleted:   result.SwapsDeleted,
+		PoolsDeleted:   result.PoolsDeleted,
+		BlocksDeleted:  result.BlocksDeleted,
+	}
+	if err := s.repo.SaveReorgLog(reorgLog); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+	fmt.Printf("🔁 链重组回滚完成: 公共祖先 %d，深度 %d，删除 swap %d 条、池子 %d 个、区块 %d 个\n",
+		ancestor, reorgLog.Depth, result.SwapsDeleted, result.PoolsDeleted, result.BlocksDeleted)
+
+	if result.PoolsDeleted > 0 || result.PoolFeesRestored > 0 {
+		s.initPoolCache()
+	}
+	if len(pools) > 0 {
+		if err := s.rebuildCandlesForPools(pools, fromTimestamp); err != nil {
+			fmt.Printf("链重组后重建K线失败: %v\n", err)
+		}
+	}
+	if err := s.rollupOpen(); err != nil {
+		fmt.Printf("链重组后重算当前周期成交汇总失败: %v\n", err)
+	}
+	return ancestor, nil
+}
+
+/*
+从 tip 往回逐个比对库里哈希和链上哈希，第一个一致的就是公共祖先
+超过 max_reorg_depth 还没找到就直接回滚到最大深度处
+*/
+func (s *ABIScanner) findCommonAncestor(tip uint64) (ancestor uint64, oldHash, newHash string, err error) {
+	maxDepth := uint64(s.cfg.Scanner.MaxReorgDepth)
+	if maxDepth == 0 {
+		maxDepth = defaultMaxReorgDepth
+	}
+	var floor uint64
+	if tip > maxDepth {
+		floor = tip - maxDepth
+	}
+
+	hi := tip
+	for {
+		lo := floor
+		if hi >= floor+reorgSearchWindow {
+			lo = hi - reorgSearchWindow + 1
+		}
+
+		stored, err := s.repo.GetBlocks(lo, hi)
+		if err != nil {
+			return 0, "", "", err
+		}
+		storedMap := make(map[uint64]*models.Block, len(stored))
+		for _, block := range stored {
+			storedMap[block.Number] = block
+		}
+		headers, err := blockchain.GetBlockHeaders(lo, hi)
+		if err != nil {
+			return 0, "", "", err
+		}
+
+		for n := hi; ; n-- {
+			chainHash := headers[n-lo].Hash.Hex()
+			block := storedMap[n]
+			if n == tip {
+				newHash = chainHash
+				if block != nil {
+					oldHash = block.Hash
+				}
+			}
+			if block != nil && strings.EqualFold(block.Hash, chainHash) {
+				return n, oldHash, newHash, nil
+			}
+			if n == lo {
+				break
+			}
+		}
+
+		if lo == floor {
+			fmt.Printf("⚠️ 超过最大重组深度%d仍未找到公共祖先，回滚到区块%d\n", maxDepth, floor)
+			return floor, oldHash, newHash, nil
+		}
+		hi = lo - 1
+	}
+}
+
+// 通知stable worker回滚到 tip 之前的公共祖先
+func (s *ABIScanner) requestSafeReorg(tip uint64) {
+	s.reorgMu.Lock()
+	defer s.reorgMu.Unlock()
+	if s.reorgTip == nil || tip < *s.reorgTip {
+		s.reorgTip = &tip
+	}
+}
+
+// stable worker取走回滚请求
+func (s *ABIScanner) takeSafeReorg() (uint64, bool) {
+	s.reorgMu.Lock()
+	defer s.reorgMu.Unlock()
+	if s.reorgTip == nil {
+		return 0, false
+	}
+	tip := *s.reorgTip
+	s.reorgTip = nil
+	return tip, true
+}
@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultRetryInterval    = 30        // 默认每30秒检查一次死信队列
+	defaultRetryBaseDelay   = 30        // 默认首次重试延迟30秒
+	defaultRetryMaxAttempts = 10        // 默认最多重试10次
+	maxRetryDelay           = time.Hour // 退避延迟上限
+	retryBatchLimit         = 100       // 每轮最多重试的区块数
+)
+
+/*
+失败区块重试worker
+safe扫描中处理失败的区块写入failed_blocks表，游标照常前进；这里按指数退避定时重扫，
+成功后移出队列，超过最大次数标记为dead。
+扫描进度不会越过队列里最小的失败区块，重启后从那里继续，不会漏块。
+*/
+func (s *ABIScanner) runRetryWorker(ctx context.Context) {
+	interval := s.cfg.Scanner.RetryInterval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retryFailedBlocks()
+		}
+	}
+}
+
+func (s *ABIScanner) retryFailedBlocks() {
+	blocks, err := s.repo.GetDueFailedBlocks(time.Now(), retryBatchLimit)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if len(blocks) == 0 {
+		return
+	}
+
+	maxAttempts := s.cfg.Scanner.RetryMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+
+	var resolved int
+	for _, failed := range blocks {
+		if err := s.scanBlock(failed.BlockNumber, "safe"); err != nil {
+			attempts := failed.Attempts + 1
+			dead := attempts >= maxAttempts
+			if dead {
+				fmt.Printf("⚠️ 区块%d重试%d次仍失败，标记为dead: %v\n", failed.BlockNumber, attempts, err)
+			}
+			nextRetryAt := time.Now().Add(s.retryDelay(attempts))
+			if err := s.repo.RescheduleFailedBlock(failed.BlockNumber, err, attempts, nextRetryAt, dead); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+			continue
+		}
+		if err := s.repo.ResolveFailedBlock(failed.BlockNumber); err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		resolved++
+	}
+	fmt.Printf("失败区块重试: %d 个，成功 %d 个\n", len(blocks), resolved)
+
+	// 队列里的最小区块可能已经解决，进度可以往前推
+	if resolved > 0 {
+		if err := s.commitStableProgress(s.stableCursor.Load()); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+}
+
+// 第attempts次重试失败后的等待时间：base * 2^attempts，最多1小时
+func (s *ABIScanner) retryDelay(attempts int) time.Duration {
+	base := s.cfg.Scanner.RetryBaseDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	delay := time.Duration(base) * time.Second
+	for i := 0; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+/*
+更新stable扫描进度：不超过死信队列里最小失败区块的前一个区块
+scanned 低于已记录的进度说明是补扫(audit -reindex)，进度不跟着回退
+*/
+func (s *ABIScanner) commitStableProgress(scanned uint64) error {
+	if scanned == 0 {
+		return nil
+	}
+	progress := scanned
+	current, err := s.repo.GetScanProgress("stable_scan")
+	if err != nil {
+		return err
+	}
+	if current > progress {
+		progress = current
+	}
+	minFailed, ok, err := s.repo.GetMinFailedBlock()
+	if err != nil {
+		return err
+	}
+	if ok && minFailed <= progress {
+		if minFailed == 0 {
+			return nil
+		}
+		progress = minFailed - 1
+	}
+	return s.repo.UpdateScanProgress("stable_scan", progress)
+}
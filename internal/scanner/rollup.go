@@ -0,0 +1,505 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"zk-sync-go-pool/internal/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const rollupBatchSize = 1000 // 重算汇总时每批读取的swap条数
+
+// 汇总周期：小时直接从swap_events重算，天由小时汇总合成(成交人数单独去重统计)
+var rollupPeriods = []struct {
+	name    string
+	seconds int64
+}{
+	{"1h", 3600},
+	{"1d", 86400},
+}
+
+// 一个汇总维度(池子/代币/池子类型)的累加器
+type rollupAgg struct {
+	swapCount int
+	volume0   *big.Rat // 池子:token0成交量，代币:成交量
+	volume1   *big.Rat // 池子:token1成交量
+	volumeUSD *big.Rat
+	feesUSD   *big.Rat
+	traders   map[string]bool
+}
+
+/*
+汇总读取的swap范围：不超过区块 upto 的safe swap
+pending为true时还包括pending swap(没结束的周期)，没有amount_usd的swap用 usd 里的估算值
+*/
+type rollupScope struct {
+	upto    uint64
+	pending bool
+	usd     map[int64]string
+}
+
+// 计入成交人数，空地址(不是交易者)跳过
+func (a *rollupAgg) addTrader(trader string) {
+	if trader != "" {
+		a.traders[trader] = true
+	}
+}
+
+func newRollupAgg() *rollupAgg {
+	return &rollupAgg{
+		volume0:   new(big.Rat),
+		volume1:   new(big.Rat),
+		volumeUSD: new(big.Rat),
+		feesUSD:   new(big.Rat),
+		traders:   make(map[string]bool),
+	}
+}
+
+/*
+成交汇总
+跟在定价进度后面(需要amount_usd)，一个小时/一天等到进度越过它的结束时间按safe数据整体算一次；
+还没结束的周期(当前的小时和天)由 rollupOpen 每轮连同pending数据重算，
+链重组回滚后进度退回，回滚点所在的周期之后重新结束时会被重算修正
+*/
+func (s *ABIScanner) rollupSwaps(ctx context.Context) error {
+	span := uint64(s.cfg.Pricing.BlockSpan)
+	if span == 0 {
+		span = defaultPricingBlockSpan
+	}
+	return s.followProgress(ctx, "rollup", "pricing", span, s.rollupBlocks)
+}
+
+/*
+汇总这段区块里结束的周期
+上一段的最后一个区块(from-1)所在的周期还没结束，从它开始，结束时间不晚于这段最后一个区块的周期都已经完整
+*/
+func (s *ABIScanner) rollupBlocks(from, to uint64) error {
+	minTs, maxTs, err := s.repo.GetBlockTimeRange(from-1, to)
+	if err != nil || maxTs == 0 {
+		return err
+	}
+	hour, day := rollupPeriods[0], rollupPeriods[1]
+	for bucket := minTs - minTs%hour.seconds; bucket+hour.seconds <= maxTs; bucket += hour.seconds {
+		if err := s.rollupHour(bucket, rollupScope{upto: to}); err != nil {
+			return err
+		}
+	}
+	for bucket := minTs - minTs%day.seconds; bucket+day.seconds <= maxTs; bucket += day.seconds {
+		if err := s.rollupDay(bucket, rollupScope{upto: to}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 持读锁重算没结束的周期
+func (s *ABIScanner) refreshOpenRollups() error {
+	s.candleRebuildMu.RLock()
+	defer s.candleRebuildMu.RUnlock()
+	return s.rollupOpen()
+}
+
+/*
+重算还没结束的汇总周期(最新区块所在的小时和天)，包括pending swap，不用等周期结束就能查到
+中间没结束的小时在它还是最新的那一轮算过，等 rollupBlocks 结束它时按safe数据重算覆盖；
+汇总进度落后最新区块超过一天(还在追历史数据)时不算，只删掉回滚之后比最新区块还晚的周期。
+还没定价的swap(包括pending)按定价状态估算USD，定价进度不落后于汇总进度，估算的swap不超过一天。调用方持 candleRebuildMu 锁
+*/
+func (s *ABIScanner) rollupOpen() error {
+	progress, err := s.repo.GetScanProgress("rollup")
+	if err != nil || progress == 0 {
+		return err
+	}
+	tip, err := s.repo.GetTimedBlockBefore(math.MaxInt64, math.MaxInt64)
+	if err != nil || tip == nil {
+		return err
+	}
+	latest := tip.Timestamp
+	hour, day := rollupPeriods[0], rollupPeriods[1]
+	hourBucket, dayBucket := latest-latest%hour.seconds, latest-latest%day.seconds
+	if err := s.repo.DeleteRollupsFrom(hour.name, hourBucket+hour.seconds); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteRollupsFrom(day.name, dayBucket+day.seconds); err != nil {
+		return err
+	}
+	if closed, err := s.repo.GetTimedBlockBefore(math.MaxInt64, progress); err != nil {
+		return err
+	} else if closed != nil && latest-closed.Timestamp > day.seconds {
+		return nil
+	}
+
+	pricing, err := s.repo.GetScanProgress("pricing")
+	if err != nil {
+		return err
+	}
+	usd, err := s.estimateUSD(pricing + 1)
+	if err != nil {
+		return err
+	}
+	scope := rollupScope{upto: math.MaxInt64, pending: true, usd: usd}
+	if err := s.rollupHour(hourBucket, scope); err != nil {
+		return err
+	}
+	return s.rollupDay(dayBucket, scope)
+}
+
+// 从 from 开始还没定价的swap(包括pending)按定价状态估算USD，只用于没结束的汇总周期，不写回swap
+func (s *ABIScanner) estimateUSD(from uint64) (map[int64]string, error) {
+	swaps, err := s.repo.GetSwapsBetween(from, math.MaxInt64)
+	if err != nil || len(swaps) == 0 {
+		return nil, err
+	}
+	state, err := s.newPriceState(from, swaps[len(swaps)-1].BlockNumber, swaps[0].BlockTimeStamp)
+	if err != nil {
+		return nil, err
+	}
+	estimates := make(map[int64]string, len(swaps))
+	for _, swap := range swaps {
+		state.advance(swap)
+		usd, err := state.swapUSD(swap)
+		if err != nil {
+			return nil, err
+		}
+		if usd != "" {
+			estimates[swap.ID] = usd
+		}
+	}
+	return estimates, nil
+}
+
+/*
+swap的交易者：接收地址(小写)
+swap_events里没有交易发起人(tx.from)，按接收地址统计；接收地址是池子(多跳兑换的中间一跳)或路由器时不是交易者，返回空，
+和 repository.CountTraders* 的口径一致
+*/
+func (s *ABIScanner) swapTrader(swap *models.SwapEvent) string {
+	trader := strings.ToLower(swap.Recipient)
+	if s.routers[trader] || s.cachedPool(common.HexToAddress(trader)) != nil {
+		return ""
+	}
+	return trader
+}
+
+// 路由器地址列表，按成交人数去重时排除
+func (s *ABIScanner) routerList() []string {
+	routers := make([]string, 0, len(s.routers))
+	for address := range s.routers {
+		routers = append(routers, address)
+	}
+	sort.Strings(routers)
+	return routers
+}
+
+/*
+从swap_events重算一个小时的汇总
+手续费按swap所在位置的费率算，费率从 pool_fee_history 里找，每个池子读一次
+*/
+func (s *ABIScanner) rollupHour(bucket int64, scope rollupScope) error {
+	period := rollupPeriods[0]
+	pools := make(map[string]*rollupAgg)
+	tokens := make(map[string]*rollupAgg)
+	poolTypes := make(map[string]*rollupAgg)
+	poolInfo := make(map[string]*models.Pool)
+	feeHistory := make(map[string][]*models.PoolFeeChange)
+
+	var afterID int64
+	for {
+		swaps, err := s.repo.GetSwapsInWindow(bucket, bucket+period.seconds, scope.upto, scope.pending, afterID, rollupBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, swap := range swaps {
+			pool := s.cachedPool(common.HexToAddress(swap.PoolAddress))
+			if pool == nil {
+				continue
+			}
+			poolKey := strings.ToLower(pool.PoolAddress)
+			poolInfo[poolKey] = pool
+			history, ok := feeHistory[poolKey]
+			if !ok {
+				if history, err = s.repo.GetPoolFeeHistory(poolKey, scope.upto, scope.pending); err != nil {
+					return err
+				}
+				feeHistory[poolKey] = history
+			}
+
+			amountIn, amountOut := decimalOrZero(swap.AmountInDecimal), decimalOrZero(swap.AmountOutDecimal)
+			usd := decimalOrZero(swap.AmountUSD)
+			if estimate, ok := scope.usd[swap.ID]; ok && swap.AmountUSD == nil {
+				usd = parseRat(estimate)
+			}
+			fee := new(big.Rat)
+			if rate := feeRateAt(history, pool, swap); rate != nil {
+				fee.Mul(usd, big.NewRat(int64(*rate), feeRateDenominator))
+			}
+			trader := s.swapTrader(swap)
+
+			agg := rollupEntry(pools, poolKey)
+			agg.swapCount++
+			if strings.EqualFold(swap.TokenIn, pool.Token0) {
+				agg.volume0.Add(agg.volume0, amountIn)
+				agg.volume1.Add(agg.volume1, amountOut)
+			} else {
+				agg.volume0.Add(agg.volume0, amountOut)
+				agg.volume1.Add(agg.volume1, amountIn)
+			}
+			agg.volumeUSD.Add(agg.volumeUSD, usd)
+			agg.feesUSD.Add(agg.feesUSD, fee)
+			agg.addTrader(trader)
+
+			for _, side := range []struct {
+				token  string
+				amount *big.Rat
+				fee    *big.Rat
+			}{
+				{swap.TokenIn, amountIn, fee},
+				{swap.TokenOut, amountOut, new(big.Rat)},
+			} {
+				agg := rollupEntry(tokens, strings.ToLower(side.token))
+				agg.swapCount++
+				agg.volume0.Add(agg.volume0, side.amount)
+				agg.volumeUSD.Add(agg.volumeUSD, usd)
+				agg.feesUSD.Add(agg.feesUSD, side.fee)
+				agg.addTrader(trader)
+			}
+
+			agg = rollupEntry(poolTypes, poolTypeKey(pool.Protocol, pool.PoolType, pool.Version))
+			agg.swapCount++
+			agg.volumeUSD.Add(agg.volumeUSD, usd)
+			agg.feesUSD.Add(agg.feesUSD, fee)
+			agg.addTrader(trader)
+		}
+		if len(swaps) < rollupBatchSize {
+			break
+		}
+		afterID = swaps[len(swaps)-1].ID
+	}
+
+	var poolRows []*models.PoolRollup
+	for key, agg := range pools {
+		pool := poolInfo[key]
+		poolRows = append(poolRows, &models.PoolRollup{
+			Period:        period.name,
+			BucketStart:   bucket,
+			PoolAddress:   key,
+			PoolType:      pool.PoolType,
+			Version:       pool.Version,
+			SwapCount:     agg.swapCount,
+			Volume0:       ratOrZero(agg.volume0),
+			Volume1:       ratOrZero(agg.volume1),
+			VolumeUSD:     ratOrZero(agg.volumeUSD),
+			UniqueTraders: len(agg.traders),
+			FeesUSD:       ratOrZero(agg.feesUSD),
+		})
+	}
+	var tokenRows []*models.TokenRollup
+	for key, agg := range tokens {
+		tokenRows = append(tokenRows, &models.TokenRollup{
+			Period:        period.name,
+			BucketStart:   bucket,
+			Token:         key,
+			SwapCount:     agg.swapCount,
+			Volume:        ratOrZero(agg.volume0),
+			VolumeUSD:     ratOrZero(agg.volumeUSD),
+			UniqueTraders: len(agg.traders),
+			FeesUSD:       ratOrZero(agg.feesUSD),
+		})
+	}
+	var typeRows []*models.PoolTypeRollup
+	for key, agg := range poolTypes {
+		parts := strings.SplitN(key, ":", 3)
+		protocol, poolType, version := parts[0], parts[1], parts[2]
+		typeRows = append(typeRows, &models.PoolTypeRollup{
+			Period:        period.name,
+			BucketStart:   bucket,
+			Protocol:      protocol,
+			PoolType:      poolType,
+			Version:       version,
+			SwapCount:     agg.swapCount,
+			VolumeUSD:     ratOrZero(agg.volumeUSD),
+			UniqueTraders: len(agg.traders),
+			FeesUSD:       ratOrZero(agg.feesUSD),
+		})
+	}
+	sortRollups(poolRows, tokenRows, typeRows)
+	return s.repo.ReplaceRollups(period.name, bucket, poolRows, tokenRows, typeRows)
+}
+
+/*
+用小时汇总合成一天的汇总
+成交笔数、成交量、手续费直接相加；成交人数不能相加，按天重新去重统计
+*/
+func (s *ABIScanner) rollupDay(bucket int64, scope rollupScope) error {
+	hour, day := rollupPeriods[0], rollupPeriods[1]
+	end := bucket + day.seconds
+
+	var hourPools []*models.PoolRollup
+	if err := s.repo.GetRollups(hour.name, bucket, end, &hourPools); err != nil {
+		return err
+	}
+	var hourTokens []*models.TokenRollup
+	if err := s.repo.GetRollups(hour.name, bucket, end, &hourTokens); err != nil {
+		return err
+	}
+	var hourTypes []*models.PoolTypeRollup
+	if err := s.repo.GetRollups(hour.name, bucket, end, &hourTypes); err != nil {
+		return err
+	}
+
+	routers := s.routerList()
+	poolTraders, err := s.repo.CountTradersByPool(bucket, end, scope.upto, scope.pending, routers)
+	if err != nil {
+		return err
+	}
+	tokenTraders, err := s.repo.CountTradersByToken(bucket, end, scope.upto, scope.pending, routers)
+	if err != nil {
+		return err
+	}
+	poolTraders, tokenTraders = lowerKeys(poolTraders), lowerKeys(tokenTraders)
+
+	pools := make(map[string]*models.PoolRollup)
+	var poolRows []*models.PoolRollup
+	typePools := make(map[string][]string) // 池子类型 -> 当天有成交的池子
+	for _, h := range hourPools {
+		row, ok := pools[h.PoolAddress]
+		if !ok {
+			row = &models.PoolRollup{Period: day.name, BucketStart: bucket, PoolAddress: h.PoolAddress,
+				PoolType: h.PoolType, Version: h.Version, Volume0: "0", Volume1: "0", VolumeUSD: "0", FeesUSD: "0",
+				UniqueTraders: poolTraders[h.PoolAddress]}
+			pools[h.PoolAddress] = row
+			poolRows = append(poolRows, row)
+			protocol := defaultProtocol
+			if pool := s.cachedPool(common.HexToAddress(h.PoolAddress)); pool != nil {
+				protocol = pool.Protocol
+			}
+			typeKey := poolTypeKey(protocol, h.PoolType, h.Version)
+			typePools[typeKey] = append(typePools[typeKey], h.PoolAddress)
+		}
+		row.SwapCount += h.SwapCount
+		row.Volume0 = addRat(row.Volume0, h.Volume0)
+		row.Volume1 = addRat(row.Volume1, h.Volume1)
+		row.VolumeUSD = addRat(row.VolumeUSD, h.VolumeUSD)
+		row.FeesUSD = addRat(row.FeesUSD, h.FeesUSD)
+	}
+
+	tokens := make(map[string]*models.TokenRollup)
+	var tokenRows []*models.TokenRollup
+	for _, h := range hourTokens {
+		row, ok := tokens[h.Token]
+		if !ok {
+			row = &models.TokenRollup{Period: day.name, BucketStart: bucket, Token: h.Token,
+				Volume: "0", VolumeUSD: "0", FeesUSD: "0", UniqueTraders: tokenTraders[h.Token]}
+			tokens[h.Token] = row
+			tokenRows = append(tokenRows, row)
+		}
+		row.SwapCount += h.SwapCount
+		row.Volume = addRat(row.Volume, h.Volume)
+		row.VolumeUSD = addRat(row.VolumeUSD, h.VolumeUSD)
+		row.FeesUSD = addRat(row.FeesUSD, h.FeesUSD)
+	}
+
+	types := make(map[string]*models.PoolTypeRollup)
+	var typeRows []*models.PoolTypeRollup
+	for _, h := range hourTypes {
+		key := poolTypeKey(h.Protocol, h.PoolType, h.Version)
+		row, ok := types[key]
+		if !ok {
+			row = &models.PoolTypeRollup{Period: day.name, BucketStart: bucket, Protocol: h.Protocol, PoolType: h.PoolType,
+				Version: h.Version, VolumeUSD: "0", FeesUSD: "0"}
+			if row.UniqueTraders, err = s.repo.CountTradersInPools(s.storedPoolAddresses(typePools[key]), bucket, end, scope.upto, scope.pending, routers); err != nil {
+				return err
+			}
+			types[key] = row
+			typeRows = append(typeRows, row)
+		}
+		row.SwapCount += h.SwapCount
+		row.VolumeUSD = addRat(row.VolumeUSD, h.VolumeUSD)
+		row.FeesUSD = addRat(row.FeesUSD, h.FeesUSD)
+	}
+
+	sortRollups(poolRows, tokenRows, typeRows)
+	return s.repo.ReplaceRollups(day.name, bucket, poolRows, tokenRows, typeRows)
+}
+
+// 汇总里存的是小写地址，查swap_events要换回池子表里的原始写法
+func (s *ABIScanner) storedPoolAddresses(keys []string) []string {
+	addresses := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if pool := s.cachedPool(common.HexToAddress(key)); pool != nil {
+			addresses = append(addresses, pool.PoolAddress)
+		}
+	}
+	return addresses
+}
+
+/*
+swap所在位置的费率：费率历史里位置不晚于它的最新一条
+历史都在它之后(创建时没读到费率)用最早的一条，没有历史用池子当前费率(配置的固定费率)
+*/
+func feeRateAt(history []*models.PoolFeeChange, pool *models.Pool, swap *models.SwapEvent) *int {
+	for i := len(history) - 1; i >= 0; i-- {
+		if !before(swap.BlockNumber, swap.LogIndex, history[i].BlockNumber, history[i].LogIndex) {
+			return history[i].FeeRate
+		}
+	}
+	if len(history) > 0 {
+		return history[0].FeeRate
+	}
+	return pool.FeeRate
+}
+
+func rollupEntry(aggs map[string]*rollupAgg, key string) *rollupAgg {
+	agg, ok := aggs[key]
+	if !ok {
+		agg = newRollupAgg()
+		aggs[key] = agg
+	}
+	return agg
+}
+
+// 按周期内的主键排序，写库顺序稳定
+func sortRollups(pools []*models.PoolRollup, tokens []*models.TokenRollup, types []*models.PoolTypeRollup) {
+	sort.Slice(pools, func(i, j int) bool { return pools[i].PoolAddress < pools[j].PoolAddress })
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Token < tokens[j].Token })
+	sort.Slice(types, func(i, j int) bool {
+		return poolTypeKey(types[i].Protocol, types[i].PoolType, types[i].Version) <
+			poolTypeKey(types[j].Protocol, types[j].PoolType, types[j].Version)
+	})
+}
+
+// 池子类型汇总的维度：协议:类型:版本，和 poolABIKey 一样
+func poolTypeKey(protocol, poolType, version string) string {
+	return poolABIKey(protocol, poolType, version)
+}
+
+func lowerKeys(m map[string]int) map[string]int {
+	lowered := make(map[string]int, len(m))
+	for k, v := range m {
+		lowered[strings.ToLower(k)] = v
+	}
+	return lowered
+}
+
+// 可为NULL的小数字段，NULL按0计
+func decimalOrZero(value *string) *big.Rat {
+	if value == nil {
+		return new(big.Rat)
+	}
+	return parseRat(*value)
+}
+
+// 超出DECIMAL(65,30)范围的(垃圾代币)按0写入
+func ratOrZero(r *big.Rat) string {
+	value, ok := ratDecimal(r)
+	if !ok {
+		fmt.Printf("⚠️ 汇总数值超出范围，按0写入: %s\n", r.FloatString(0))
+		return "0"
+	}
+	return value
+}
@@ -0,0 +1,313 @@
+package scanner
+
+import (
+	"fmt"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+)
+
+func TestRollupBlocksOnlyWritesClosedBuckets(t *testing.T) {
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newTestScanner(t, pool)
+
+	// 区块100-103：前两个在第一个小时，后两个在第二个小时
+	const hour0 = int64(1699999200) // 整点
+	times := map[uint64]int64{100: hour0 + 10, 101: hour0 + 3000, 102: hour0 + 3700, 103: hour0 + 7300}
+	batch := repository.NewBatch()
+	for number, ts := range times {
+		batch.AddBlock(&models.Block{Number: number, Hash: "0xhash", ParentHash: "0xparent", Timestamp: ts, FinalityStatus: "safe"})
+		swap := buyWETH(pool.PoolAddress, number, 0, "1", "2000")
+		swap.BlockTimeStamp = ts
+		batch.AddSwap(swap)
+	}
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	hourRows := func() []*models.PoolRollup {
+		var rows []*models.PoolRollup
+		if err := s.repo.GetRollups("1h", 0, hour0+86400, &rows); err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	// 第一段停在第二个小时中间：只有第一个小时结束了
+	if err := s.rollupBlocks(100, 102); err != nil {
+		t.Fatal(err)
+	}
+	rows := hourRows()
+	if len(rows) != 1 || rows[0].BucketStart != hour0 || rows[0].SwapCount != 2 {
+		t.Fatalf("hour rollups after first span = %+v", rows)
+	}
+
+	// 第二段越过第二个小时：第二个小时按整个小时算一次，包括上一段里的区块102
+	if err := s.rollupBlocks(103, 103); err != nil {
+		t.Fatal(err)
+	}
+	rows = hourRows()
+	if len(rows) != 2 || rows[1].BucketStart != hour0+3600 || rows[1].SwapCount != 1 {
+		t.Fatalf("hour rollups after second span = %+v", rows)
+	}
+
+	// 这一天在 hour0+7200 结束，第二段才越过它
+	var days []*models.PoolRollup
+	if err := s.repo.GetRollups("1d", 0, hour0+86400, &days); err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || days[0].SwapCount != 3 || days[0].UniqueTraders != 1 {
+		t.Fatalf("day rollups = %+v", days)
+	}
+}
+
+func TestRollupSeparatesPoolTypesByProtocol(t *testing.T) {
+	syncswap := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	other := wethUSDCPool("0x00000000000000000000000000000000000000d2")
+	other.Protocol = "other"
+	s := newTestScanner(t, syncswap, other)
+
+	const hour0 = int64(1699999200)
+	batch := repository.NewBatch()
+	for number, ts := range map[uint64]int64{100: hour0 + 10, 101: hour0 + 20, 102: hour0 + 3700} {
+		batch.AddBlock(&models.Block{Number: number, Hash: "0xhash", ParentHash: "0xparent", Timestamp: ts, FinalityStatus: "safe"})
+	}
+	for i, pool := range []*models.Pool{syncswap, other} {
+		swap := buyWETH(pool.PoolAddress, uint64(100+i), 0, "1", "2000")
+		swap.BlockTimeStamp = hour0 + 10
+		swap.Protocol = pool.Protocol
+		batch.AddSwap(swap)
+	}
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.rollupBlocks(100, 102); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []*models.PoolTypeRollup
+	if err := s.repo.GetRollups("1h", 0, hour0+86400, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Protocol != "other" || rows[1].Protocol != "syncswap" || rows[0].SwapCount != 1 || rows[1].SwapCount != 1 {
+		t.Fatalf("pool type rollups = %+v", rows)
+	}
+}
+
+func TestRollupUsesFeeRateAtSwapPosition(t *testing.T) {
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	current := 100
+	pool.FeeRate = &current // 池子现在的费率，之前的swap不能按它算
+	s := newTestScanner(t, pool)
+
+	const hour0 = int64(1699999200)
+	batch := repository.NewBatch()
+	for _, change := range []struct {
+		block uint64
+		rate  int
+	}{{90, 3000}, {101, 1000}, {103, 100}} {
+		rate := change.rate
+		batch.AddPoolFeeChange(&models.PoolFeeChange{BlockNumber: change.block, TxHash: fmt.Sprintf("0xfee%d", change.block),
+			ContractAddress: pool.PoolAddress, PoolAddress: pool.PoolAddress, EventName: "FeeAmount", FeeRate: &rate, FinalityStatus: "safe"})
+	}
+	for number, ts := range map[uint64]int64{100: hour0 + 10, 102: hour0 + 20, 104: hour0 + 3700} {
+		batch.AddBlock(&models.Block{Number: number, Hash: "0xhash", ParentHash: "0xparent", Timestamp: ts, FinalityStatus: "safe"})
+		swap := buyWETH(pool.PoolAddress, number, 0, "1", "2000")
+		swap.BlockTimeStamp = ts
+		usd := "2000"
+		swap.AmountUSD = &usd
+		batch.AddSwap(swap)
+	}
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.rollupBlocks(100, 104); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []*models.PoolRollup
+	if err := s.repo.GetRollups("1h", hour0, hour0+1, &rows); err != nil {
+		t.Fatal(err)
+	}
+	// 2000*0.3% + 2000*0.1%
+	if len(rows) != 1 || parseRat(rows[0].FeesUSD).Cmp(parseRat("8")) != 0 {
+		t.Fatalf("hour rollups = %+v, want fees 8", rows)
+	}
+}
+
+func TestOpenRollupsIncludePendingAndFollowRollback(t *testing.T) {
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newTestScanner(t, pool)
+
+	const hour0 = int64(1699999200)
+	reserve := repository.NewBatch()
+	reserve.AddPoolReserve(&models.PoolReserve{PoolAddress: pool.PoolAddress, Reserve0: deepWETH, Reserve1: deepUSDC, BlockNumber: 99, FinalityStatus: "safe"})
+	if _, err := s.repo.SaveBatch(reserve); err != nil {
+		t.Fatal(err)
+	}
+	saveBlock := func(number uint64, ts int64, finality, usdc string) {
+		batch := repository.NewBatch()
+		batch.AddBlock(&models.Block{Number: number, Hash: "0xhash", ParentHash: "0xparent", Timestamp: ts, FinalityStatus: finality})
+		swap := buyWETH(pool.PoolAddress, number, 0, "1", usdc)
+		swap.BlockTimeStamp, swap.FinalityStatus = ts, finality
+		if finality == "safe" {
+			swap.AmountUSD = &usdc
+		}
+		batch.AddSwap(swap)
+		if _, err := s.repo.SaveBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saveBlock(100, hour0+10, "safe", "2000")
+	saveBlock(101, hour0+20, "pending", "2500")
+	for _, task := range []string{"pricing", "rollup"} {
+		if err := s.repo.InitScanProgress(task, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rollups := func(period string) []*models.PoolRollup {
+		var rows []*models.PoolRollup
+		if err := s.repo.GetRollups(period, 0, hour0+86400, &rows); err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	// 最新区块所在的小时有汇总，pending swap按估算的USD计入
+	if err := s.refreshOpenRollups(); err != nil {
+		t.Fatal(err)
+	}
+	if hours := rollups("1h"); len(hours) != 1 || hours[0].SwapCount != 2 || parseRat(hours[0].VolumeUSD).Cmp(parseRat("4500")) != 0 {
+		t.Fatalf("open hour rollups = %+v", hours)
+	}
+
+	// 进入下一个小时只重算新的小时，上一个小时留着上一轮的结果，天由两个小时合成
+	saveBlock(102, hour0+3700, "pending", "3000")
+	if err := s.refreshOpenRollups(); err != nil {
+		t.Fatal(err)
+	}
+	hours := rollups("1h")
+	if len(hours) != 2 || hours[0].SwapCount != 2 || hours[1].SwapCount != 1 {
+		t.Fatalf("open hour rollups = %+v", hours)
+	}
+	if days := rollups("1d"); len(days) != 1 || days[0].SwapCount != 3 || parseRat(days[0].VolumeUSD).Cmp(parseRat("7500")) != 0 {
+		t.Fatalf("open day rollups = %+v", days)
+	}
+
+	// pending回滚之后只剩safe那笔，第二个小时没有区块了，它的汇总删掉
+	if err := s.deletePending(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refreshOpenRollups(); err != nil {
+		t.Fatal(err)
+	}
+	hours = rollups("1h")
+	if len(hours) != 1 || hours[0].SwapCount != 1 || parseRat(hours[0].VolumeUSD).Cmp(parseRat("2000")) != 0 {
+		t.Fatalf("hour rollups after pending rollback = %+v", hours)
+	}
+	if days := rollups("1d"); len(days) != 1 || days[0].SwapCount != 1 {
+		t.Fatalf("day rollups after pending rollback = %+v", days)
+	}
+}
+
+func TestOpenRollupsWaitWhileRollupIsADayBehind(t *testing.T) {
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newTestScanner(t, pool)
+
+	const hour0 = int64(1699999200)
+	batch := repository.NewBatch()
+	for _, b := range []struct {
+		number uint64
+		ts     int64
+	}{{100, hour0 + 10}, {200, hour0 + 86400 + 3600}} {
+		batch.AddBlock(&models.Block{Number: b.number, Hash: "0xhash", ParentHash: "0xparent", Timestamp: b.ts, FinalityStatus: "safe"})
+		swap := buyWETH(pool.PoolAddress, b.number, 0, "1", "2000")
+		swap.BlockTimeStamp, swap.FinalityStatus = b.ts, "safe"
+		batch.AddSwap(swap)
+	}
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range []string{"pricing", "rollup"} {
+		if err := s.repo.InitScanProgress(task, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.refreshOpenRollups(); err != nil {
+		t.Fatal(err)
+	}
+	for _, period := range []string{"1h", "1d"} {
+		var rows []*models.PoolRollup
+		if err := s.repo.GetRollups(period, 0, hour0+3*86400, &rows); err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 0 {
+			t.Fatalf("%s rollups while catching up = %+v", period, rows)
+		}
+	}
+}
+
+func TestRollupTradersSkipPoolAndRouterRecipients(t *testing.T) {
+	a := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	b := wethUSDCPool("0x00000000000000000000000000000000000000d2")
+	s := newTestScanner(t, a, b)
+	const router, trader = "0x00000000000000000000000000000000000000e1", "0x00000000000000000000000000000000000000e2"
+	s.routers = map[string]bool{router: true}
+
+	const hour0 = int64(1699999200)
+	batch := repository.NewBatch()
+	batch.AddPool(a)
+	batch.AddPool(b)
+	// 两跳兑换：第一跳的接收地址是下一个池子；另一笔的接收地址是路由器
+	for _, sw := range []struct {
+		number    uint64
+		pool      string
+		recipient string
+	}{{100, a.PoolAddress, b.PoolAddress}, {101, b.PoolAddress, trader}, {102, a.PoolAddress, router}} {
+		ts := hour0 + int64(sw.number-100)*10
+		batch.AddBlock(&models.Block{Number: sw.number, Hash: "0xhash", ParentHash: "0xparent", Timestamp: ts, FinalityStatus: "safe"})
+		swap := buyWETH(sw.pool, sw.number, 0, "1", "2000")
+		swap.BlockTimeStamp, swap.Recipient = ts, sw.recipient
+		batch.AddSwap(swap)
+	}
+	batch.AddBlock(&models.Block{Number: 103, Hash: "0xhash", ParentHash: "0xparent", Timestamp: hour0 + 86400, FinalityStatus: "safe"})
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.rollupBlocks(100, 103); err != nil {
+		t.Fatal(err)
+	}
+
+	// 小时在内存里统计，天用SQL去重，两边口径一样
+	for _, period := range []string{"1h", "1d"} {
+		var pools []*models.PoolRollup
+		if err := s.repo.GetRollups(period, 0, hour0+86400, &pools); err != nil {
+			t.Fatal(err)
+		}
+		traders := make(map[string]int)
+		for _, row := range pools {
+			traders[row.PoolAddress] = row.UniqueTraders
+		}
+		if len(pools) != 2 || traders[a.PoolAddress] != 0 || traders[b.PoolAddress] != 1 {
+			t.Fatalf("%s pool rollups = %+v", period, pools)
+		}
+		var tokens []*models.TokenRollup
+		if err := s.repo.GetRollups(period, 0, hour0+86400, &tokens); err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range tokens {
+			if row.SwapCount != 3 || row.UniqueTraders != 1 {
+				t.Fatalf("%s token rollup = %+v", period, row)
+			}
+		}
+		var types []*models.PoolTypeRollup
+		if err := s.repo.GetRollups(period, 0, hour0+86400, &types); err != nil {
+			t.Fatal(err)
+		}
+		if len(types) != 1 || types[0].UniqueTraders != 1 {
+			t.Fatalf("%s pool type rollups = %+v", period, types)
+		}
+	}
+}
@@ -24,7 +24,7 @@ type FactoryInfo struct {
 
 type Scanner struct {
 	cfg            *config.Config
-	repo           *repository.Repository
+	repo           repository.Storage
 	factoryInfoMap map[string]FactoryInfo // 池子信息映射 用于存储工厂信息
 
 	poolCache      map[string]bool // 池子地址内存缓存
@@ -32,7 +32,7 @@ type Scanner struct {
 }
 
 // 创建Scanner 扫描器 专注于扫描事件和索引事件
-func NewScanner(cfg *config.Config, repo *repository.Repository) *Scanner {
+func NewScanner(cfg *config.Config, repo repository.Storage) *Scanner {
 	s := &Scanner{cfg: cfg, repo: repo}
 	s.initPoolInfoMap()    // 初始化映射工厂地址
 	s.initSwapSignatures() // 初始化收集各类型swap事件哈希集合
@@ -375,7 +375,7 @@ func (s *Scanner) scanBlock(blockNum uint64) error {
 			if s.IsSwapEvent(*log) {
 				// fmt.Printf("✅ 扫描区块 %d: 发现Swap事件\n", blockNum)
 				swapEvent := s.parseSwapEvent(*log, receipt.TxHash.Hex(), blockNum, blockTimestamp)
-				if err := s.repo.SaveSwapEvent(swapEvent); err != nil {
+				if _, err := s.repo.SaveSwapEvent(swapEvent); err != nil {
 					fmt.Printf("⚠️  保存失败: %v\n", err)
 					continue
 				}
@@ -531,7 +531,7 @@ func (s *Scanner) parseSwapEvent(log types.Log, txHash string, blockNum uint64,
 		Recipient:      recipient,
 		TokenIn:        tokenIn,
 		TokenOut:       tokenOut,
-		AmountIn:       amountIn,
-		AmountOut:      amountOut,
+		AmountIn:       models.BigInt(amountIn),
+		AmountOut:      models.BigInt(amountOut),
 	}
 }
@@ -0,0 +1,287 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"zk-sync-go-pool/internal/blockchain"
+	"zk-sync-go-pool/internal/models"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	defaultSnapshotInterval = 3600            // 默认每小时一个快照
+	snapshotCheckInterval   = 30              // 快照worker检查定价进度的间隔(秒)
+	snapshotCallLogIndex    = math.MaxInt32   // 调用合约读到的是区块末尾的状态，排在该区块所有Sync之后
+	snapshotTask            = "pool_snapshot" // 快照进度
+)
+
+// 读取池子状态的方法：classic/stable/aqua 用 getReserves()，range池子用两个代币的 balanceOf(pool)
+const poolStateABIJSON = `[
+	{"type":"function","name":"getReserves","inputs":[],"outputs":[{"name":"_reserve0","type":"uint256"},{"name":"_reserve1","type":"uint256"}],"stateMutability":"view"},
+	{"type":"function","name":"balanceOf","inputs":[{"name":"account","type":"address"}],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"}
+]`
+
+var poolStateABI, _ = ethabi.JSON(strings.NewReader(poolStateABIJSON))
+
+func (s *ABIScanner) snapshotInterval() int64 {
+	if s.cfg.Scanner.SnapshotInterval <= 0 {
+		return defaultSnapshotInterval
+	}
+	return int64(s.cfg.Scanner.SnapshotInterval)
+}
+
+// 生成池子快照，按代币精度换算储备量；TVL等定价进度经过快照所在区块时再算(pricing.go)
+func (s *ABIScanner) newPoolSnapshot(pool *models.Pool, reserve0, reserve1 models.BigInt, blockNum uint64, blockTimestamp int64, logIndex int, source, finality string) *models.PoolSnapshot {
+	interval := s.snapshotInterval()
+	return &models.PoolSnapshot{
+		PoolAddress:     pool.PoolAddress,
+		PoolType:        pool.PoolType,
+		Version:         pool.Version,
+		BucketStart:     blockTimestamp - blockTimestamp%interval,
+		FinalityStatus:  finality,
+		BlockNumber:     blockNum,
+		BlockTimeStamp:  blockTimestamp,
+		LogIndex:        logIndex,
+		Source:          source,
+		Reserve0:        reserve0,
+		Reserve1:        reserve1,
+		Reserve0Decimal: s.normalizeAmount(pool.Token0, reserve0.String()),
+		Reserve1Decimal: s.normalizeAmount(pool.Token1, reserve1.String()),
+	}
+}
+
+/*
+快照的TVL(USD)：按快照位置(含)之前最近的价格，两个代币都能定价时才有值
+定价状态移到快照的位置，调用方之后要从下一笔swap重新推进
+*/
+func (st *priceState) snapshotTVL(snapshot *models.PoolSnapshot) (*string, error) {
+	pool := st.s.cachedPool(common.HexToAddress(snapshot.PoolAddress))
+	if pool == nil || snapshot.Reserve0Decimal == nil || snapshot.Reserve1Decimal == nil {
+		return nil, nil
+	}
+	st.moveTo(snapshot.BlockNumber, snapshot.LogIndex, snapshot.BlockTimeStamp)
+	price0, err := st.price(pool.Token0)
+	if err != nil {
+		return nil, err
+	}
+	price1, err := st.price(pool.Token1)
+	if err != nil {
+		return nil, err
+	}
+	if price0 == nil || price1 == nil {
+		return nil, nil
+	}
+	tvl := new(big.Rat).Mul(parseRat(*snapshot.Reserve0Decimal), price0.price)
+	tvl.Add(tvl, new(big.Rat).Mul(parseRat(*snapshot.Reserve1Decimal), price1.price))
+	value, ok := ratDecimal(tvl)
+	if !ok {
+		return nil, nil
+	}
+	return &value, nil
+}
+
+// Sync事件更新所在周期的快照
+func (s *ABIScanner) saveSyncSnapshot(block *BlockContext, pool *models.Pool, reserve *models.PoolReserve) error {
+	block.Batch.AddPoolSnapshot(s.newPoolSnapshot(pool, reserve.Reserve0, reserve.Reserve1, reserve.BlockNumber, block.Timestamp,
+		reserve.LogIndex, "sync", reserve.FinalityStatus))
+	return nil
+}
+
+/*
+快照worker
+快照周期按区块时间划分：定价进度越过一个周期的结束时间后，在这个周期最后一个有时间戳的区块上读取所有池子的状态，
+追赶历史区块时每个周期也都有快照；周期内有Sync的池子已经有更新的快照，不会被覆盖，没有Sync的池子(包括range池子)由这里补齐
+*/
+func (s *ABIScanner) runSnapshotWorker(ctx context.Context) {
+	ticker := time.NewTicker(snapshotCheckInterval * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := s.snapshotBuckets(ctx); err != nil {
+			fmt.Printf("⚠️ 池子快照失败: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+给定价进度以内已经结束的快照周期补上快照
+进度记在 scan_progress(pool_snapshot)，是最后一次快照所在的区块；快照区块不超过定价进度，TVL直接按那时的价格算
+*/
+func (s *ABIScanner) snapshotBuckets(ctx context.Context) error {
+	upto, err := s.repo.GetScanProgress("pricing")
+	if err != nil || upto == 0 {
+		return err
+	}
+	uptoTimestamp, err := s.blockTimestamp(upto)
+	if err != nil {
+		return err
+	}
+	last, err := s.repo.GetScanProgress(snapshotTask)
+	if err != nil {
+		return err
+	}
+	if last == 0 {
+		last = uint64(s.cfg.Scanner.StartBlock)
+		if err := s.repo.InitScanProgress(snapshotTask, last); err != nil {
+			return err
+		}
+	}
+
+	interval := s.snapshotInterval()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		// 上次快照之后第一个有时间戳的区块所在的周期，定价进度到了下一个周期才算结束
+		first, err := s.repo.GetTimedBlockAfter(last, upto)
+		if err != nil || first == nil {
+			return err
+		}
+		end := first.Timestamp - first.Timestamp%interval + interval
+		if uptoTimestamp < end {
+			return nil
+		}
+		block, err := s.repo.GetTimedBlockBefore(end, upto)
+		if err != nil || block == nil {
+			return err
+		}
+		if ok, err := s.snapshotPools(block.Number, block.Timestamp); err != nil || !ok {
+			return err
+		}
+		last = block.Number
+	}
+}
+
+// 区块时间戳，区块记录里没有(logs模式下没有日志的区块)再去链上读
+func (s *ABIScanner) blockTimestamp(number uint64) (int64, error) {
+	stored, err := s.repo.GetBlock(number)
+	if err != nil {
+		return 0, err
+	}
+	if stored != nil && stored.Timestamp > 0 {
+		return stored.Timestamp, nil
+	}
+	return blockchain.GetBlockTimestamp(number)
+}
+
+/*
+在一个区块上读取所有池子的状态写入快照，并把快照进度推进到这个区块
+返回false表示期间发生了回滚(定价进度退到了区块之前)，这一轮先停下
+*/
+func (s *ABIScanner) snapshotPools(block uint64, blockTimestamp int64) (bool, error) {
+	var pools []*models.Pool
+	s.poolCacheMu.RLock()
+	for address, pool := range s.poolCache {
+		if _, unreadable := s.unreadablePools.Load(address); pool.CreatedBlock <= block && !unreadable {
+			pools = append(pools, pool)
+		}
+	}
+	s.poolCacheMu.RUnlock()
+	sort.Slice(pools, func(i, j int) bool { return pools[i].PoolAddress < pools[j].PoolAddress })
+
+	// range(v3)池子没有getReserves，读两个代币在池子里的余额(包含未领取的手续费)
+	var calls []blockchain.ContractCall
+	for _, pool := range pools {
+		address := common.HexToAddress(pool.PoolAddress)
+		if s.poolFactory(pool).Swap == swapV3 {
+			data, _ := poolStateABI.Pack("balanceOf", address)
+			calls = append(calls,
+				blockchain.ContractCall{To: common.HexToAddress(pool.Token0), Data: data},
+				blockchain.ContractCall{To: common.HexToAddress(pool.Token1), Data: data})
+			continue
+		}
+		data, _ := poolStateABI.Pack("getReserves")
+		calls = append(calls, blockchain.ContractCall{To: address, Data: data})
+	}
+	results, errs, callErr := blockchain.BatchCallContracts(calls, block)
+
+	// 保存期间不能有链重组回滚，拿到锁后确认快照区块还在定价进度以内
+	s.candleRebuildMu.RLock()
+	defer s.candleRebuildMu.RUnlock()
+	if progress, err := s.repo.GetScanProgress("pricing"); err != nil || progress < block {
+		return false, err
+	}
+	state, err := s.newPriceState(block+1, block, blockTimestamp)
+	if err != nil {
+		return false, err
+	}
+
+	var saved, failed int
+	i := 0
+	for _, pool := range pools {
+		var reserve0, reserve1 *big.Int
+		var poolErrs []error
+		if s.poolFactory(pool).Swap == swapV3 {
+			reserve0 = unpackUint(errs[i], "balanceOf", results[i], 0)
+			reserve1 = unpackUint(errs[i+1], "balanceOf", results[i+1], 0)
+			poolErrs = errs[i : i+2]
+			i += 2
+		} else {
+			reserve0 = unpackUint(errs[i], "getReserves", results[i], 0)
+			reserve1 = unpackUint(errs[i], "getReserves", results[i], 1)
+			poolErrs = errs[i : i+1]
+			i++
+		}
+		if reserve0 == nil || reserve1 == nil {
+			failed++
+			// 合约revert或者返回值解析不了，换个区块也一样，进程重启前不再读这个池子；节点失败的下一轮再读
+			if callErr == nil || deterministicCallFailure(poolErrs) {
+				s.unreadablePools.Store(strings.ToLower(pool.PoolAddress), true)
+				fmt.Printf("⚠️ 池子%s读不到储备量，之后的快照跳过: %v\n", pool.PoolAddress, poolErrs[0])
+			}
+			continue
+		}
+		snapshot := s.newPoolSnapshot(pool, models.BigInt(reserve0.String()), models.BigInt(reserve1.String()), block, blockTimestamp,
+			snapshotCallLogIndex, "call", "safe")
+		if snapshot.TvlUSD, err = state.snapshotTVL(snapshot); err != nil {
+			return false, err
+		}
+		if err := s.repo.SavePoolSnapshot(snapshot); err != nil {
+			return false, err
+		}
+		saved++
+	}
+	if callErr != nil {
+		// 节点失败的池子这个周期没有快照，不推进进度，下一轮在同一个区块上重读
+		return false, callErr
+	}
+	fmt.Printf("✅ 池子快照 区块%d: %d 个池子，失败 %d 个\n", block, saved, failed)
+	return true, s.repo.UpdateScanProgress(snapshotTask, block)
+}
+
+// 一个池子的几个调用里有revert之类的确定性失败
+func deterministicCallFailure(errs []error) bool {
+	for _, err := range errs {
+		if blockchain.IsDeterministicError(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析调用返回的第index个uint256，调用失败或解析不了返回nil
+func unpackUint(err error, method string, result []byte, index int) *big.Int {
+	if err != nil {
+		return nil
+	}
+	values, err := poolStateABI.Unpack(method, result)
+	if err != nil || len(values) <= index {
+		return nil
+	}
+	v, _ := values[index].(*big.Int)
+	return v
+}
@@ -0,0 +1,128 @@
+package scanner
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	deepWETH = "5000000000000000000000" // 5000 WETH
+	deepUSDC = "10000000000000"         // 1000万 USDC
+)
+
+func snapshotTVL(t *testing.T, snapshot *models.PoolSnapshot) string {
+	t.Helper()
+	if snapshot.TvlUSD == nil {
+		t.Fatalf("snapshot of %s at block %d has no TVL", snapshot.PoolAddress, snapshot.BlockNumber)
+	}
+	return *snapshot.TvlUSD
+}
+
+func TestSnapshotTVLUsesPriceAtSnapshotPosition(t *testing.T) {
+	deep := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	shallow := wethUSDCPool("0x00000000000000000000000000000000000000d2")
+	s := newTestScanner(t, deep, shallow)
+
+	batch := repository.NewBatch()
+	batch.AddPoolReserve(&models.PoolReserve{PoolAddress: deep.PoolAddress, Reserve0: deepWETH, Reserve1: deepUSDC, BlockNumber: 99, FinalityStatus: "safe"})
+	batch.AddSwap(buyWETH(deep.PoolAddress, 100, 0, "1", "2000"))
+	batch.AddSwap(buyWETH(deep.PoolAddress, 102, 0, "1", "3000"))
+	// 101的Sync快照在3000那笔之前；102的快照在它之后
+	before := s.newPoolSnapshot(deep, deepWETH, deepUSDC, 101, 1700000001, 0, "sync", "safe")
+	after := s.newPoolSnapshot(shallow, "1000000000000000000", "2000000000", 102, 1700000002, 5, "sync", "safe")
+	if before.TvlUSD != nil || after.TvlUSD != nil {
+		t.Fatal("TVL computed before pricing reached the snapshot")
+	}
+	batch.AddPoolSnapshot(before)
+	batch.AddPoolSnapshot(after)
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.priceBlocks(100, 102); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := s.repo.GetSnapshotsBetween(100, 102)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("snapshots = %d, want 2", len(snapshots))
+	}
+	for i, want := range []string{"20000000", "5000"} { // 5000*2000+1000万；1*3000+2000
+		if got := snapshotTVL(t, snapshots[i]); parseRat(got).Cmp(parseRat(want)) != 0 {
+			t.Fatalf("TVL at block %d = %s, want %s", snapshots[i].BlockNumber, got, want)
+		}
+	}
+}
+
+func TestSnapshotWorkerSpacesSnapshotsByBlockTime(t *testing.T) {
+	chain := newFakeChain(t, 200)
+	chain.call = func(to common.Address, data []byte) ([]byte, error) {
+		weth, _ := new(big.Int).SetString(deepWETH, 10)
+		usdc, _ := new(big.Int).SetString(deepUSDC, 10)
+		return poolStateABI.Methods["getReserves"].Outputs.Pack(weth, usdc)
+	}
+	pool := wethUSDCPool("0x00000000000000000000000000000000000000d1")
+	s := newTestScanner(t, pool)
+	s.cfg.Scanner.StartBlock = 99
+
+	// 区块时间和墙上时间无关：几个区块就跨了好几个小时，没有日志的区块没有时间戳
+	const hour = 1700002800 // 整点
+	timestamps := map[uint64]int64{100: hour + 100, 110: hour + 1800, 120: hour + 3600 + 100, 130: hour + 3*3600 + 10, 140: hour + 4*3600 + 5}
+	batch := repository.NewBatch()
+	for n := uint64(100); n <= 140; n++ {
+		batch.AddBlock(&models.Block{Number: n, Timestamp: timestamps[n], FinalityStatus: "safe"})
+	}
+	batch.AddPoolReserve(&models.PoolReserve{PoolAddress: pool.PoolAddress, Reserve0: deepWETH, Reserve1: deepUSDC, BlockNumber: 99, FinalityStatus: "safe"})
+	swap := buyWETH(pool.PoolAddress, 100, 0, "1", "2000")
+	swap.BlockTimeStamp = timestamps[100]
+	batch.AddSwap(swap)
+	if _, err := s.repo.SaveBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	// 定价到130：前两个小时结束了，第四个小时还没结束
+	if err := s.repo.InitScanProgress("pricing", 130); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.snapshotBuckets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if progress, _ := s.repo.GetScanProgress(snapshotTask); progress != 120 {
+		t.Fatalf("snapshot progress = %d, want 120", progress)
+	}
+
+	// 第三个小时没有区块，直接跳过
+	if err := s.repo.UpdateScanProgress("pricing", 140); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.snapshotBuckets(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := s.repo.GetSnapshotsBetween(0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		block  uint64
+		bucket int64
+	}{{110, hour}, {120, hour + 3600}, {130, hour + 3*3600}}
+	if len(snapshots) != len(want) {
+		t.Fatalf("snapshots = %d, want %d", len(snapshots), len(want))
+	}
+	for i, w := range want {
+		got := snapshots[i]
+		if got.BlockNumber != w.block || got.BucketStart != w.bucket || got.Source != "call" {
+			t.Fatalf("snapshot %d = block %d bucket %d source %s, want block %d bucket %d", i, got.BlockNumber, got.BucketStart, got.Source, w.block, w.bucket)
+		}
+		if tvl := snapshotTVL(t, got); parseRat(tvl).Cmp(parseRat("20000000")) != 0 {
+			t.Fatalf("TVL at block %d = %s, want 20000000", got.BlockNumber, tvl)
+		}
+	}
+}
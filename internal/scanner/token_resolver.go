@@ -0,0 +1,361 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+	"zk-sync-go-pool/internal/blockchain"
+	"zk-sync-go-pool/internal/cache"
+	"zk-sync-go-pool/internal/models"
+	"zk-sync-go-pool/internal/repository"
+
+	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	tokenQueueSize     = 1000            // 待解析代币队列长度
+	tokenRetryInterval = 5 * time.Minute // 网络错误导致解析失败的代币多久后重试
+	tokenSymbolMaxLen  = 20              // 与tokens.symbol字段长度一致
+	tokenNameMaxLen    = 100             // 与tokens.name字段长度一致
+	backfillBatchSize  = 1000            // 回填swap换算数量时每批条数
+)
+
+// ERC20元数据方法，只用来打包调用数据和解析string返回值
+const erc20MetadataABI = `[
+	{"type":"function","name":"symbol","inputs":[],"outputs":[{"name":"","type":"string"}],"stateMutability":"view"},
+	{"type":"function","name":"name","inputs":[],"outputs":[{"name":"","type":"string"}],"stateMutability":"view"},
+	{"type":"function","name":"decimals","inputs":[],"outputs":[{"name":"","type":"uint8"}],"stateMutability":"view"}
+]`
+
+var erc20ABI, _ = ethabi.JSON(strings.NewReader(erc20MetadataABI))
+
+/*
+代币元数据解析
+PoolCreated 里出现的 token0/token1 如果还没见过就放进队列，后台协程调用
+symbol()/name()/decimals() 拿元数据写入tokens表，并缓存到Redis。
+老代币(如MKR)的symbol/name返回bytes32，按bytes32兜底解析；
+调用revert的代币也会入库(status=false)，避免反复调用。
+*/
+type tokenResolver struct {
+	repo  repository.Storage
+	queue chan string
+
+	mu       sync.Mutex
+	seen     map[string]bool // 已入库或已在队列中的代币(小写地址)
+	decimals map[string]int  // 已知精度的代币(小写地址)，解析swap时换算数量用
+
+	onBackfill func(address string, pools []string, fromBlock uint64, fromTimestamp int64) // 回填了swap换算数量之后的回调(从最早那笔swap起重建K线、重新计算推导任务)
+}
+
+func newTokenResolver(repo repository.Storage) *tokenResolver {
+	r := &tokenResolver{
+		repo:     repo,
+		queue:    make(chan string, tokenQueueSize),
+		seen:     make(map[string]bool),
+		decimals: make(map[string]int),
+	}
+	tokens, err := repo.GetAllTokens()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+	}
+	for _, token := range tokens {
+		r.remember(token)
+	}
+	return r
+}
+
+// 记录代币精度，非标准代币(status=false)精度不可信，不参与换算
+func (r *tokenResolver) remember(token *models.Token) {
+	if !token.Status {
+		return
+	}
+	r.mu.Lock()
+	r.decimals[strings.ToLower(token.Address)] = token.Decimals
+	r.mu.Unlock()
+}
+
+// 代币精度，只查内存不发请求（在解析swap的热路径上）
+func (r *tokenResolver) Decimals(address string) (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	decimals, ok := r.decimals[strings.ToLower(address)]
+	return decimals, ok
+}
+
+// 放入待解析队列，已经见过的直接忽略；队列满了也忽略，重启时会从pools表补齐
+func (r *tokenResolver) Enqueue(addresses ...string) {
+	for _, address := range addresses {
+		if !r.markSeen(address) {
+			continue
+		}
+		select {
+		case r.queue <- address:
+		default:
+			fmt.Printf("⚠️ 代币解析队列已满，跳过 %s\n", address)
+			r.forget(strings.ToLower(address))
+		}
+	}
+}
+
+// 第一次见到返回true
+func (r *tokenResolver) markSeen(address string) bool {
+	key := strings.ToLower(address)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen[key] {
+		return false
+	}
+	r.seen[key] = true
+	return true
+}
+
+func (r *tokenResolver) forget(key string) {
+	r.mu.Lock()
+	delete(r.seen, key)
+	r.mu.Unlock()
+}
+
+// 后台协程：先补齐历史池子里缺的代币和swap换算数量，再持续消费队列
+func (r *tokenResolver) Run(ctx context.Context) {
+	go r.backfillAll()
+
+	if addresses, err := r.repo.GetUnknownTokenAddresses(); err != nil {
+		fmt.Printf("%v\n", err)
+	} else if len(addresses) > 0 {
+		fmt.Printf("补齐代币元数据: %d 个\n", len(addresses))
+		// 可能超过队列长度，单独协程排队放入，不阻塞消费
+		go func() {
+			for _, address := range addresses {
+				if !r.markSeen(address) {
+					continue
+				}
+				select {
+				case r.queue <- address:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case address := <-r.queue:
+			if _, err := r.Resolve(address); err != nil {
+				fmt.Printf("⚠️ %v，%v后重试\n", err, tokenRetryInterval)
+				go r.retryLater(ctx, address)
+			}
+		}
+	}
+}
+
+// 等 tokenRetryInterval 后重新排队，扫描器停止时直接放弃
+func (r *tokenResolver) retryLater(ctx context.Context, address string) {
+	timer := time.NewTimer(tokenRetryInterval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		r.forget(strings.ToLower(address))
+		r.Enqueue(address)
+	case <-ctx.Done():
+	}
+}
+
+/*
+获取代币元数据：Redis -> 数据库 -> 链上调用
+*/
+func (r *tokenResolver) Resolve(address string) (*models.Token, error) {
+	address = common.HexToAddress(address).Hex()
+	token, err := cache.GetToken(address)
+	if err != nil || token == nil {
+		token, err = r.resolveUncached(address)
+		if err != nil {
+			return nil, err
+		}
+		if err := cache.SetToken(token); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+	if _, known := r.Decimals(address); !known && token.Status {
+		r.remember(token)
+		r.backfill(address, token.Decimals) // 之前入库的swap精度未知，现在回填
+	}
+	return token, nil
+}
+
+// 数据库没有再去链上读取
+func (r *tokenResolver) resolveUncached(address string) (*models.Token, error) {
+	token, err := r.repo.GetTokenByAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		if token, err = fetchTokenMetadata(address); err != nil {
+			return nil, err
+		}
+		if err := r.repo.SaveToken(token); err != nil {
+			return nil, err
+		}
+		fmt.Printf("✅ 新代币 %s %s(%s) decimals=%d\n", token.Address, token.Symbol, token.Name, token.Decimals)
+	}
+	return token, nil
+}
+
+// 启动时回填所有精度已知但swap还没换算的代币
+func (r *tokenResolver) backfillAll() {
+	addresses, err := r.repo.GetTokensMissingDecimal(decimalIntDigits)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	for _, address := range addresses {
+		if decimals, ok := r.Decimals(address); ok {
+			r.backfill(address, decimals)
+		}
+	}
+}
+
+/*
+回填某个代币的swap换算数量（在Go里做精确换算，SQL里的POW是浮点）
+两侧分开处理：作为token_in 和作为token_out
+*/
+func (r *tokenResolver) backfill(address string, decimals int) {
+	var total int
+	pools := make(map[string]bool)
+	var fromBlock uint64
+	var fromTimestamp int64
+	for _, side := range []string{"in", "out"} {
+		var afterID int64
+		for {
+			amounts, err := r.repo.GetSwapAmountsMissingDecimal(side, address, decimals+decimalIntDigits, afterID, backfillBatchSize)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return
+			}
+			if len(amounts) == 0 {
+				break
+			}
+			values := make(map[int64]string, len(amounts))
+			for _, amount := range amounts {
+				if value, ok := formatUnits(amount.Amount, decimals); ok {
+					values[amount.ID] = value
+					pools[amount.PoolAddress] = true
+					if fromTimestamp == 0 || amount.BlockTimeStamp < fromTimestamp {
+						fromTimestamp = amount.BlockTimeStamp
+					}
+					if fromBlock == 0 || amount.BlockNumber < fromBlock {
+						fromBlock = amount.BlockNumber
+					}
+				}
+			}
+			if err := r.repo.UpdateSwapAmountDecimals(side, values); err != nil {
+				fmt.Printf("%v\n", err)
+				return
+			}
+			total += len(values)
+			afterID = amounts[len(amounts)-1].ID
+		}
+	}
+	if total > 0 {
+		fmt.Printf("回填代币 %s 的swap换算数量: %d 条\n", address, total)
+		if r.onBackfill != nil {
+			affected := make([]string, 0, len(pools))
+			for pool := range pools {
+				affected = append(affected, pool)
+			}
+			sort.Strings(affected)
+			r.onBackfill(address, affected, fromBlock, fromTimestamp)
+		}
+	}
+}
+
+/*
+链上读取代币元数据
+节点/网络错误返回error稍后重试；合约revert或返回值无法解析视为非标准代币，对应字段留空
+*/
+func fetchTokenMetadata(address string) (*models.Token, error) {
+	token := &models.Token{Address: address, Status: true}
+
+	symbol, err := callTokenString(address, "symbol")
+	if err != nil && !blockchain.IsDeterministicError(err) {
+		return nil, err
+	}
+	name, err := callTokenString(address, "name")
+	if err != nil && !blockchain.IsDeterministicError(err) {
+		return nil, err
+	}
+	decimals, ok, err := callTokenDecimals(address)
+	if err != nil && !blockchain.IsDeterministicError(err) {
+		return nil, err
+	}
+	if !ok {
+		token.Status = false // 连decimals都拿不到，不是标准ERC20
+	}
+
+	token.Symbol = truncate(symbol, tokenSymbolMaxLen)
+	token.Name = truncate(name, tokenNameMaxLen)
+	token.Decimals = decimals
+	return token, nil
+}
+
+// 调用symbol()/name()，兼容返回string和bytes32两种实现，解析不了返回空字符串
+func callTokenString(address, method string) (string, error) {
+	data, _ := erc20ABI.Pack(method)
+	result, err := blockchain.CallContract(common.HexToAddress(address), data)
+	if err != nil {
+		return "", err
+	}
+	if len(result) == 32 {
+		return cleanTokenString(string(bytes.TrimRight(result, "\x00"))), nil
+	}
+	values, err := erc20ABI.Unpack(method, result)
+	if err != nil || len(values) == 0 {
+		return "", nil
+	}
+	str, _ := values[0].(string)
+	return cleanTokenString(str), nil
+}
+
+// 调用decimals()，返回值解析不了(包括非合约地址返回空)时ok为false
+func callTokenDecimals(address string) (decimals int, ok bool, err error) {
+	data, _ := erc20ABI.Pack("decimals")
+	result, err := blockchain.CallContract(common.HexToAddress(address), data)
+	if err != nil {
+		return 0, false, err
+	}
+	values, err := erc20ABI.Unpack("decimals", result)
+	if err != nil || len(values) == 0 {
+		return 0, false, nil
+	}
+	v, ok := values[0].(uint8)
+	return int(v), ok, nil
+}
+
+// 非法UTF-8和控制字符去掉，避免写库失败
+func cleanTokenString(s string) string {
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s))
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) > max {
+		return string(runes[:max])
+	}
+	return s
+}
@@ -0,0 +1,32 @@
+package testsupport
+
+import (
+	"testing"
+	"zk-sync-go-pool/internal/database"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+/*
+repository 和 scanner 的测试共用的库：内存SQLite + 迁移脚本建表(种子数据里有WETH/USDC的精度)，每个测试一个独立的库
+只在测试里引用，不会编进程序
+*/
+func NewDB(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1) // :memory: 每个连接是一个新库
+	t.Cleanup(func() { sqlDB.Close() })
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -14,6 +15,8 @@ import (
 	"zk-sync-go-pool/internal/database"
 	"zk-sync-go-pool/internal/repository"
 	"zk-sync-go-pool/internal/scanner"
+
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -27,8 +30,14 @@ func main() {
 		log.Fatalf("加载配置文件失败: %v", err)
 	}
 
-	// 初始化数据库
-	err = database.InitMySQL(&cfg.Database)
+	// migrate 子命令只需要数据库，在检查表结构版本、连接Redis和节点之前处理
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(&cfg.Database, os.Args[2:])
+		return
+	}
+
+	// 初始化数据库(database.driver: mysql / postgres / sqlite)
+	db, err := database.Open(&cfg.Database)
 	if err != nil {
 		log.Fatalf("初始化数据库失败: %v", err)
 	}
@@ -53,16 +62,146 @@ func main() {
 
 	// 创建Repository 业务拆离，Repository层负责与数据库交互
 	// 就是写各种方法和调用各种方法，跟业务抽离出来。类似controller和service的关系。
-	repo := repository.NewRepository()
+	repo := repository.NewRepository(db)
 
 	// 创建Scanner 扫描器 专注于扫描事件和索引事件
-	scanner := scanner.NewABIScanner(cfg, repo)
+	abiScanner := scanner.NewABIScanner(cfg, repo)
+
+	// 子命令：不带参数默认启动扫描
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "audit":
+			runAudit(abiScanner, os.Args[2:])
+			return
+		case "rebuild-candles":
+			runRebuildCandles(db, abiScanner, os.Args[2:])
+			return
+		case "sync-clickhouse":
+			runSyncClickhouse(abiScanner, os.Args[2:])
+			return
+		default:
+			log.Fatalf("未知命令: %s", os.Args[1])
+		}
+	}
 
-	// 启动扫描器
-	if err := scanner.Start(ctx); err != nil {
+	// 启动扫描器，运行期间拿着扫描器锁，别的进程里的 rebuild-candles 不能同时执行
+	err = database.WithScannerLock(db, func() error { return abiScanner.Start(ctx) })
+	if err != nil {
 		log.Fatal("扫描失败:", err)
 	}
 
 	fmt.Println("🎉 所有模块初始化成功！")
 
 }
+
+/*
+audit 子命令：检查已索引数据是否完整
+go run main.go audit [-from N] [-to N] [-verify] [-reindex]
+*/
+func runAudit(s *scanner.ABIScanner, args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	from := fs.Uint64("from", 0, "起始区块，默认 scanner.start_block 的下一个区块")
+	to := fs.Uint64("to", 0, "结束区块，默认 stable_scan 进度")
+	verify := fs.Bool("verify", false, "重新拉取日志解码，和库里的swap数对比")
+	reindex := fs.Bool("reindex", false, "对缺失和不一致的区块重新索引")
+	fs.Parse(args)
+
+	report, err := s.Audit(scanner.AuditOptions{From: *from, To: *to, Verify: *verify, Reindex: *reindex})
+	if err != nil {
+		log.Fatalf("审计失败: %v", err)
+	}
+	if len(report.Missing) > 0 || len(report.Mismatched) > 0 {
+		if !*reindex {
+			os.Exit(1) // 有问题返回非0，方便定时任务告警
+		}
+	}
+}
+
+/*
+rebuild-candles 子命令：从swap_events全量重建K线
+go run main.go rebuild-candles [-pool 0x...]
+扫描器在另一个进程里，K线的锁管不到它，要先停掉扫描器；MySQL/PostgreSQL 上扫描器在跑时拿不到扫描器锁，直接报错
+*/
+func runRebuildCandles(db *gorm.DB, s *scanner.ABIScanner, args []string) {
+	fs := flag.NewFlagSet("rebuild-candles", flag.ExitOnError)
+	pool := fs.String("pool", "", "只重建这个池子(及其交易对)的K线，默认全部")
+	fs.Parse(args)
+
+	err := database.WithScannerLock(db, func() error { return s.RebuildCandles(*pool) })
+	if err != nil {
+		log.Fatalf("重建K线失败: %v", err)
+	}
+	fmt.Println("✅ K线重建完成")
+}
+
+/*
+sync-clickhouse 子命令：把一段区块的事件重新同步到ClickHouse
+go run main.go sync-clickhouse [-from N] [-to N]
+*/
+func runSyncClickhouse(s *scanner.ABIScanner, args []string) {
+	fs := flag.NewFlagSet("sync-clickhouse", flag.ExitOnError)
+	from := fs.Uint64("from", 0, "起始区块，默认 scanner.start_block 的下一个区块")
+	to := fs.Uint64("to", 0, "结束区块，默认 clickhouse 同步进度")
+	fs.Parse(args)
+
+	if err := s.SyncClickhouse(*from, *to); err != nil {
+		log.Fatalf("同步ClickHouse失败: %v", err)
+	}
+	fmt.Println("✅ ClickHouse同步完成")
+}
+
+/*
+migrate 子命令：表结构迁移
+go run main.go migrate up | down [-steps N] | status | baseline [-version N]
+*/
+func runMigrate(cfg *config.DatabaseConfig, args []string) {
+	if len(args) == 0 {
+		log.Fatalf("用法: migrate up | down [-steps N] | status | baseline [-version N]")
+	}
+	db, err := database.Connect(cfg)
+	if err != nil {
+		log.Fatalf("初始化数据库失败: %v", err)
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(db)
+		if err != nil {
+			log.Fatalf("迁移失败: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("表结构已经是最新版本")
+		}
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := fs.Int("steps", 1, "回退的版本数")
+		fs.Parse(args[1:])
+		if _, err := database.MigrateDown(db, *steps); err != nil {
+			log.Fatalf("回退失败: %v", err)
+		}
+	case "baseline":
+		fs := flag.NewFlagSet("migrate baseline", flag.ExitOnError)
+		version := fs.Int64("version", 1, "已有表结构对应的迁移版本，不超过这个版本的迁移记为已执行")
+		fs.Parse(args[1:])
+		if _, err := database.MigrateBaseline(db, *version); err != nil {
+			log.Fatalf("baseline失败: %v", err)
+		}
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			log.Fatalf("读取迁移状态失败: %v", err)
+		}
+		for _, state := range states {
+			status := "未执行"
+			if state.AppliedAt != nil {
+				status = "已执行 " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if state.Unknown {
+				status += "(程序里没有这个版本)"
+			}
+			fmt.Printf("%04d_%-30s %s\n", state.Version, state.Name, status)
+		}
+	default:
+		log.Fatalf("未知的migrate命令: %s", args[0])
+	}
+}